@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// runBatch sends a sweep over rules, seeds and densities to the broker as one batch and prints the results table
+func runBatch(args []string) {
+	var cfg config.Config
+	var game stubs.BatchGame
+	flags := cfg.NewFlagSet("batch", "")
+	flags.IntVar(&game.Width, "w", 512, "Width of each board.")
+	flags.IntVar(&game.Height, "h", 512, "Height of each board.")
+	flags.IntVar(&game.Turns, "turns", 1000, "Number of turns to run each game for.")
+	flags.StringVar(&game.Edge, "edge", "toroidal", "What lies beyond the edge of each board: toroidal, dead or mirrored.")
+	flags.Float64Var(&game.BirthProbability, "pbirth", 0, "Probability of a dead cell being born spontaneously each turn.")
+	flags.Float64Var(&game.DeathProbability, "pdeath", 0, "Probability of an alive cell dying spontaneously each turn.")
+	flags.BoolVar(&game.StopEarly, "stopEarly", false, "Stop each game once the board is empty, stops changing or starts cycling.")
+	flags.IntVar(&game.CycleWindow, "cycleWindow", 0, "How many previous turns to check for a repeating cycle.")
+	ruleList := flags.String("rules", rules.Default, "Semicolon-separated list of rules to try, e.g. B3/S23;highlife.")
+	seedList := flags.String("seeds", "1", "Comma-separated list of seeds to try, or a range such as 1..10.")
+	densityList := flags.String("densities", "0.5", "Comma-separated list of starting densities to try, between 0 and 1.")
+	interleave := flags.Bool("interleave", false, "Run the games at the same time, sharing the workers, rather than one after another.")
+	priority := flags.Int("priority", 0, "Share of the broker's workers the batch gets while other games want them too, each level up doubling it, from -10 to 10. Use a negative priority for long sweeps that shouldn't slow down interactive games.")
+	output := flags.String("out", "", "Also write the results table to this CSV file.")
+	cfg.Parse(flags, args)
+
+	seeds, err := parseSeeds(*seedList)
+	handleError("Invalid seeds", err)
+	var densities []float64
+	for _, field := range strings.Split(*densityList, ",") {
+		density, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		handleError("Invalid densities", err)
+		densities = append(densities, density)
+	}
+	request := stubs.BatchRequest{Header: stubs.NewHeader(stubs.NewID()), Interleave: *interleave, Priority: *priority}
+	for _, rule := range strings.Split(*ruleList, ";") {
+		for _, seed := range seeds {
+			for _, density := range densities {
+				game.Rule, game.Seed, game.Density = strings.TrimSpace(rule), seed, density
+				request.Games = append(request.Games, game)
+			}
+		}
+	}
+	fmt.Println("Running", len(request.Games), "games")
+
+	broker, err := stubs.DialBroker(cfg.BrokerAddress)
+	handleError("Dial broker error", err)
+	response := new(stubs.BatchResponse)
+	err = broker.RunBatch(request, response)
+	handleError("Call broker error", err)
+	_ = broker.Close()
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	rows := batchRows(response.Results)
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	_ = writer.Flush()
+	if *output != "" {
+		file, err := os.Create(*output)
+		handleError("Create results file error", err)
+		err = csv.NewWriter(file).WriteAll(rows)
+		handleError("Write results file error", err)
+		handleError("Close results file error", file.Close())
+	}
+}
+
+// batchRows lays out the results as a table, with a header row first
+func batchRows(results []stubs.BatchResult) [][]string {
+	rows := [][]string{{"rule", "seed", "density", "turns", "alive", "stopped", "cycle start", "cycle period", "seconds"}}
+	for _, result := range results {
+		rows = append(rows, []string{
+			result.Game.Rule,
+			strconv.FormatInt(result.Game.Seed, 10),
+			strconv.FormatFloat(result.Game.Density, 'g', -1, 64),
+			strconv.Itoa(result.CompletedTurns),
+			strconv.Itoa(result.AliveCount),
+			result.StopReason,
+			strconv.Itoa(result.CycleStart),
+			strconv.Itoa(result.CyclePeriod),
+			strconv.FormatFloat(result.Duration.Seconds(), 'f', 3, 64),
+		})
+	}
+	return rows
+}
+
+// parseSeeds reads a comma-separated list of seeds, where each can also be a range such as 1..10
+func parseSeeds(text string) ([]int64, error) {
+	var seeds []int64
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		bounds := strings.SplitN(field, "..", 2)
+		first, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("seed range %q goes backwards", field)
+		}
+		for seed := first; seed <= last; seed++ {
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds, nil
+}
@@ -0,0 +1,57 @@
+package broker
+
+// createAges creates the age of every cell on the starting board, with every alive cell starting at 0
+func createAges(width int, height int) [][]uint32 {
+	ages := make([][]uint32, height)
+	for y := range ages {
+		ages[y] = make([]uint32, width)
+	}
+	return ages
+}
+
+// updateAges counts another turn for every cell that is still alive, and resets the age of every cell that isn't
+// Must be called with the game locked, after the boards have been swapped.
+func (game *Game) updateAges() {
+	for y, row := range game.current.cells {
+		for x, value := range row {
+			if game.aliveValues[value] && game.previouslyAlive(x, y) {
+				game.ages[y][x]++
+			} else {
+				game.ages[y][x] = 0
+			}
+		}
+	}
+}
+
+// previouslyAlive checks whether a cell was alive on the turn before the current one
+func (game *Game) previouslyAlive(x int, y int) bool {
+	return game.aliveValues[game.advanced.cells[y][x]]
+}
+
+// copyAges copies the ages so they can be sent whilst turns carry on updating them
+func (game *Game) copyAges() [][]uint32 {
+	return copyCounts(game.ages)
+}
+
+// AgeStatistics gives the mean and maximum age of the alive cells
+func (game *Game) AgeStatistics() (mean float64, max uint32) {
+	var total uint64
+	var alive int
+	for y, row := range game.current.cells {
+		for x, value := range row {
+			if !game.aliveValues[value] {
+				continue
+			}
+			age := game.ages[y][x]
+			total += uint64(age)
+			alive++
+			if age > max {
+				max = age
+			}
+		}
+	}
+	if alive > 0 {
+		mean = float64(total) / float64(alive)
+	}
+	return mean, max
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// keptFinishedBoards is how many finished boards are kept for their alive cells to be paged through
+const keptFinishedBoards = 4
+
+// finishedBoards holds the final boards of the games whose alive cells weren't sent with StartGame's response,
+// oldest first
+var finishedBoards struct {
+	sync.Mutex
+	ids    []string
+	boards map[string]*Board
+}
+
+// keepFinishedBoard remembers a game's final board so its alive cells can be paged through, forgetting the oldest
+func keepFinishedBoard(id string, board *Board) {
+	finishedBoards.Lock()
+	defer finishedBoards.Unlock()
+	if finishedBoards.boards == nil {
+		finishedBoards.boards = make(map[string]*Board)
+	}
+	finishedBoards.ids = append(finishedBoards.ids, id)
+	finishedBoards.boards[id] = board
+	if len(finishedBoards.ids) > keptFinishedBoards {
+		delete(finishedBoards.boards, finishedBoards.ids[0])
+		finishedBoards.ids = finishedBoards.ids[1:]
+	}
+}
+
+// AliveCells sends a page of a finished game's alive cells
+// After and Next count cells in row order from the top left, so a page is found by scanning from where the last
+// one ended rather than by listing every alive cell first.
+func (s *SecretBrokerOperation) AliveCells(req stubs.AliveCellsRequest, response *stubs.AliveCellsResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	finishedBoards.Lock()
+	board := finishedBoards.boards[req.GameID]
+	finishedBoards.Unlock()
+	if board == nil {
+		return stubs.Errorf(stubs.NoGame, "no finished board for game %q, only the last %d are kept", req.GameID, keptFinishedBoards)
+	}
+	if req.Limit <= 0 {
+		return stubs.Errorf(stubs.InvalidParams, "page limit %d must be positive", req.Limit)
+	}
+	cells := board.width * board.height
+	next := req.After
+	for ; next < cells && len(response.Cells) < req.Limit; next++ {
+		x, y := next%board.width, next/board.width
+		if board.Alive(x, y, false) {
+			response.Cells = append(response.Cells, util.Cell{X: x, Y: y})
+		}
+	}
+	response.Next = next
+	response.Done = next >= cells
+	return
+}
@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxAPIRequest is the most bytes of JSON an API call can send, enough for a 4096x4096 starting board
+const maxAPIRequest = 64 << 20
+
+// errorType is the type of the error every RPC returns
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// API serves the broker's RPCs as JSON over HTTP, for clients in other languages, such as clients/python
+// POST /api/<Method> with the JSON of the method's request calls it, answering with the JSON of its response, whose
+// Header.Error is set if it failed. GET /api/ lists the methods, each with a request and response of zero values.
+// Fields have the names of the stubs types' fields, and boards are arrays of rows, each in base64.
+func API(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/")
+	if name == "" && r.Method == http.MethodGet {
+		writeJSON(w, apiMethods())
+		return
+	}
+	method := reflect.ValueOf(new(SecretBrokerOperation)).MethodByName(name)
+	if !method.IsValid() || !isRPC(method.Type()) {
+		http.Error(w, "the broker has no method "+name+", see GET /api/", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "methods are called with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	request := reflect.New(method.Type().In(0))
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequest))
+	decoder.DisallowUnknownFields() // so a misspelt field isn't silently left at zero
+	if err := decoder.Decode(request.Interface()); err != nil {
+		http.Error(w, "the request isn't a "+method.Type().In(0).Name()+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := reflect.New(method.Type().In(1).Elem())
+	method.Call([]reflect.Value{request.Elem(), response}) // which records any error in the response's Header
+	writeJSON(w, response.Interface())
+}
+
+// apiMethod describes a method API serves
+type apiMethod struct {
+	Method   string
+	Request  interface{}
+	Response interface{}
+}
+
+// apiMethods lists every method API serves, in order of name
+func apiMethods() []apiMethod {
+	receiver := reflect.ValueOf(new(SecretBrokerOperation))
+	var methods []apiMethod
+	for i := 0; i < receiver.NumMethod(); i++ {
+		if method := receiver.Type().Method(i); isRPC(receiver.Method(i).Type()) {
+			methods = append(methods, apiMethod{method.Name, reflect.New(method.Type.In(1)).Interface(),
+				reflect.New(method.Type.In(2).Elem()).Interface()})
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return methods
+}
+
+// isRPC checks a method has the shape net/rpc serves, taking a request and a pointer to a response and giving an error
+func isRPC(method reflect.Type) bool {
+	return method.NumIn() == 2 && method.In(1).Kind() == reflect.Ptr && method.NumOut() == 1 && method.Out(0) == errorType
+}
+
+// writeJSON answers with a value as JSON
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
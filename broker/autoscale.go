@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Scaler changes how many workers exist, for example by starting or stopping cloud instances
+// It gives back the addresses of every worker that should now be used.
+type Scaler interface {
+	Scale(workers int) ([]string, error)
+}
+
+// scalingWindow is how long throughput is measured for before the recommendation is checked
+const scalingWindow = 2 * time.Second
+
+// scalingTolerance is how far the measured throughput can drift from the target before workers are added or removed
+const scalingTolerance = 0.2
+
+// autoscaler measures how many turns per second the workers manage, and works out how many are needed
+// to reach the target. If enact is set it also changes the number of workers used to match.
+type autoscaler struct {
+	target      float64 // turns per second wanted
+	enact       bool
+	cells       int // cells on the board, so the measured rate can be turned into work per worker
+	windowStart time.Time
+	windowTurns int
+	rate        float64 // turns per second over the last window
+	recommended int     // workers needed to reach the target, 0 until the first window is measured
+}
+
+func newAutoscaler(target float64, enact bool, cells int, completedTurns int) *autoscaler {
+	return &autoscaler{target: target, enact: enact, cells: cells, windowStart: time.Now(), windowTurns: completedTurns}
+}
+
+// measure records the turns completed so far, returning true when a window has finished and the rate is updated
+func (scaling *autoscaler) measure(completedTurns int) bool {
+	elapsed := time.Since(scaling.windowStart)
+	if elapsed < scalingWindow {
+		return false
+	}
+	scaling.rate = float64(completedTurns-scaling.windowTurns) / elapsed.Seconds()
+	scaling.windowStart, scaling.windowTurns = time.Now(), completedTurns
+	return true
+}
+
+// recommend works out how many workers would reach the target, assuming each worker advances cells at the rate
+// the current workers managed over the last window. It only changes the recommendation when the throughput
+// has drifted far enough from the target, so the workers used don't change every window.
+func (scaling *autoscaler) recommend(workers int) int {
+	drift := math.Abs(scaling.rate-scaling.target) / scaling.target
+	if scaling.recommended > 0 && drift <= scalingTolerance || scaling.rate == 0 {
+		return scaling.recommended
+	}
+	cellsPerWorker := scaling.rate * float64(scaling.cells) / float64(workers) // cells each worker advances per second
+	scaling.recommended = int(math.Ceil(scaling.target * float64(scaling.cells) / cellsPerWorker))
+	if scaling.recommended < 1 {
+		scaling.recommended = 1
+	}
+	return scaling.recommended
+}
+
+// adjustWorkers checks the throughput once a window has passed and, if enacting, gives back the workers to use next
+// Without a Scaler the broker can only choose how many of its known workers to use; with one, new workers are
+// asked for and dialled, and every worker client is replaced. Must be called with the game locked.
+func (game *Game) adjustWorkers(allClients []*stubs.Worker, workerClients []*stubs.Worker) ([]*stubs.Worker, []*stubs.Worker) {
+	scaling := game.autoscale
+	if !scaling.measure(game.completedTurns) {
+		return allClients, workerClients
+	}
+	recommended := scaling.recommend(len(workerClients))
+	if !scaling.enact || recommended == len(workerClients) {
+		return allClients, workerClients
+	}
+	if options.Scaler != nil {
+		addresses, err := options.Scaler.Scale(recommended)
+		if err != nil {
+			log.Println("Scale workers error:", err)
+			return allClients, workerClients
+		}
+		setWorkers(addresses)
+		if options.OrderByLatency {
+			orderWorkersByLatency()
+		}
+		scaledClients, err := dialWorkers()
+		if err == nil {
+			err = game.checkCapabilities(scaledClients)
+		}
+		if err != nil {
+			log.Println("Dial scaled workers error:", err)
+			return allClients, workerClients
+		}
+		allClients = scaledClients // workers no longer used are dropped from the pool when it is next used
+		log.Println("Scaled to", len(allClients), "workers for", scaling.target, "turns per second")
+		return allClients, allClients
+	}
+	if recommended > len(allClients) {
+		recommended = len(allClients)
+	}
+	if recommended != len(workerClients) {
+		log.Println("Using", recommended, "of", len(allClients), "workers for", scaling.target, "turns per second")
+	}
+	return allClients, allClients[:recommended]
+}
+
+// provisionWorkers asks the Scaler for the workers each game starts with, if the broker is set up to do so
+func provisionWorkers() error {
+	if options.Scaler == nil || options.ScaleWorkers <= 0 {
+		return nil
+	}
+	addresses, err := options.Scaler.Scale(options.ScaleWorkers)
+	if err != nil {
+		return err
+	}
+	setWorkers(addresses)
+	log.Println("Started", len(addresses), "workers:", addresses)
+	return nil
+}
+
+// releaseWorkers gives back every worker the Scaler started, once the game has ended
+func releaseWorkers() {
+	if options.Scaler == nil || options.ScaleWorkers <= 0 {
+		return
+	}
+	if _, err := options.Scaler.Scale(0); err != nil {
+		log.Println("Release workers error:", err)
+		return
+	}
+	setWorkers(nil)
+	log.Println("Released workers")
+}
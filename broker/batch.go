@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// createBatchGame creates a game from a random starting board, checking the game's settings first
+func createBatchGame(batchGame stubs.BatchGame) (*Game, error) {
+	rule, err := rules.Parse(batchGame.Rule)
+	if err != nil {
+		return nil, err
+	}
+	edge, err := rules.ParseEdge(batchGame.Edge)
+	if err != nil {
+		return nil, err
+	}
+	noise := rules.Noise{Seed: batchGame.Seed, Birth: batchGame.BirthProbability, Death: batchGame.DeathProbability}
+	if err = noise.Validate(); err != nil {
+		return nil, err
+	}
+	if batchGame.Width <= 0 || batchGame.Height <= 0 {
+		return nil, fmt.Errorf("board size %dx%d must be positive", batchGame.Width, batchGame.Height)
+	}
+	if batchGame.Sections < 0 {
+		return nil, fmt.Errorf("%d sections can't be worked out, 0 is one per worker", batchGame.Sections)
+	}
+	if batchGame.Density < 0 || batchGame.Density > 1 {
+		return nil, fmt.Errorf("density %v must be between 0 and 1", batchGame.Density)
+	}
+	random := rand.New(rand.NewSource(batchGame.Seed))
+	cells := createBoard(batchGame.Width, batchGame.Height).cells
+	for _, row := range cells {
+		for x := range row {
+			if random.Float64() < batchGame.Density {
+				row[x] = 255
+			}
+		}
+	}
+	game := createGame(batchGame.Width, batchGame.Height, cells, rule, edge.String(), noise)
+	game.stopEarly = batchGame.StopEarly
+	game.cycles = newCycleDetector(batchGame.CycleWindow)
+	game.checkCycle()
+	return game, nil
+}
+
+// runBatchGame plays a game of a batch to the end, returning its row of the results table
+// Batch games can't be paused or watched, so they don't listen for the controller.
+func runBatchGame(game *Game, batchGame stubs.BatchGame, workerClients []*stubs.Worker) (stubs.BatchResult, error) {
+	defer dumpOnPanic(game)
+	if batchGame.Sections > 0 {
+		workerClients = spreadSections(workerClients, batchGame.Sections)
+	}
+	start := time.Now()
+	for game.completedTurns < batchGame.Turns && game.stopReason == "" {
+		finished := game.waitForTurn()
+		if finished == nil {
+			return stubs.BatchResult{}, stubs.Errorf(stubs.Draining, "the broker is closing down")
+		}
+		err := game.executeTurn(batchGame.Turns, workerClients)
+		finished()
+		if err != nil {
+			return stubs.BatchResult{}, err
+		}
+	}
+	return stubs.BatchResult{
+		Game:           batchGame,
+		CompletedTurns: game.completedTurns,
+		AliveCount:     len(game.current.AliveCells()),
+		StopReason:     game.stopReason,
+		CycleStart:     game.cycles.start,
+		CyclePeriod:    game.cycles.period,
+		Checksum:       stubs.Sum(game.current.cells),
+		Duration:       time.Since(start),
+	}, nil
+}
+
+// spreadSections gives the worker to send each of the given number of sections to, going round the workers in turn
+// so a worker can be sent several sections of the same turn
+func spreadSections(workerClients []*stubs.Worker, sections int) []*stubs.Worker {
+	spread := make([]*stubs.Worker, sections)
+	for i := range spread {
+		spread[i] = workerClients[i%len(workerClients)]
+	}
+	return spread
+}
+
+// RunBatch runs every game of a batch, returning a row of results for each
+// Every game is checked before any are run, so a mistake in one doesn't waste the others.
+func (s *SecretBrokerOperation) RunBatch(req stubs.BatchRequest, res *stubs.BatchResponse) (err error) {
+	if req.GameID == "" {
+		req.GameID = stubs.NewID()
+	}
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	games := make([]*Game, len(req.Games))
+	memory := 0 // every game of a batch is held at once
+	for i, batchGame := range req.Games {
+		memory += boardMemory(batchGame.Width, batchGame.Height, 0)
+		if err = checkLimits(batchGame.Width, batchGame.Height, batchGame.Turns, memory); err != nil {
+			return stubs.Errorf(stubs.InvalidParams, "game %d: %v", i+1, err.(*stubs.Error).Message)
+		}
+		if games[i], err = createBatchGame(batchGame); err != nil {
+			return stubs.Errorf(stubs.InvalidParams, "game %d: %v", i+1, err)
+		}
+		games[i].id = fmt.Sprintf("%s/%d", req.GameID, i+1)
+		games[i].deadline = req.Deadline
+		games[i].job, games[i].priority = req.GameID, req.Priority
+	}
+	if err = startRunning(); err != nil {
+		return err
+	}
+	defer stopRunning()
+	workerClients, err := dialWorkers()
+	if err != nil {
+		return err
+	}
+	for _, game := range games {
+		if err = game.checkCapabilities(workerClients); err != nil {
+			return err
+		}
+	}
+	res.Results = make([]stubs.BatchResult, len(games))
+	if !req.Interleave {
+		for i, game := range games {
+			if res.Results[i], err = runBatchGame(game, req.Games[i], workerClients); err != nil {
+				return err
+			}
+		}
+		return
+	}
+	var wg sync.WaitGroup // every game sends its turns to the workers at the same time
+	errs := make([]error, len(games))
+	for i, game := range games {
+		wg.Add(1)
+		go func(i int, game *Game) {
+			defer wg.Done()
+			res.Results[i], errs[i] = runBatchGame(game, req.Games[i], workerClients)
+		}(i, game)
+	}
+	wg.Wait()
+	for _, err = range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return
+}
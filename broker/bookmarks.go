@@ -0,0 +1,172 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// maxBookmarks is how many bookmarks a game can keep, as each holds a copy of the board
+const maxBookmarks = 16
+
+// bookmark is everything needed to take a game back to a turn: its board, with the counts and statistics kept
+// alongside it
+type bookmark struct {
+	name               string
+	turn               int
+	cells              [][]uint8
+	ages, flips        [][]uint32
+	stats              stubs.TurnStats
+	originX, originY   int
+	expandLimitReached bool
+}
+
+// copyCounts copies a count for each cell, such as their ages, leaving nil as nil
+func copyCounts(counts [][]uint32) [][]uint32 {
+	if counts == nil {
+		return nil
+	}
+	copied := make([][]uint32, len(counts))
+	for y, row := range counts {
+		copied[y] = append([]uint32(nil), row...)
+	}
+	return copied
+}
+
+// Bookmark keeps the running game as it is now, once its current turn has finished, replacing any bookmark of the
+// same name
+func (s *SecretBrokerOperation) Bookmark(req stubs.BookmarkRequest, res *stubs.BookmarkResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := bookmarkableGame(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("turn-%d", game.completedTurns)
+	}
+	kept := game.bookmarks[:0]
+	for _, mark := range game.bookmarks {
+		if mark.name != name {
+			kept = append(kept, mark)
+		}
+	}
+	if len(kept) >= maxBookmarks {
+		return stubs.Errorf(stubs.InvalidParams, "game %s already has %d bookmarks", game.id, maxBookmarks)
+	}
+	game.fetchStrips()
+	game.bookmarks = append(kept, &bookmark{
+		name:               name,
+		turn:               game.completedTurns,
+		cells:              copyCells(game.current.cells),
+		ages:               copyCounts(game.ages),
+		flips:              copyCounts(game.flips),
+		stats:              game.turnStats(),
+		originX:            game.originX,
+		originY:            game.originY,
+		expandLimitReached: game.expandLimitReached,
+	})
+	log.Printf("Game %s: bookmarked turn %d as %s", game.id, game.completedTurns, name)
+	game.listBookmarks(res)
+	return nil
+}
+
+// JumpToBookmark takes the paused game back, or forward, to one of its bookmarks, leaving it paused there
+func (s *SecretBrokerOperation) JumpToBookmark(req stubs.BookmarkRequest, res *stubs.BookmarkResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := bookmarkableGame(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	if !game.paused {
+		return stubs.Errorf(stubs.InvalidParams, "game %s must be paused to jump to a bookmark", game.id)
+	}
+	var found *bookmark
+	for _, mark := range game.bookmarks {
+		if mark.name == req.Name || req.Name == "" {
+			found = mark
+		}
+	}
+	if found == nil {
+		return stubs.Errorf(stubs.InvalidParams, "game %s has no bookmark %q", game.id, req.Name)
+	}
+	game.jumpTo(found)
+	log.Printf("Game %s: jumped to bookmark %s at turn %d", game.id, found.name, found.turn)
+	game.listBookmarks(res)
+	return nil
+}
+
+// Bookmarks lists the running game's bookmarks
+func (s *SecretBrokerOperation) Bookmarks(req stubs.BookmarkRequest, res *stubs.BookmarkResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := bookmarkableGame(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	game.listBookmarks(res)
+	return nil
+}
+
+// bookmarkableGame gets the running game, as long as its whole board is kept in memory to be copied
+func bookmarkableGame(header stubs.Header) (*Game, error) {
+	game, err := gameFor(header)
+	if err != nil {
+		return nil, err
+	}
+	if game.tiled != nil || game.hashlife != nil {
+		return nil, stubs.Errorf(stubs.InvalidParams, "tiled boards and the hashlife engine can't be bookmarked")
+	}
+	return game, nil
+}
+
+// listBookmarks fills in the game's turn and bookmarks, which must be locked
+func (game *Game) listBookmarks(res *stubs.BookmarkResponse) {
+	res.CompletedTurns = game.completedTurns
+	for _, mark := range game.bookmarks {
+		res.Bookmarks = append(res.Bookmarks, stubs.Bookmark{Name: mark.name, Turn: mark.turn})
+	}
+}
+
+// jumpTo puts the game back as it was when it was bookmarked, so the turns from there are played again
+// The bookmark is copied rather than used, so the game can be taken back to it more than once.
+// Must be called with the game locked.
+func (game *Game) jumpTo(mark *bookmark) {
+	height, width := len(mark.cells), len(mark.cells[0])
+	game.current = &Board{cells: copyCells(mark.cells), width: width, height: height, rule: game.rule}
+	game.advanced = createBoard(width, height)
+	game.advanced.rule = game.rule
+	game.completedTurns = mark.turn
+	game.ages, game.flips = copyCounts(mark.ages), copyCounts(mark.flips)
+	game.alive, game.births, game.deaths = mark.stats.Population, mark.stats.Births, mark.stats.Deaths
+	game.originX, game.originY = mark.originX, mark.originY
+	game.expandLimitReached = mark.expandLimitReached
+	game.stopReason = ""
+	game.cycles = newCycleDetector(game.cycles.window)
+	game.checkCycle()
+	game.history.rewind(mark.stats)
+	game.boardReplaced()
+	game.streamTurn()
+	game.boardChanged()
+}
@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// callBookmarks calls one of the bookmark methods, giving back its response and the error in it
+func callBookmarks(method func(stubs.BookmarkRequest, *stubs.BookmarkResponse) error, req stubs.BookmarkRequest) (stubs.BookmarkResponse, error) {
+	var res stubs.BookmarkResponse
+	_ = method(req, &res)
+	return res, res.Err()
+}
+
+// currentBoard gets the running game's board, failing the test if it can't
+func currentBoard(t *testing.T, gameID string) stubs.CurrentBoardResponse {
+	t.Helper()
+	var res stubs.CurrentBoardResponse
+	_ = new(SecretBrokerOperation).CurrentBoard(stubs.CurrentBoardRequest{Header: stubs.Header{GameID: gameID}}, &res)
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// TestJumpToBookmark checks a paused game can be taken back and forward to its bookmarks, more than once, and that
+// the turns played again from a bookmark give the board they did the first time.
+func TestJumpToBookmark(t *testing.T) {
+	useWorkers(t, 1)
+	const turns = 20000
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3, 21, 20, 22, 21, 20, 22, 21, 22, 22, 22) // a blinker and a glider
+	id := gameID(t)
+	finished := startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: turns})
+	operation, header := new(SecretBrokerOperation), stubs.Header{GameID: id}
+	early := pauseAfter(t, id, 3)
+	marked, err := callBookmarks(operation.Bookmark, stubs.BookmarkRequest{Header: header, Name: "early"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []stubs.Bookmark{{Name: "early", Turn: early}}; !reflect.DeepEqual(marked.Bookmarks, want) {
+		t.Fatalf("got bookmarks %v, want %v", marked.Bookmarks, want)
+	}
+	resume(t, id)
+	if _, err = callBookmarks(operation.JumpToBookmark, stubs.BookmarkRequest{Header: header, Name: "early"}); stubs.Code(err) != stubs.InvalidParams {
+		t.Fatalf("jumping while the game was running gave %v, want %s", err, stubs.InvalidParams)
+	}
+	later := pauseAfter(t, id, early+5)
+	if marked, err = callBookmarks(operation.Bookmark, stubs.BookmarkRequest{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []stubs.Bookmark{{Name: "early", Turn: early}, {Name: fmt.Sprintf("turn-%d", later), Turn: later}}; !reflect.DeepEqual(marked.Bookmarks, want) {
+		t.Fatalf("got bookmarks %v, want %v", marked.Bookmarks, want)
+	}
+	for _, mark := range []stubs.Bookmark{{Name: "early", Turn: early}, marked.Bookmarks[1], {Name: "early", Turn: early}} {
+		jumped, err := callBookmarks(operation.JumpToBookmark, stubs.BookmarkRequest{Header: header, Name: mark.Name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		board := currentBoard(t, id)
+		if jumped.CompletedTurns != mark.Turn || board.CompletedTurns != mark.Turn {
+			t.Fatalf("jumping to %s gave turn %d and a board of turn %d, want turn %d", mark.Name, jumped.CompletedTurns, board.CompletedTurns, mark.Turn)
+		}
+		sameBoard(t, board.Board, step(start, mark.Turn))
+	}
+	if _, err = callBookmarks(operation.JumpToBookmark, stubs.BookmarkRequest{Header: header, Name: "unicorn"}); stubs.Code(err) != stubs.InvalidParams {
+		t.Fatalf("jumping to a bookmark the game doesn't have gave %v, want %s", err, stubs.InvalidParams)
+	}
+	resume(t, id)
+	sameBoard(t, finish(t, finished).FinishedBoard, step(start, turns))
+}
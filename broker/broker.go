@@ -1,12 +1,16 @@
-package main
+package broker
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"net/rpc"
 	"os"
 	"sync"
 	"time"
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/rules"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -15,14 +19,68 @@ type Board struct{
 	cells [][]uint8
 	width int
 	height int
+	rule rules.Rule
 }
 
 type Game struct {
+	lastHeartbeat int64 // when the controller last showed it was still there in Unix nanoseconds, 0 if it doesn't send heartbeats; first so it is aligned for sync/atomic
 	current *Board
 	advanced *Board
 	completedTurns int
 	mutex sync.Mutex
-	paused bool
+	paused bool // whether the game has been paused between turns, changed with setPaused
+	unpaused chan struct{} // closed when a paused game is resumed
+	rule rules.Rule
+	edge string
+	noise rules.Noise
+	ages [][]uint32 // number of turns each cell has been alive for
+	aliveValues [256]bool // which cell values count as alive under the rule
+	includeAges bool // whether the final response should include every cell's age
+	stopEarly bool // whether to stop once the board is empty or stops changing
+	stopReason string // why the game stopped before its turn count, if it did
+	cycles *cycleDetector // spots when the board starts repeating itself
+	census bool // whether to take a census of the final board
+	stopConditions []stubs.StopCondition // user conditions that end the game once any of them hold
+	expand bool // whether the board grows when cells get close to its edge
+	expandLimitReached bool // whether the board has grown as big as it is allowed to
+	originX, originY int // where the top left of the starting board now is, if the board has grown
+	tiled *tiledGame // the board's tiles if it is stored as tiles, in which case current and advanced are nil
+	hashlife *hashlife.Universe // the board if the game uses the hashlife engine, in which case current and advanced are nil
+	width, height int // size of the starting board, for the hashlife engine
+	autoscale *autoscaler // measures throughput against a target, nil if no target was given
+	activeWorkers int // how many workers the game is using
+	id string // identifies the game in requests and the log
+	turns int // turns the game was asked for
+	running bool // whether turns are being executed
+	abandoned chan struct{} // closed once the controller's heartbeats stop
+	quit chan struct{} // closed once the controller has quit, nil for games it can't reach
+	quitOnce sync.Once
+	detach bool // whether to finish the game without its controller once it goes
+	detached int32 // set atomically to 1 once the controller has gone from a game it asked to be finished
+	deadline time.Time // when the request that started the game stops waiting, zero for no deadline
+	degraded bool // whether the game is waiting for enough healthy workers to carry on, see Options.MinWorkers
+	poolChanges int // how many times the broker's pool of workers had changed when the game last split its board between them
+	alive int // cells alive on the current board, kept in step with the births and deaths of each turn
+	births, deaths int // cells that came alive and died during the last turn
+	history *history // the statistics of every turn, nil for games that don't keep them
+	metrics workerMetrics // how each worker has performed over the game
+	timer *turnTimer // where the time of each turn went, nil unless the game was asked to time them
+	flips [][]uint32 // how many times each cell has come alive or died, nil unless the game was asked for a heatmap
+	watches map[string]*regionWatch // regions being watched with WatchRegion, by watch ID
+	stream *turnStream // the changes of the latest turns, nil unless the game was started with StreamTurns
+	changed chan struct{} // closed the next time the board changes, nil while no WatchRegion call is waiting
+	ended bool // whether the game's turns have finished, so there's nothing left to watch
+	bookmarks []*bookmark // turns the game can be taken back to, oldest first
+	turnLog *turnLog // the checksums of every turn's board, nil unless Options.TurnLogDirectory is set
+	writeTurn writeTurn // which of the controllers sharing the game can change its board, see WriteTurn
+	sharedImage bool // whether the workers write the finished board, see Options.SharedImageDirectory
+	lastSections *lastSections // how the last turn was split, kept by the workers for sharedImage games
+	encodings boardEncodings // how the board is packed for each worker, see Options.Encodings
+	shared *sharedBoards // the board shared with workers on this host, nil until one is sent a turn, see Options.SharedMemoryDirectory
+	quiet quietRows // which rows of the board can't change next turn, see Options.Cull
+	priority int // the game's share of the workers while other games want them, see StartGameRequest.Priority
+	job string // the batch the game is part of, which shares of the workers go to, empty for a game on its own
+	strips *haloStrips // the strips the workers keep if it is a halo game, in which case current is only fetched when needed
 }
 
 type SecretBrokerOperation struct {}
@@ -55,15 +113,43 @@ func createBoard(width int, height int) *Board {
 	}
 }
 
+// checkBoardSize makes sure a starting board has height rows of width cells, so the workers aren't sent
+// a board that doesn't match the size they are told
+func checkBoardSize(board [][]uint8, width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return stubs.Errorf(stubs.InvalidParams, "board size %dx%d must be positive", width, height)
+	}
+	if len(board) != height {
+		return stubs.Errorf(stubs.InvalidParams, "board has %d rows, but its height is %d", len(board), height)
+	}
+	for y, row := range board {
+		if len(row) != width {
+			return stubs.Errorf(stubs.InvalidParams, "row %d of the board has %d cells, but its width is %d", y, len(row), width)
+		}
+	}
+	return nil
+}
+
 // createGame creates an instance of Game
-func createGame(width int, height int, startingBoard [][]uint8) *Game {
-	current := &Board{cells: startingBoard,width: width,height: height}
+func createGame(width int, height int, startingBoard [][]uint8, rule rules.Rule, edge string, noise rules.Noise) *Game {
+	current := &Board{cells: startingBoard,width: width,height: height,rule: rule}
 	advanced := createBoard(width, height)
+	advanced.rule = rule
+	var aliveValues [256]bool
+	for value := range aliveValues {
+		aliveValues[value] = rule.Alive(uint8(value))
+	}
 	return &Game{
 		current:        current,
 		advanced:       advanced,
 		completedTurns: 0,
 		paused: 		false,
+		rule:           rule,
+		edge:           edge,
+		noise:          noise,
+		ages:           createAges(width, height),
+		aliveValues:    aliveValues,
+		alive:          current.AliveCount(),
 	}
 }
 
@@ -78,7 +164,7 @@ func (board *Board) Alive(x int, y int, wrap bool) bool {
 		x = (x + board.width) % board.width // need to add the w and h for these as Go modulus doesn't like negatives
 		y = (y + board.height) % board.height
 	}
-	return board.Get(x, y) == 255
+	return board.rule.Alive(board.Get(x, y))
 }
 
 
@@ -95,11 +181,31 @@ func (board *Board) AliveCells() []util.Cell {
 	return aliveCells
 }
 
+// AliveCount counts the alive cells without listing them
+func (board *Board) AliveCount() int {
+	count := 0
+	for j := 0; j < board.height; j++ {
+		for i := 0; i < board.width; i++ {
+			if board.Alive(i, j, false) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
 
 // Advance splits the board into horizontal slices. Each worker works on one section to advance the whole board one turn
-func (game *Game) Advance(workers int, width int, height int, workerClients []*rpc.Client) {
+func (game *Game) Advance(workers int, width int, height int, workerClients []*stubs.Worker) (err error) {
 	var doneChannels []chan *rpc.Call // signal through this channel when the worker has finished the job
 	var responses []*stubs.WorkerResponse // all the workers' work
+	var bounds [][2]int // the rows of each worker's section
+	var calls []*sectionCall // how long each worker's call took, and what it sent
+	var sectionClients []*stubs.Worker // the workers sent a section, which are all of them unless some sections can't change
+	checksum := stubs.Sum(game.current.cells) // every worker is sent the whole board
+	shared := game.shareBoard(workerClients[:workers])
+	packed := make(map[stubs.Encoding]*stubs.EncodedBoard)
+	active := game.activeRows()
 	for i := 0; i < workers; i++ {
 		startY := i * height / workers
 		var endY int
@@ -108,130 +214,725 @@ func (game *Game) Advance(workers int, width int, height int, workerClients []*r
 		} else {
 			endY = (i + 1) * height / workers
 		}
-		request := stubs.WorkerRequest{StartY: startY, EndY: endY, Width: width, Height: height, CurrentBoard: game.current.cells}
-		responses = append(responses, new(stubs.WorkerResponse)) // add response for this worker
-		doneChannels = append(doneChannels, make(chan *rpc.Call, 1))
-		workerClients[i].Go(stubs.AdvanceSection, request, &responses[i], doneChannels[i])
+		startY, endY, changing := activeSpan(active, startY, endY)
+		if !changing { // its rows stay as they are on the advanced board, which they already match
+			continue
+		}
+		worker := workerClients[i]
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/%d/%d", game.id, game.completedTurns, i), Deadline: game.deadline}
+		request := stubs.WorkerRequest{Header: header, StartY: startY, EndY: endY, Width: width, Height: height, CurrentBoard: game.current.cells, Checksum: checksum, Rule: game.rule.String(), Edge: game.edge,
+			Turn: game.completedTurns, OriginX: game.originX, OriginY: game.originY, Seed: game.noise.Seed, BirthProbability: game.noise.Birth, DeathProbability: game.noise.Death,
+			KeepSection: game.sharedImage}
+		if shared != nil && sharesMemory(worker) { // the worker reads the board where the broker put it
+			request.CurrentBoard, request.SharedBoard, request.SharedAdvanced = nil, shared.board.Path, shared.advanced.Path
+		} else {
+			game.encodeBoard(&request, worker, packed)
+		}
+		response, done, call := new(stubs.WorkerResponse), make(chan *rpc.Call, 1), new(sectionCall)
+		responses = append(responses, response) // add response for this worker
+		bounds = append(bounds, [2]int{startY, endY})
+		doneChannels = append(doneChannels, done)
+		calls = append(calls, call)
+		sectionClients = append(sectionClients, worker)
+		goAdvanceMeasured(worker, request, response, done, call, game.current.cells)
 	}
+	game.keepSent(sectionClients, checksum)
+	game.turnLog.split(bounds, sectionClients)
 	// now wait for all the work to be done
-	for i:=0; i<workers; i++ {
-		<-doneChannels[i]
+	for i := range sectionClients {
+		call, cancelled := awaitCall(doneChannels[i], game.completedTurns)
+		if cancelled != nil {
+			return cancelled
+		}
+		game.answered(sectionClients[i], call.Error == nil)
+		if call.Error != nil && err == nil {
+			err = stubs.Errorf(stubs.WorkerUnavailable, "worker %s failed turn %d: %v", sectionClients[i].Address, game.completedTurns, call.Error)
+			if stubs.Code(call.Error) == stubs.DeadlineExceeded {
+				err = call.Error
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = game.readShared(shared, responses, bounds, sectionClients); err != nil {
+		return err
+	}
+	if err = game.decodeSections(responses, bounds, calls, sectionClients); err != nil {
+		return err
+	}
+	game.timer.sectionsDone(responses, calls)
+	game.Reassemble(responses, bounds)
+	game.countTurn(responses, sectionClients, bounds)
+	game.metrics.record(sectionClients, responses, calls, bounds, width)
+	if game.sharedImage {
+		game.lastSections = &lastSections{turn: game.completedTurns, width: width, bounds: bounds, workers: sectionClients}
 	}
-	game.Reassemble(responses)
+	return nil
 }
 
-// Reassemble takes all the slices from workers and reassemble them to update the advanced board
-func (game *Game) Reassemble(responses []*stubs.WorkerResponse){
-	count := 0
-	for _, response := range responses {
-		for _, row := range response.AdvancedMiniBoard {
-			game.advanced.cells[count] = row // making sure the order of the slices is correct
-			count++
+// Reassemble takes all the slices from workers and puts them in their rows of the advanced board
+func (game *Game) Reassemble(responses []*stubs.WorkerResponse, bounds [][2]int) {
+	for i, response := range responses {
+		for y, row := range response.AdvancedMiniBoard {
+			game.advanced.cells[bounds[i][0]+y] = row
 		}
 	}
 }
 
 // ExecuteTurns calls n workers and distributes the processing of the board among them
-func (game *Game) ExecuteTurns(turns int){
-	//addresses := []string{"18.212.5.104:8030", "54.157.44.67:8030", "3.94.203.220:8030", "54.161.136.245:8030"}
-	addresses := []string{"127.0.0.1:8031", "127.0.0.1:8032", "127.0.0.1:8033", "127.0.0.1:8034"}
-	var workerClients []*rpc.Client
-	for _, address := range addresses { // dial to each worker in our list of addresses
-		worker, err := rpc.Dial("tcp", address)
-		handleError("Dial worker error", err)
-		workerClients = append(workerClients, worker)
-	}
-	for game.completedTurns < turns {
+func (game *Game) ExecuteTurns(turns int) error {
+	defer dumpOnPanic(game)
+	game.mutex.Lock()
+	game.running, game.turns = true, turns
+	game.mutex.Unlock()
+	defer func() {
+		game.mutex.Lock()
+		game.running, game.ended = false, true
+		game.setPaused(false) // the broker isn't paused once its game has ended
+		game.fetchStrips() // so the game's board is the one it finished with
+		game.writeDetached()
+		game.boardChanged()
+		game.releaseShared()
+		game.mutex.Unlock()
+	}()
+	var allClients []*stubs.Worker
+	if game.hashlife == nil && game.completedTurns < turns { // the hashlife engine works out every turn itself, and 0 turns need no workers
+		var err error
+		game.poolChanged()
+		if options.MinWorkers > 0 { // start with the workers that answer, waiting for more if there are too few
+			allClients, _ = game.healthyWorkers(nil)
+		} else if allClients, err = dialWorkers(); err != nil {
+			return err
+		}
+		if err = game.checkCapabilities(allClients); err != nil {
+			return err
+		}
+		game.checkQuorum(allClients, allClients)
+	}
+	workerClients := allClients
+	game.abandoned = make(chan struct{})
+	watching := make(chan struct{})
+	defer close(watching)
+	go game.watchHeartbeats(watching, options.ControllerTimeout)
+	for game.playing(turns) {
+		resumed, recheck := game.resumed(), game.awaitingQuorum()
+		if recheck != nil { // no turns are worked out until enough workers are back
+			resumed = nil
+		}
 		select {
-		case <-controllerClosed: // controller has closed, so we stop game and wait for a new one
-			return
-		case <-pauseTurns: // controller has told us to pause
-			<-pauseTurns // wait for unpause
-		case <-closeWorkers: // controller has told us to close everything
-			for _, w := range workerClients { // tell each worker to close
-				err := w.Call(stubs.CloseWorkerHandler, new(stubs.Request), new(stubs.Response))
-				handleError("Call worker error", err)
-				err = w.Close()
-				handleError("Close worker error", err)
+		case <-game.quit: // controller has closed, so we stop game and wait for a new one
+			return nil
+		case <-game.abandoned: // the controller has stopped sending heartbeats
+			return game.abandon()
+		case <-closeWorkers: // controller has told us to close everything, which CloseBroker does once we've stopped
+			return nil
+		case <-recheck: // the game is degraded, so see whether its workers have come back
+			if game.pastDeadline() {
+				game.stopReason = stubs.StopDeadline
+				return nil
+			}
+			allClients, workerClients = game.healthyWorkers(workerClients)
+			game.checkQuorum(allClients, workerClients)
+			continue
+		case <-resumed: // carry on with the next turn, straight away unless the game is paused
+		}
+		if game.hashlife == nil && game.poolChanged() { // workers registered or went, so the board is split between those there are now
+			allClients, workerClients = game.healthyWorkers(workerClients)
+			if len(allClients) == 0 && options.MinWorkers == 0 {
+				return stubs.Errorf(stubs.WorkerUnavailable, "none of the broker's workers can be reached")
+			}
+			log.Printf("Game %s: splitting the board between %d workers from turn %d", game.id, len(workerClients), game.completedTurns)
+			if game.checkQuorum(allClients, workerClients) {
+				continue
+			}
+		}
+		finished := game.waitForTurn()
+		if finished == nil { // the game was stopped while waiting, which the loop sees next time round
+			continue
+		}
+		err := game.executeTurn(turns, workerClients)
+		finished()
+		if err != nil {
+			if stubs.Code(err) == stubs.Draining { // the broker started closing partway through the turn
+				return nil
+			}
+			if stubs.Code(err) != stubs.WorkerUnavailable || options.MinWorkers == 0 {
+				return err
 			}
-			close(workersClosed) // signal we are done closing the workers
-			return
-		default:
+			log.Printf("Game %s: %v", game.id, err) // the turn is worked out again by the workers still healthy
+			allClients, workerClients = game.healthyWorkers(workerClients)
+			game.checkQuorum(allClients, workerClients)
+			continue
+		}
+		if game.autoscale != nil {
+			game.mutex.Lock()
+			allClients, workerClients = game.adjustWorkers(allClients, workerClients)
+			game.activeWorkers = len(workerClients)
+			game.mutex.Unlock()
+		}
+	}
+	return nil
+}
+
+// playing checks whether the game has turns left to work out and hasn't stopped early, with the game locked as a
+// paused game can be taken to a bookmark while the turn loop is between turns
+func (game *Game) playing(turns int) bool {
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	return game.completedTurns < turns && game.stopReason == ""
+}
+
+// executeTurn advances the game by one turn, or by a jump of many turns with the hashlife engine
+func (game *Game) executeTurn(turns int, workerClients []*stubs.Worker) error {
+	game.mutex.Lock() // lock in case AliveCellCount required whilst swapping the board
+	defer game.mutex.Unlock()
+	if game.paused { // paused after the turn loop last checked, so this turn waits until it's resumed
+		return nil
+	}
+	if game.pastDeadline() {
+		game.stopReason = stubs.StopDeadline
+		return nil
+	}
+	if game.tiled != nil {
+		if err := game.advanceTiles(workerClients); err != nil {
+			return game.stopAtDeadline(err)
 		}
-		game.mutex.Lock() // lock in case AliveCellCount required whilst swapping the board
-		game.Advance(len(addresses), game.current.width, game.current.height, workerClients)
-		game.current, game.advanced = game.advanced, game.current
 		game.completedTurns++
-		game.mutex.Unlock()
+		game.boardChanged()
+		return nil
+	}
+	if game.strips != nil {
+		return game.executeHaloTurn(workerClients)
+	}
+	if game.hashlife != nil {
+		step := hashLifeStep(game.completedTurns, turns)
+		game.hashlife.Step(step)
+		game.completedTurns += step
+		game.boardChanged()
+		return nil
+	}
+	start := time.Now()
+	workers := len(workerClients)
+	if workers > game.current.height { // every worker has at least one row
+		workers = game.current.height
 	}
+	if err := game.Advance(workers, game.current.width, game.current.height, workerClients); err != nil {
+		return game.stopAtDeadline(err)
+	}
+	game.current, game.advanced = game.advanced, game.current
+	game.quiet.turned(game.advanced, game.current)
+	game.updateAges()
+	game.countFlips()
+	game.completedTurns++
+	game.runHook()
+	game.stopReason = game.checkStop()
+	if game.checkCycle() && game.stopEarly && game.stopReason == "" {
+		game.stopReason = stubs.StopCycle
+	}
+	game.growIfNeeded()
+	game.history.record(game.turnStats())
+	game.timer.turnDone(game.completedTurns, start)
+	game.turnLog.turn(game.completedTurns, game.current.cells)
+	game.streamTurn()
+	game.boardChanged()
+	return nil
 }
 
 // StartGame starts initialising game and executing when distributor calls
-func (s *SecretBrokerOperation) StartGame(req stubs.Request, res *stubs.Response)(err error){
+func (s *SecretBrokerOperation) StartGame(req stubs.StartGameRequest, res *stubs.StartGameResponse)(err error){
+	if req.GameID == "" { // older controllers don't name their games
+		req.GameID = stubs.NewID()
+	}
+	res.Header = req.Header
+	started := time.Now()
+	defer func() {
+		if res.FinishedBoard != nil {
+			res.Checksum = stubs.Sum(res.FinishedBoard)
+		}
+		res.Elapsed = time.Since(started)
+		err = res.Fail(err)
+	}()
+	if err = req.Checksum.Verify(req.StartingBoard); err != nil {
+		return err
+	}
+	if err = checkBoardSize(req.StartingBoard, req.Width, req.Height); err != nil {
+		return err
+	}
+	if req.Turns < 0 {
+		return stubs.Errorf(stubs.InvalidParams, "%d turns can't be worked out, the fewest is 0", req.Turns)
+	}
+	if req.StartTurn < 0 || req.StartTurn > req.Turns {
+		return stubs.Errorf(stubs.InvalidParams, "can't carry on from turn %d of a %d turn game", req.StartTurn, req.Turns)
+	}
+	if err = require(stubs.StateIdle, stubs.StateRunning, stubs.StatePaused); err != nil {
+		return err
+	}
 	startingBoard := req.StartingBoard
-	currentGame = createGame(req.Height,req.Width,startingBoard)
-	currentGame.ExecuteTurns(req.Turns) // begin game
-	res.FinishedBoard = currentGame.current.cells
-	res.CompletedTurns = currentGame.completedTurns
-	res.AliveCells = currentGame.current.AliveCells()
+	rule, err := rules.Parse(req.Rule)
+	if err != nil { // reject the game before anything is sent to the workers
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	edge, err := rules.ParseEdge(req.Edge)
+	if err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	if req.Expand {
+		edge = rules.Dead // nothing can be beyond the edge of an expanding board
+	}
+	noise := rules.Noise{Seed: req.Seed, Birth: req.BirthProbability, Death: req.DeathProbability}
+	if err = noise.Validate(); err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	for _, condition := range req.StopConditions {
+		if err = condition.Validate(req.Width, req.Height); err != nil {
+			return stubs.WithCode(stubs.InvalidParams, err)
+		}
+	}
+	if err = checkLimits(req.Width, req.Height, req.Turns, boardMemory(req.Width, req.Height, req.TileSize)); err != nil {
+		return err
+	}
+	releaseGame, err := takeControllerGame(req)
+	if err != nil {
+		return err
+	}
+	defer releaseGame()
+	if err = startRunning(); err != nil {
+		return err
+	}
+	defer stopRunning()
+	if err = provisionWorkers(); err != nil {
+		return stubs.WithCode(stubs.WorkerUnavailable, err)
+	}
+	defer releaseWorkers()
+	if options.OrderByLatency {
+		orderWorkersByLatency()
+	}
+	log.Printf("Game %s: %dx%d board for %d turns (request %s)", req.GameID, req.Width, req.Height, req.Turns, req.RequestID)
+	if req.Halo {
+		if err = validateHalo(req, rule); err != nil {
+			return stubs.WithCode(stubs.InvalidParams, err)
+		}
+	}
+	switch req.Engine {
+	case "", stubs.EngineWorkers:
+	case stubs.EngineHashLife:
+		return startHashLifeGame(req, res, rule)
+	default:
+		return stubs.Errorf(stubs.InvalidParams, "unknown engine %q, expected %s or %s", req.Engine, stubs.EngineWorkers, stubs.EngineHashLife)
+	}
+	if req.TileSize > 0 {
+		return startTiledGame(req, res, rule, edge, noise)
+	}
+	if req.SharedImage && options.SharedImageDirectory == "" {
+		return stubs.Errorf(stubs.InvalidParams, "the broker has no -sharedImages directory for the workers to write the board to")
+	}
+	game := createGame(req.Width,req.Height,startingBoard,rule,edge.String(),noise)
+	game.id = req.GameID
+	game.sharedImage = req.SharedImage
+	game.completedTurns = req.StartTurn
+	game.detach = req.Detach
+	game.priority = req.Priority
+	game.deadline = req.Deadline
+	game.includeAges = req.IncludeAges
+	game.stopEarly = req.StopEarly
+	game.census = req.Census
+	game.stopConditions = req.StopConditions
+	game.expand = req.Expand
+	game.activeWorkers = len(listWorkers())
+	if req.TimeTurns {
+		game.timer = new(turnTimer)
+	}
+	if req.Heatmap {
+		game.flips = createAges(req.Width, req.Height)
+	}
+	if req.TargetTurnsPerSecond > 0 {
+		game.autoscale = newAutoscaler(req.TargetTurnsPerSecond, req.Autoscale, req.Width*req.Height, game.completedTurns)
+	}
+	game.growIfNeeded()
+	game.cycles = newCycleDetector(req.CycleWindow)
+	game.checkCycle() // remember the starting board too
+	game.history = newHistory(game.id, game.turnStats())
+	defer game.history.finish()
+	if req.Halo {
+		game.strips = game.newHaloStrips()
+	} else { // a halo game's board isn't there to log each turn
+		game.turnLog = newTurnLog(game.id, game.completedTurns, game.current.cells)
+	}
+	defer game.turnLog.close()
+	if req.StreamTurns && game.strips == nil && !game.expand { // tiled and hashlife games are started elsewhere, and don't stream either
+		game.stream = newTurnStream(game.current.cells, game.completedTurns)
+	}
+	publish(game)
+	if err = game.ExecuteTurns(req.Turns); err != nil { // begin game
+		return err
+	}
+	if game.sharedImage {
+		if res.ImagePath, err = game.writeSharedImage(); err != nil {
+			return stubs.WithCode(stubs.Internal, err)
+		}
+	} else {
+		res.FinishedBoard = game.current.cells
+	}
+	res.CompletedTurns = game.completedTurns
+	if req.PageAliveCells {
+		keepFinishedBoard(req.GameID, game.current)
+		res.AliveCount = game.current.AliveCount()
+	} else {
+		res.AliveCells = game.current.AliveCells()
+		res.AliveCount = len(res.AliveCells)
+	}
+	res.MeanAge, res.MaxAge = game.AgeStatistics()
+	res.StopReason = game.stopReason
+	res.WorkerMetrics = game.metrics.list()
+	res.TurnTimings = game.timer.list()
+	res.Flips = game.flips
+	res.Width, res.Height = game.current.width, game.current.height
+	res.OriginX, res.OriginY = game.originX, game.originY
+	res.CycleStart, res.CyclePeriod = game.cycles.start, game.cycles.period
+	if game.includeAges {
+		res.Ages = game.ages
+	}
+	if game.census {
+		res.Census = game.takeCensus()
+	}
 	return
 }
 
 // AliveCellCount return alive Cells to distributor
-func (s *SecretBrokerOperation) AliveCellCount(_ stubs.Request, response *stubs.Response)(err error){
-	currentGame.mutex.Lock() // lock so turns don't continue whilst counting
-	response.FinishedBoard = currentGame.current.cells
-	response.CompletedTurns = currentGame.completedTurns
-	response.AliveCells = currentGame.current.AliveCells()
-	currentGame.mutex.Unlock()
+func (s *SecretBrokerOperation) AliveCellCount(req stubs.AliveCellCountRequest, response *stubs.AliveCellCountResponse)(err error){
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil { // lock so turns don't continue whilst counting
+		return err
+	}
+	defer game.mutex.Unlock()
+	response.ActiveWorkers = game.activeWorkers
+	response.Degraded, response.MinWorkers = game.degraded, options.MinWorkers
+	if game.tiled != nil {
+		response.CompletedTurns = game.completedTurns
+		response.AliveCount, err = game.tiled.store.Population(game.aliveValues)
+		return
+	}
+	if game.hashlife != nil {
+		response.CompletedTurns = game.completedTurns
+		response.AliveCount = game.hashlife.Population()
+		return
+	}
+	if game.strips != nil { // counted from the workers' births and deaths, as the board isn't fetched each turn
+		response.CompletedTurns = game.completedTurns
+		response.AliveCount = game.alive
+		return
+	}
+	response.CompletedTurns = game.completedTurns
+	response.AliveCount = game.current.AliveCount()
+	response.MeanAge, response.MaxAge = game.AgeStatistics()
+	response.CycleStart, response.CyclePeriod = game.cycles.start, game.cycles.period
+	if game.autoscale != nil {
+		response.TurnsPerSecond = game.autoscale.rate
+		response.RecommendedWorkers = game.autoscale.recommended
+	}
 	return
 }
 
 // CurrentBoard return current board to distributor
-func (s *SecretBrokerOperation) CurrentBoard(_ stubs.Request, response *stubs.Response) (err error) {
-	response.FinishedBoard = currentGame.current.cells
-	response.CompletedTurns = currentGame.completedTurns
+func (s *SecretBrokerOperation) CurrentBoard(req stubs.CurrentBoardRequest, response *stubs.CurrentBoardResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		if response.Board != nil {
+			response.Checksum = stubs.Sum(response.Board)
+		}
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	return game.currentBoard(req.Header, req.IncludeAges, response)
+}
+
+// currentBoard fills in the response with the game's board as it is now
+// A board kept in memory is only ever swapped between turns, never changed, so it can be read without waiting
+// for the turn being worked out, unless its ages are needed too.
+func (game *Game) currentBoard(header stubs.Header, includeAges bool, response *stubs.CurrentBoardResponse) error {
+	if game.tiled == nil && game.hashlife == nil && game.strips == nil && !includeAges {
+		return game.board(false, response)
+	}
+	if err := game.lockBy(header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	return game.board(includeAges, response)
+}
+
+// board fills in the response with the game's board, which should be done with the game locked so the board
+// and its turn match
+func (game *Game) board(includeAges bool, response *stubs.CurrentBoardResponse) (err error) {
+	game.fetchStrips()
+	response.CompletedTurns = game.completedTurns
+	if game.tiled != nil { // the board may not fit in memory, so it is written out here instead
+		response.Width, response.Height = game.tiled.store.Width, game.tiled.store.Height
+		response.ImagePath, err = game.writeTiledImage()
+		return
+	}
+	if game.hashlife != nil {
+		response.Board, response.OriginX, response.OriginY = game.hashLifeBoard()
+		response.Width, response.Height = len(response.Board[0]), len(response.Board)
+		return
+	}
+	response.Board = game.current.cells
+	response.Width, response.Height = game.current.width, game.current.height
+	response.OriginX, response.OriginY = game.originX, game.originY
+	if includeAges {
+		response.Ages = game.copyAges()
+	}
 	return
 }
 
-// CloseBroker close the broker
-func (s *SecretBrokerOperation) CloseBroker(_ stubs.Request, _ *stubs.Response) (err error) {
-	close(closeWorkers) // signal we need to close workers
-	<-workersClosed // wait until workers have been closed
-	close(closed)
+// startTiledGame runs a game stored as tiles, writing the final board as an image rather than sending it back
+func startTiledGame(req stubs.StartGameRequest, res *stubs.StartGameResponse, rule rules.Rule, edge rules.Edge, noise rules.Noise) (err error) {
+	if err = validateTiled(req, rule); err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	game, err := createTiledGame(req, rule, edge, noise)
+	if err != nil {
+		return err
+	}
+	defer game.tiled.store.Close()
+	game.activeWorkers = len(listWorkers())
+	publish(game)
+	if err = game.ExecuteTurns(req.Turns); err != nil {
+		return err
+	}
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	res.CompletedTurns = game.completedTurns
+	res.StopReason = game.stopReason
+	res.Width, res.Height = req.Width, req.Height
+	if res.AliveCount, err = game.tiled.store.Population(game.aliveValues); err != nil {
+		return err
+	}
+	res.ImagePath, err = game.writeTiledImage()
 	return
 }
 
-// PauseBroker pause the broker
-func (s *SecretBrokerOperation) PauseBroker(_ stubs.Request, response *stubs.Response) (err error) {
-	if currentGame.paused {
-		currentGame.paused = false
+// startHashLifeGame runs a game with the hashlife engine, on an unbounded board like an expanding one
+func startHashLifeGame(req stubs.StartGameRequest, res *stubs.StartGameResponse, rule rules.Rule) (err error) {
+	if err = validateHashLife(req); err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	game, err := createHashLifeGame(req, rule)
+	if err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	publish(game)
+	if err = game.ExecuteTurns(req.Turns); err != nil {
+		return err
+	}
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	board := &Board{rule: rule}
+	board.cells, res.OriginX, res.OriginY = game.hashLifeBoard()
+	board.width, board.height = len(board.cells[0]), len(board.cells)
+	res.FinishedBoard = board.cells
+	res.CompletedTurns = game.completedTurns
+	res.StopReason = game.stopReason
+	if req.PageAliveCells {
+		keepFinishedBoard(req.GameID, board)
+		res.AliveCount = board.AliveCount()
 	} else {
-		currentGame.paused = true
+		res.AliveCells = board.AliveCells()
+		res.AliveCount = len(res.AliveCells)
+	}
+	res.Width, res.Height = board.width, board.height
+	if game.census {
+		res.Census = game.takeCensus()
+	}
+	return
+}
+
+// CloseBroker close the broker
+func (s *SecretBrokerOperation) CloseBroker(req stubs.CloseRequest, response *stubs.CloseResponse) (err error) {
+	response.Header = req.Header
+	finish, replayed := replay("CloseBroker", req.RequestID, response)
+	if replayed {
+		return
+	}
+	defer finish()
+	if err = drain(); err != nil { // signal we need to close workers
+		return response.Fail(err)
+	}
+	select {
+	case <-gamesStopped(): // the turns in progress are cancelled, so games stop straight away
+	case <-time.After(drainTimeout):
+		response.Skipped = append(response.Skipped, "waiting for the running games, which didn't stop in time")
+	}
+	response.Skipped = append(response.Skipped, shutDownWorkers()...)
+	for _, skipped := range response.Skipped {
+		log.Println("Closing broker, skipped", skipped)
+	}
+	closeDown()
+	return
+}
+
+// Census counts the known objects on the current board
+func (s *SecretBrokerOperation) Census(req stubs.CensusRequest, response *stubs.CensusResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if game.tiled != nil {
+		return stubs.Errorf(stubs.InvalidParams, "census isn't supported on tiled boards")
+	}
+	if err = game.lockBy(req.Header); err != nil { // lock so the board doesn't change whilst it is being scanned
+		return err
+	}
+	response.Census = game.takeCensus()
+	response.CompletedTurns = game.completedTurns
+	game.mutex.Unlock()
+	return
+}
+
+// Version tells the caller which version of gol the broker is running, and which workers it uses
+func (s *SecretBrokerOperation) Version(req stubs.VersionRequest, response *stubs.VersionResponse) (err error) {
+	response.Header = req.Header
+	response.Version = config.Version
+	response.Workers = listWorkers()
+	return
+}
+
+// gameFor finds the game a request is about, which has to be the broker's current game, refusing requests
+// made while the broker isn't running one
+func gameFor(header stubs.Header) (*Game, error) {
+	if err := require(stubs.StateRunning, stubs.StatePaused, stubs.StateDraining); err != nil {
+		return nil, err
+	}
+	current.Lock()
+	game := current.game
+	current.Unlock()
+	if game == nil {
+		return nil, stubs.Errorf(stubs.NoGame, "no game has been started")
 	}
-	pauseTurns <- currentGame.paused
-	response.CompletedTurns = currentGame.completedTurns
+	if header.GameID != "" && header.GameID != game.id {
+		return nil, stubs.Errorf(stubs.NoGame, "game %s isn't running, the broker's game is %s", header.GameID, game.id)
+	}
+	return game, nil
+}
+
+// Games lists the game the broker is running, if there is one, and how many games and batches are running in all
+func (s *SecretBrokerOperation) Games(req stubs.GamesRequest, response *stubs.GamesResponse) (err error) {
+	response.Header = req.Header
+	runningGames.Lock()
+	response.Running = runningGames.count
+	runningGames.Unlock()
+	current.Lock()
+	game := current.game
+	current.Unlock()
+	if game == nil {
+		return
+	}
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	if !game.running {
+		return
+	}
+	status := stubs.GameStatus{ID: game.id, Turns: game.turns, CompletedTurns: game.completedTurns, Paused: game.paused,
+		Engine: stubs.EngineWorkers, Tiled: game.tiled != nil, Workers: game.activeWorkers, Rule: game.rule.String(), Edge: game.edge,
+		Seed: game.noise.Seed, BirthProbability: game.noise.Birth, DeathProbability: game.noise.Death, Priority: game.priority}
+	switch {
+	case game.tiled != nil:
+		status.Width, status.Height = game.tiled.store.Width, game.tiled.store.Height
+	case game.hashlife != nil:
+		status.Width, status.Height, status.Engine = game.width, game.height, stubs.EngineHashLife
+	default:
+		status.Width, status.Height = game.current.width, game.current.height
+	}
+	response.Games = append(response.Games, status)
 	return
 }
 
-func (s *SecretBrokerOperation) ControllerClosed(_ stubs.Request, _ *stubs.Response) (err error) {
-	controllerClosed <- true
+// ControllerClosed stops the game, as its controller has quit
+// Before a game has been started there is nothing to stop, and it fails with NoGame rather than waiting for one.
+func (s *SecretBrokerOperation) ControllerClosed(req stubs.CloseRequest, response *stubs.CloseResponse) (err error) {
+	response.Header = req.Header
+	finish, replayed := replay("ControllerClosed", req.RequestID, response)
+	if replayed {
+		return
+	}
+	defer finish()
+	if req.GameID != "" && unqueue(req.GameID) { // the game hasn't started, so it never will
+		return
+	}
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return response.Fail(err)
+	}
+	if game.detach {
+		game.detachFrom("quit")
+		return
+	}
+	game.stop()
 	return
 }
 
-var currentGame *Game
-var pauseTurns = make(chan bool)
+// current is the game started by the last StartGame, which the controller's RPCs are about
+var current struct {
+	sync.Mutex
+	game *Game
+}
+
+// publish makes a game the broker's current game, once it is ready to be asked about
+func publish(game *Game) {
+	game.quit = make(chan struct{})
+	current.Lock()
+	current.game = game
+	current.Unlock()
+}
+
 var closeWorkers = make(chan struct{})
-var workersClosed = make(chan struct{})
-var controllerClosed = make(chan bool)
 var closed = make(chan struct{})
 
-func main(){
-	err := rpc.Register(&SecretBrokerOperation{})
+// Ready reports whether the broker can run a game, which needs every worker to be reachable and the broker
+// not to be closing down
+func Ready() error {
+	if err := require(stubs.StateIdle, stubs.StateRunning, stubs.StatePaused); err != nil {
+		return fmt.Errorf("closing")
+	}
+	addresses := listWorkers()
+	if len(addresses) == 0 {
+		return fmt.Errorf("no workers")
+	}
+	for _, address := range addresses {
+		connection, err := stubs.DialConn(address, time.Second)
+		if err != nil {
+			return fmt.Errorf("worker %s unreachable: %v", address, err)
+		}
+		_ = connection.Close()
+	}
+	return nil
+}
+
+// Run starts the broker accepting connections on the listener, using the workers at the given addresses
+func Run(listener net.Listener, workers []string, brokerOptions Options) {
+	setWorkers(workers)
+	options = brokerOptions
+	err := checkWhileRunning(options.WhileRunning)
+	handleError("Broker options error", err)
+	err = stubs.CheckBroker(&SecretBrokerOperation{})
+	handleError("Broker RPC error", err)
+	err = rpc.Register(&SecretBrokerOperation{})
 	handleError("Register error", err)
-	listener, err := net.Listen("tcp",":8030")
 	go checkClosed()
-	handleError("Listener error", err)
 
 	defer func(listener net.Listener) {
 		err := listener.Close()
@@ -0,0 +1,222 @@
+package broker
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/mux"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/worker"
+)
+
+// testWorker is a worker served on a local port, which can be killed part way through a game
+type testWorker struct {
+	net.Listener
+	address string
+	mutex   sync.Mutex
+	conns   []net.Conn
+}
+
+// Accept keeps the connections the worker accepts, so kill can close them
+func (w *testWorker) Accept() (net.Conn, error) {
+	conn, err := w.Listener.Accept()
+	if err == nil {
+		w.mutex.Lock()
+		w.conns = append(w.conns, conn)
+		w.mutex.Unlock()
+	}
+	return conn, err
+}
+
+// kill stops the worker answering, as if its machine went away
+func (w *testWorker) kill() {
+	_ = w.Listener.Close()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, conn := range w.conns {
+		_ = conn.Close()
+	}
+}
+
+// serveWorker serves a worker on a local port, killing it once the test is over
+func serveWorker(t *testing.T) *testWorker {
+	server := rpc.NewServer()
+	if err := server.Register(&worker.SecretWorkerOperation{}); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWorker{Listener: listener, address: listener.Addr().String()}
+	go mux.Serve(w, server.ServeConn)
+	t.Cleanup(w.kill)
+	return w
+}
+
+// useWorkers serves n workers and has the broker use them, with its options as they are by default, putting both
+// back once the test is over
+func useWorkers(t *testing.T, n int) []*testWorker {
+	var served []*testWorker
+	var addresses []string
+	for i := 0; i < n; i++ {
+		w := serveWorker(t)
+		served = append(served, w)
+		addresses = append(addresses, w.address)
+	}
+	defaults, given := options, listWorkers()
+	setWorkers(addresses)
+	t.Cleanup(func() {
+		options = defaults
+		setWorkers(given)
+	})
+	return served
+}
+
+// gameResult is what StartGame gave back
+type gameResult struct {
+	response stubs.StartGameResponse
+	err      error
+}
+
+// startGame starts a game as a controller would, on a copy of its starting board as the broker plays on the board
+// it is given, giving back what StartGame does once the game finishes. The game is stopped if the test ends first.
+func startGame(t *testing.T, req stubs.StartGameRequest) <-chan gameResult {
+	req.StartingBoard = copyBoard(req.StartingBoard)
+	finished, stopped := make(chan gameResult, 1), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var result gameResult
+		_ = new(SecretBrokerOperation).StartGame(req, &result.response)
+		result.err = result.response.Err() // the broker's methods give their errors back in the response
+		finished <- result
+	}()
+	t.Cleanup(func() {
+		_ = new(SecretBrokerOperation).ControllerClosed(stubs.CloseRequest{Header: req.Header}, new(stubs.CloseResponse))
+		<-stopped
+	})
+	return finished
+}
+
+// finish waits for a game started with startGame, failing the test if it fails or takes too long
+func finish(t *testing.T, finished <-chan gameResult) stubs.StartGameResponse {
+	select {
+	case result := <-finished:
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		return result.response
+	case <-time.After(30 * time.Second):
+		t.Fatal("game didn't finish")
+		return stubs.StartGameResponse{}
+	}
+}
+
+// pauseAfter waits for a game to complete at least the turns given and pauses it, giving the turn it was paused at
+func pauseAfter(t *testing.T, gameID string, turns int) int {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var games stubs.GamesResponse
+		_ = new(SecretBrokerOperation).Games(stubs.GamesRequest{}, &games)
+		if len(games.Games) == 1 && games.Games[0].ID == gameID && games.Games[0].CompletedTurns >= turns {
+			var paused stubs.PauseResponse
+			_ = new(SecretBrokerOperation).Pause(stubs.PauseRequest{Header: stubs.Header{GameID: gameID}}, &paused)
+			if err := paused.Err(); err != nil {
+				t.Fatal(err)
+			}
+			return paused.CompletedTurns
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("game %s didn't get to turn %d", gameID, turns)
+	return 0
+}
+
+// resume carries on with a paused game
+func resume(t *testing.T, gameID string) {
+	var resumed stubs.PauseResponse
+	_ = new(SecretBrokerOperation).Resume(stubs.PauseRequest{Header: stubs.Header{GameID: gameID}}, &resumed)
+	if err := resumed.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newBoard makes an empty board with the cells given, as x, y pairs, alive
+func newBoard(width int, height int, alive ...int) [][]uint8 {
+	board := make([][]uint8, height)
+	for y := range board {
+		board[y] = make([]uint8, width)
+	}
+	for i := 0; i+1 < len(alive); i += 2 {
+		board[alive[i+1]][alive[i]] = 255
+	}
+	return board
+}
+
+// copyBoard copies a board, so it can be kept as it is while the broker plays on the copy
+func copyBoard(board [][]uint8) [][]uint8 {
+	copied := make([][]uint8, len(board))
+	for y, row := range board {
+		copied[y] = append([]uint8(nil), row...)
+	}
+	return copied
+}
+
+// step works out turns of B3/S23 on a toroidal board the slow way, to check the broker's boards against
+func step(board [][]uint8, turns int) [][]uint8 {
+	height, width := len(board), len(board[0])
+	for turn := 0; turn < turns; turn++ {
+		next := newBoard(width, height)
+		for y := range board {
+			for x := range board[y] {
+				neighbours := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if (dx != 0 || dy != 0) && board[(y+dy+height)%height][(x+dx+width)%width] == 255 {
+							neighbours++
+						}
+					}
+				}
+				if neighbours == 3 || neighbours == 2 && board[y][x] == 255 {
+					next[y][x] = 255
+				}
+			}
+		}
+		board = next
+	}
+	return board
+}
+
+// sameBoard fails the test if a board isn't the one wanted
+func sameBoard(t *testing.T, got [][]uint8, want [][]uint8) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got board\n%s\nwant\n%s", drawBoard(got), drawBoard(want))
+	}
+}
+
+// drawBoard draws a board with # for alive cells, for failures
+func drawBoard(board [][]uint8) string {
+	drawn := ""
+	for _, row := range board {
+		for _, cell := range row {
+			if cell == 255 {
+				drawn += "#"
+			} else {
+				drawn += "."
+			}
+		}
+		drawn += "\n"
+	}
+	return drawn
+}
+
+// gameID names a game after the test playing it
+func gameID(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
@@ -0,0 +1,108 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// What StartGame does when the broker is already running a controller's game, chosen with Options.WhileRunning
+const (
+	RejectNewGames  = "reject" // fail with AlreadyRunning
+	QueueNewGames   = "queue"  // wait for the running game to finish, then start
+	StopRunningGame = "stop"   // stop the running game first, if the request says to with StopRunning, else reject
+)
+
+// controllerGame is held by the StartGame running the broker's current game, so a second one can't replace
+// the game while its turn loop is still going
+var controllerGame = make(chan struct{}, 1)
+
+// queued has a channel for each game waiting for controllerGame, closed if its controller quits before it starts
+var queued = struct {
+	sync.Mutex
+	games map[string]chan struct{}
+}{games: make(map[string]chan struct{})}
+
+// checkWhileRunning makes sure Options.WhileRunning is one the broker knows
+func checkWhileRunning(mode string) error {
+	switch mode {
+	case "", RejectNewGames, QueueNewGames, StopRunningGame:
+		return nil
+	default:
+		return fmt.Errorf("unknown -whileRunning %q, expected %s, %s or %s", mode, RejectNewGames, QueueNewGames, StopRunningGame)
+	}
+}
+
+// takeControllerGame makes the request's game the one the controller RPCs are about once no other game is, as
+// Options.WhileRunning says, giving a function that lets the next game have it
+func takeControllerGame(req stubs.StartGameRequest) (func(), error) {
+	release := func() {
+		<-controllerGame
+	}
+	select {
+	case controllerGame <- struct{}{}:
+		return release, nil
+	default:
+	}
+	running := "another game"
+	if game, err := gameFor(stubs.Header{}); err == nil {
+		running = "game " + game.id
+	}
+	switch {
+	case options.WhileRunning == QueueNewGames:
+		log.Printf("Game %s: queued until %s has finished", req.GameID, running)
+	case options.WhileRunning == StopRunningGame && req.StopRunning:
+		game, err := gameFor(stubs.Header{})
+		if err == nil {
+			log.Printf("Game %s: stopping game %s to start", req.GameID, game.id)
+			game.stop()
+		}
+	default:
+		return nil, stubs.Errorf(stubs.AlreadyRunning, "the broker is already running %s", running)
+	}
+	quit := make(chan struct{})
+	queued.Lock()
+	queued.games[req.GameID] = quit
+	queued.Unlock()
+	defer func() {
+		queued.Lock()
+		delete(queued.games, req.GameID)
+		queued.Unlock()
+	}()
+	var expired <-chan time.Time
+	if !req.Deadline.IsZero() {
+		expired = time.After(time.Until(req.Deadline))
+	}
+	select {
+	case controllerGame <- struct{}{}:
+		return release, nil
+	case <-closeWorkers:
+		return nil, stubs.Errorf(stubs.Draining, "the broker is closing down")
+	case <-quit:
+		return nil, stubs.Errorf(stubs.NoGame, "game %s was given up on by its controller before it started", req.GameID)
+	case <-expired:
+		return nil, stubs.Errorf(stubs.DeadlineExceeded, "game %s passed its deadline before %s finished", req.GameID, running)
+	}
+}
+
+// unqueue gives up on a game still waiting to start, as its controller has quit, reporting whether there was one
+func unqueue(gameID string) bool {
+	queued.Lock()
+	defer queued.Unlock()
+	quit, ok := queued.games[gameID]
+	if ok {
+		close(quit)
+		delete(queued.games, gameID)
+	}
+	return ok
+}
+
+// stop ends the game as if its controller had quit, even if it asked to be finished without it
+func (game *Game) stop() {
+	game.quitOnce.Do(func() {
+		close(game.quit)
+	})
+}
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Hello agrees with a controller which capabilities to use, giving back those both of them support
+func (s *SecretBrokerOperation) Hello(req stubs.HelloRequest, response *stubs.HelloResponse) (err error) {
+	response.Header = req.Header
+	response.Version = config.Version
+	response.Capabilities = stubs.BrokerCapabilities.Common(req.Capabilities)
+	return
+}
+
+// needs gives the capabilities a worker must have to work out the game's turns
+func (game *Game) needs() stubs.Capabilities {
+	var needed stubs.Capabilities
+	if game.rule.IsLargerThanLife() {
+		needed = append(needed, stubs.LargerThanLife)
+	}
+	if game.rule.Colours > 0 {
+		needed = append(needed, stubs.Coloured)
+	} else if game.rule.States > 2 {
+		needed = append(needed, stubs.Generations)
+	}
+	if game.noise.Enabled() {
+		needed = append(needed, stubs.Noise)
+	}
+	if game.strips != nil {
+		needed = append(needed, stubs.Halos)
+	}
+	return needed
+}
+
+// checkCapabilities makes sure every worker can play the game, rather than letting an older one get it wrong
+func (game *Game) checkCapabilities(workerClients []*stubs.Worker) error {
+	for _, capability := range game.needs() {
+		for _, worker := range workerClients {
+			if !worker.Capabilities.Has(capability) {
+				return stubs.Errorf(stubs.WorkerUnavailable, "worker %s doesn't support %s, which game %s needs", worker.Address, capability, game.id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package broker
+
+import (
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// takeCensus counts the known objects on the current board
+func (game *Game) takeCensus() census.Census {
+	var cells [][]uint8
+	edge, _ := rules.ParseEdge(game.edge)
+	if game.hashlife != nil {
+		cells, _, _ = game.hashLifeBoard()
+		edge = rules.Dead // the board is cut from an unbounded universe, so nothing is beyond its edges
+	} else {
+		cells = game.current.cells
+	}
+	return census.Take(cells, func(value uint8) bool {
+		return game.aliveValues[value]
+	}, edge)
+}
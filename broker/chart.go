@@ -0,0 +1,126 @@
+package broker
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// chartPoints is the most turns plotted on a chart, longer runs being sampled evenly
+const chartPoints = 1000
+
+// chartWidth and chartHeight are the size of a chart, and chartMargin the space around its plot for the labels
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	chartMargin = 60
+)
+
+// Chart serves an SVG chart of a game's population against its turn, for a quick look at a remote run from a browser
+// It charts the broker's current game unless ?game= names one of its last few, and ?from= and ?to= limit the turns.
+func Chart(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, _ := strconv.Atoi(query.Get("from"))
+	to, _ := strconv.Atoi(query.Get("to"))
+	response := new(stubs.HistoryResponse)
+	request := stubs.HistoryRequest{Header: stubs.NewHeader(query.Get("game")), From: from, To: to, Limit: chartPoints}
+	_ = new(SecretBrokerOperation).History(request, response) // which records any error in the response
+	if err := response.Err(); err != nil {
+		code := http.StatusInternalServerError
+		if stubs.Code(err) == stubs.NoGame {
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	turns, err := sampleHistory(request, response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store") // the chart changes every turn
+	_, _ = fmt.Fprint(w, chartSVG(request.GameID, turns))
+}
+
+// sampleHistory reads the rest of the turns asked for after the first page, keeping every so many of them so no more
+// than about chartPoints are plotted, and always the last
+func sampleHistory(request stubs.HistoryRequest, first *stubs.HistoryResponse) ([]stubs.TurnStats, error) {
+	if len(first.Turns) == 0 {
+		return nil, nil
+	}
+	to := request.To
+	if to == 0 || to > first.Latest {
+		to = first.Latest
+	}
+	step := (to-first.Turns[0].Turn)/chartPoints + 1
+	var sampled []stubs.TurnStats
+	response := first
+	for {
+		for _, turn := range response.Turns {
+			if (turn.Turn-first.Turns[0].Turn)%step == 0 || turn.Turn == to {
+				sampled = append(sampled, turn)
+			}
+		}
+		if len(response.Turns) == 0 || response.Next > to {
+			return sampled, nil
+		}
+		request.From, request.Limit = response.Next, 100*chartPoints
+		response = new(stubs.HistoryResponse)
+		_ = new(SecretBrokerOperation).History(request, response)
+		if err := response.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// chartSVG draws the population of each turn as a line, with the turns and populations at its ends labelled
+func chartSVG(gameID string, turns []stubs.TurnStats) string {
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`, chartWidth, chartHeight)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="white"/>`, chartWidth, chartHeight)
+	title := "Population"
+	if gameID != "" {
+		title += " of game " + html.EscapeString(gameID)
+	}
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle" font-size="14">%s</text>`, chartWidth/2, chartMargin/2, title)
+	left, right, top, bottom := chartMargin, chartWidth-chartMargin/2, chartMargin, chartHeight-chartMargin
+	fmt.Fprintf(&svg, `<polyline points="%d,%d %d,%d %d,%d" fill="none" stroke="black"/>`, left, top, left, bottom, right, bottom)
+	if len(turns) == 0 {
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle">No turns yet</text></svg>`, chartWidth/2, chartHeight/2)
+		return svg.String()
+	}
+	firstTurn, lastTurn, most := turns[0].Turn, turns[len(turns)-1].Turn, 1
+	for _, turn := range turns {
+		if turn.Population > most {
+			most = turn.Population
+		}
+	}
+	x := func(turn int) float64 {
+		if lastTurn == firstTurn {
+			return float64(left)
+		}
+		return float64(left) + float64(right-left)*float64(turn-firstTurn)/float64(lastTurn-firstTurn)
+	}
+	y := func(population int) float64 {
+		return float64(bottom) - float64(bottom-top)*float64(population)/float64(most)
+	}
+	svg.WriteString(`<polyline fill="none" stroke="steelblue" stroke-width="1.5" points="`)
+	for _, turn := range turns {
+		fmt.Fprintf(&svg, "%.1f,%.1f ", x(turn.Turn), y(turn.Population))
+	}
+	svg.WriteString(`"/>`)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%d</text>`, left-6, top+4, most)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">0</text>`, left-6, bottom+4)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d">%d</text>`, left, bottom+18, firstTurn)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%d</text>`, right, bottom+18, lastTurn)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle">turn</text>`, (left+right)/2, bottom+36)
+	last := turns[len(turns)-1]
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%d alive after turn %d</text>`, right, top-8, last.Population, last.Turn)
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
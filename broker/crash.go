@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"uk.ac.bris.cs/gameoflife/crash"
+)
+
+// dumpOnPanic saves the game being played if the goroutine is panicking, then carries on panicking
+// Deferred at the start of every goroutine that advances a game, so hours of turns can be picked up again from the dump
+// rather than lost. The game's mutex may be held by the code that panicked, so the game is read without it.
+func dumpOnPanic(game *Game) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := debug.Stack()
+	dump := crash.Dump{Role: "broker"}
+	if game != nil {
+		dump.Turn = game.completedTurns
+		dump.Details = []string{"rule: " + game.rule.String(), "edge: " + game.edge}
+		switch {
+		case game.tiled != nil:
+			dump.WriteTo = game.tiled.store.WritePGM
+		case game.hashlife != nil: // the universe may be what broke, so it is only read whilst writing the board
+			dump.WriteTo = func(path string) error {
+				cells, _, _ := game.hashLifeBoard()
+				return crash.WritePGM(path, cells)
+			}
+		case game.current != nil:
+			dump.Board = game.current.cells
+			if game.strips != nil { // the board is from the turn it was last fetched at
+				dump.Turn = game.strips.fetched
+			}
+			if game.expand {
+				dump.Details = append(dump.Details, fmt.Sprintf("starting board at: %d,%d", game.originX, game.originY))
+			}
+		}
+	}
+	if path, err := crash.Write(dump, recovered, stack); err != nil {
+		log.Println("Crash dump error:", err)
+	} else {
+		log.Println("Crash dump written to", path)
+	}
+	panic(recovered)
+}
@@ -0,0 +1,53 @@
+package broker
+
+import "hash/fnv"
+
+// cycleDetector remembers the hashes of the boards from the last few turns, to spot when the game starts repeating
+type cycleDetector struct {
+	window int            // how many previous turns to remember
+	turns  map[uint64]int // the turn each remembered hash was seen on
+	order  []uint64       // the remembered hashes, oldest first
+	start  int            // the first turn of the cycle, once one has been found
+	period int            // the length of the cycle, 0 until one has been found
+}
+
+func newCycleDetector(window int) *cycleDetector {
+	return &cycleDetector{window: window, turns: make(map[uint64]int)}
+}
+
+// add records the hash of the board after the given turn, returning true the first time a cycle is found
+func (detector *cycleDetector) add(hash uint64, turn int) bool {
+	if detector.window <= 0 || detector.period > 0 {
+		return false
+	}
+	if seen, ok := detector.turns[hash]; ok {
+		detector.start = seen
+		detector.period = turn - seen
+		return true
+	}
+	detector.turns[hash] = turn
+	detector.order = append(detector.order, hash)
+	if len(detector.order) > detector.window { // forget the oldest turn
+		delete(detector.turns, detector.order[0])
+		detector.order = detector.order[1:]
+	}
+	return false
+}
+
+// hash summarises the board so boards from different turns can be compared cheaply
+func (board *Board) hash() uint64 {
+	h := fnv.New64a()
+	for _, row := range board.cells {
+		_, _ = h.Write(row) // writing to a hash never fails
+	}
+	return h.Sum64()
+}
+
+// checkCycle records the current board, returning true the first time the game is found to be repeating
+// Must be called with the game locked, after the boards have been swapped.
+func (game *Game) checkCycle() bool {
+	if game.cycles.window <= 0 || game.noise.Enabled() { // random births and deaths mean repeats aren't cycles
+		return false
+	}
+	return game.cycles.add(game.current.hash(), game.completedTurns)
+}
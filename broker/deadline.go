@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// lockBy locks the game for a request, giving up if the request's deadline passes first, as it can while
+// a long turn on an overloaded worker holds the lock
+func (game *Game) lockBy(header stubs.Header) error {
+	if header.Deadline.IsZero() {
+		game.mutex.Lock()
+		return nil
+	}
+	locked := make(chan struct{})
+	go func() {
+		game.mutex.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-time.After(time.Until(header.Deadline)):
+		go func() { // hand the lock straight back once it comes
+			<-locked
+			game.mutex.Unlock()
+		}()
+		return stubs.Errorf(stubs.DeadlineExceeded, "turn %d of game %s is still running", game.completedTurns+1, game.id)
+	}
+}
+
+// pastDeadline reports whether the deadline of the request that started the game has passed
+func (game *Game) pastDeadline() bool {
+	return !game.deadline.IsZero() && time.Now().After(game.deadline)
+}
+
+// stopAtDeadline ends the game early when err is a worker giving up at the game's deadline, which isn't a failure:
+// the game stops at the last turn every worker finished
+func (game *Game) stopAtDeadline(err error) error {
+	if stubs.Code(err) == stubs.DeadlineExceeded {
+		game.stopReason = stubs.StopDeadline
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package broker
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// detachFrom lets a game carry on once its controller has gone, as it asked to be finished either way
+func (game *Game) detachFrom(reason string) {
+	if atomic.CompareAndSwapInt32(&game.detached, 0, 1) {
+		log.Printf("Game %s: controller %s, finishing the game without it", game.id, reason)
+	}
+}
+
+// writeDetached writes the board of a game that finished without its controller to out, as nobody else will
+// Must be called with the game locked.
+func (game *Game) writeDetached() {
+	if atomic.LoadInt32(&game.detached) == 0 {
+		return
+	}
+	if game.tiled != nil { // startTiledGame writes the image on the broker anyway
+		return
+	}
+	path, err := game.checkpoint()
+	if err != nil {
+		log.Printf("Game %s: error writing the finished board: %v", game.id, err)
+		return
+	}
+	log.Printf("Game %s: finished at turn %d without its controller, board written to %s", game.id, game.completedTurns, path)
+}
@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// diagnosticsTimeout is how long a worker has to answer, so one stuck worker doesn't hide the others
+const diagnosticsTimeout = 5 * time.Second
+
+// Diagnostics gathers the runtime state and recent log of the broker and each of its workers,
+// so a misbehaving remote worker can be looked at without logging in to it
+func (s *SecretBrokerOperation) Diagnostics(request stubs.DiagnosticsRequest, response *stubs.DiagnosticsResponse) (err error) {
+	response.Header = request.Header
+	response.Broker = config.Diagnose(request.Lines)
+	addresses := listWorkers()
+	response.Workers = make([]stubs.Diagnostics, len(addresses))
+	done := make(chan bool)
+	for i, address := range addresses {
+		go func(i int, address string) {
+			response.Workers[i] = workerDiagnostics(address, request)
+			done <- true
+		}(i, address)
+	}
+	for range addresses {
+		<-done
+	}
+	return
+}
+
+// workerDiagnostics fetches one worker's diagnostics, describing what went wrong in place of them if it can't
+func workerDiagnostics(address string, request stubs.DiagnosticsRequest) stubs.Diagnostics {
+	failed := func(err error) stubs.Diagnostics {
+		return stubs.Diagnostics{Address: address, Error: err.Error()}
+	}
+	connection, err := stubs.DialTimeout(address, diagnosticsTimeout)
+	if err != nil {
+		return failed(err)
+	}
+	client := &stubs.Worker{Client: connection}
+	defer client.Close()
+	var diagnostics stubs.Diagnostics
+	call := client.GoDiagnostics(request, &diagnostics, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return failed(call.Error)
+		}
+	case <-time.After(diagnosticsTimeout):
+		return failed(fmt.Errorf("no reply after %v", diagnosticsTimeout))
+	}
+	diagnostics.Address = address
+	return diagnostics
+}
@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"log"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// SetCells changes cells of the running game's board once its current turn has finished
+func (s *SecretBrokerOperation) SetCells(req stubs.SetCellsRequest, res *stubs.SetCellsResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	return game.applyEdits(req.Header, req.Controller, req.Cells, res)
+}
+
+// InjectPattern places a pattern on the running game's board once its current turn has finished
+func (s *SecretBrokerOperation) InjectPattern(req stubs.InjectPatternRequest, res *stubs.SetCellsResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	rows := req.Rows
+	if req.Name != "" {
+		var known bool
+		if rows, known = census.Pattern(req.Name); !known {
+			return stubs.Errorf(stubs.InvalidParams, "no pattern is called %q", req.Name)
+		}
+	}
+	var edits []stubs.CellEdit
+	for dy, row := range rows {
+		for dx, cell := range row {
+			edit := stubs.CellEdit{X: req.X + dx, Y: req.Y + dy}
+			switch cell {
+			case '#', 'O':
+				edit.Value = game.rule.Value(1)
+			case '.':
+			default:
+				return stubs.Errorf(stubs.InvalidParams, "row %d of the pattern has %q, expected # or O for alive cells and . for dead ones", dy+1, cell)
+			}
+			edits = append(edits, edit)
+		}
+	}
+	return game.applyEdits(req.Header, req.Controller, edits, res)
+}
+
+// applyEdits makes a controller's edits between two turns, once every one has been checked, as the workers are sent
+// the whole board each turn and so pick them up with the next
+func (game *Game) applyEdits(header stubs.Header, controller string, edits []stubs.CellEdit, res *stubs.SetCellsResponse) error {
+	if game.tiled != nil || game.hashlife != nil {
+		return stubs.Errorf(stubs.InvalidParams, "cells can't be set on tiled boards or with the hashlife engine")
+	}
+	if err := game.lockBy(header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	if err := game.mayWrite(controller); err != nil {
+		return err
+	}
+	game.fetchStrips()
+	for _, edit := range edits {
+		if edit.X < 0 || edit.Y < 0 || edit.X >= game.current.width || edit.Y >= game.current.height {
+			return stubs.Errorf(stubs.InvalidParams, "cell %d,%d is outside the %dx%d board", edit.X, edit.Y, game.current.width, game.current.height)
+		}
+		if game.rule.Value(game.rule.State(edit.Value)) != edit.Value {
+			return stubs.Errorf(stubs.InvalidParams, "%d isn't the value of a state of %s", edit.Value, game.rule)
+		}
+	}
+	for _, edit := range edits {
+		if game.current.cells[edit.Y][edit.X] != edit.Value {
+			game.setCell(edit.X, edit.Y, edit.Value)
+			res.Changed++
+		}
+	}
+	res.CompletedTurns = game.completedTurns
+	if res.Changed > 0 {
+		game.boardReplaced()
+		game.streamTurn()
+	}
+	game.boardChanged()
+	log.Printf("Game %s: %d cells changed after turn %d", game.id, res.Changed, game.completedTurns)
+	return nil
+}
+
+// setCell changes a cell of the current board, keeping the population in step and starting the cell's age again
+// if it came alive or died. Must be called with the game locked.
+func (game *Game) setCell(x int, y int, value uint8) {
+	was, is := game.aliveValues[game.current.cells[y][x]], game.aliveValues[value]
+	if is != was {
+		if is {
+			game.alive++
+		} else {
+			game.alive--
+		}
+		if game.ages != nil {
+			game.ages[y][x] = 0
+		}
+	}
+	game.current.cells[y][x] = value
+}
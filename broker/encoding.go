@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"log"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// linkWeight is how far each section's measurement moves the speed the broker has for a link
+const linkWeight = 0.3
+
+// encodingLink is what the broker has seen of sending boards to one worker over a game, for choosing encodings by
+type encodingLink struct {
+	bytesPerSecond float64         // how fast sections have gone to the worker and back, 0 until measured
+	encoding       stubs.Encoding  // what the worker was last sent the board in
+	keeping        bool            // whether the worker was asked to keep the board it was sent this turn
+	base           *stubs.Checksum // of the board the worker kept, for the next to be sent as a delta from, nil if none
+}
+
+// boardEncodings is how a game sends its board to its workers packed in encodings, see Options.Encodings
+type boardEncodings struct {
+	links   map[string]*encodingLink // by worker address
+	sent    [][]uint8                // a copy of the board the workers were last sent, which deltas are from
+	sentSum *stubs.Checksum
+}
+
+// link gives what the game has seen of sending boards to a worker
+func (encodings *boardEncodings) link(address string) *encodingLink {
+	if encodings.links == nil {
+		encodings.links = make(map[string]*encodingLink)
+	}
+	if encodings.links[address] == nil {
+		encodings.links[address] = &encodingLink{encoding: stubs.Dense}
+	}
+	return encodings.links[address]
+}
+
+// encodeBoard sends a worker the board in whichever encoding should get it there fastest, given the board's
+// density, how much of it changed last turn and how fast the link to the worker has been, and lets the worker send
+// its section back in one. packed has the board in each encoding already used this turn, so it's only packed once.
+func (game *Game) encodeBoard(request *stubs.WorkerRequest, worker *stubs.Worker, packed map[stubs.Encoding]*stubs.EncodedBoard) {
+	link := game.encodings.link(worker.Address)
+	link.keeping = false
+	if len(options.Encodings) == 0 || !worker.Capabilities.Has(stubs.PackedBoards) {
+		return
+	}
+	request.Encodings, request.BytesPerSecond = options.Encodings, link.bytesPerSecond
+	link.keeping = options.Encodings.Has(stubs.Delta)
+	allowed := options.Encodings
+	if !link.base.Same(game.encodings.sentSum) { // the worker hasn't the board a delta would be from
+		allowed = nil
+		for _, encoding := range options.Encodings {
+			if encoding != stubs.Delta {
+				allowed = append(allowed, encoding)
+			}
+		}
+	}
+	board := game.current
+	cells := board.width * board.height
+	encoding := stubs.ChooseEncoding(allowed, cells, game.alive, game.births+game.deaths, link.bytesPerSecond)
+	if encoding != stubs.Dense && packed[encoding] == nil {
+		encoded, ok := stubs.Encode(board.cells, encoding, game.encodings.sent)
+		if !ok || len(encoded.Data) >= cells { // it can't be packed that way, or packing it didn't make it smaller
+			encoded = nil
+		} else if encoding == stubs.Delta {
+			encoded.Base = game.encodings.sentSum
+		}
+		packed[encoding] = encoded
+	}
+	if encoding != stubs.Dense && packed[encoding] == nil {
+		encoding = stubs.Dense
+	}
+	if encoding != stubs.Dense {
+		request.Board, request.CurrentBoard = packed[encoding], nil
+	}
+	if encoding != link.encoding {
+		log.Printf("Game %s: sending worker %s the board %s from turn %d", game.id, worker.Address, describeEncoding(encoding), game.completedTurns)
+		link.encoding = encoding
+	}
+}
+
+// describeEncoding says how a board is sent in an encoding, for the log
+func describeEncoding(encoding stubs.Encoding) string {
+	switch encoding {
+	case stubs.BitPacked:
+		return "bit-packed"
+	case stubs.Sparse:
+		return "as its alive cells"
+	case stubs.Delta:
+		return "as the cells that changed"
+	default:
+		return "whole"
+	}
+}
+
+// keepSent copies the board the workers have been sent, once they have all been sent it, if any were asked to keep
+// it, so the next can be sent to them as a delta from it
+func (game *Game) keepSent(workerClients []*stubs.Worker, checksum *stubs.Checksum) {
+	keeping := false
+	for _, worker := range workerClients {
+		keeping = keeping || game.encodings.link(worker.Address).keeping
+	}
+	if !keeping {
+		return
+	}
+	board, sent := game.current, game.encodings.sent
+	if len(sent) != board.height || board.height > 0 && len(sent[0]) != board.width {
+		sent = make([][]uint8, board.height)
+		for y := range sent {
+			sent[y] = make([]uint8, board.width)
+		}
+	}
+	for y, row := range board.cells {
+		copy(sent[y], row)
+	}
+	game.encodings.sent, game.encodings.sentSum = sent, checksum
+}
+
+// answered notes whether a worker advanced its section, after which it has kept the board it was sent if asked to
+func (game *Game) answered(worker *stubs.Worker, ok bool) {
+	link := game.encodings.link(worker.Address)
+	link.base = nil
+	if ok && link.keeping {
+		link.base = game.encodings.sentSum
+	}
+}
+
+// decodeSections unpacks the sections workers sent back in an encoding into their responses, checking each against
+// the checksum the worker sent, so the rest of the turn carries on as if they had been sent as they are. It also
+// measures how fast each link has been, from the bytes each section took to send and get back.
+func (game *Game) decodeSections(responses []*stubs.WorkerResponse, bounds [][2]int, calls []*sectionCall, workerClients []*stubs.Worker) error {
+	for i, response := range responses {
+		link := game.encodings.link(workerClients[i].Address)
+		if wire := calls[i].took - response.Compute; wire > time.Millisecond && calls[i].encoding != "" {
+			measured := float64(calls[i].traffic.Sent+calls[i].traffic.Received) / wire.Seconds()
+			if link.bytesPerSecond == 0 {
+				link.bytesPerSecond = measured
+			} else {
+				link.bytesPerSecond += linkWeight * (measured - link.bytesPerSecond)
+			}
+		}
+		if response.Section == nil {
+			continue
+		}
+		var base [][]uint8
+		if response.Section.Encoding == stubs.Delta { // from the section as it was sent
+			base = game.current.cells[bounds[i][0]:bounds[i][1]]
+		}
+		section, err := response.Section.Decode(base)
+		if err == nil {
+			err = response.Checksum.Verify(section)
+		}
+		if err != nil {
+			return stubs.Errorf(stubs.WorkerUnavailable, "worker %s's section of turn %d: %v", workerClients[i].Address, game.completedTurns, err)
+		}
+		response.AdvancedMiniBoard = section
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package broker
+
+import "io"
+
+// writeKept writes a file the broker keeps, such as a checkpoint, encrypting it with Options.EncryptionKey if there is one
+func writeKept(path string, write func(w io.Writer) error) error {
+	file, err := options.EncryptionKey.Create(path, false)
+	if err != nil {
+		return err
+	}
+	if err = write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,90 @@
+package broker
+
+import "log"
+
+// maxExpandedSize is the largest an expanding board can grow to in either direction
+const maxExpandedSize = 16384
+
+// minGrowth is the fewest rows or columns added at a time, so the board isn't regrown every turn
+const minGrowth = 16
+
+// growIfNeeded makes an expanding board bigger on every side where alive cells are close enough to the edge
+// that the next turn could need cells beyond it. Workers treat the edge as dead, so this keeps the board
+// behaving as if it were unbounded. Must be called with the game locked, after the boards have been swapped.
+func (game *Game) growIfNeeded() {
+	if !game.expand {
+		return
+	}
+	margin := game.rule.Radius
+	growth := 2 * margin
+	if growth < minGrowth {
+		growth = minGrowth
+	}
+	width, height := game.current.width, game.current.height
+	var left, right, top, bottom int
+	for y, row := range game.current.cells {
+		for x, value := range row {
+			if !game.aliveValues[value] {
+				continue
+			}
+			if x < margin {
+				left = growth
+			}
+			if x >= width-margin {
+				right = growth
+			}
+			if y < margin {
+				top = growth
+			}
+			if y >= height-margin {
+				bottom = growth
+			}
+		}
+	}
+	if width+left+right > maxExpandedSize || height+top+bottom > maxExpandedSize {
+		if !game.expandLimitReached {
+			log.Println("Expanding board has reached its maximum size, cells beyond the edge will be lost")
+			game.expandLimitReached = true
+		}
+		if width+left+right > maxExpandedSize {
+			left, right = 0, 0
+		}
+		if height+top+bottom > maxExpandedSize {
+			top, bottom = 0, 0
+		}
+	}
+	if left+right+top+bottom == 0 {
+		return
+	}
+
+	newWidth, newHeight := width+left+right, height+top+bottom
+	game.current = game.current.padded(left, top, newWidth, newHeight)
+	game.advanced = createBoard(newWidth, newHeight)
+	game.advanced.rule = game.rule
+	game.ages = paddedCounts(game.ages, left, top, newWidth, newHeight)
+	if game.flips != nil {
+		game.flips = paddedCounts(game.flips, left, top, newWidth, newHeight)
+	}
+	game.originX += left
+	game.originY += top
+}
+
+// paddedCounts copies a count for each cell, such as their ages, into a bigger grid, with its top left corner at
+// (left, top) and the new cells counting 0
+func paddedCounts(counts [][]uint32, left int, top int, width int, height int) [][]uint32 {
+	bigger := createAges(width, height)
+	for y, row := range counts {
+		copy(bigger[y+top][left:], row)
+	}
+	return bigger
+}
+
+// padded copies the board into a bigger board, with its top left corner at (left, top)
+func (board *Board) padded(left int, top int, width int, height int) *Board {
+	bigger := createBoard(width, height)
+	bigger.rule = board.rule
+	for y, row := range board.cells {
+		copy(bigger.cells[y+top][left:], row)
+	}
+	return bigger
+}
@@ -0,0 +1,257 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// DefaultHaloEvery is how many turns apart halo games fetch their whole board if no other number is given
+const DefaultHaloEvery = 100
+
+// haloStrips is how a halo game's board is split between the workers that keep it, see StartGameRequest.Halo
+// Each worker keeps a strip of rows between turns, and is only sent the rule's radius of rows either side of it
+// each turn, which the broker has from the first and last rows of the strips around it. The game's board is only
+// fetched from the workers when it is needed, such as for CurrentBoard, and every Options.HaloEvery turns, so it
+// is always the board of the turn it was last fetched at. If a worker's strip is lost the game goes back to that
+// turn, and its strips are loaded again onto the workers left.
+type haloStrips struct {
+	workers []*stubs.Worker // the worker keeping each strip, down the board, nil until they are loaded from the board
+	bounds  [][2]int        // the rows of each strip
+	edges   map[int][]uint8 // the first and last rows of each strip as of the game's turn, by row
+	fetched int             // the turn of the game's board
+	stats   stubs.TurnStats // the statistics of that turn, to go back to
+}
+
+// validateHalo rejects the options that need the whole board every turn, or that keep it anywhere but the workers
+func validateHalo(req stubs.StartGameRequest, rule rules.Rule) error {
+	if req.TileSize > 0 || req.Engine == stubs.EngineHashLife {
+		return fmt.Errorf("halo games can't be tiled or use the hashlife engine")
+	}
+	if req.IncludeAges || req.StopEarly || req.CycleWindow > 0 || req.Census || len(req.StopConditions) > 0 || req.Expand || req.Heatmap || req.SharedImage {
+		return fmt.Errorf("ages, stopping early, cycle detection, census, stop conditions, expanding, heatmaps and shared images aren't supported in halo games")
+	}
+	if req.Height < rule.Radius {
+		return fmt.Errorf("the board is %d rows tall, fewer than the rule's radius of %d", req.Height, rule.Radius)
+	}
+	return nil
+}
+
+// newHaloStrips starts a halo game's strips, to be loaded onto the workers with its first turn
+func (game *Game) newHaloStrips() *haloStrips {
+	return &haloStrips{fetched: game.completedTurns, stats: game.turnStats()}
+}
+
+// stripsLoaded checks whether the game's strips are kept by the workers given, in order, as many as it can use
+func (game *Game) stripsLoaded(workerClients []*stubs.Worker) bool {
+	strips := game.strips
+	if strips.workers == nil || len(strips.workers) != game.stripCount(len(workerClients)) {
+		return false
+	}
+	for i, worker := range strips.workers {
+		if workerClients[i] != worker {
+			return false
+		}
+	}
+	return true
+}
+
+// stripCount gives how many strips the game's board is split into between the workers, every strip having to be at
+// least as tall as the halo
+func (game *Game) stripCount(workers int) int {
+	if most := game.current.height / game.rule.Radius; workers > most {
+		return most
+	}
+	return workers
+}
+
+// advanceStrips has each worker advance its strip by a turn, first loading the board onto the workers given if they
+// don't already keep it. Must be called with the game locked.
+func (game *Game) advanceStrips(workerClients []*stubs.Worker) error {
+	strips := game.strips
+	if !game.stripsLoaded(workerClients) {
+		game.fetchStrips() // from the workers that kept them, before they are split differently
+		if err := game.loadStrips(workerClients); err != nil {
+			return game.loseStrips(err)
+		}
+	}
+	edge, err := rules.ParseEdge(game.edge)
+	if err != nil {
+		return err
+	}
+	halo := game.rule.Radius
+	doneChannels := make([]chan *rpc.Call, len(strips.workers))
+	responses := make([]*stubs.HaloResponse, len(strips.workers))
+	for i, worker := range strips.workers {
+		startY, endY := strips.bounds[i][0], strips.bounds[i][1]
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/%d/%d", game.id, game.completedTurns, i), Deadline: game.deadline}
+		request := stubs.HaloRequest{Header: header, Turn: game.completedTurns,
+			Above: game.haloRows(startY-halo, startY, edge), Below: game.haloRows(endY, endY+halo, edge)}
+		responses[i], doneChannels[i] = new(stubs.HaloResponse), make(chan *rpc.Call, 1)
+		worker.GoAdvanceStrip(request, responses[i], doneChannels[i])
+	}
+	game.births, game.deaths = 0, 0
+	for i, worker := range strips.workers {
+		call, cancelled := awaitCall(doneChannels[i], game.completedTurns)
+		if cancelled != nil {
+			return game.loseStrips(cancelled)
+		}
+		if call.Error != nil {
+			if stubs.Code(call.Error) == stubs.DeadlineExceeded {
+				return game.loseStrips(call.Error)
+			}
+			return game.loseStrips(stubs.Errorf(stubs.WorkerUnavailable, "worker %s failed turn %d: %v", worker.Address, game.completedTurns, call.Error))
+		}
+		game.births += responses[i].Births
+		game.deaths += responses[i].Deaths
+	}
+	for i, response := range responses {
+		startY, endY := strips.bounds[i][0], strips.bounds[i][1]
+		for y, row := range response.Top {
+			strips.edges[startY+y] = row
+		}
+		for y, row := range response.Bottom {
+			strips.edges[endY-halo+y] = row
+		}
+	}
+	game.alive += game.births - game.deaths
+	return nil
+}
+
+// executeHaloTurn advances a halo game by a turn on the workers keeping its strips. Must be called with the game
+// locked.
+func (game *Game) executeHaloTurn(workerClients []*stubs.Worker) error {
+	start := time.Now()
+	if err := game.advanceStrips(workerClients); err != nil {
+		return game.stopAtDeadline(err)
+	}
+	game.completedTurns++
+	game.runHook()
+	game.history.record(game.turnStats())
+	game.timer.turnDone(game.completedTurns, start)
+	game.fetchEvery()
+	game.boardChanged()
+	return nil
+}
+
+// haloRows gives the rows from to to around a strip, as the board's edge makes them, from the strips' first and last
+// rows. Strips are at least as tall as the halo, so these are always the rows of the strips either side of it.
+func (game *Game) haloRows(from int, to int, edge rules.Edge) [][]uint8 {
+	rows := make([][]uint8, 0, to-from)
+	for y := from; y < to; y++ {
+		row, inside := edge.Resolve(y, game.current.height)
+		if !inside {
+			rows = append(rows, make([]uint8, game.current.width))
+			continue
+		}
+		rows = append(rows, game.strips.edges[row])
+	}
+	return rows
+}
+
+// loadStrips splits the game's board into a strip for each worker, as many as the board has rows for, and gives each
+// worker its strip to keep. Must be called with the game locked, once the board is up to date.
+func (game *Game) loadStrips(workerClients []*stubs.Worker) error {
+	strips, board := game.strips, game.current
+	workers := game.stripCount(len(workerClients))
+	strips.workers, strips.bounds, strips.edges = nil, nil, make(map[int][]uint8)
+	doneChannels := make([]chan *rpc.Call, workers)
+	for i := 0; i < workers; i++ {
+		startY, endY := i*board.height/workers, (i+1)*board.height/workers
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/%d/load/%d", game.id, game.completedTurns, i), Deadline: game.deadline}
+		rows := board.cells[startY:endY]
+		request := stubs.StripRequest{Header: header, StartY: startY, EndY: endY, Rows: rows, Checksum: stubs.Sum(rows),
+			Width: board.width, Height: board.height, Rule: game.rule.String(), Edge: game.edge, Turn: game.completedTurns,
+			OriginX: game.originX, OriginY: game.originY, Seed: game.noise.Seed, BirthProbability: game.noise.Birth, DeathProbability: game.noise.Death}
+		doneChannels[i] = make(chan *rpc.Call, 1)
+		workerClients[i].GoLoadStrip(request, new(stubs.StripResponse), doneChannels[i])
+		strips.bounds = append(strips.bounds, [2]int{startY, endY})
+		for y := startY; y < endY; y++ {
+			if y < startY+game.rule.Radius || y >= endY-game.rule.Radius {
+				strips.edges[y] = board.cells[y]
+			}
+		}
+	}
+	for i := 0; i < workers; i++ {
+		call, cancelled := awaitCall(doneChannels[i], game.completedTurns)
+		if cancelled != nil {
+			return cancelled
+		}
+		if call.Error != nil {
+			return stubs.Errorf(stubs.WorkerUnavailable, "worker %s couldn't keep its strip: %v", workerClients[i].Address, call.Error)
+		}
+	}
+	strips.workers = workerClients[:workers]
+	log.Printf("Game %s: %d workers keep strips of the board from turn %d", game.id, workers, game.completedTurns)
+	return nil
+}
+
+// fetchStrips brings the board of a halo game up to date with the strips its workers keep, if it isn't already.
+// If any strip can't be fetched the game goes back to the turn the board is from. Must be called with the game locked.
+func (game *Game) fetchStrips() {
+	strips := game.strips
+	if strips == nil || strips.workers == nil || strips.fetched == game.completedTurns {
+		return
+	}
+	doneChannels := make([]chan *rpc.Call, len(strips.workers))
+	responses := make([]*stubs.FetchStripResponse, len(strips.workers))
+	for i, worker := range strips.workers {
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/%d/fetch/%d", game.id, game.completedTurns, i)}
+		responses[i], doneChannels[i] = new(stubs.FetchStripResponse), make(chan *rpc.Call, 1)
+		worker.GoFetchStrip(stubs.FetchStripRequest{Header: header, Turn: game.completedTurns}, responses[i], doneChannels[i])
+	}
+	for i, worker := range strips.workers {
+		call, err := awaitCall(doneChannels[i], game.completedTurns)
+		if err == nil && call.Error != nil {
+			err = call.Error
+		}
+		if err == nil && len(responses[i].Rows) != strips.bounds[i][1]-strips.bounds[i][0] {
+			err = fmt.Errorf("sent %d rows", len(responses[i].Rows))
+		}
+		if err != nil {
+			_ = game.loseStrips(fmt.Errorf("can't fetch the strip kept by worker %s: %v", worker.Address, err))
+			return
+		}
+	}
+	for i, response := range responses { // the board is only changed once every strip has come back
+		copy(game.current.cells[strips.bounds[i][0]:], response.Rows)
+	}
+	strips.fetched, strips.stats = game.completedTurns, game.turnStats()
+}
+
+// loseStrips takes a halo game back to the turn its board is from, after its strips can't be advanced or fetched,
+// so the turns from there are worked out again by the workers the strips are next loaded onto. It gives back err.
+func (game *Game) loseStrips(err error) error {
+	strips := game.strips
+	if strips.workers != nil && game.completedTurns != strips.fetched {
+		log.Printf("Game %s: going back to turn %d, as the workers' strips are lost: %v", game.id, strips.fetched, err)
+	}
+	strips.workers = nil
+	game.completedTurns = strips.fetched
+	game.alive, game.births, game.deaths = strips.stats.Population, strips.stats.Births, strips.stats.Deaths
+	game.history.rewind(strips.stats)
+	return err
+}
+
+// boardReplaced loads a halo game's strips again from its board, after the broker changed it, such as with edits
+// or a hook, and has every row worked out next turn. Must be called with the game locked.
+func (game *Game) boardReplaced() {
+	game.quiet.forget()
+	if game.strips == nil {
+		return
+	}
+	game.strips.workers = nil
+	game.strips.fetched, game.strips.stats = game.completedTurns, game.turnStats()
+}
+
+// fetchEvery fetches a halo game's board every Options.HaloEvery turns, which is as far back as it goes if a strip is
+// lost. Must be called with the game locked.
+func (game *Game) fetchEvery() {
+	if options.HaloEvery > 0 && game.completedTurns-game.strips.fetched >= options.HaloEvery {
+		game.fetchStrips()
+	}
+}
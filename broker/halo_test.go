@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestLoseStrips checks a halo game whose worker goes part way between fetches goes back to the turn it last fetched
+// its board at, and works the turns from there out again on the worker that takes its place, finishing with the
+// board and population it would have had anyway.
+func TestLoseStrips(t *testing.T) {
+	served := useWorkers(t, 1)
+	options.MinWorkers = 1
+	replacement := serveWorker(t)
+	const turns = 300
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3, 21, 20, 22, 21, 20, 22, 21, 22, 22, 22) // a blinker and a glider
+	id := gameID(t)
+	finished := startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: turns, Halo: true})
+	paused := pauseAfter(t, id, 10)
+	if paused >= options.HaloEvery {
+		t.Fatalf("paused at turn %d, after the board was fetched at turn %d", paused, options.HaloEvery)
+	}
+	served[0].kill()
+	setWorkers([]string{replacement.address})
+	resume(t, id)
+	result := finish(t, finished)
+	want := step(start, turns)
+	sameBoard(t, result.FinishedBoard, want)
+	alive := 0
+	for _, row := range want {
+		for _, cell := range row {
+			if cell == 255 {
+				alive++
+			}
+		}
+	}
+	if result.CompletedTurns != turns || result.AliveCount != alive {
+		t.Fatalf("completed %d turns with %d cells alive, want %d turns with %d alive", result.CompletedTurns, result.AliveCount, turns, alive)
+	}
+}
@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"fmt"
+
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// validateHashLife rejects the options that need every turn to be worked out
+func validateHashLife(req stubs.StartGameRequest) error {
+	if req.Seed != 0 && (req.BirthProbability > 0 || req.DeathProbability > 0) {
+		return fmt.Errorf("random births and deaths aren't supported by the hashlife engine")
+	}
+	if req.IncludeAges || req.StopEarly || req.CycleWindow > 0 || len(req.StopConditions) > 0 || req.TileSize > 0 || req.Heatmap {
+		return fmt.Errorf("ages, stopping early, cycle detection, stop conditions, tiles and heatmaps aren't supported by the hashlife engine")
+	}
+	return nil
+}
+
+// createHashLifeGame loads the starting board into an unbounded HashLife universe
+func createHashLifeGame(req stubs.StartGameRequest, rule rules.Rule) (*Game, error) {
+	universe, err := hashlife.New(rule)
+	if err != nil {
+		return nil, err
+	}
+	universe.Load(req.StartingBoard, rule.Alive)
+	var aliveValues [256]bool
+	for value := range aliveValues {
+		aliveValues[value] = rule.Alive(uint8(value))
+	}
+	return &Game{
+		rule:           rule,
+		edge:           rules.Dead.String(),
+		aliveValues:    aliveValues,
+		census:         req.Census,
+		hashlife:       universe,
+		width:          req.Width,
+		height:         req.Height,
+		id:             req.GameID,
+		deadline:       req.Deadline,
+		detach:         req.Detach,
+		priority:       req.Priority,
+		completedTurns: req.StartTurn,
+	}, nil
+}
+
+// hashLifeStep is how many turns to jump next, the largest power of two that doesn't pass the turn count
+// Jumping by powers of two is what HashLife does fastest, and keeps the game responsive between jumps.
+func hashLifeStep(completed int, turns int) int {
+	step := 1
+	for step*2 <= turns-completed {
+		step *= 2
+	}
+	return step
+}
+
+// hashLifeBoard gives the part of the universe holding the starting board and every alive cell,
+// along with where the starting board's top left cell is within it
+// Patterns can spread much further than a board can be sent, so it is no bigger than an expanding board can grow.
+func (game *Game) hashLifeBoard() (cells [][]uint8, originX int, originY int) {
+	left, top, right, bottom := 0, 0, game.width, game.height
+	if x, y, width, height, ok := game.hashlife.Bounds(); ok {
+		left, right = hashLifeSpan(x, x+width, game.width)
+		top, bottom = hashLifeSpan(y, y+height, game.height)
+	}
+	return game.hashlife.Cells(left, top, right-left, bottom-top), -left, -top
+}
+
+// hashLifeSpan extends the span of the starting board along one side to cover the alive cells from start up to end,
+// keeping the starting board in the middle of it if it would be bigger than maxExpandedSize
+func hashLifeSpan(start int, end int, size int) (int, int) {
+	low, high := 0, size
+	if start < low {
+		low = start
+	}
+	if end > high {
+		high = end
+	}
+	if high-low > maxExpandedSize && size < maxExpandedSize {
+		margin := (maxExpandedSize - size) / 2
+		if low < -margin {
+			low = -margin
+		}
+		if high > size+margin {
+			high = size + margin
+		}
+	}
+	return low, high
+}
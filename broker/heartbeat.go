@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/crash"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Heartbeat records that the game's controller is still there
+// Once a controller has sent one, its game is abandoned if they stop for longer than Options.ControllerTimeout.
+func (s *SecretBrokerOperation) Heartbeat(req stubs.HeartbeatRequest, response *stubs.HeartbeatResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&game.lastHeartbeat, time.Now().UnixNano()) // not locked, as a long turn holds the lock
+	return
+}
+
+// watchHeartbeats closes the game's abandoned channel if its controller's heartbeats stop for longer than timeout,
+// until done is closed
+func (game *Game) watchHeartbeats(done chan struct{}, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		last := atomic.LoadInt64(&game.lastHeartbeat)
+		if last != 0 && time.Since(time.Unix(0, last)) > timeout {
+			log.Printf("Game %s: no heartbeat from its controller for %v", game.id, time.Since(time.Unix(0, last)).Round(time.Second))
+			if game.detach {
+				game.detachFrom("stopped sending heartbeats")
+				return
+			}
+			close(game.abandoned)
+			return
+		}
+	}
+}
+
+// abandon stops a game whose controller has gone, writing its board to out first so it can be started again
+// The game ends as if the controller had quit, freeing its place for another.
+func (game *Game) abandon() error {
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	path, err := game.checkpoint()
+	if err != nil {
+		log.Printf("Game %s: checkpoint error: %v", game.id, err)
+		return nil
+	}
+	log.Printf("Game %s: abandoned at turn %d, board written to %s", game.id, game.completedTurns, path)
+	return nil
+}
+
+// checkpoint writes the board as an image in out, named like the controller's images, giving its path
+// The image is encrypted if the broker has Options.EncryptionKey. Must be called with the game locked.
+func (game *Game) checkpoint() (string, error) {
+	if err := os.MkdirAll("out", os.ModePerm); err != nil {
+		return "", err
+	}
+	var width, height int
+	var write func(w io.Writer) error
+	if game.tiled != nil {
+		store := game.tiled.store
+		width, height, write = store.Width, store.Height, store.WritePGMTo
+	} else {
+		game.fetchStrips()
+		cells := game.current.cells
+		if game.hashlife != nil {
+			cells, _, _ = game.hashLifeBoard()
+		}
+		height = len(cells)
+		if height > 0 {
+			width = len(cells[0])
+		}
+		write = func(w io.Writer) error {
+			return crash.WritePGMTo(w, cells)
+		}
+	}
+	path := filepath.Join("out", strconv.Itoa(width)+"x"+strconv.Itoa(height)+"x"+strconv.Itoa(game.completedTurns)+".pgm")
+	return path, writeKept(path, write)
+}
@@ -0,0 +1,17 @@
+package broker
+
+// countFlips counts another flip for every cell that came alive or died on the last turn, for games asked for a
+// heatmap of where the board was active
+// Must be called with the game locked, after the boards have been swapped.
+func (game *Game) countFlips() {
+	if game.flips == nil {
+		return
+	}
+	for y, row := range game.current.cells {
+		for x, value := range row {
+			if game.aliveValues[value] != game.previouslyAlive(x, y) {
+				game.flips[y][x]++
+			}
+		}
+	}
+}
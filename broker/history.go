@@ -0,0 +1,281 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// keptHistories is how many games' turn statistics are kept for History, including the running game's
+const keptHistories = 4
+
+// DefaultHistoryTurns is how many turns of each game's statistics are kept in memory if no limit is given
+const DefaultHistoryTurns = 100000
+
+// history is the statistics of each turn of a game, so an observer that joins late can still see the whole run
+// The latest Options.HistoryTurns are kept in memory, and every turn is written to a CSV file as well if
+// Options.HistoryDirectory is set.
+type history struct {
+	sync.Mutex
+	kept     []stubs.TurnStats // consecutive turns, oldest first
+	first    int               // the first turn recorded, which is the first line of the file
+	path     string            // of the file, empty if turns aren't written to one
+	file     *os.File
+	sealed   io.WriteCloser // encrypts what is written to the file if the broker has Options.EncryptionKey
+	writer   *bufio.Writer
+	finished bool
+}
+
+// histories holds the histories of the last few games, oldest first
+var histories struct {
+	sync.Mutex
+	ids    []string
+	byGame map[string]*history
+}
+
+// newHistory starts recording a game's turn statistics from those of its starting board, forgetting the history
+// of the oldest game kept
+func newHistory(id string, start stubs.TurnStats) *history {
+	h := &history{first: start.Turn}
+	if options.HistoryDirectory != "" {
+		h.path = filepath.Join(options.HistoryDirectory, filepath.Base(id)+".csv")
+		err := os.MkdirAll(options.HistoryDirectory, os.ModePerm)
+		var file *os.File
+		if err == nil {
+			file, err = os.Create(h.path)
+		}
+		if err != nil {
+			log.Printf("Game %s: keeping its history in memory only: %v", id, err)
+			h.path = ""
+		} else {
+			h.file, h.sealed = file, options.EncryptionKey.NewWriter(file, true)
+			h.writer = bufio.NewWriter(h.sealed)
+		}
+	}
+	h.record(start)
+	histories.Lock()
+	defer histories.Unlock()
+	if histories.byGame == nil {
+		histories.byGame = make(map[string]*history)
+	}
+	if histories.byGame[id] == nil {
+		histories.ids = append(histories.ids, id)
+	}
+	histories.byGame[id] = h
+	if len(histories.ids) > keptHistories {
+		delete(histories.byGame, histories.ids[0])
+		histories.ids = histories.ids[1:]
+	}
+	return h
+}
+
+// record adds the statistics of the turn after the last one recorded
+// Once more turns are kept than Options.HistoryTurns the older half are forgotten, though they can still be
+// read from the file if there is one. Games that don't keep a history have a nil one, which records nothing.
+func (h *history) record(stats stubs.TurnStats) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.kept = append(h.kept, stats)
+	if options.HistoryTurns > 0 && len(h.kept) > options.HistoryTurns {
+		h.kept = append([]stubs.TurnStats(nil), h.kept[len(h.kept)/2:]...)
+	}
+	if h.writer == nil {
+		return
+	}
+	_, err := fmt.Fprintf(h.writer, "%d,%d,%d,%d,%g\n", stats.Turn, stats.Population, stats.Births, stats.Deaths, stats.Density)
+	if err != nil { // what was written is still there, but nothing older than memory can be read from now on
+		log.Printf("Error writing turn %d to %s: %v", stats.Turn, h.path, err)
+		h.closeFile()
+		h.path = ""
+	}
+}
+
+// rewind forgets the turns from that of stats on, as the game has gone back to it, and records stats in their place
+// so the turns carry on from it
+func (h *history) rewind(stats stubs.TurnStats) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	kept := 0
+	for kept < len(h.kept) && h.kept[kept].Turn < stats.Turn {
+		kept++
+	}
+	h.kept = h.kept[:kept]
+	if h.writer != nil {
+		if err := h.truncateFile(stats.Turn - h.first); err != nil {
+			log.Printf("Error rewinding %s to turn %d: %v", h.path, stats.Turn, err)
+			h.closeFile()
+			h.path = ""
+		}
+	}
+	h.Unlock()
+	h.record(stats)
+}
+
+// truncateFile cuts the history's file down to its first lines, so it can be written on from there
+func (h *history) truncateFile(lines int) error {
+	if err := h.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := h.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if options.EncryptionKey != nil {
+		lines++ // the header, as each line is encrypted on a line of its own
+	}
+	reader := bufio.NewReader(h.file)
+	var offset int64
+	for line := 0; line < lines; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		offset += int64(len(text))
+	}
+	if err := h.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := h.file.Seek(offset, io.SeekStart)
+	h.writer.Reset(h.sealed)
+	return err
+}
+
+// finish marks the game finished, closing its file
+func (h *history) finish() {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.finished = true
+	h.closeFile()
+}
+
+func (h *history) closeFile() {
+	if h.file == nil {
+		return
+	}
+	if err := h.writer.Flush(); err != nil {
+		log.Printf("Error writing %s: %v", h.path, err)
+	}
+	if err := h.sealed.Close(); err != nil {
+		log.Printf("Error writing %s: %v", h.path, err)
+	}
+	if err := h.file.Close(); err != nil {
+		log.Printf("Error closing %s: %v", h.path, err)
+	}
+	h.file, h.sealed, h.writer = nil, nil, nil
+}
+
+// read fills in a page of the turns the request asks for, from memory if they are still kept there and from the file
+// if not, which is read without the history locked so the game isn't held up
+func (h *history) read(req stubs.HistoryRequest, response *stubs.HistoryResponse) error {
+	h.Lock()
+	response.Finished = h.finished
+	response.Earliest, response.Latest = h.kept[0].Turn, h.kept[len(h.kept)-1].Turn
+	if h.path != "" {
+		response.Earliest = h.first
+	}
+	from, to := req.From, req.To
+	if from < response.Earliest {
+		from = response.Earliest
+	}
+	if to == 0 || to > response.Latest {
+		to = response.Latest
+	}
+	if to-from+1 > req.Limit {
+		to = from + req.Limit - 1
+	}
+	response.Next = from
+	if from > to {
+		h.Unlock()
+		return nil
+	}
+	if from >= h.kept[0].Turn {
+		response.Turns = append(response.Turns, h.kept[from-h.kept[0].Turn:to-h.kept[0].Turn+1]...)
+		response.Next = to + 1
+		h.Unlock()
+		return nil
+	}
+	path, first, inMemory := h.path, h.first, h.kept[0].Turn
+	if h.writer != nil {
+		if err := h.writer.Flush(); err != nil {
+			h.Unlock()
+			return stubs.Errorf(stubs.Internal, "can't read the history of turns before %d: %v", inMemory, err)
+		}
+	}
+	h.Unlock()
+	turns, err := readHistoryFile(path, from-first, to-from+1)
+	if err != nil {
+		return stubs.Errorf(stubs.Internal, "can't read the history of turns before %d: %v", inMemory, err)
+	}
+	response.Turns = turns
+	response.Next = from + len(turns)
+	return nil
+}
+
+// readHistoryFile reads count turns from a history's file, starting skip lines in
+func readHistoryFile(path string, skip int, count int) ([]stubs.TurnStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := options.EncryptionKey.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var turns []stubs.TurnStats
+	scanner := bufio.NewScanner(reader)
+	for line := 0; line < skip+count && scanner.Scan(); line++ {
+		if line < skip {
+			continue
+		}
+		var stats stubs.TurnStats
+		_, err = fmt.Sscanf(scanner.Text(), "%d,%d,%d,%d,%g", &stats.Turn, &stats.Population, &stats.Births, &stats.Deaths, &stats.Density)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: %v", line+1, path, err)
+		}
+		turns = append(turns, stats)
+	}
+	return turns, scanner.Err()
+}
+
+// History sends a page of the turn statistics of the running game, or of one of the last few games
+func (s *SecretBrokerOperation) History(req stubs.HistoryRequest, response *stubs.HistoryResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	if req.Limit <= 0 {
+		return stubs.Errorf(stubs.InvalidParams, "page limit %d must be positive", req.Limit)
+	}
+	id := req.GameID
+	if id == "" {
+		current.Lock()
+		if current.game != nil {
+			id = current.game.id
+		}
+		current.Unlock()
+	}
+	if id == "" {
+		return stubs.Errorf(stubs.NoGame, "no game has been started")
+	}
+	histories.Lock()
+	h := histories.byGame[id]
+	histories.Unlock()
+	if h == nil {
+		return stubs.Errorf(stubs.NoGame, "no history for game %q, which is only kept for the last %d games, and not for tiled or hashlife games", id, keptHistories)
+	}
+	return h.read(req, response)
+}
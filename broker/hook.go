@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hookTimeout is how long a hook can run before it is killed and the game carries on without it
+const hookTimeout = time.Minute
+
+// runHook runs Options.Hook on the game's board every Options.HookEvery turns, replacing the board with the one the
+// hook prints, if it prints one. A hook that fails is logged and the game carries on as if it hadn't run.
+// Must be called with the game locked, after the turn has been counted.
+func (game *Game) runHook() {
+	if options.Hook == "" || options.HookEvery <= 0 || game.completedTurns%options.HookEvery != 0 {
+		return
+	}
+	game.fetchStrips()
+	cells, err := game.callHook()
+	if err != nil {
+		log.Printf("Game %s: hook failed at turn %d, carrying on without it: %v", game.id, game.completedTurns, err)
+		return
+	}
+	if cells != nil {
+		game.replaceCells(cells)
+	}
+}
+
+// callHook sends the board to the hook as a PGM image, giving the board the hook prints back, or nil if it printed
+// nothing. Whatever the hook writes to stderr is logged a line at a time, for custom metrics.
+func (game *Game) callHook() ([][]uint8, error) {
+	command := strings.Fields(options.Hook)
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	hook := exec.CommandContext(ctx, command[0], command[1:]...)
+	hook.Env = append(os.Environ(),
+		"GOL_GAME="+game.id,
+		"GOL_TURN="+strconv.Itoa(game.completedTurns),
+		"GOL_RULE="+game.rule.String(),
+		"GOL_EDGE="+game.edge)
+	var board, output, logged bytes.Buffer
+	fmt.Fprintf(&board, "P5\n%d %d\n255\n", game.current.width, game.current.height)
+	for _, row := range game.current.cells {
+		board.Write(row)
+	}
+	hook.Stdin, hook.Stdout, hook.Stderr = &board, &output, &logged
+	err := hook.Run()
+	for _, line := range strings.Split(strings.TrimRight(logged.String(), "\n"), "\n") {
+		if line != "" {
+			log.Printf("Game %s: hook at turn %d: %s", game.id, game.completedTurns, line)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if output.Len() == 0 {
+		return nil, nil
+	}
+	return readHookBoard(&output, game.current.width, game.current.height)
+}
+
+// readHookBoard reads the PGM image printed by a hook, which must be the size of the game's board
+func readHookBoard(reader *bytes.Buffer, width int, height int) ([][]uint8, error) {
+	var magic string
+	var imageWidth, imageHeight, maxValue int
+	if _, err := fmt.Fscan(reader, &magic, &imageWidth, &imageHeight, &maxValue); err != nil || magic != "P5" || maxValue != 255 {
+		return nil, fmt.Errorf("hook didn't print a binary PGM image with a maximum value of 255")
+	}
+	if imageWidth != width || imageHeight != height {
+		return nil, fmt.Errorf("hook printed a %dx%d board for a %dx%d game", imageWidth, imageHeight, width, height)
+	}
+	_, _ = reader.ReadByte() // the whitespace ending the header
+	cells := make([][]uint8, height)
+	for y := range cells {
+		cells[y] = make([]uint8, width)
+		if _, err := io.ReadFull(reader, cells[y]); err != nil {
+			return nil, fmt.Errorf("hook's image ends at row %d of %d", y, height)
+		}
+	}
+	return cells, nil
+}
+
+// replaceCells puts the board given by a hook in place of the current one a cell at a time
+func (game *Game) replaceCells(cells [][]uint8) {
+	for y, row := range cells {
+		for x, value := range row {
+			game.setCell(x, y, value)
+		}
+	}
+	game.boardReplaced()
+}
@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"log"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// orderWorkersByLatency reorders the workers so neighbouring slices of the board go to workers close to each other
+// Each worker measures its latency to every other worker, and the broker its latency to each worker. The order
+// starts with the worker nearest the broker and then always moves on to the nearest worker not yet placed, so
+// workers in the same region end up next to each other and the slow hops between regions are as few as possible.
+// If any worker can't be measured the order is left as it was given.
+func orderWorkersByLatency() {
+	addresses := listWorkers()
+	if len(addresses) < 3 { // with two workers every order has the same neighbours
+		return
+	}
+	fromBroker, between, err := measureLatencies(addresses)
+	if err != nil {
+		log.Println("Measure worker latency error:", err)
+		return
+	}
+	order := latencyOrder(fromBroker, between)
+	ordered := make([]string, len(order))
+	for i, worker := range order {
+		ordered[i] = addresses[worker]
+	}
+	setWorkers(ordered)
+	log.Println("Workers ordered by latency:", ordered)
+}
+
+// measureLatencies times a call to each worker from the broker, and asks each worker for its latency to the others
+// between[i][j] is the round trip from worker i to worker j.
+func measureLatencies(addresses []string) (fromBroker []time.Duration, between [][]time.Duration, err error) {
+	fromBroker = make([]time.Duration, len(addresses))
+	between = make([][]time.Duration, len(addresses))
+	for i, address := range addresses {
+		start := time.Now()
+		client, err := stubs.DialWorker(address)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = client.Version(stubs.VersionRequest{Header: stubs.NewHeader("")}, new(stubs.VersionResponse)); err != nil {
+			_ = client.Close()
+			return nil, nil, err
+		}
+		fromBroker[i] = time.Since(start)
+		response := new(stubs.LatencyResponse)
+		err = client.MeasureLatency(stubs.LatencyRequest{Header: stubs.NewHeader(""), Addresses: addresses}, response)
+		_ = client.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		between[i] = response.Latencies
+	}
+	return fromBroker, between, nil
+}
+
+// latencyOrder works out the order to use the workers in from their measured latencies
+// Latencies are averaged in both directions, as the two workers may not have measured the same.
+func latencyOrder(fromBroker []time.Duration, between [][]time.Duration) []int {
+	placed := make([]bool, len(fromBroker))
+	current := 0
+	for i, latency := range fromBroker {
+		if latency < fromBroker[current] {
+			current = i
+		}
+	}
+	order := []int{current}
+	placed[current] = true
+	for len(order) < len(fromBroker) {
+		next := -1
+		for i := range fromBroker {
+			if placed[i] {
+				continue
+			}
+			if next == -1 || between[current][i]+between[i][current] < between[current][next]+between[next][current] {
+				next = i
+			}
+		}
+		order = append(order, next)
+		placed[next] = true
+		current = next
+	}
+	return order
+}
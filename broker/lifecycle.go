@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// lifecycle is where the broker is in its life, which decides the RPCs it carries out
+// It only changes through moveTo, so the broker can't, say, start a game once it has begun closing.
+var lifecycle = struct {
+	sync.Mutex
+	state stubs.BrokerState
+	since time.Time
+}{state: stubs.StateIdle, since: time.Now()}
+
+// transitions lists the states the broker can move to from each state
+var transitions = map[stubs.BrokerState][]stubs.BrokerState{
+	stubs.StateIdle:     {stubs.StateRunning, stubs.StateDraining},
+	stubs.StateRunning:  {stubs.StateIdle, stubs.StatePaused, stubs.StateDraining},
+	stubs.StatePaused:   {stubs.StateRunning, stubs.StateIdle, stubs.StateDraining}, // idle if a paused game is quit
+	stubs.StateDraining: {stubs.StateClosed},
+	stubs.StateClosed:   {},
+}
+
+// moveTo changes the broker's state, which must be locked, refusing changes transitions doesn't allow
+// Draining closes closeWorkers and closed closes closed, so the turn loops and Run find out.
+func moveTo(state stubs.BrokerState) error {
+	from := lifecycle.state
+	if !hasState(transitions[from], state) {
+		return refuse(from)
+	}
+	lifecycle.state, lifecycle.since = state, time.Now()
+	switch state {
+	case stubs.StateDraining:
+		close(closeWorkers)
+	case stubs.StateClosed:
+		close(closed)
+	}
+	if state == stubs.StateDraining || state == stubs.StateClosed {
+		log.Printf("Broker %s", state)
+	}
+	return nil
+}
+
+// require refuses an RPC unless the broker is in one of the states it can be carried out in
+func require(states ...stubs.BrokerState) error {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	if hasState(states, lifecycle.state) {
+		return nil
+	}
+	return refuse(lifecycle.state)
+}
+
+// refuse gives the error for an RPC the broker can't carry out in a state, coded by why
+func refuse(state stubs.BrokerState) error {
+	switch state {
+	case stubs.StateIdle:
+		return stubs.Errorf(stubs.NoGame, "the broker is idle, no game is running")
+	case stubs.StateDraining, stubs.StateClosed:
+		return stubs.Errorf(stubs.Draining, "the broker is closing down")
+	default:
+		return stubs.Errorf(stubs.InvalidParams, "the broker can't do that while %s", state)
+	}
+}
+
+func hasState(states []stubs.BrokerState, state stubs.BrokerState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// gameStarted moves an idle broker to running as a game or batch starts, refusing it if the broker is closing
+func gameStarted() error {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	switch lifecycle.state {
+	case stubs.StateIdle:
+		return moveTo(stubs.StateRunning)
+	case stubs.StateRunning, stubs.StatePaused:
+		return nil
+	default:
+		return refuse(lifecycle.state)
+	}
+}
+
+// gamesFinished moves the broker back to idle once the last game or batch running has finished
+func gamesFinished() {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	if lifecycle.state == stubs.StateRunning || lifecycle.state == stubs.StatePaused {
+		_ = moveTo(stubs.StateIdle)
+	}
+}
+
+// pauseChanged moves the broker between running and paused as the controller's game is paused or resumed
+func pauseChanged(paused bool) {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	switch {
+	case paused && lifecycle.state == stubs.StateRunning:
+		_ = moveTo(stubs.StatePaused)
+	case !paused && lifecycle.state == stubs.StatePaused:
+		_ = moveTo(stubs.StateRunning)
+	}
+}
+
+// drain moves the broker to draining as it starts closing, which it can only do once
+func drain() error {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	return moveTo(stubs.StateDraining)
+}
+
+// closeDown moves a draining broker to closed once its workers have been closed
+func closeDown() {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	_ = moveTo(stubs.StateClosed)
+}
+
+// Status tells the caller which state the broker is in, and how far its current game has got
+func (s *SecretBrokerOperation) Status(req stubs.StatusRequest, response *stubs.StatusResponse) (err error) {
+	response.Header = req.Header
+	lifecycle.Lock()
+	response.State, response.Since = lifecycle.state, lifecycle.since
+	lifecycle.Unlock()
+	runningGames.Lock()
+	response.Running = runningGames.count
+	runningGames.Unlock()
+	current.Lock()
+	game := current.game
+	current.Unlock()
+	if game == nil {
+		return
+	}
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	if game.running {
+		response.GameID, response.CompletedTurns, response.Turns = game.id, game.completedTurns, game.turns
+	}
+	return
+}
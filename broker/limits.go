@@ -0,0 +1,94 @@
+package broker
+
+import (
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Limits caps the games a broker will take on, so one mistaken request can't take over a shared broker
+// A zero field means no limit.
+type Limits struct {
+	MaxWidth, MaxHeight int // largest starting board, in cells
+	MaxTurns            int
+	MaxGames            int // games, or batches, running at once
+	MaxMemory           int // megabytes a game's boards are estimated to need on the broker
+}
+
+// bytesPerCell is how much broker memory each cell of a board held in memory takes: the current and advanced boards
+// and the cell's age
+const bytesPerCell = 1 + 1 + 4
+
+var runningGames = struct {
+	sync.Mutex
+	count int
+	none  chan struct{} // closed while no games or batches are running
+}{none: notPaused} // already closed, as no games are running yet
+
+// checkLimits rejects a game that is bigger or longer than the broker allows, where memory is the estimated bytes
+// the broker needs for it
+func checkLimits(width int, height int, turns int, memory int) error {
+	limits := options.Limits
+	if limits.MaxWidth > 0 && width > limits.MaxWidth {
+		return stubs.Errorf(stubs.InvalidParams, "board width %d is more than this broker allows, at most %d", width, limits.MaxWidth)
+	}
+	if limits.MaxHeight > 0 && height > limits.MaxHeight {
+		return stubs.Errorf(stubs.InvalidParams, "board height %d is more than this broker allows, at most %d", height, limits.MaxHeight)
+	}
+	if limits.MaxTurns > 0 && turns > limits.MaxTurns {
+		return stubs.Errorf(stubs.InvalidParams, "%d turns is more than this broker allows, at most %d", turns, limits.MaxTurns)
+	}
+	if megabytes := (memory + 1<<20 - 1) >> 20; limits.MaxMemory > 0 && megabytes > limits.MaxMemory {
+		return stubs.Errorf(stubs.InvalidParams, "game would need about %dMB, more than this broker allows, at most %dMB", megabytes, limits.MaxMemory)
+	}
+	return nil
+}
+
+// boardMemory estimates the bytes the broker needs to hold a game's board
+// A tiled board only keeps some of its tiles in memory, and the rest on disk.
+func boardMemory(width int, height int, tileSize int) int {
+	cells := width * height
+	if tileSize > 0 {
+		if resident := options.MaxResidentTiles * tileSize * tileSize; resident < cells {
+			cells = resident
+		}
+		return cells
+	}
+	return cells * bytesPerCell
+}
+
+// startRunning counts a game as running, refusing it if the broker is already running as many as it allows
+// or is closing down
+func startRunning() error {
+	runningGames.Lock()
+	defer runningGames.Unlock()
+	if options.Limits.MaxGames > 0 && runningGames.count >= options.Limits.MaxGames {
+		return stubs.Errorf(stubs.AlreadyRunning, "this broker is already running %d games, the most it allows", runningGames.count)
+	}
+	if err := gameStarted(); err != nil {
+		return err
+	}
+	if runningGames.count == 0 {
+		runningGames.none = make(chan struct{})
+	}
+	runningGames.count++
+	return nil
+}
+
+// stopRunning frees the place of a game started with startRunning, leaving the broker idle if it was the last
+func stopRunning() {
+	runningGames.Lock()
+	runningGames.count--
+	if runningGames.count == 0 {
+		close(runningGames.none)
+		gamesFinished()
+	}
+	runningGames.Unlock()
+}
+
+// gamesStopped gives a channel that is closed once no games or batches are running
+func gamesStopped() <-chan struct{} {
+	runningGames.Lock()
+	defer runningGames.Unlock()
+	return runningGames.none
+}
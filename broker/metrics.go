@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// sectionCall is how long one section took to come back from its worker, and the bytes sent and received meanwhile
+type sectionCall struct {
+	took     time.Duration
+	traffic  stubs.Traffic
+	encoding stubs.Encoding // what the board was sent in, empty if it was shared in memory
+}
+
+// goAdvanceMeasured sends a worker its section in the background like GoAdvanceSection, measuring the call in
+// measured before sending it on done
+// A board sent as a delta from one the worker no longer has is sent again whole, which is board.
+func goAdvanceMeasured(worker *stubs.Worker, request stubs.WorkerRequest, response *stubs.WorkerResponse, done chan *rpc.Call, measured *sectionCall, board [][]uint8) {
+	go func() {
+		before, start := worker.Traffic(), time.Now()
+		call := <-worker.GoAdvanceSection(request, response, make(chan *rpc.Call, 1)).Done
+		if stubs.Code(call.Error) == stubs.Stale && request.Board != nil {
+			request.Board, request.CurrentBoard = nil, board
+			*response = stubs.WorkerResponse{}
+			call = <-worker.GoAdvanceSection(request, response, make(chan *rpc.Call, 1)).Done
+		}
+		switch {
+		case request.SharedBoard != "":
+			measured.encoding = ""
+		case request.Board != nil:
+			measured.encoding = request.Board.Encoding
+		default:
+			measured.encoding = stubs.Dense
+		}
+		after := worker.Traffic()
+		measured.took = time.Since(start)
+		measured.traffic = stubs.Traffic{Sent: after.Sent - before.Sent, Received: after.Received - before.Received}
+		done <- call
+	}()
+}
+
+// workerMetrics adds up how each worker performed over a game, which must be locked to use it
+type workerMetrics struct {
+	byAddress map[string]*stubs.WorkerMetrics
+	order     []string // addresses, in the order the workers were first used
+}
+
+// record adds a turn's sections to their workers' metrics
+func (metrics *workerMetrics) record(workerClients []*stubs.Worker, responses []*stubs.WorkerResponse, calls []*sectionCall, bounds [][2]int, width int) {
+	if metrics.byAddress == nil {
+		metrics.byAddress = make(map[string]*stubs.WorkerMetrics)
+	}
+	for i, response := range responses {
+		address := workerClients[i].Address
+		worker := metrics.byAddress[address]
+		if worker == nil {
+			worker = &stubs.WorkerMetrics{Address: address}
+			metrics.byAddress[address] = worker
+			metrics.order = append(metrics.order, address)
+		}
+		worker.Sections++
+		worker.Cells += (bounds[i][1] - bounds[i][0]) * width
+		worker.Compute += response.Compute
+		worker.RoundTrip += calls[i].took
+		worker.BytesSent += calls[i].traffic.Sent
+		worker.BytesReceived += calls[i].traffic.Received
+		if calls[i].encoding != "" { // rather than shared in memory
+			if worker.Encodings == nil {
+				worker.Encodings = make(map[stubs.Encoding]int)
+			}
+			worker.Encodings[calls[i].encoding]++
+			if response.Section != nil {
+				worker.Encodings[response.Section.Encoding]++
+			} else {
+				worker.Encodings[stubs.Dense]++
+			}
+		}
+	}
+}
+
+// list gives the metrics of each worker, in the order they were first used
+func (metrics *workerMetrics) list() []stubs.WorkerMetrics {
+	var list []stubs.WorkerMetrics
+	for _, address := range metrics.order {
+		list = append(list, *metrics.byAddress[address])
+	}
+	return list
+}
+
+// turnTimer records where the time of each of a game's turns went, for games asked to with TimeTurns
+// A game that wasn't asked has a nil one, which records nothing.
+type turnTimer struct {
+	timings      []stubs.TurnTiming
+	current      stubs.TurnTiming
+	sectionsBack time.Time // when the last section of the current turn came back
+}
+
+// sectionsDone notes how long the last worker back spent computing its section and sending it, as reassembly starts
+func (timer *turnTimer) sectionsDone(responses []*stubs.WorkerResponse, calls []*sectionCall) {
+	if timer == nil {
+		return
+	}
+	if len(calls) == 0 { // no section could change, so no worker was sent one
+		timer.current, timer.sectionsBack = stubs.TurnTiming{}, time.Now()
+		return
+	}
+	slowest := 0
+	for i := range calls {
+		if calls[i].took > calls[slowest].took {
+			slowest = i
+		}
+	}
+	compute := responses[slowest].Compute
+	timer.current = stubs.TurnTiming{Compute: compute, Network: calls[slowest].took - compute}
+	timer.sectionsBack = time.Now()
+}
+
+// turnDone records the timing of a turn that started at start, once the board has been checked
+func (timer *turnTimer) turnDone(turn int, start time.Time) {
+	if timer == nil {
+		return
+	}
+	timer.current.Turn = turn
+	timer.current.Total = time.Since(start)
+	timer.current.Reassembly = time.Since(timer.sectionsBack)
+	timer.timings = append(timer.timings, timer.current)
+}
+
+// list gives the timing of each turn, oldest first
+func (timer *turnTimer) list() []stubs.TurnTiming {
+	if timer == nil {
+		return nil
+	}
+	return timer.timings
+}
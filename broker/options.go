@@ -0,0 +1,44 @@
+package broker
+
+import (
+	"os"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/seal"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Options holds the broker settings that aren't shared with the other subcommands
+type Options struct {
+	TileDirectory         string          // where tiles of tiled games are written when they don't fit in memory
+	MaxResidentTiles      int             // how many tiles of a tiled game are kept in memory at once
+	Scaler                Scaler          // starts and stops workers when autoscaling, nil to only use the workers given
+	ScaleWorkers          int             // workers to ask the Scaler for when each game starts, all released when it ends
+	OrderByLatency        bool            // order the workers by measured latency when each game starts, for workers in many regions
+	Limits                Limits          // caps on the games the broker will run
+	ControllerTimeout     time.Duration   // how long a controller can go without a heartbeat before its game is abandoned, 0 to never
+	WhileRunning          string          // what StartGame does while a controller's game is running, RejectNewGames if empty
+	MinWorkers            int             // fewest healthy workers a game carries on with, waiting for more below it, 0 to fail instead
+	HistoryDirectory      string          // where each game's turn statistics are written as CSV, empty to keep them in memory only
+	HistoryTurns          int             // most turns of each game's statistics kept in memory, 0 for no limit
+	Hook                  string          // program, with its arguments, that can read and change each game's board, empty for none
+	HookEvery             int             // how many turns apart the hook is run
+	TurnLogDirectory      string          // where each game's board checksums are logged after every turn, empty to not log them
+	TurnLogBoards         int             // how many turns apart the board is saved beside the turn log, 0 to not save it
+	SharedImageDirectory  string          // storage shared with the workers, at the same path, for them to write finished boards to
+	SharedMemoryDirectory string          // directory in memory, such as /dev/shm, to share boards through with workers on this host
+	Encodings             stubs.Encodings // what boards can be packed in to send to workers that support it, chosen between each turn
+	EncryptionKey         *seal.Key       // encrypts the checkpoints, turn logs and histories the broker writes, nil to write them as they are
+	Cull                  bool            // only send workers the rows that could change each turn, rather than every row
+	TurnSlots             int             // how many turns of games competing for the workers are worked out at once
+	HaloEvery             int             // how many turns apart halo games fetch their whole board from the workers, 0 for only when needed
+}
+
+// DefaultMaxResidentTiles is how many tiles are kept in memory if no limit is given
+const DefaultMaxResidentTiles = 1024
+
+// DefaultEncodings is what boards can be packed in if nothing else is given, with sparse and delta left to be asked for
+const DefaultEncodings = "bits"
+
+var options = Options{TileDirectory: os.TempDir(), MaxResidentTiles: DefaultMaxResidentTiles, HistoryTurns: DefaultHistoryTurns, HookEvery: 1,
+	Encodings: stubs.Encodings{stubs.BitPacked}, Cull: true, TurnSlots: DefaultTurnSlots, HaloEvery: DefaultHaloEvery}
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// notPaused is always closed, for games that aren't paused to carry on straight away
+var notPaused = func() chan struct{} {
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}()
+
+// Pause stops the game once the turn being worked out has finished, doing nothing if it's already paused
+// The response gives the turn the board has reached, which stays the same until the game is resumed.
+func (s *SecretBrokerOperation) Pause(req stubs.PauseRequest, response *stubs.PauseResponse) (err error) {
+	response.Header = req.Header
+	return response.Fail(changePause(req.Header, stubs.PauseGame, response))
+}
+
+// Resume carries on with a paused game, doing nothing if it's already running
+func (s *SecretBrokerOperation) Resume(req stubs.PauseRequest, response *stubs.PauseResponse) (err error) {
+	response.Header = req.Header
+	return response.Fail(changePause(req.Header, stubs.ResumeGame, response))
+}
+
+// PauseBroker pauses or resumes the game, as the request asks, for controllers from before Pause and Resume
+// Toggling isn't safe to retry, so replies are remembered and given again to retries.
+func (s *SecretBrokerOperation) PauseBroker(req stubs.PauseRequest, response *stubs.PauseResponse) (err error) {
+	response.Header = req.Header
+	finish, replayed := replay("PauseBroker", req.RequestID, response)
+	if replayed {
+		return
+	}
+	defer finish()
+	return response.Fail(changePause(req.Header, req.Action, response))
+}
+
+// changePause pauses or resumes the game between turns, giving back the state it is then in
+func changePause(header stubs.Header, action stubs.PauseAction, response *stubs.PauseResponse) error {
+	if err := require(stubs.StateRunning, stubs.StatePaused); err != nil {
+		return err
+	}
+	game, err := gameFor(header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(header); err != nil { // the turn being worked out finishes first
+		return err
+	}
+	defer game.mutex.Unlock()
+	if !game.running { // nothing would ever resume it
+		return stubs.Errorf(stubs.NoGame, "game %s isn't running", game.id)
+	}
+	switch action {
+	case stubs.TogglePause:
+		game.setPaused(!game.paused)
+	case stubs.PauseGame:
+		game.setPaused(true)
+	case stubs.ResumeGame:
+		game.setPaused(false)
+	default:
+		return stubs.Errorf(stubs.InvalidParams, "unknown pause action %q", action)
+	}
+	response.CompletedTurns = game.completedTurns
+	response.Paused = game.paused
+	return nil
+}
+
+// setPaused pauses or resumes the game, which must be locked and be the controller's game
+func (game *Game) setPaused(paused bool) {
+	if paused == game.paused {
+		return
+	}
+	game.paused = paused
+	pauseChanged(paused)
+	if paused {
+		game.unpaused = make(chan struct{})
+	} else {
+		close(game.unpaused)
+	}
+}
+
+// resumed gives a channel that is closed once the game isn't paused, which it already is if the game is running
+func (game *Game) resumed() <-chan struct{} {
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	if !game.paused {
+		return notPaused
+	}
+	return game.unpaused
+}
@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// livenessTimeout is how long a pooled worker has to answer before its connection is dialled again
+const livenessTimeout = 2 * time.Second
+
+// pool keeps a connection to each worker open from one game to the next, so games don't wait for every
+// worker to be dialled when they start
+var pool = struct {
+	sync.Mutex
+	clients map[string]*stubs.Worker
+}{clients: make(map[string]*stubs.Worker)}
+
+// dialWorkers gives a connection to every worker in our list of addresses, failing if any of them can't be reached
+// Pooled connections are checked to still answer first, and those to workers no longer listed are closed.
+func dialWorkers() ([]*stubs.Worker, error) {
+	pool.Lock()
+	defer pool.Unlock()
+	listed := make(map[string]bool)
+	var workerClients []*stubs.Worker
+	for _, address := range listWorkers() {
+		listed[address] = true
+		worker, err := pooledWorker(address)
+		if err != nil && forgetWorker(address) { // it registered, and can register again once it is back
+			continue
+		}
+		if err != nil {
+			return nil, stubs.Errorf(stubs.WorkerUnavailable, "can't reach worker %s: %v", address, err)
+		}
+		workerClients = append(workerClients, worker)
+	}
+	for address, worker := range pool.clients {
+		if !listed[address] {
+			_ = worker.Close()
+			delete(pool.clients, address)
+		}
+	}
+	if len(workerClients) == 0 {
+		return nil, stubs.Errorf(stubs.WorkerUnavailable, "the broker has no workers")
+	}
+	return workerClients, nil
+}
+
+// pooledWorker gives the pool's connection to a worker, which must be locked, dialling it again if it doesn't answer
+func pooledWorker(address string) (*stubs.Worker, error) {
+	worker, ok := pool.clients[address]
+	if ok && alive(worker) {
+		return worker, nil
+	}
+	if ok {
+		_ = worker.Close()
+	}
+	worker, err := dialWorker(address)
+	if err != nil {
+		delete(pool.clients, address)
+		return nil, err
+	}
+	pool.clients[address] = worker
+	return worker, nil
+}
+
+// dialWorker connects to a worker and agrees which capabilities to use with it, moving to a multiplexed
+// connection if the worker supports one
+func dialWorker(address string) (*stubs.Worker, error) {
+	worker, err := stubs.DialWorker(address)
+	if err != nil {
+		return nil, err
+	}
+	if err = worker.Negotiate(config.Version, stubs.WorkerCapabilities); err != nil {
+		_ = worker.Close()
+		return nil, err
+	}
+	if !worker.Capabilities.Has(stubs.Multiplexing) {
+		return worker, nil
+	}
+	_ = worker.Close()
+	multiplexed, err := stubs.DialMultiplexed(address)
+	if err != nil {
+		return nil, err
+	}
+	multiplexed.Capabilities = worker.Capabilities
+	return multiplexed, nil
+}
+
+// alive checks a pooled worker still answers, without waiting long for one that has gone quiet
+func alive(worker *stubs.Worker) bool {
+	call := worker.GoVersion(stubs.VersionRequest{Header: stubs.NewHeader("")}, new(stubs.VersionResponse), make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error == nil
+	case <-time.After(livenessTimeout):
+		return false
+	}
+}
+
+// closeClients closes connections to workers that are going away, taking them out of the pool
+func closeClients(workerClients []*stubs.Worker) {
+	pool.Lock()
+	defer pool.Unlock()
+	for _, worker := range workerClients {
+		if pool.clients[worker.Address] == worker {
+			delete(pool.clients, worker.Address)
+		}
+		_ = worker.Close()
+	}
+}
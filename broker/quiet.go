@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"bytes"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// quietRows is what a game needs to work out which rows of its board can't change next turn, see Options.Cull
+// A cell's next state depends only on the cells within the rule's radius of it, so a row whose neighbouring rows
+// all stayed the same last turn stays the same too, and needn't be sent to a worker.
+type quietRows struct {
+	from, to *Board // the boards before and after the last turn, which the game still has unless it was replaced since
+}
+
+// turned notes the boards either side of the turn just worked out
+func (quiet *quietRows) turned(from *Board, to *Board) {
+	quiet.from, quiet.to = from, to
+}
+
+// forget drops the boards either side of the last turn, as the current board was changed in place since, so the
+// rows that changed last turn are no longer all the rows that could change next turn
+func (quiet *quietRows) forget() {
+	quiet.from, quiet.to = nil, nil
+}
+
+// activeRows gives which rows of the board could change this turn, from the rows that changed last turn. It gives
+// nil if every row could, as on the first turn, after the board is edited, changed by a hook, grows or is taken
+// back to a bookmark, and with random births and deaths.
+func (game *Game) activeRows() []bool {
+	if !options.Cull || game.noise.Enabled() || game.quiet.from != game.advanced || game.quiet.to != game.current {
+		return nil
+	}
+	edge, err := rules.ParseEdge(game.edge)
+	if err != nil {
+		return nil
+	}
+	height := game.current.height
+	changed := make([]bool, height)
+	for y := range changed {
+		changed[y] = !bytes.Equal(game.current.cells[y], game.advanced.cells[y])
+	}
+	active := make([]bool, height)
+	for y := range active {
+		for dy := -game.rule.Radius; dy <= game.rule.Radius && !active[y]; dy++ {
+			row, inside := edge.Resolve(y+dy, height)
+			active[y] = inside && changed[row]
+		}
+	}
+	return active
+}
+
+// activeSpan narrows a section to the rows from its first that could change this turn to its last, giving false if
+// none of its rows could, in which case the section stays as it is and no worker is sent it
+func activeSpan(active []bool, startY int, endY int) (int, int, bool) {
+	if active == nil {
+		return startY, endY, true
+	}
+	for startY < endY && !active[startY] {
+		startY++
+	}
+	for endY > startY && !active[endY-1] {
+		endY--
+	}
+	return startY, endY, startY < endY
+}
@@ -0,0 +1,40 @@
+package broker
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestEditResume checks rows edited between turns are worked out from the next turn, even when the edits put them
+// back as they were the turn before, so they look as if they didn't change.
+func TestEditResume(t *testing.T) {
+	useWorkers(t, 2)
+	options.Cull = true
+	const turns = 2000
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3, 21, 20, 22, 21, 20, 22, 21, 22, 22, 22) // a blinker, and a glider far enough away to be culled apart
+	id := gameID(t)
+	finished := startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: turns})
+	paused := pauseAfter(t, id, 2)
+	before, current := step(start, paused-1), step(start, paused)
+	var edits []stubs.CellEdit // the glider back as it was the turn before
+	for y := 16; y < 32; y++ {
+		for x := range current[y] {
+			if current[y][x] != before[y][x] {
+				edits = append(edits, stubs.CellEdit{X: x, Y: y, Value: before[y][x]})
+				current[y][x] = before[y][x]
+			}
+		}
+	}
+	var set stubs.SetCellsResponse
+	_ = new(SecretBrokerOperation).SetCells(stubs.SetCellsRequest{Header: stubs.Header{GameID: id}, Cells: edits}, &set)
+	if err := set.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if set.Changed != len(edits) || set.CompletedTurns != paused {
+		t.Fatalf("changed %d cells after turn %d, want %d after turn %d", set.Changed, set.CompletedTurns, len(edits), paused)
+	}
+	resume(t, id)
+	response := finish(t, finished)
+	sameBoard(t, response.FinishedBoard, step(current, turns-paused))
+}
@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"log"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// quorumInterval is how often a degraded game checks whether enough of its workers have come back
+const quorumInterval = time.Second
+
+// dialHealthyWorkers gives a connection to each worker in our list that can be reached, leaving out the rest
+func dialHealthyWorkers() []*stubs.Worker {
+	pool.Lock()
+	defer pool.Unlock()
+	var healthy []*stubs.Worker
+	for _, address := range listWorkers() {
+		if worker, err := pooledWorker(address); err == nil {
+			healthy = append(healthy, worker)
+		} else {
+			forgetWorker(address)
+		}
+	}
+	return healthy
+}
+
+// healthyWorkers gives the workers that answer and support what the game needs, to use in place of the game's
+// workers after one has failed or while it waits for them to come back, along with as many of them as the game uses
+func (game *Game) healthyWorkers(workerClients []*stubs.Worker) ([]*stubs.Worker, []*stubs.Worker) {
+	var healthy []*stubs.Worker
+	for _, worker := range dialHealthyWorkers() {
+		if game.checkCapabilities([]*stubs.Worker{worker}) == nil {
+			healthy = append(healthy, worker)
+		}
+	}
+	if game.autoscale == nil || len(workerClients) > len(healthy) {
+		return healthy, healthy
+	}
+	return healthy, healthy[:len(workerClients)]
+}
+
+// checkQuorum marks the game degraded if fewer workers are healthy than Options.MinWorkers, so it waits for
+// more rather than carrying on with too few, reporting whether it is
+func (game *Game) checkQuorum(healthy []*stubs.Worker, workerClients []*stubs.Worker) bool {
+	degraded := game.hashlife == nil && len(healthy) < options.MinWorkers
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	if degraded && !game.degraded {
+		log.Printf("Game %s: degraded at turn %d, only %d of the %d workers needed are healthy", game.id, game.completedTurns, len(healthy), options.MinWorkers)
+	} else if !degraded && game.degraded {
+		log.Printf("Game %s: %d workers are healthy, carrying on from turn %d", game.id, len(healthy), game.completedTurns)
+	}
+	game.degraded = degraded
+	game.activeWorkers = len(workerClients)
+	return degraded
+}
+
+// awaitingQuorum gives a channel that fires once a degraded game should check for its workers again,
+// and nil for games that aren't degraded
+func (game *Game) awaitingQuorum() <-chan time.Time {
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	if !game.degraded {
+		return nil
+	}
+	return time.After(quorumInterval)
+}
@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// maxRegionCells is the most cells GetRegion sends at once, so a viewer can't ask for more than a board at a time
+const maxRegionCells = 4096 * 4096
+
+// GetRegion sends a rectangle of the running game's board, so a viewer zoomed in on a huge board only fetches what
+// it shows
+func (s *SecretBrokerOperation) GetRegion(req stubs.RegionRequest, response *stubs.RegionResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		if response.Cells != nil {
+			response.Checksum = stubs.Sum(response.Cells)
+		}
+		err = response.Fail(err)
+	}()
+	if err = checkRegion(req.Width, req.Height); err != nil {
+		return err
+	}
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if game.tiled == nil && game.hashlife == nil && game.strips == nil { // swapped between turns, like currentBoard's
+		current, originX, originY := game.current, game.originX, game.originY
+		response.CompletedTurns = game.completedTurns
+		response.Cells = boardRegion(current, req.X+originX, req.Y+originY, req.Width, req.Height)
+		return nil
+	}
+	if err = game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	response.CompletedTurns = game.completedTurns
+	response.Cells, err = game.region(req.X, req.Y, req.Width, req.Height)
+	return err
+}
+
+// checkRegion rejects regions too small or too big to send
+func checkRegion(width int, height int) error {
+	if width <= 0 || height <= 0 || width*height > maxRegionCells {
+		return stubs.Errorf(stubs.InvalidParams, "a %dx%d region can't be sent, it must have between 1 and %d cells", width, height, maxRegionCells)
+	}
+	return nil
+}
+
+// region copies a rectangle of the game's board, with its top left cell at x, y on the starting board
+// Must be called with the game locked.
+func (game *Game) region(x int, y int, width int, height int) ([][]uint8, error) {
+	if game.hashlife != nil {
+		return game.hashlife.Cells(x, y, width, height), nil
+	}
+	if game.tiled != nil {
+		return game.tiled.store.Region(x, y, width, height, rules.Dead)
+	}
+	game.fetchStrips()
+	return boardRegion(game.current, x+game.originX, y+game.originY, width, height), nil
+}
+
+// boardRegion copies a rectangle of a board, leaving the cells beyond its edge dead
+func boardRegion(board *Board, x int, y int, width int, height int) [][]uint8 {
+	region := make([][]uint8, height)
+	for j := range region {
+		region[j] = make([]uint8, width)
+		if y+j < 0 || y+j >= board.height {
+			continue
+		}
+		for i := range region[j] {
+			if x+i >= 0 && x+i < board.width {
+				region[j][i] = board.cells[y+j][x+i]
+			}
+		}
+	}
+	return region
+}
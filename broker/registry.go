@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"log"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// workers is the broker's pool of workers: those it was given, with -workers or by a Scaler, and those that have
+// registered themselves since with RegisterWorker
+// A registered worker that can't be dialled is forgotten until it registers again, so one that has gone doesn't
+// hold up every game after it. Games notice the pool has changed between turns, and split the board between
+// however many workers there are from then on.
+var workers = struct {
+	sync.Mutex
+	addresses  []string
+	registered map[string]bool // the addresses that registered, rather than being given
+	changes    int             // how many times workers have registered or been forgotten
+}{registered: make(map[string]bool)}
+
+// listWorkers gives the address of every worker in the pool
+func listWorkers() []string {
+	workers.Lock()
+	defer workers.Unlock()
+	return append([]string(nil), workers.addresses...)
+}
+
+// setWorkers replaces the workers the broker was given, keeping those that registered themselves
+func setWorkers(addresses []string) {
+	workers.Lock()
+	defer workers.Unlock()
+	listed := make(map[string]bool)
+	for _, address := range addresses {
+		listed[address] = true
+	}
+	for _, address := range workers.addresses {
+		if workers.registered[address] && !listed[address] {
+			addresses = append(addresses, address)
+		}
+	}
+	workers.addresses = addresses
+}
+
+// registerWorker adds a worker that registered to the pool, reporting whether it wasn't there already
+func registerWorker(address string) bool {
+	workers.Lock()
+	defer workers.Unlock()
+	for _, known := range workers.addresses {
+		if known == address {
+			return false
+		}
+	}
+	workers.addresses = append(workers.addresses, address)
+	workers.registered[address] = true
+	workers.changes++
+	return true
+}
+
+// forgetWorker takes a worker that can't be dialled out of the pool if it registered itself, reporting whether it did
+// Workers the broker was given are kept, as they can't register again.
+func forgetWorker(address string) bool {
+	workers.Lock()
+	defer workers.Unlock()
+	if !workers.registered[address] {
+		return false
+	}
+	delete(workers.registered, address)
+	for i, known := range workers.addresses {
+		if known == address {
+			workers.addresses = append(workers.addresses[:i:i], workers.addresses[i+1:]...)
+			break
+		}
+	}
+	workers.changes++
+	log.Printf("Worker %s can't be reached, so it is left out until it registers again", address)
+	return true
+}
+
+// poolChanged checks whether workers have registered or been forgotten since the game last checked
+func (game *Game) poolChanged() bool {
+	workers.Lock()
+	defer workers.Unlock()
+	changed := game.poolChanges != workers.changes
+	game.poolChanges = workers.changes
+	return changed
+}
+
+// RegisterWorker adds a worker that has announced itself to the broker's pool, once the broker has dialled it back,
+// so games use it from their next turn
+func (s *SecretBrokerOperation) RegisterWorker(req stubs.RegisterWorkerRequest, response *stubs.RegisterWorkerResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	if err = require(stubs.StateIdle, stubs.StateRunning, stubs.StatePaused); err != nil {
+		return err
+	}
+	address, err := config.NormaliseAddress(req.Address, config.DefaultWorkerPort)
+	if err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	pool.Lock()
+	_, err = pooledWorker(address)
+	pool.Unlock()
+	if err != nil {
+		return stubs.Errorf(stubs.WorkerUnavailable, "can't dial worker %s back: %v", address, err)
+	}
+	response.New = registerWorker(address)
+	response.Workers = listWorkers()
+	if response.New {
+		log.Printf("Worker %s registered, the broker has %d workers now", address, len(response.Workers))
+	}
+	return
+}
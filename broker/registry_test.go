@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestRegisteredWorkerLost checks a game carries on when a worker that registered goes part way through, its rows
+// going to the other workers, and finishes with the board it would have had anyway.
+func TestRegisteredWorkerLost(t *testing.T) {
+	useWorkers(t, 2)
+	options.MinWorkers = 1
+	registered := serveWorker(t)
+	var response stubs.RegisterWorkerResponse
+	_ = new(SecretBrokerOperation).RegisterWorker(stubs.RegisterWorkerRequest{Address: registered.address}, &response)
+	if err := response.Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forgetWorker(registered.address) })
+	if !response.New || len(response.Workers) != 3 {
+		t.Fatalf("registering gave new %v and workers %v, want a new third worker", response.New, response.Workers)
+	}
+	const turns = 500
+	start := newBoard(48, 48)
+	for _, x := range []int{4, 20, 36} { // gliders in every worker's rows, so each has cells to work out
+		for _, y := range []int{2, 18, 34} {
+			start[y][x+1], start[y+1][x+2], start[y+2][x], start[y+2][x+1], start[y+2][x+2] = 255, 255, 255, 255, 255
+		}
+	}
+	id := gameID(t)
+	finished := startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 48, Height: 48, Turns: turns})
+	paused := pauseAfter(t, id, 5)
+	registered.kill()
+	resume(t, id)
+	result := finish(t, finished)
+	if result.CompletedTurns != turns {
+		t.Fatalf("completed %d turns, want %d", result.CompletedTurns, turns)
+	}
+	for _, address := range listWorkers() {
+		if address == registered.address {
+			t.Fatalf("worker %s is still in the pool after it went at turn %d", address, paused)
+		}
+	}
+	sameBoard(t, result.FinishedBoard, step(start, turns))
+}
@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"reflect"
+	"sync"
+)
+
+// keptReplies is how many replies to mutating calls are remembered for retries
+const keptReplies = 64
+
+// reply is the response to a mutating call, closed once the call has finished
+type reply struct {
+	done     chan struct{}
+	response interface{}
+}
+
+// replyKey identifies a call by its method as well as its request ID, as a client reusing an ID for a call to another
+// method mustn't be given a response of the wrong type
+type replyKey struct {
+	method, requestID string
+}
+
+// replies remembers the responses to recent mutating calls by method and request ID, so a call retried after a
+// dropped connection is given the first call's response rather than being carried out twice
+var replies = struct {
+	sync.Mutex
+	keys  []replyKey
+	byKey map[replyKey]*reply
+}{byKey: make(map[replyKey]*reply)}
+
+// replay fills response with the response to an earlier call to the same method with the same request ID, waiting
+// for it to finish, and reports whether there was one. Otherwise the call is recorded, and finish must be called
+// once it is done. Calls without a request ID, from older clients, are never replayed.
+func replay(method string, requestID string, response interface{}) (finish func(), replayed bool) {
+	if requestID == "" {
+		return func() {}, false
+	}
+	key := replyKey{method, requestID}
+	replies.Lock()
+	previous, ok := replies.byKey[key]
+	if !ok {
+		current := &reply{done: make(chan struct{}), response: response}
+		replies.byKey[key] = current
+		replies.keys = append(replies.keys, key)
+		if len(replies.keys) > keptReplies {
+			delete(replies.byKey, replies.keys[0])
+			replies.keys = replies.keys[1:]
+		}
+		replies.Unlock()
+		return func() { close(current.done) }, false
+	}
+	replies.Unlock()
+	<-previous.done
+	reflect.ValueOf(response).Elem().Set(reflect.ValueOf(previous.response).Elem())
+	return nil, true
+}
@@ -0,0 +1,35 @@
+package broker
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestReplay checks a retried call is given the first call's response, and that a request ID reused for a call to
+// another method is carried out as a new call rather than given a response of the wrong type.
+func TestReplay(t *testing.T) {
+	first := &stubs.PauseResponse{CompletedTurns: 7, Paused: true}
+	finish, replayed := replay("PauseBroker", "reused", first)
+	if replayed {
+		t.Fatal("replayed a call that hadn't been made")
+	}
+	finish()
+
+	retried := new(stubs.PauseResponse)
+	if _, replayed = replay("PauseBroker", "reused", retried); !replayed || *retried != *first {
+		t.Fatalf("retry got %+v, %v, want %+v replayed", retried, replayed, first)
+	}
+
+	other := new(stubs.CloseResponse)
+	finish, replayed = replay("ControllerClosed", "reused", other)
+	if replayed {
+		t.Fatal("replayed a call to another method with the same request ID")
+	}
+	finish()
+
+	if finish, replayed = replay("PauseBroker", "", new(stubs.PauseResponse)); replayed {
+		t.Fatal("replayed a call without a request ID")
+	}
+	finish()
+}
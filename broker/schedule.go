@@ -0,0 +1,216 @@
+package broker
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultTurnSlots is how many turns of games competing for the workers are worked out at once if no other number
+// is given, so the game whose turn it is has the workers to itself
+const DefaultTurnSlots = 1
+
+// MaxPriority is the highest priority a game can have, and its negative the lowest, as each level doubles a game's
+// share of the workers
+const MaxPriority = 10
+
+// turnGap is how long after its last turn a job still counts as wanting the workers, so a game that is between
+// turns, such as one sending its board to its controller, keeps its place
+const turnGap = time.Second
+
+// handBack is how long a turn slot is kept for a job that has just finished a turn and has used least of its share,
+// so it gets its next turn rather than whichever job was already waiting
+const handBack = 10 * time.Millisecond
+
+// idleJob is how long a job can go without asking for a turn before the scheduler forgets how much it has used
+const idleJob = time.Minute
+
+// job is a game, or a batch of games, which the workers are shared between by priority
+type job struct {
+	weight   float64
+	used     float64   // seconds of turns worked out, divided by the weight
+	running  int       // turns being worked out
+	waiting  int       // turns waiting to be
+	lastSeen time.Time // when the job last asked for a turn or finished one
+}
+
+// turnWaiter is a game waiting for the scheduler to let it work out its next turn
+type turnWaiter struct {
+	job     string
+	granted chan struct{} // closed once the turn can be worked out
+}
+
+// scheduler decides whose turn is worked out next while more than one job wants the workers
+// Whichever waiting job has used least of its share goes next, a job's share being twice that of one a priority
+// below. Turns aren't interrupted once sent to the workers, so a job only gives way to another between turns. A
+// job on its own isn't held back, so the games of an interleaved batch all run at once as before.
+var scheduler = struct {
+	sync.Mutex
+	jobs    map[string]*job
+	waiting []*turnWaiter // oldest first
+	running int
+	held    *time.Timer // dispatches turns once a slot kept for a job that has just finished a turn is let go
+}{jobs: make(map[string]*job)}
+
+// priorityWeight gives the share of the workers a game of a priority has
+func priorityWeight(priority int) float64 {
+	if priority > MaxPriority {
+		priority = MaxPriority
+	} else if priority < -MaxPriority {
+		priority = -MaxPriority
+	}
+	return math.Pow(2, float64(priority))
+}
+
+// waitForTurn waits until the scheduler lets the game work out its next turn, giving a function to call once it has,
+// or nil if the game is stopped or abandoned, or the broker closes, first
+// Games that don't use the workers, such as hashlife games, don't wait.
+func (game *Game) waitForTurn() func() {
+	if game.hashlife != nil {
+		return func() {}
+	}
+	id := game.job
+	if id == "" {
+		id = game.id
+	}
+	waiter := &turnWaiter{job: id, granted: make(chan struct{})}
+	scheduler.Lock()
+	j := scheduler.jobs[id]
+	if j == nil {
+		j = &job{}
+		scheduler.jobs[id] = j
+	}
+	if !j.active() { // a job coming back doesn't get to make up for the time it was idle
+		j.used = math.Max(j.used, leastUsed())
+	}
+	j.weight, j.lastSeen = priorityWeight(game.priority), time.Now()
+	j.waiting++
+	scheduler.waiting = append(scheduler.waiting, waiter)
+	dispatchTurns()
+	scheduler.Unlock()
+	select {
+	case <-waiter.granted:
+		start := time.Now()
+		return func() {
+			finishTurn(id, time.Since(start))
+		}
+	case <-game.quit:
+	case <-game.abandoned:
+	case <-closeWorkers:
+	}
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	select {
+	case <-waiter.granted: // the turn was given as the game stopped waiting, so it's handed straight back
+		chargeTurn(id, 0)
+	default:
+		for i, waiting := range scheduler.waiting {
+			if waiting == waiter {
+				scheduler.waiting = append(scheduler.waiting[:i], scheduler.waiting[i+1:]...)
+				break
+			}
+		}
+		j.waiting--
+		dispatchTurns()
+	}
+	return nil
+}
+
+// finishTurn charges a job for a turn it has worked out, and lets the next turn start
+func finishTurn(id string, took time.Duration) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	chargeTurn(id, took)
+}
+
+// chargeTurn is finishTurn with the scheduler locked
+func chargeTurn(id string, took time.Duration) {
+	j := scheduler.jobs[id]
+	j.running--
+	scheduler.running--
+	j.used += took.Seconds() / j.weight
+	j.lastSeen = time.Now()
+	for other, idle := range scheduler.jobs {
+		if idle.running == 0 && idle.waiting == 0 && time.Since(idle.lastSeen) > idleJob {
+			delete(scheduler.jobs, other)
+		}
+	}
+	dispatchTurns()
+}
+
+// dispatchTurns lets waiting games work out their turns, the jobs that have used least of their shares first, for as
+// long as there are Options.TurnSlots free or only one job wants the workers, but keeping slots for jobs that have
+// just finished a turn and are owed the next. The scheduler must be locked.
+func dispatchTurns() {
+	for len(scheduler.waiting) > 0 {
+		if scheduler.running >= options.TurnSlots && competing() {
+			return
+		}
+		next := 0
+		for i, waiter := range scheduler.waiting {
+			if scheduler.jobs[waiter.job].used < scheduler.jobs[scheduler.waiting[next].job].used {
+				next = i
+			}
+		}
+		if owed, jobs := owedTurns(scheduler.jobs[scheduler.waiting[next].job].used); jobs > 0 && jobs >= options.TurnSlots-scheduler.running {
+			if scheduler.held == nil {
+				scheduler.held = time.AfterFunc(owed, func() {
+					scheduler.Lock()
+					defer scheduler.Unlock()
+					scheduler.held = nil
+					dispatchTurns()
+				})
+			}
+			return
+		}
+		waiter := scheduler.waiting[next]
+		scheduler.waiting = append(scheduler.waiting[:next], scheduler.waiting[next+1:]...)
+		j := scheduler.jobs[waiter.job]
+		j.waiting--
+		j.running++
+		scheduler.running++
+		close(waiter.granted)
+	}
+}
+
+// owedTurns gives how many jobs have just finished a turn and used less of their share than the waiting job that
+// would go next, and how long the longest a slot should be kept for one of them is. A job that has just finished a
+// turn hasn't asked for its next one yet, so without this two games would take turns about whatever their
+// priorities. The scheduler must be locked.
+func owedTurns(used float64) (time.Duration, int) {
+	longest, jobs := time.Duration(0), 0
+	for _, j := range scheduler.jobs {
+		if owed := handBack - time.Since(j.lastSeen); j.running == 0 && j.waiting == 0 && j.used < used && owed > 0 {
+			longest, jobs = max(longest, owed), jobs+1
+		}
+	}
+	return longest, jobs
+}
+
+// competing checks whether more than one job wants the workers. The scheduler must be locked.
+func competing() bool {
+	active := 0
+	for _, j := range scheduler.jobs {
+		if j.active() {
+			active++
+		}
+	}
+	return active > 1
+}
+
+// active checks whether a job is working out a turn, waiting to, or has only just finished one
+func (j *job) active() bool {
+	return j.running > 0 || j.waiting > 0 || time.Since(j.lastSeen) < turnGap
+}
+
+// leastUsed gives how much of its share the active job that has used least of it has, or 0 if none are active. The
+// scheduler must be locked.
+func leastUsed() float64 {
+	least, found := 0.0, false
+	for _, j := range scheduler.jobs {
+		if j.active() && (!found || j.used < least) {
+			least, found = j.used, true
+		}
+	}
+	return least
+}
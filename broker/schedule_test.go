@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// playTurns has games each ask the scheduler for turn after turn, every turn taking as long as turn, until there
+// have been turns turns between them, giving how many each got
+func playTurns(t *testing.T, games []*Game, turns int, turn time.Duration) []int {
+	defaults := options
+	options.TurnSlots = 1
+	t.Cleanup(func() {
+		options = defaults
+		scheduler.Lock()
+		defer scheduler.Unlock()
+		for _, game := range games {
+			delete(scheduler.jobs, game.id)
+		}
+	})
+	starter := &Game{id: gameID(t) + "-starter"} // holds the slot until every game is waiting, so none starts alone
+	starter.waitForTurn()
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	got, played := make([]int, len(games)), 0
+	for i, game := range games {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for {
+				if game.waitForTurn() == nil {
+					return
+				}
+				mutex.Lock()
+				over := played >= turns
+				if !over {
+					got[i]++
+					played++
+				}
+				mutex.Unlock()
+				finishTurn(game.id, turn) // charged the same every time, however long the test machine takes
+				if over {
+					return
+				}
+			}
+		}()
+	}
+	for waiting := 0; waiting < len(games); time.Sleep(time.Millisecond) {
+		scheduler.Lock()
+		waiting = len(scheduler.waiting)
+		scheduler.Unlock()
+	}
+	finishTurn(starter.id, 0)
+	scheduler.Lock()
+	delete(scheduler.jobs, starter.id)
+	scheduler.Unlock()
+	wait.Wait()
+	return got
+}
+
+// TestSchedulerShares checks games competing for one turn slot get turns in proportion to their shares, each
+// priority level doubling a game's share.
+func TestSchedulerShares(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []int
+		want       []int
+	}{
+		{"equal", []int{0, 0}, []int{150, 150}},
+		{"one level apart", []int{1, 0}, []int{200, 100}},
+		{"two levels apart", []int{-1, 1}, []int{60, 240}},
+		{"three games", []int{0, 1, 2}, []int{43, 86, 171}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var games []*Game
+			for _, priority := range test.priorities {
+				games = append(games, &Game{id: gameID(t), priority: priority})
+			}
+			got := playTurns(t, games, 300, time.Millisecond)
+			for i := range got {
+				if got[i] < test.want[i]*9/10 || got[i] > test.want[i]*11/10 {
+					t.Fatalf("got %v turns, want about %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+// TestSchedulerStarvation checks a low-priority game still gets turns alongside a game that has twice its share many
+// times over, with only one turn worked out at a time.
+func TestSchedulerStarvation(t *testing.T) {
+	high, low := &Game{id: gameID(t) + "-high", priority: 3}, &Game{id: gameID(t) + "-low", priority: -1}
+	got := playTurns(t, []*Game{high, low}, 340, time.Millisecond)
+	if got[1] < 15 {
+		t.Fatalf("the low-priority game got %d of %d turns, want about 20", got[1], got[0]+got[1])
+	}
+}
@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// lastSections is how the last turn was split between the workers, which kept their sections of it
+type lastSections struct {
+	turn    int // the turn the sections were advanced in
+	width   int
+	bounds  [][2]int
+	workers []*stubs.Worker
+}
+
+// writeSharedImage writes the finished board as a PGM image in Options.SharedImageDirectory, giving its path
+// The broker makes the image at its full size, each worker writes the rows it worked out on the last turn into it,
+// and the broker writes the rest itself: rows whose worker couldn't, or whose rows don't match the board as the
+// broker has it, such as when a hook changed them. The image only takes its name once every row is in place.
+func (game *Game) writeSharedImage() (string, error) {
+	board := game.current
+	if err := os.MkdirAll(options.SharedImageDirectory, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := strconv.Itoa(board.width) + "x" + strconv.Itoa(board.height) + "x" + strconv.Itoa(game.completedTurns) + ".pgm"
+	path := filepath.Join(options.SharedImageDirectory, name)
+	partial := path + ".part"
+	file, err := os.Create(partial)
+	if err != nil {
+		return "", err
+	}
+	header := fmt.Sprintf("P5\n%d %d\n255\n", board.width, board.height)
+	_, err = file.WriteString(header)
+	if err == nil {
+		err = file.Truncate(int64(len(header) + board.width*board.height))
+	}
+	if err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	written := game.writeSections(partial, int64(len(header)))
+	rowsWritten := 0
+	for y, row := range board.cells {
+		if written[y] {
+			rowsWritten++
+			continue
+		}
+		if _, err = file.WriteAt(row, int64(len(header)+y*board.width)); err != nil {
+			_ = file.Close()
+			return "", err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+	log.Printf("Game %s: workers wrote %d of the %d rows of %s", game.id, rowsWritten, board.height, path)
+	return path, os.Rename(partial, path)
+}
+
+// writeSections has each worker write the section it kept of the last turn into the image, giving which rows they
+// wrote that match the board
+func (game *Game) writeSections(path string, offset int64) []bool {
+	board, last := game.current, game.lastSections
+	written := make([]bool, board.height)
+	if last == nil || last.turn != game.completedTurns-1 || last.width != board.width {
+		return written // the board has grown, or been taken back to a bookmark, since
+	}
+	done := make([]chan *rpc.Call, len(last.bounds))
+	responses := make([]*stubs.WriteSectionResponse, len(last.bounds))
+	for i, rows := range last.bounds {
+		if rows[1] > board.height || !last.workers[i].Capabilities.Has(stubs.WriteSections) {
+			continue
+		}
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/write/%d", game.id, i)}
+		request := stubs.WriteSectionRequest{Header: header, Turn: last.turn, StartY: rows[0], EndY: rows[1], Path: path, Offset: offset}
+		done[i], responses[i] = make(chan *rpc.Call, 1), new(stubs.WriteSectionResponse)
+		last.workers[i].GoWriteSection(request, responses[i], done[i])
+	}
+	for i, rows := range last.bounds {
+		if done[i] == nil {
+			continue
+		}
+		call := <-done[i]
+		if call.Error != nil {
+			log.Printf("Game %s: worker %s couldn't write rows %d-%d, so the broker will: %v", game.id, last.workers[i].Address, rows[0], rows[1], call.Error)
+			continue
+		}
+		if sum := responses[i].Checksum; sum == nil || sum.Verify(board.cells[rows[0]:rows[1]]) != nil {
+			log.Printf("Game %s: rows %d-%d have changed since worker %s worked them out, so the broker will write them", game.id, rows[0], rows[1], last.workers[i].Address)
+			continue
+		}
+		for y := rows[0]; y < rows[1]; y++ {
+			written[y] = true
+		}
+	}
+	return written
+}
@@ -0,0 +1,119 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"uk.ac.bris.cs/gameoflife/shm"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// sharedBoards is a game's board put in Options.SharedMemoryDirectory for the workers on the broker's host, along
+// with the board they write the sections they advance to
+type sharedBoards struct {
+	board    *shm.Board
+	advanced *shm.Board
+	failed   bool // the boards couldn't be made, so the game sends its board to every worker
+}
+
+// sharesMemory checks whether a worker can be sent the board in shared memory, which it has to support and be on the
+// broker's host for, taken to be so of workers the broker dials on a Unix socket or a loopback address
+func sharesMemory(worker *stubs.Worker) bool {
+	if options.SharedMemoryDirectory == "" || !worker.Capabilities.Has(stubs.SharedMemory) {
+		return false
+	}
+	network, address := stubs.Network(worker.Address)
+	if network == "unix" {
+		return true
+	}
+	address, _ = stubs.SplitFingerprint(address)
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
+
+// shareBoard copies the board into shared memory for the turn about to be worked out, if any of its workers share
+// memory with the broker, giving nil if none do or the board can't be shared
+func (game *Game) shareBoard(workerClients []*stubs.Worker) *sharedBoards {
+	sharing := false
+	for _, worker := range workerClients {
+		sharing = sharing || sharesMemory(worker)
+	}
+	if !sharing || game.shared != nil && game.shared.failed {
+		return nil
+	}
+	width, height := game.current.width, game.current.height
+	if game.shared == nil || game.shared.board.Width != width || game.shared.board.Height != height {
+		game.releaseShared() // the board has grown since it was last shared
+		shared, err := newSharedBoards(game.id, width, height)
+		if err != nil {
+			log.Printf("Game %s: can't share the board in memory, so it will be sent to every worker: %v", game.id, err)
+			game.shared = &sharedBoards{failed: true}
+			return nil
+		}
+		game.shared = shared
+	}
+	for y, row := range game.current.cells {
+		copy(game.shared.board.Rows[y], row)
+	}
+	return game.shared
+}
+
+// newSharedBoards makes the files a game's boards are shared through
+func newSharedBoards(gameID string, width int, height int) (*sharedBoards, error) {
+	if err := os.MkdirAll(options.SharedMemoryDirectory, os.ModePerm); err != nil {
+		return nil, err
+	}
+	prefix := filepath.Join(options.SharedMemoryDirectory, fmt.Sprintf("gol-%s-%dx%d", gameID, width, height))
+	board, err := shm.Create(prefix+".board", width, height)
+	if err != nil {
+		return nil, err
+	}
+	advanced, err := shm.Create(prefix+".advanced", width, height)
+	if err != nil {
+		_ = board.Remove()
+		return nil, err
+	}
+	return &sharedBoards{board: board, advanced: advanced}, nil
+}
+
+// readShared reads the sections workers wrote to shared memory into their responses, checking each against the
+// checksum the worker sent, so the rest of the turn carries on as if they had been sent back
+func (game *Game) readShared(shared *sharedBoards, responses []*stubs.WorkerResponse, bounds [][2]int, workerClients []*stubs.Worker) error {
+	for i, response := range responses {
+		if !response.Shared {
+			continue
+		}
+		if shared == nil {
+			return stubs.Errorf(stubs.Internal, "worker %s wrote its section of turn %d to shared memory it wasn't sent", workerClients[i].Address, game.completedTurns)
+		}
+		rows := shared.advanced.Rows[bounds[i][0]:bounds[i][1]]
+		if err := response.Checksum.Verify(rows); err != nil {
+			return stubs.Errorf(stubs.WorkerUnavailable, "worker %s's section of turn %d in shared memory: %v", workerClients[i].Address, game.completedTurns, err)
+		}
+		response.AdvancedMiniBoard = make([][]uint8, len(rows))
+		for y, row := range rows { // copied, as the shared rows are written over next turn
+			response.AdvancedMiniBoard[y] = append([]uint8(nil), row...)
+		}
+	}
+	return nil
+}
+
+// releaseShared removes the files the game's boards were shared through, once its turns have finished
+func (game *Game) releaseShared() {
+	if game.shared == nil || game.shared.failed {
+		return
+	}
+	for _, board := range []*shm.Board{game.shared.board, game.shared.advanced} {
+		if err := board.Remove(); err != nil {
+			log.Printf("Game %s: can't remove %s: %v", game.id, board.Path, err)
+		}
+	}
+	game.shared = nil
+}
@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// drainTimeout is how long CloseBroker waits for the running games to stop before closing the workers anyway
+const drainTimeout = 10 * time.Second
+
+// awaitCall waits for a call to a worker to finish, giving up with Draining if the broker starts closing first,
+// as nothing will use the turn the call is part of
+// The game's board is left as it was at the start of the turn, so the state it is closed with is a whole turn.
+func awaitCall(done chan *rpc.Call, turn int) (*rpc.Call, error) {
+	select {
+	case call := <-done:
+		return call, nil
+	case <-closeWorkers:
+		return nil, stubs.Errorf(stubs.Draining, "turn %d cancelled, the broker is closing down", turn)
+	}
+}
+
+// shutDownWorkers tells each of the broker's workers to close, which stops any section they are still advancing, then
+// closes the broker's connections to them. It gives the workers it couldn't close and why, so a worker that has
+// already gone doesn't stop the broker closing.
+func shutDownWorkers() []string {
+	var skipped []string
+	var clients []*stubs.Worker
+	pool.Lock()
+	for _, address := range listWorkers() {
+		worker, err := pooledWorker(address)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("worker %s, which can't be reached: %v", address, err))
+			continue
+		}
+		clients = append(clients, worker)
+	}
+	pool.Unlock()
+	for _, worker := range clients {
+		err := worker.CloseWorker(stubs.CloseRequest{Header: stubs.NewHeader("")}, new(stubs.CloseResponse))
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("worker %s, which didn't close: %v", worker.Address, err))
+		}
+	}
+	closeClients(clients)
+	return skipped
+}
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Snapshot takes the game's board once the turn being worked out has finished, so the board is always from the
+// turn reported, leaving the game paused unless asked to carry on with it
+func (s *SecretBrokerOperation) Snapshot(req stubs.SnapshotRequest, response *stubs.SnapshotResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		if response.Board != nil {
+			response.Checksum = stubs.Sum(response.Board)
+		}
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil { // the turn being worked out finishes first
+		return err
+	}
+	defer game.mutex.Unlock()
+	if err = game.board(req.IncludeAges, &response.CurrentBoardResponse); err != nil {
+		return err
+	}
+	if game.running && !req.Resume {
+		game.setPaused(true)
+	}
+	response.Board = copyCells(response.Board) // the next turn mustn't change the board before it is sent
+	response.Paused = game.paused
+	return
+}
+
+// copyCells copies a board, row by row
+func copyCells(cells [][]uint8) [][]uint8 {
+	if cells == nil {
+		return nil
+	}
+	copied := make([][]uint8, len(cells))
+	for y, row := range cells {
+		copied[y] = append([]uint8(nil), row...)
+	}
+	return copied
+}
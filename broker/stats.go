@@ -0,0 +1,67 @@
+package broker
+
+import "uk.ac.bris.cs/gameoflife/stubs"
+
+// countTurn adds up the births and deaths the workers counted in their sections of the turn just advanced,
+// counting them for workers too old to, and keeps the game's population in step
+// bounds gives the rows of each worker's section, and the advanced board must have been reassembled.
+func (game *Game) countTurn(responses []*stubs.WorkerResponse, workerClients []*stubs.Worker, bounds [][2]int) {
+	game.births, game.deaths = 0, 0
+	for i, response := range responses {
+		births, deaths := response.Births, response.Deaths
+		if !workerClients[i].Capabilities.Has(stubs.TurnStatistics) {
+			births, deaths = game.countChanges(bounds[i][0], bounds[i][1])
+		}
+		game.births += births
+		game.deaths += deaths
+	}
+	game.alive += game.births - game.deaths
+}
+
+// countChanges counts the cells in rows startY to endY that came alive and died between the current and
+// advanced boards
+func (game *Game) countChanges(startY int, endY int) (births int, deaths int) {
+	for y := startY; y < endY; y++ {
+		for x := 0; x < game.current.width; x++ {
+			was, is := game.aliveValues[game.current.cells[y][x]], game.aliveValues[game.advanced.cells[y][x]]
+			if is && !was {
+				births++
+			} else if was && !is {
+				deaths++
+			}
+		}
+	}
+	return
+}
+
+// turnStats gives the statistics of the game's last turn, which must be locked
+func (game *Game) turnStats() stubs.TurnStats {
+	return stubs.TurnStats{
+		Turn:       game.completedTurns,
+		Population: game.alive,
+		Births:     game.births,
+		Deaths:     game.deaths,
+		Density:    float64(game.alive) / float64(game.current.width*game.current.height),
+	}
+}
+
+// TurnStats tells the caller how the running game's last turn changed its board
+func (s *SecretBrokerOperation) TurnStats(req stubs.TurnStatsRequest, response *stubs.TurnStatsResponse) (err error) {
+	response.Header = req.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if game.tiled != nil || game.hashlife != nil {
+		return stubs.Errorf(stubs.InvalidParams, "turn statistics aren't kept for tiled boards or the hashlife engine")
+	}
+	if err = game.lockBy(req.Header); err != nil { // lock so the turn doesn't change whilst the statistics are read
+		return err
+	}
+	defer game.mutex.Unlock()
+	response.TurnStats = game.turnStats()
+	return
+}
@@ -0,0 +1,86 @@
+package broker
+
+import (
+	"bytes"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// checkStop decides whether the game should stop before reaching its turn count, giving the reason if so
+// Must be called with the game locked, after the boards have been swapped.
+func (game *Game) checkStop() string {
+	if reason := game.checkConditions(); reason != "" {
+		return reason
+	}
+	if !game.stopEarly || game.noise.Enabled() { // random births and deaths can bring any board back to life
+		return ""
+	}
+	empty, unchanged := true, true
+	for y, row := range game.current.cells {
+		if unchanged && !bytes.Equal(row, game.advanced.cells[y]) {
+			unchanged = false
+		}
+		if empty {
+			for _, value := range row {
+				if game.aliveValues[value] {
+					empty = false
+					break
+				}
+			}
+		}
+		if !empty && !unchanged {
+			return ""
+		}
+	}
+	if empty {
+		return stubs.StopExtinct
+	}
+	return stubs.StopStable
+}
+
+// checkConditions gives the description of the first user stop condition that holds, if any do
+func (game *Game) checkConditions() string {
+	population := -1 // only counted if a condition needs it
+	for _, condition := range game.stopConditions {
+		switch condition.Kind {
+		case stubs.PopulationBelow, stubs.PopulationAbove:
+			if population < 0 {
+				population = game.population()
+			}
+			if (condition.Kind == stubs.PopulationBelow && population < condition.Population) ||
+				(condition.Kind == stubs.PopulationAbove && population > condition.Population) {
+				return condition.String()
+			}
+		case stubs.RegionEmpty:
+			if game.regionEmpty(condition.X+game.originX, condition.Y+game.originY, condition.Width, condition.Height) {
+				return condition.String()
+			}
+		}
+	}
+	return ""
+}
+
+// population counts the alive cells on the current board
+func (game *Game) population() int {
+	count := 0
+	for _, row := range game.current.cells {
+		for _, value := range row {
+			if game.aliveValues[value] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// regionEmpty checks there are no alive cells in a region of the current board
+func (game *Game) regionEmpty(x int, y int, width int, height int) bool {
+	for j := y; j < y+height; j++ { // the region can't have moved off the board, as boards only ever grow
+		for _, value := range game.current.cells[j][x : x+width] {
+			if game.aliveValues[value] {
+				return false
+			}
+		}
+	}
+	return true
+}
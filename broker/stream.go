@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"fmt"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// maxStreamTurns is how many turns of changes a game keeps for GetTurnDiff before a controller that has fallen
+// behind is sent the whole board instead
+const maxStreamTurns = 64
+
+// maxStreamChanges is how many changed cells a game keeps for GetTurnDiff over all its turns, so a board that is
+// changing everywhere doesn't keep maxStreamTurns copies of itself
+const maxStreamChanges = 1 << 20
+
+// turnStream is the changes the latest turns of a game made to its board, for GetTurnDiff, see
+// StartGameRequest.StreamTurns
+// Each turn's changes are worked out from the board as kept after the turn before, so changes made between turns,
+// such as by SetCells, go in with them. Games that are tiled, use hashlife, are halo games or expand don't keep any.
+type turnStream struct {
+	last    [][]uint8        // the board as of the latest changes kept
+	turn    int              // the turn last is from
+	diffs   []stubs.TurnDiff // oldest first
+	first   int              // the number of the oldest changes kept, each turn's changes being numbered from 0
+	changes int              // how many changed cells diffs has in all
+}
+
+// newTurnStream starts keeping the changes to a board from how it is at a turn
+func newTurnStream(cells [][]uint8, turn int) *turnStream {
+	return &turnStream{last: copyCells(cells), turn: turn}
+}
+
+// streamTurn keeps the changes to the game's board since they were last kept, if it was started with StreamTurns
+// Must be called with the game locked.
+func (game *Game) streamTurn() {
+	stream := game.stream
+	if stream == nil {
+		return
+	}
+	var changes []stubs.CellChange
+	for y, row := range game.current.cells {
+		last := stream.last[y]
+		for x, value := range row {
+			if value != last[x] {
+				changes = append(changes, stubs.CellChange{X: x, Y: y, Value: value})
+				last[x] = value
+			}
+		}
+	}
+	stream.turn = game.completedTurns
+	stream.diffs = append(stream.diffs, stubs.TurnDiff{Turn: stream.turn, Changes: changes})
+	stream.changes += len(changes)
+	for len(stream.diffs) > 1 && (len(stream.diffs) > maxStreamTurns || stream.changes > maxStreamChanges) {
+		stream.changes -= len(stream.diffs[0].Changes)
+		stream.diffs = stream.diffs[1:]
+		stream.first++
+	}
+}
+
+// next gives the number of the changes kept after the latest
+func (stream *turnStream) next() int {
+	return stream.first + len(stream.diffs)
+}
+
+// GetTurnDiff waits for the running game's board to change after the changes the caller has had, then sends every
+// turn's changes since, or the whole board if they are no longer kept
+func (s *SecretBrokerOperation) GetTurnDiff(req stubs.TurnDiffRequest, res *stubs.TurnDiffResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	wait := req.Wait
+	if wait <= 0 || wait > maxWatchWait {
+		wait = maxWatchWait
+	}
+	giveUp := time.After(wait)
+	for {
+		if err = game.lockBy(req.Header); err != nil {
+			return err
+		}
+		stream := game.stream
+		if stream == nil {
+			game.mutex.Unlock()
+			return stubs.WithCode(stubs.InvalidParams, fmt.Errorf("game %s wasn't started with StreamTurns", game.id))
+		}
+		res.Next, res.Turn = stream.next(), stream.turn
+		switch {
+		case req.Next < stream.first || req.Next > stream.next(): // fallen behind, or from before the broker restarted
+			res.Board = copyCells(stream.last)
+		case req.Next < stream.next():
+			res.Diffs = append([]stubs.TurnDiff(nil), stream.diffs[req.Next-stream.first:]...)
+		}
+		changed, ended := game.changes(), game.ended
+		game.mutex.Unlock()
+		if res.Board != nil || res.Diffs != nil {
+			return nil
+		}
+		if ended {
+			return stubs.Errorf(stubs.NoGame, "game %s has finished", game.id)
+		}
+		select {
+		case <-changed:
+		case <-giveUp:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// getTurnDiff calls GetTurnDiff, failing the test if it fails
+func getTurnDiff(t *testing.T, req stubs.TurnDiffRequest) stubs.TurnDiffResponse {
+	t.Helper()
+	var res stubs.TurnDiffResponse
+	_ = new(SecretBrokerOperation).GetTurnDiff(req, &res)
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// TestGetTurnDiff checks the changes streamed from a game's starting board make its board of each turn, changes
+// made between turns are streamed with them, and a controller that has fallen behind is sent the whole board.
+func TestGetTurnDiff(t *testing.T) {
+	useWorkers(t, 1)
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3, 21, 20, 22, 21, 20, 22, 21, 22, 22, 22) // a blinker and a glider
+	id := gameID(t)
+	startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: 1000000, StreamTurns: true})
+	paused := pauseAfter(t, id, 3)
+	header := stubs.Header{GameID: id}
+	streamed := getTurnDiff(t, stubs.TurnDiffRequest{Header: header})
+	board := copyBoard(start)
+	for turn, diff := range streamed.Diffs {
+		if diff.Turn != turn+1 {
+			t.Fatalf("the changes of turn %d came as turn %d", turn+1, diff.Turn)
+		}
+		for _, change := range diff.Changes {
+			board[change.Y][change.X] = change.Value
+		}
+		sameBoard(t, board, step(start, diff.Turn))
+	}
+	if streamed.Board != nil || len(streamed.Diffs) != paused || streamed.Turn != paused || streamed.Next != paused {
+		t.Fatalf("got %d turns of changes up to turn %d, next %d, want %d", len(streamed.Diffs), streamed.Turn, streamed.Next, paused)
+	}
+	next := stubs.TurnDiffRequest{Header: header, Next: streamed.Next, Wait: 50 * time.Millisecond}
+	if unchanged := getTurnDiff(t, next); unchanged.Board != nil || len(unchanged.Diffs) > 0 || unchanged.Next != streamed.Next {
+		t.Fatalf("sent %v and board %v while the game was paused", unchanged.Diffs, unchanged.Board)
+	}
+	var set stubs.SetCellsResponse
+	_ = new(SecretBrokerOperation).SetCells(stubs.SetCellsRequest{Header: header, Cells: []stubs.CellEdit{{X: 10, Y: 10, Value: 255}}}, &set)
+	if err := set.Err(); err != nil {
+		t.Fatal(err)
+	}
+	edited := getTurnDiff(t, next)
+	if want := []stubs.TurnDiff{{Turn: paused, Changes: []stubs.CellChange{{X: 10, Y: 10, Value: 255}}}}; !reflect.DeepEqual(edited.Diffs, want) {
+		t.Fatalf("sent %v after the edit, want %v", edited.Diffs, want)
+	}
+	resume(t, id)
+	pauseAfter(t, id, paused+2*maxStreamTurns)
+	latest := currentBoard(t, id)
+	for _, behind := range []int{streamed.Next, edited.Next + 1000} { // fallen behind, and from before the broker restarted
+		whole := getTurnDiff(t, stubs.TurnDiffRequest{Header: header, Next: behind})
+		if whole.Diffs != nil || whole.Turn != latest.CompletedTurns {
+			t.Fatalf("asking for changes from %d sent %d turns of changes up to turn %d, want the board of turn %d", behind, len(whole.Diffs), whole.Turn, latest.CompletedTurns)
+		}
+		sameBoard(t, whole.Board, latest.Board)
+	}
+}
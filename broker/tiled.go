@@ -0,0 +1,214 @@
+package broker
+
+import (
+	"fmt"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/tiles"
+)
+
+// tiledGame holds the state of a game stored as tiles, most of which can be on disk
+// Only tiles that changed last turn, and the tiles around them, are sent to the workers each turn;
+// the rest can't change so they are left where they are.
+type tiledGame struct {
+	store   *tiles.Store
+	edge    rules.Edge
+	changed map[tiles.Key]bool // tiles that changed last turn, nil before the first turn
+	all     bool               // whether every tile has to be advanced each turn, as empty tiles can come alive
+}
+
+// validateTiled rejects the options that need the whole board in memory every turn
+func validateTiled(req stubs.StartGameRequest, rule rules.Rule) error {
+	if req.TileSize < rule.Radius {
+		return fmt.Errorf("tile size %d is smaller than the rule's radius %d", req.TileSize, rule.Radius)
+	}
+	if req.IncludeAges || req.StopEarly || req.CycleWindow > 0 || req.Census || len(req.StopConditions) > 0 || req.Expand || req.Heatmap {
+		return fmt.Errorf("ages, stopping early, cycle detection, census, stop conditions, expanding and heatmaps aren't supported on tiled boards")
+	}
+	return nil
+}
+
+// createTiledGame stores the starting board as tiles, dropping the board itself
+func createTiledGame(req stubs.StartGameRequest, rule rules.Rule, edge rules.Edge, noise rules.Noise) (*Game, error) {
+	store, err := tiles.NewStore(options.TileDirectory, req.Width, req.Height, req.TileSize, options.MaxResidentTiles)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.Load(req.StartingBoard); err != nil {
+		return nil, err
+	}
+	var aliveValues [256]bool
+	for value := range aliveValues {
+		aliveValues[value] = rule.Alive(uint8(value))
+	}
+	return &Game{
+		rule:           rule,
+		edge:           edge.String(),
+		noise:          noise,
+		aliveValues:    aliveValues,
+		id:             req.GameID,
+		deadline:       req.Deadline,
+		detach:         req.Detach,
+		priority:       req.Priority,
+		completedTurns: req.StartTurn,
+		tiled: &tiledGame{
+			store: store,
+			edge:  edge,
+			all:   noise.Enabled() || rule.Birth[0],
+		},
+	}, nil
+}
+
+// activeTiles lists the tiles that could change this turn
+func (tiled *tiledGame) activeTiles() []tiles.Key {
+	store := tiled.store
+	if tiled.all {
+		keys := make([]tiles.Key, 0, store.Rows()*store.Columns())
+		for y := 0; y < store.Rows(); y++ {
+			for x := 0; x < store.Columns(); x++ {
+				keys = append(keys, tiles.Key{X: x, Y: y})
+			}
+		}
+		return keys
+	}
+	sources := store.Keys() // on the first turn any tile with alive cells can change
+	if tiled.changed != nil {
+		sources = sources[:0]
+		for key := range tiled.changed {
+			sources = append(sources, key)
+		}
+	}
+	active := make(map[tiles.Key]bool)
+	for _, key := range sources {
+		for _, neighbour := range tiled.around(key) {
+			active[neighbour] = true
+		}
+	}
+	keys := make([]tiles.Key, 0, len(active))
+	for key := range active {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// around lists the tile itself and every tile with a cell close enough to be affected by it
+func (tiled *tiledGame) around(key tiles.Key) []tiles.Key {
+	store := tiled.store
+	radius := store.Size // tiles are at least as big as the rule's radius, so this is always far enough
+	x, y, width, height := store.Bounds(key)
+	columns := tiled.spanned(x-radius, x+width+radius, store.Width)
+	rows := tiled.spanned(y-radius, y+height+radius, store.Height)
+	var keys []tiles.Key
+	for _, row := range rows {
+		for _, column := range columns {
+			keys = append(keys, tiles.Key{X: column, Y: row})
+		}
+	}
+	return keys
+}
+
+// spanned lists the tile indices covering the cells from start up to end along one side of the board
+func (tiled *tiledGame) spanned(start int, end int, size int) []int {
+	seen := make(map[int]bool)
+	var indices []int
+	for i := start; i < end; i++ {
+		resolved, inside := tiled.edge.Resolve(i, size)
+		if index := resolved / tiled.store.Size; inside && !seen[index] {
+			seen[index] = true
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+// advanceTiles sends each active tile, with a halo of cells around it, to the workers
+// Tiles are handed out in bands of rows in the workers' order, so neighbouring tiles go to the same or neighbouring
+// workers. The results are held until every tile has been advanced, so no tile sees another's next turn.
+func (game *Game) advanceTiles(workerClients []*stubs.Worker) error {
+	tiled := game.tiled
+	store := tiled.store
+	halo := game.rule.Radius
+	keys := tiled.activeTiles()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Y < keys[j].Y || keys[i].Y == keys[j].Y && keys[i].X < keys[j].X
+	})
+	doneChannels := make([]chan *rpc.Call, len(keys))
+	responses := make([]*stubs.WorkerResponse, len(keys))
+	for i, key := range keys {
+		x, y, width, height := store.Bounds(key)
+		region, err := store.Region(x-halo, y-halo, width+2*halo, height+2*halo, tiled.edge)
+		if err != nil {
+			return err
+		}
+		header := stubs.Header{GameID: game.id, RequestID: fmt.Sprintf("%s/%d/%d,%d", game.id, game.completedTurns, key.X, key.Y), Deadline: game.deadline}
+		request := stubs.WorkerRequest{Header: header, StartY: halo, EndY: halo + height, Width: width + 2*halo, Height: height + 2*halo,
+			CurrentBoard: region, Checksum: stubs.Sum(region), Rule: game.rule.String(), Edge: rules.Dead.String(), Turn: game.completedTurns,
+			OriginX: halo - x, OriginY: halo - y, // keeps the random births and deaths where they'd be on the whole board
+			Seed: game.noise.Seed, BirthProbability: game.noise.Birth, DeathProbability: game.noise.Death}
+		responses[i] = new(stubs.WorkerResponse)
+		doneChannels[i] = make(chan *rpc.Call, 1)
+		workerClients[i*len(workerClients)/len(keys)].GoAdvanceSection(request, responses[i], doneChannels[i])
+	}
+	changed := make(map[tiles.Key]bool)
+	for i, key := range keys {
+		call, err := awaitCall(doneChannels[i], game.completedTurns)
+		if err != nil {
+			return err
+		}
+		if call.Error != nil {
+			if stubs.Code(call.Error) == stubs.DeadlineExceeded {
+				return call.Error
+			}
+			return stubs.Errorf(stubs.WorkerUnavailable, "worker failed tile %d,%d of turn %d: %v", key.X, key.Y, game.completedTurns, call.Error)
+		}
+		_, _, width, _ := store.Bounds(key)
+		cells := responses[i].AdvancedMiniBoard
+		for y := range cells {
+			cells[y] = cells[y][halo : halo+width] // drop the halo
+		}
+		previous, err := store.Tile(key)
+		if err != nil {
+			return err
+		}
+		if !sameCells(previous, cells) {
+			changed[key] = true
+		}
+	}
+	for i, key := range keys {
+		if changed[key] {
+			if err := store.Put(key, responses[i].AdvancedMiniBoard); err != nil {
+				return err
+			}
+		}
+	}
+	tiled.changed = changed
+	return nil
+}
+
+// sameCells checks whether a tile is unchanged, where a nil tile is one with every cell dead
+func sameCells(previous [][]uint8, next [][]uint8) bool {
+	for y, row := range next {
+		for x, value := range row {
+			if previous == nil && value != 0 || previous != nil && previous[y][x] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writeTiledImage writes the board as a PGM image in the broker's out directory, named like the controller's images
+func (game *Game) writeTiledImage() (string, error) {
+	store := game.tiled.store
+	if err := os.MkdirAll("out", os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join("out", strconv.Itoa(store.Width)+"x"+strconv.Itoa(store.Height)+"x"+strconv.Itoa(game.completedTurns)+".pgm")
+	return path, store.WritePGM(path)
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/crash"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// turnLog writes the checksum of a game's board, and of each of its rows, after every turn, along with the sections
+// each turn was split into and the worker each went to, so gol diverge can find where two runs of a game first differ
+// Games that don't keep one have a nil turnLog, which writes nothing.
+type turnLog struct {
+	path     string         // of the log without its extension, which the boards saved alongside it are named after
+	file     io.WriteCloser // encrypted if the broker has Options.EncryptionKey
+	writer   *bufio.Writer
+	sections string // the sections last written
+}
+
+// newTurnLog starts a game's turn log in Options.TurnLogDirectory with its starting board, giving nil if turns
+// aren't logged or the log can't be created
+func newTurnLog(id string, turn int, cells [][]uint8) *turnLog {
+	if options.TurnLogDirectory == "" {
+		return nil
+	}
+	l := &turnLog{path: filepath.Join(options.TurnLogDirectory, filepath.Base(id))}
+	err := os.MkdirAll(options.TurnLogDirectory, os.ModePerm)
+	if err == nil {
+		l.file, err = options.EncryptionKey.Create(l.path+".turns", true)
+	}
+	if err != nil {
+		log.Printf("Game %s: not logging its turns: %v", id, err)
+		return nil
+	}
+	l.writer = bufio.NewWriter(l.file)
+	fmt.Fprintf(l.writer, "# turn log of game %s: turn, board checksum, then the checksum of each row\n", id)
+	l.turn(turn, cells)
+	return l
+}
+
+// split notes the sections of the board the next turn is split into, and the worker each is sent to
+func (l *turnLog) split(bounds [][2]int, workerClients []*stubs.Worker) {
+	if l == nil {
+		return
+	}
+	var sections []string
+	for i, rows := range bounds {
+		sections = append(sections, fmt.Sprintf("%d-%d@%s", rows[0], rows[1], workerClients[i].Address))
+	}
+	if layout := strings.Join(sections, " "); layout != l.sections {
+		l.sections = layout
+		fmt.Fprintf(l.writer, "sections %s\n", layout)
+	}
+}
+
+// turn writes the checksums of the board after a turn, saving the board too every Options.TurnLogBoards turns
+func (l *turnLog) turn(turn int, cells [][]uint8) {
+	if l == nil || l.writer == nil {
+		return
+	}
+	fmt.Fprintf(l.writer, "turn %d %08x ", turn, stubs.Sum(cells).CRC)
+	for _, row := range cells {
+		fmt.Fprintf(l.writer, "%08x", crc32.ChecksumIEEE(row))
+	}
+	if err := l.writer.WriteByte('\n'); err != nil {
+		log.Printf("Error logging turn %d to %s.turns, no longer logging: %v", turn, l.path, err)
+		l.close()
+		return
+	}
+	if options.TurnLogBoards > 0 && turn%options.TurnLogBoards == 0 {
+		err := writeKept(l.path+"-"+strconv.Itoa(turn)+".pgm", func(w io.Writer) error {
+			return crash.WritePGMTo(w, cells)
+		})
+		if err != nil {
+			log.Printf("Error saving turn %d beside %s.turns: %v", turn, l.path, err)
+		}
+	}
+}
+
+// close flushes the log and closes its file
+func (l *turnLog) close() {
+	if l == nil || l.writer == nil {
+		return
+	}
+	if err := l.writer.Flush(); err != nil {
+		log.Printf("Error writing %s.turns: %v", l.path, err)
+	}
+	if err := l.file.Close(); err != nil {
+		log.Printf("Error closing %s.turns: %v", l.path, err)
+	}
+	l.writer = nil
+}
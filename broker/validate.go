@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Validate checks a game the way StartGame would, and says how it would be run, without starting it
+// Every problem is listed rather than just the first, so they can all be fixed at once.
+func (s *SecretBrokerOperation) Validate(req stubs.ValidateRequest, response *stubs.ValidateResponse) (err error) {
+	response.Header = req.Header
+	game := req.Game
+	problem := func(err error) {
+		if coded, ok := err.(*stubs.Error); ok {
+			response.Problems = append(response.Problems, coded.Message)
+		} else if err != nil {
+			response.Problems = append(response.Problems, err.Error())
+		}
+	}
+	problem(require(stubs.StateIdle, stubs.StateRunning, stubs.StatePaused))
+	if game.Width <= 0 || game.Height <= 0 {
+		problem(stubs.Errorf(stubs.InvalidParams, "board size %dx%d must be positive", game.Width, game.Height))
+	}
+	if game.Turns < 0 {
+		problem(stubs.Errorf(stubs.InvalidParams, "%d turns can't be worked out, the fewest is 0", game.Turns))
+	}
+	rule, ruleErr := rules.Parse(game.Rule)
+	problem(ruleErr)
+	_, err = rules.ParseEdge(game.Edge)
+	problem(err)
+	problem(rules.Noise{Seed: game.Seed, Birth: game.BirthProbability, Death: game.DeathProbability}.Validate())
+	for _, condition := range game.StopConditions {
+		problem(condition.Validate(game.Width, game.Height))
+	}
+	response.MemoryBytes = boardMemory(game.Width, game.Height, game.TileSize)
+	problem(checkLimits(game.Width, game.Height, game.Turns, response.MemoryBytes))
+	runningGames.Lock()
+	if options.Limits.MaxGames > 0 && runningGames.count >= options.Limits.MaxGames {
+		problem(stubs.Errorf(stubs.AlreadyRunning, "this broker is already running %d games, the most it allows", runningGames.count))
+	}
+	runningGames.Unlock()
+	if len(controllerGame) > 0 && options.WhileRunning != QueueNewGames && !(options.WhileRunning == StopRunningGame && game.StopRunning) {
+		problem(stubs.Errorf(stubs.AlreadyRunning, "the broker is already running a game"))
+	}
+
+	if game.Halo && ruleErr == nil {
+		problem(validateHalo(game, rule))
+	}
+	response.Engine = game.Engine
+	switch game.Engine {
+	case "", stubs.EngineWorkers:
+		response.Engine = stubs.EngineWorkers
+		response.Tiled = game.TileSize > 0
+		if response.Tiled && ruleErr == nil {
+			problem(validateTiled(game, rule))
+		}
+	case stubs.EngineHashLife:
+		problem(validateHashLife(game))
+		if ruleErr == nil {
+			_, err = hashlife.New(rule)
+			problem(err)
+		}
+		return // the hashlife engine doesn't use the workers
+	default:
+		problem(stubs.Errorf(stubs.InvalidParams, "unknown engine %q, expected %s or %s", game.Engine, stubs.EngineWorkers, stubs.EngineHashLife))
+	}
+
+	if options.Scaler != nil && options.ScaleWorkers > 0 {
+		response.ScaleWorkers = options.ScaleWorkers // they don't exist yet, so there's nothing to check
+		return
+	}
+	response.Workers = listWorkers()
+	for _, address := range response.Workers {
+		connection, err := stubs.DialConn(address, time.Second)
+		if err != nil {
+			response.UnreachableWorkers = append(response.UnreachableWorkers, address)
+			continue
+		}
+		_ = connection.Close()
+	}
+	if len(response.Workers) == 0 {
+		problem(stubs.Errorf(stubs.WorkerUnavailable, "the broker has no workers"))
+	} else if len(response.UnreachableWorkers) > 0 {
+		problem(stubs.Errorf(stubs.WorkerUnavailable, "can't reach workers %s", strings.Join(response.UnreachableWorkers, ", ")))
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// boardWait is the longest Board waits for a turn after the one asked for, before sending the board as it is
+const boardWait = 30 * time.Second
+
+// BoardImage serves the running game's whole board as a PGM image, for viewers without the RPC client, such as the browser
+// viewer. With ?after= it first waits for a turn after that one to finish, so a viewer follows the game by asking
+// again with the turn of each board it is sent, which is given in the X-Completed-Turns header.
+func BoardImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // so a viewer served from elsewhere can follow the game
+	w.Header().Set("Access-Control-Expose-Headers", "X-Game, X-Completed-Turns")
+	query := r.URL.Query()
+	after := -1
+	if query.Get("after") != "" {
+		var err error
+		if after, err = strconv.Atoi(query.Get("after")); err != nil {
+			http.Error(w, "after must be a turn", http.StatusBadRequest)
+			return
+		}
+	}
+	game, err := gameFor(stubs.Header{GameID: query.Get("game")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	giveUp := time.NewTimer(boardWait)
+	defer giveUp.Stop()
+	cells, turn, err := game.boardAfter(after, giveUp.C, r.Context().Done())
+	if err != nil {
+		code := http.StatusInternalServerError
+		if stubs.Code(err) == stubs.InvalidParams {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "image/x-portable-graymap")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Game", game.id)
+	w.Header().Set("X-Completed-Turns", strconv.Itoa(turn))
+	_, _ = fmt.Fprintf(w, "P5\n%d %d\n255\n", len(cells[0]), len(cells))
+	for _, row := range cells {
+		if _, err = w.Write(row); err != nil {
+			return
+		}
+	}
+}
+
+// boardAfter copies the whole board once a turn after the one given has finished, the game has ended, or either
+// channel closes, giving it with the turn it is from
+func (game *Game) boardAfter(after int, giveUp <-chan time.Time, gone <-chan struct{}) ([][]uint8, int, error) {
+	game.mutex.Lock()
+	defer game.mutex.Unlock()
+	for waiting := true; waiting && game.completedTurns <= after && !game.ended; {
+		changed := game.changes()
+		game.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-giveUp:
+			waiting = false
+		case <-gone:
+			waiting = false
+		}
+		game.mutex.Lock()
+	}
+	var cells [][]uint8
+	var err error
+	switch {
+	case game.tiled != nil:
+		if err = checkRegion(game.tiled.store.Width, game.tiled.store.Height); err == nil {
+			cells, err = game.region(0, 0, game.tiled.store.Width, game.tiled.store.Height)
+		}
+	case game.hashlife != nil:
+		if err = checkRegion(game.width, game.height); err == nil {
+			cells, err = game.region(0, 0, game.width, game.height)
+		}
+	default: // the whole of a board that has grown, rather than the part where the starting board was
+		game.fetchStrips()
+		if err = checkRegion(game.current.width, game.current.height); err == nil {
+			cells = boardRegion(game.current, 0, 0, game.current.width, game.current.height)
+		}
+	}
+	return cells, game.completedTurns, err
+}
@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// maxWatches is how many regions of a game can be watched at once
+const maxWatches = 64
+
+// maxWatchWait is the longest a WatchRegion call waits for a change, so callers that have gone don't pile up
+const maxWatchWait = time.Minute
+
+// regionWatch is a region of a game's board someone is watching, with the cells they were last sent
+type regionWatch struct {
+	x, y, width, height int
+	last                [][]uint8
+}
+
+// boardChanged wakes the WatchRegion calls waiting for the game's board to change
+// Must be called with the game locked.
+func (game *Game) boardChanged() {
+	if game.changed != nil {
+		close(game.changed)
+		game.changed = nil
+	}
+}
+
+// changes gives a channel closed the next time the game's board changes
+// Must be called with the game locked.
+func (game *Game) changes() <-chan struct{} {
+	if game.changed == nil {
+		game.changed = make(chan struct{})
+	}
+	return game.changed
+}
+
+// WatchRegion waits until cells inside a watched region of the running game's board have changed, then sends them
+func (s *SecretBrokerOperation) WatchRegion(req stubs.WatchRequest, res *stubs.WatchResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if req.WatchID == "" {
+		return game.startWatch(req, res)
+	}
+	wait := req.Wait
+	if wait <= 0 || wait > maxWatchWait {
+		wait = maxWatchWait
+	}
+	giveUp := time.After(wait)
+	res.WatchID = req.WatchID
+	for {
+		if err = game.lockBy(req.Header); err != nil {
+			return err
+		}
+		watch := game.watches[req.WatchID]
+		if watch == nil {
+			game.mutex.Unlock()
+			return stubs.Errorf(stubs.InvalidParams, "game %s has no watch %s", game.id, req.WatchID)
+		}
+		if req.Stop {
+			delete(game.watches, req.WatchID)
+			game.mutex.Unlock()
+			return nil
+		}
+		res.CompletedTurns = game.completedTurns
+		res.Changes, err = game.watchChanges(watch)
+		changed, ended := game.changes(), game.ended
+		game.mutex.Unlock()
+		if err != nil || len(res.Changes) > 0 {
+			return err
+		}
+		if ended {
+			return stubs.Errorf(stubs.NoGame, "game %s has finished", game.id)
+		}
+		select {
+		case <-changed:
+		case <-giveUp:
+			return nil
+		}
+	}
+}
+
+// startWatch starts watching the region asked for, sending every cell in it that isn't dead
+func (game *Game) startWatch(req stubs.WatchRequest, res *stubs.WatchResponse) error {
+	if err := checkRegion(req.Width, req.Height); err != nil {
+		return err
+	}
+	if err := game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	if len(game.watches) >= maxWatches {
+		return stubs.Errorf(stubs.InvalidParams, "game %s already has %d watches, stop one first", game.id, maxWatches)
+	}
+	watch := &regionWatch{x: req.X, y: req.Y, width: req.Width, height: req.Height}
+	watch.last = make([][]uint8, req.Height)
+	for y := range watch.last {
+		watch.last[y] = make([]uint8, req.Width)
+	}
+	changes, err := game.watchChanges(watch)
+	if err != nil {
+		return err
+	}
+	if game.watches == nil {
+		game.watches = make(map[string]*regionWatch)
+	}
+	res.WatchID = stubs.NewID()
+	game.watches[res.WatchID] = watch
+	res.Changes, res.CompletedTurns = changes, game.completedTurns
+	return nil
+}
+
+// watchChanges gives the cells of a watched region that have changed since it was last looked at, remembering them
+// Must be called with the game locked.
+func (game *Game) watchChanges(watch *regionWatch) ([]stubs.CellChange, error) {
+	cells, err := game.region(watch.x, watch.y, watch.width, watch.height)
+	if err != nil {
+		return nil, err
+	}
+	var changes []stubs.CellChange
+	for y, row := range cells {
+		for x, value := range row {
+			if value != watch.last[y][x] {
+				changes = append(changes, stubs.CellChange{X: watch.x + x, Y: watch.y + y, Value: value})
+			}
+		}
+	}
+	watch.last = cells
+	return changes, nil
+}
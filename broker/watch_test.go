@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// watchRegion calls WatchRegion, failing the test if it fails
+func watchRegion(t *testing.T, req stubs.WatchRequest) stubs.WatchResponse {
+	t.Helper()
+	var res stubs.WatchResponse
+	_ = new(SecretBrokerOperation).WatchRegion(req, &res)
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// regionChanges gives the cells of a region at x, y that differ between two boards, as a watch sends them
+func regionChanges(before [][]uint8, after [][]uint8, x int, y int, width int, height int) []stubs.CellChange {
+	var changes []stubs.CellChange
+	for j := y; j < y+height; j++ {
+		for i := x; i < x+width; i++ {
+			if before[j][i] != after[j][i] {
+				changes = append(changes, stubs.CellChange{X: i, Y: j, Value: after[j][i]})
+			}
+		}
+	}
+	return changes
+}
+
+// TestWatchRegion checks a watch is sent its region's live cells when it starts, then only the cells inside it that
+// have changed since it was last answered, whether by turns or by edits, and that a stopped watch is gone.
+func TestWatchRegion(t *testing.T) {
+	useWorkers(t, 1)
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3, 21, 20, 22, 21, 20, 22, 21, 22, 22, 22) // a blinker, and a glider outside the region
+	id := gameID(t)
+	startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: 1000000})
+	paused := pauseAfter(t, id, 1)
+	header := stubs.Header{GameID: id}
+	x, y, width, height := 1, 1, 5, 5
+	board := step(start, paused)
+	started := watchRegion(t, stubs.WatchRequest{Header: header, X: x, Y: y, Width: width, Height: height})
+	if want := regionChanges(newBoard(32, 32), board, x, y, width, height); !reflect.DeepEqual(started.Changes, want) || started.CompletedTurns != paused {
+		t.Fatalf("starting the watch sent %v after turn %d, want %v after turn %d", started.Changes, started.CompletedTurns, want, paused)
+	}
+	watch := stubs.WatchRequest{Header: header, WatchID: started.WatchID, Wait: 50 * time.Millisecond}
+	if unchanged := watchRegion(t, watch); len(unchanged.Changes) > 0 {
+		t.Fatalf("sent %v while the game was paused", unchanged.Changes)
+	}
+	edited := copyBoard(board)
+	edited[1][1], edited[10][10] = 255, 255
+	var set stubs.SetCellsResponse
+	edits := []stubs.CellEdit{{X: 1, Y: 1, Value: 255}, {X: 10, Y: 10, Value: 255}} // one inside the region and one outside it
+	_ = new(SecretBrokerOperation).SetCells(stubs.SetCellsRequest{Header: header, Cells: edits}, &set)
+	if err := set.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := watchRegion(t, watch).Changes, []stubs.CellChange{{X: 1, Y: 1, Value: 255}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v after the edits, want %v", got, want)
+	}
+	woken := make(chan stubs.WatchResponse, 1)
+	go func() {
+		var res stubs.WatchResponse
+		_ = new(SecretBrokerOperation).WatchRegion(stubs.WatchRequest{Header: header, WatchID: started.WatchID, Wait: 10 * time.Second}, &res)
+		woken <- res
+	}()
+	resume(t, id)
+	played := <-woken
+	if err := played.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := regionChanges(edited, step(edited, played.CompletedTurns-paused), x, y, width, height); len(want) == 0 || !reflect.DeepEqual(played.Changes, want) {
+		t.Fatalf("sent %v after turn %d, want %v", played.Changes, played.CompletedTurns, want)
+	}
+	watchRegion(t, stubs.WatchRequest{Header: header, WatchID: started.WatchID, Stop: true})
+	var stopped stubs.WatchResponse
+	_ = new(SecretBrokerOperation).WatchRegion(watch, &stopped)
+	if err := stopped.Err(); stubs.Code(err) != stubs.InvalidParams {
+		t.Fatalf("watching after the watch stopped gave %v, want %s", err, stubs.InvalidParams)
+	}
+}
@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"log"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// writeLease is how long a controller keeps the turn to change a board without changing it or asking again, so one
+// that has gone doesn't keep everyone else waiting
+const writeLease = time.Minute
+
+// writeTurn is which controller sharing a game has the turn to change its board, and who is waiting for it
+// While nobody has the turn anyone can change the board, as they always could.
+type writeTurn struct {
+	holder  string
+	expires time.Time
+	waiting []string
+}
+
+// WriteTurn asks for, or gives up, the turn to change the running game's board
+func (s *SecretBrokerOperation) WriteTurn(req stubs.WriteTurnRequest, res *stubs.WriteTurnResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	if req.Controller == "" {
+		return stubs.Errorf(stubs.InvalidParams, "a controller must be named to take turns")
+	}
+	game, err := gameFor(req.Header)
+	if err != nil {
+		return err
+	}
+	if err = game.lockBy(req.Header); err != nil {
+		return err
+	}
+	defer game.mutex.Unlock()
+	turn := &game.writeTurn
+	turn.expire(game.id)
+	switch {
+	case req.Release && turn.holder == req.Controller:
+		turn.passOn(game.id)
+	case req.Release:
+		turn.leaveLine(req.Controller)
+	case turn.holder == "" || turn.holder == req.Controller:
+		turn.give(game.id, req.Controller)
+	case !turn.inLine(req.Controller):
+		turn.waiting = append(turn.waiting, req.Controller)
+	}
+	res.Holder, res.Expires = turn.holder, turn.expires
+	res.Waiting = append([]string(nil), turn.waiting...)
+	return nil
+}
+
+// give gives a controller the turn, or renews its lease on it
+func (turn *writeTurn) give(gameID string, controller string) {
+	if turn.holder != controller {
+		log.Printf("Game %s: %s has the turn to change the board", gameID, controller)
+	}
+	turn.holder, turn.expires = controller, time.Now().Add(writeLease)
+	turn.leaveLine(controller)
+}
+
+// passOn gives the turn to the next controller waiting for it, or to nobody
+func (turn *writeTurn) passOn(gameID string) {
+	if len(turn.waiting) == 0 {
+		log.Printf("Game %s: %s gave up the turn to change the board", gameID, turn.holder)
+		*turn = writeTurn{}
+		return
+	}
+	turn.give(gameID, turn.waiting[0])
+}
+
+// expire passes the turn on once its holder's lease has run out
+func (turn *writeTurn) expire(gameID string) {
+	if turn.holder != "" && time.Now().After(turn.expires) {
+		log.Printf("Game %s: %s's turn to change the board ran out", gameID, turn.holder)
+		turn.passOn(gameID)
+	}
+}
+
+// inLine reports whether a controller is waiting for the turn
+func (turn *writeTurn) inLine(controller string) bool {
+	for _, waiting := range turn.waiting {
+		if waiting == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveLine stops a controller waiting for the turn
+func (turn *writeTurn) leaveLine(controller string) {
+	kept := turn.waiting[:0]
+	for _, waiting := range turn.waiting {
+		if waiting != controller {
+			kept = append(kept, waiting)
+		}
+	}
+	turn.waiting = kept
+}
+
+// mayWrite checks a controller can change the board, renewing its lease if it has the turn
+// Must be called with the game locked.
+func (game *Game) mayWrite(controller string) error {
+	turn := &game.writeTurn
+	turn.expire(game.id)
+	switch turn.holder {
+	case "":
+		return nil
+	case controller:
+		turn.expires = time.Now().Add(writeLease)
+		return nil
+	default:
+		return stubs.Errorf(stubs.InvalidParams, "it's %s's turn to change the board of game %s", turn.holder, game.id)
+	}
+}
@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// askTurn asks for or gives up the turn to change a game's board, giving back who has it and who is waiting
+func askTurn(t *testing.T, gameID string, controller string, release bool) (string, []string) {
+	t.Helper()
+	var res stubs.WriteTurnResponse
+	_ = new(SecretBrokerOperation).WriteTurn(stubs.WriteTurnRequest{Header: stubs.Header{GameID: gameID}, Controller: controller, Release: release}, &res)
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res.Holder, res.Waiting
+}
+
+// setCell changes a cell of a game's board as a controller, giving back the error it gets
+func setCell(gameID string, controller string, x int, y int) error {
+	var res stubs.SetCellsResponse
+	req := stubs.SetCellsRequest{Header: stubs.Header{GameID: gameID}, Controller: controller, Cells: []stubs.CellEdit{{X: x, Y: y, Value: 255}}}
+	_ = new(SecretBrokerOperation).SetCells(req, &res)
+	return res.Err()
+}
+
+// TestWriteTurn checks controllers sharing a game wait in line for the turn to change its board, only whoever has it
+// can change the board, and the turn passes on when given up or when its lease runs out.
+func TestWriteTurn(t *testing.T) {
+	useWorkers(t, 1)
+	start := newBoard(32, 32, 2, 3, 3, 3, 4, 3)
+	id := gameID(t)
+	startGame(t, stubs.StartGameRequest{Header: stubs.Header{GameID: id}, StartingBoard: start, Width: 32, Height: 32, Turns: 1000000})
+	pauseAfter(t, id, 1)
+	if err := setCell(id, "second", 10, 10); err != nil {
+		t.Fatalf("changing the board while nobody has the turn gave %v", err)
+	}
+	check := func(holder string, waiting []string, wantHolder string, wantWaiting ...string) {
+		t.Helper()
+		if holder != wantHolder || !reflect.DeepEqual(append([]string(nil), waiting...), wantWaiting) {
+			t.Fatalf("%s has the turn and %v are waiting, want %s and %v", holder, waiting, wantHolder, wantWaiting)
+		}
+	}
+	holder, waiting := askTurn(t, id, "first", false)
+	check(holder, waiting, "first")
+	holder, waiting = askTurn(t, id, "second", false)
+	check(holder, waiting, "first", "second")
+	askTurn(t, id, "third", false)
+	holder, waiting = askTurn(t, id, "second", false) // asking again doesn't go to the back of the line
+	check(holder, waiting, "first", "second", "third")
+	if err := setCell(id, "second", 11, 11); stubs.Code(err) != stubs.InvalidParams {
+		t.Fatalf("changing the board without the turn gave %v, want %s", err, stubs.InvalidParams)
+	}
+	if err := setCell(id, "first", 11, 11); err != nil {
+		t.Fatalf("changing the board with the turn gave %v", err)
+	}
+	holder, waiting = askTurn(t, id, "third", true)
+	check(holder, waiting, "first", "second")
+	holder, waiting = askTurn(t, id, "first", true)
+	check(holder, waiting, "second")
+	askTurn(t, id, "first", false)
+	current.Lock()
+	game := current.game
+	current.Unlock()
+	game.mutex.Lock()
+	game.writeTurn.expires = time.Now().Add(-time.Second) // as if second had gone without giving the turn up
+	game.mutex.Unlock()
+	if err := setCell(id, "first", 12, 12); err != nil {
+		t.Fatalf("changing the board once the turn passed on gave %v", err)
+	}
+	holder, waiting = askTurn(t, id, "first", true)
+	check(holder, waiting, "")
+	var res stubs.WriteTurnResponse
+	_ = new(SecretBrokerOperation).WriteTurn(stubs.WriteTurnRequest{Header: stubs.Header{GameID: id}}, &res)
+	if err := res.Err(); stubs.Code(err) != stubs.InvalidParams {
+		t.Fatalf("asking for the turn without naming a controller gave %v, want %s", err, stubs.InvalidParams)
+	}
+}
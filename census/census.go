@@ -0,0 +1,284 @@
+package census
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// Other is the name given to objects that don't match any template
+const Other = "other"
+
+// Census counts how many of each kind of object are on a board, by name
+type Census map[string]int
+
+// template is a Life object in one of its phases, drawn with '#' for alive cells
+// Objects with a period greater than 1 have their other phases worked out by running them.
+type template struct {
+	name   string
+	period int
+	rows   []string
+}
+
+// templates is the library of objects the census recognises, all under B3/S23
+var templates = []template{
+	{"block", 1, []string{"##", "##"}},
+	{"beehive", 1, []string{".##.", "#..#", ".##."}},
+	{"loaf", 1, []string{".##.", "#..#", ".#.#", "..#."}},
+	{"boat", 1, []string{"##.", "#.#", ".#."}},
+	{"ship", 1, []string{"##.", "#.#", ".##"}},
+	{"tub", 1, []string{".#.", "#.#", ".#."}},
+	{"pond", 1, []string{".##.", "#..#", "#..#", ".##."}},
+	{"blinker", 2, []string{"###"}},
+	{"toad", 2, []string{".###", "###."}},
+	{"beacon", 2, []string{"##..", "##..", "..##", "..##"}},
+	{"glider", 4, []string{".#.", "..#", "###"}},
+	{"lwss", 4, []string{".#..#", "#....", "#...#", "####."}},
+}
+
+// Pattern gives the rows of a known object, such as glider or lwss, drawn with '#' for alive cells and '.' for dead
+func Pattern(name string) ([]string, bool) {
+	for _, t := range templates {
+		if t.name == name {
+			return t.rows, true
+		}
+	}
+	return nil, false
+}
+
+// maxObjectSize is the most cells an object in the library has, so bigger components are skipped quickly
+var maxObjectSize int
+
+// library maps the canonical form of every phase of every template to the template's name
+var library = buildLibrary()
+
+type point struct {
+	x, y int
+}
+
+// Take counts the objects on a board, treating each group of touching alive cells as one object
+// Groups that aren't in the template library are counted as Other, unless they make a known object together
+// with a nearby group, as the two halves of a beacon do in one of its phases. On a Toroidal board groups carry on
+// across the edges, so an object the edge cuts in two is still counted once.
+func Take(cells [][]uint8, alive func(value uint8) bool, edge rules.Edge) Census {
+	result := Census{}
+	height := len(cells)
+	if height == 0 {
+		return result
+	}
+	width := len(cells[0])
+	wrap := edge == rules.Toroidal
+	visited := make([][]bool, height)
+	for y := range visited {
+		visited[y] = make([]bool, width)
+	}
+	var unknown [][]point // small groups that didn't match on their own
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if visited[y][x] || !alive(cells[y][x]) {
+				continue
+			}
+			component := findComponent(cells, alive, visited, point{x, y}, wrap)
+			if len(component) > maxObjectSize {
+				result[Other]++
+			} else if name, ok := library[canonical(component)]; ok {
+				result[name]++
+			} else {
+				unknown = append(unknown, component)
+			}
+		}
+	}
+	matched := make([]bool, len(unknown))
+	for i := range unknown {
+		for j := i + 1; j < len(unknown) && !matched[i]; j++ {
+			if matched[j] {
+				continue
+			}
+			shift, ok := near(unknown[i], unknown[j], width, height, wrap)
+			if !ok {
+				continue
+			}
+			together := append([]point(nil), unknown[i]...)
+			for _, p := range unknown[j] {
+				together = append(together, point{p.x + shift.x, p.y + shift.y})
+			}
+			if name, ok := library[canonical(together)]; ok {
+				result[name]++
+				matched[i], matched[j] = true, true
+			}
+		}
+		if !matched[i] {
+			result[Other]++
+		}
+	}
+	return result
+}
+
+// near reports whether any cell of one group is within two cells of the other, giving how far the other has to move
+// to be beside the first, which it only does when they are beside each other across the edges of a board that wraps
+func near(a []point, b []point, width int, height int, wrap bool) (point, bool) {
+	for _, p := range a {
+		for _, q := range b {
+			dx, dy := q.x-p.x, q.y-p.y
+			var shift point
+			if wrap {
+				shift = point{shortest(dx, width) - dx, shortest(dy, height) - dy}
+			}
+			if abs(dx+shift.x) <= 2 && abs(dy+shift.y) <= 2 {
+				return shift, true
+			}
+		}
+	}
+	return point{}, false
+}
+
+// shortest gives the shortest distance the same as d along an axis of a board that wraps
+func shortest(d int, size int) int {
+	d = (d%size + size) % size
+	if d > size/2 {
+		d -= size
+	}
+	return d
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// findComponent collects every alive cell touching the start cell, directly or through other alive cells
+// If the board wraps, cells found across an edge are given as beyond it, so the group keeps its shape.
+func findComponent(cells [][]uint8, alive func(value uint8) bool, visited [][]bool, start point, wrap bool) []point {
+	height, width := len(cells), len(cells[0])
+	component := []point{start}
+	visited[start.y][start.x] = true
+	for next := 0; next < len(component); next++ {
+		cell := component[next]
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				x, y := cell.x+dx, cell.y+dy
+				onX, onY := x, y // where the cell is on the board
+				if wrap {
+					onX, onY = (x%width+width)%width, (y%height+height)%height
+				}
+				if onX < 0 || onY < 0 || onX >= width || onY >= height || visited[onY][onX] || !alive(cells[onY][onX]) {
+					continue
+				}
+				visited[onY][onX] = true
+				component = append(component, point{x, y})
+			}
+		}
+	}
+	return component
+}
+
+// canonical gives the same string for a set of cells whatever its position, rotation or reflection
+func canonical(cells []point) string {
+	transforms := []func(p point) point{
+		func(p point) point { return point{p.x, p.y} },
+		func(p point) point { return point{-p.x, p.y} },
+		func(p point) point { return point{p.x, -p.y} },
+		func(p point) point { return point{-p.x, -p.y} },
+		func(p point) point { return point{p.y, p.x} },
+		func(p point) point { return point{-p.y, p.x} },
+		func(p point) point { return point{p.y, -p.x} },
+		func(p point) point { return point{-p.y, -p.x} },
+	}
+	best := ""
+	for _, transform := range transforms {
+		moved := make([]point, len(cells))
+		minX, minY := 0, 0
+		for i, cell := range cells {
+			moved[i] = transform(cell)
+			if i == 0 || moved[i].x < minX {
+				minX = moved[i].x
+			}
+			if i == 0 || moved[i].y < minY {
+				minY = moved[i].y
+			}
+		}
+		sort.Slice(moved, func(i, j int) bool {
+			if moved[i].y != moved[j].y {
+				return moved[i].y < moved[j].y
+			}
+			return moved[i].x < moved[j].x
+		})
+		var builder strings.Builder
+		for _, cell := range moved {
+			builder.WriteString(fmt.Sprintf("%d,%d;", cell.x-minX, cell.y-minY))
+		}
+		if key := builder.String(); best == "" || key < best {
+			best = key
+		}
+	}
+	return best
+}
+
+// buildLibrary works out the canonical form of every phase of every template
+func buildLibrary() map[string]string {
+	forms := make(map[string]string)
+	for _, t := range templates {
+		var cells []point
+		for y, row := range t.rows {
+			for x, c := range row {
+				if c == '#' {
+					cells = append(cells, point{x, y})
+				}
+			}
+		}
+		for phase := 0; phase < t.period; phase++ {
+			forms[canonical(cells)] = t.name
+			if len(cells) > maxObjectSize {
+				maxObjectSize = len(cells)
+			}
+			cells = step(cells)
+		}
+	}
+	return forms
+}
+
+// step runs a small pattern on its own for one turn of B3/S23, on an unbounded board
+func step(cells []point) []point {
+	alive := make(map[point]bool)
+	neighbours := make(map[point]int)
+	for _, cell := range cells {
+		alive[cell] = true
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx != 0 || dy != 0 {
+					neighbours[point{cell.x + dx, cell.y + dy}]++
+				}
+			}
+		}
+	}
+	var next []point
+	for cell, count := range neighbours {
+		if count == 3 || (count == 2 && alive[cell]) {
+			next = append(next, cell)
+		}
+	}
+	return next
+}
+
+// String lists the counts with the most common objects first, e.g. "block: 12, blinker: 3, other: 5"
+func (c Census) String() string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if c[names[i]] != c[names[j]] {
+			return c[names[i]] > c[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s: %d", name, c[name])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,164 @@
+package census
+
+import (
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// gliderPhases are the four phases of a glider heading down and right, drawn by hand rather than worked out by step
+var gliderPhases = [][]string{
+	{".#.", "..#", "###"},
+	{"#.#", ".##", ".#."},
+	{"..#", "#.#", ".##"},
+	{"#..", ".##", "##."},
+}
+
+// orient turns and reflects a drawing, giving it in each of its eight orientations
+func orient(rows []string) [][]string {
+	height, width := len(rows), len(rows[0])
+	at := func(x int, y int) byte { return rows[y][x] }
+	transforms := []struct {
+		width, height int
+		cell          func(x int, y int) byte
+	}{
+		{width, height, func(x, y int) byte { return at(x, y) }},
+		{width, height, func(x, y int) byte { return at(width-1-x, y) }},
+		{width, height, func(x, y int) byte { return at(x, height-1-y) }},
+		{width, height, func(x, y int) byte { return at(width-1-x, height-1-y) }},
+		{height, width, func(x, y int) byte { return at(y, x) }},
+		{height, width, func(x, y int) byte { return at(width-1-y, x) }},
+		{height, width, func(x, y int) byte { return at(y, height-1-x) }},
+		{height, width, func(x, y int) byte { return at(width-1-y, height-1-x) }},
+	}
+	var oriented [][]string
+	for _, transform := range transforms {
+		drawn := make([]string, transform.height)
+		for y := range drawn {
+			row := make([]byte, transform.width)
+			for x := range row {
+				row[x] = transform.cell(x, y)
+			}
+			drawn[y] = string(row)
+		}
+		oriented = append(oriented, drawn)
+	}
+	return oriented
+}
+
+// place draws an object on a board with its top left cell at (x, y), wrapping around the board's edges
+func place(board [][]uint8, rows []string, x int, y int) {
+	height, width := len(board), len(board[0])
+	for j, row := range rows {
+		for i, c := range row {
+			if c == '#' {
+				board[((y+j)%height+height)%height][((x+i)%width+width)%width] = 255
+			}
+		}
+	}
+}
+
+func emptyBoard(width int, height int) [][]uint8 {
+	board := make([][]uint8, height)
+	for y := range board {
+		board[y] = make([]uint8, width)
+	}
+	return board
+}
+
+func alive(value uint8) bool {
+	return value == 255
+}
+
+// TestObjects checks single objects are counted in every phase and orientation.
+func TestObjects(t *testing.T) {
+	tests := []struct {
+		name   string
+		phases [][]string
+	}{
+		{"block", [][]string{{"##", "##"}}},
+		{"beehive", [][]string{{".##.", "#..#", ".##."}}},
+		{"blinker", [][]string{{"###"}, {"#", "#", "#"}}},
+		{"glider", gliderPhases},
+		{"beacon", [][]string{{"##..", "##..", "..##", "..##"}, {"##..", "#...", "...#", "..##"}}},
+		{"lwss", [][]string{{".#..#", "#....", "#...#", "####."}}},
+	}
+	for _, test := range tests {
+		for phase, rows := range test.phases {
+			for orientation, drawn := range orient(rows) {
+				board := emptyBoard(16, 16)
+				place(board, drawn, 5, 6)
+				got := Take(board, alive, rules.Toroidal)
+				if want := (Census{test.name: 1}); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s phase %d orientation %d: got %v, want %v", test.name, phase, orientation, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestBoard checks a board of several objects, some that aren't known, is counted.
+func TestBoard(t *testing.T) {
+	board := emptyBoard(64, 64)
+	place(board, []string{"##", "##"}, 2, 2)
+	place(board, []string{"##", "##"}, 50, 40)
+	place(board, []string{".##.", "#..#", ".##."}, 10, 2)
+	place(board, []string{"###"}, 20, 2)
+	place(board, []string{"#", "#", "#"}, 30, 2)
+	place(board, gliderPhases[0], 40, 2)
+	place(board, orient(gliderPhases[2])[5], 2, 20)
+	place(board, []string{"#"}, 20, 20)                       // dies
+	place(board, []string{"#####", "#####", "#####"}, 30, 30) // too big for any object
+	place(board, []string{".##", "##.", ".#."}, 10, 40)       // an R-pentomino, which isn't in the library
+	got := Take(board, alive, rules.Toroidal)
+	want := Census{"block": 2, "beehive": 1, "blinker": 2, "glider": 2, Other: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got.String() != "other: 3, blinker: 2, block: 2, glider: 2, beehive: 1" {
+		t.Fatalf("listed as %q", got.String())
+	}
+	if got := Take(nil, alive, rules.Toroidal); len(got) != 0 {
+		t.Fatalf("got %v for an empty board", got)
+	}
+}
+
+// TestWraparound checks objects cut in two by the edges of a toroidal board are counted once, and counted as the
+// pieces they are on a board with dead edges.
+func TestWraparound(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		x, y int
+		want Census
+		dead Census
+	}{
+		{"block in the corners", []string{"##", "##"}, -1, -1, Census{"block": 1}, Census{Other: 4}},
+		{"beehive across the left edge", []string{".##.", "#..#", ".##."}, -2, 5, Census{"beehive": 1}, Census{Other: 2}},
+		{"blinker across the bottom edge", []string{"#", "#", "#"}, 7, 14, Census{"blinker": 1}, Census{Other: 2}},
+		{"glider across the top corner", gliderPhases[1], 14, -1, Census{"glider": 1}, Census{Other: 4}},
+		{"beacon's halves on either side", []string{"##..", "#...", "...#", "..##"}, -2, 3, Census{"beacon": 1}, Census{Other: 2}},
+	}
+	for _, test := range tests {
+		board := emptyBoard(16, 16)
+		place(board, test.rows, test.x, test.y)
+		if got := Take(board, alive, rules.Toroidal); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v on a toroidal board, want %v", test.name, got, test.want)
+		}
+		if got := Take(board, alive, rules.Dead); !reflect.DeepEqual(got, test.dead) {
+			t.Errorf("%s: got %v with dead edges, want %v", test.name, got, test.dead)
+		}
+	}
+}
+
+// TestPattern checks known objects can be looked up by name.
+func TestPattern(t *testing.T) {
+	rows, ok := Pattern("glider")
+	if !ok || !reflect.DeepEqual(rows, gliderPhases[0]) {
+		t.Fatalf("got %v, %v for glider", rows, ok)
+	}
+	if _, ok := Pattern("unicorn"); ok {
+		t.Fatal("found an object that isn't in the library")
+	}
+}
@@ -0,0 +1,168 @@
+"""Reference Python client for the broker's JSON API.
+
+The broker serves its API on its -health address:
+
+    go run . broker -health :9030
+
+Every RPC the Go controller makes can be called with Broker.call, by its name and the fields of its request, as
+listed by Broker.methods(). The methods below wrap the ones most useful for scripting experiments. Only the standard
+library is used, so the file can be copied next to a notebook.
+
+    from gol_client import Broker, read_pgm
+
+    broker = Broker("http://127.0.0.1:9030")
+    board = read_pgm("images/64x64.pgm")
+    result = broker.start_game(board, turns=100, Rule="B36/S23")
+    print(result["AliveCount"], "cells alive after", result["CompletedTurns"], "turns")
+
+Boards are lists of rows, each a bytes object of cell values as stored in PGM images: 255 for alive and 0 for dead.
+"""
+
+import base64
+import json
+import os
+import urllib.error
+import urllib.request
+
+
+class BrokerError(Exception):
+    """An RPC the broker answered with an error, with the code saying what kind, such as NoGame or InvalidParams."""
+
+    def __init__(self, code, message):
+        super().__init__("%s: %s" % (code, message))
+        self.code = code
+        self.message = message
+
+
+def new_id():
+    """Makes a random ID for a game or request, like stubs.NewID."""
+    return os.urandom(8).hex()
+
+
+def encode_board(board):
+    """Turns a board into the JSON the broker takes, each row in base64."""
+    return [base64.b64encode(bytes(row)).decode("ascii") for row in board]
+
+
+def decode_board(rows):
+    """Turns a board in the JSON the broker sends back into a list of rows of bytes."""
+    return [base64.b64decode(row) for row in rows or []]
+
+
+def read_pgm(path):
+    """Reads a binary PGM image, such as those in images, as a board."""
+    with open(path, "rb") as image:
+        data = image.read()
+    fields, start = [], 0
+    while len(fields) < 4:  # the magic number, width, height and maximum value, separated by whitespace
+        while data[start:start + 1].isspace():
+            start += 1
+        end = start
+        while not data[end:end + 1].isspace():
+            end += 1
+        fields.append(data[start:end])
+        start = end
+    if fields[0] != b"P5":
+        raise ValueError(path + " isn't a binary PGM image")
+    width, height = int(fields[1]), int(fields[2])
+    start += 1  # the whitespace ending the header
+    return [data[start + y * width:start + (y + 1) * width] for y in range(height)]
+
+
+def write_pgm(path, board):
+    """Writes a board as a binary PGM image."""
+    with open(path, "wb") as image:
+        image.write(b"P5\n%d %d\n255\n" % (len(board[0]), len(board)))
+        for row in board:
+            image.write(bytes(row))
+
+
+class Broker:
+    """A broker's JSON API, at the URL of its -health address."""
+
+    def __init__(self, url="http://127.0.0.1:9030", timeout=None):
+        self.url = url.rstrip("/")
+        self.timeout = timeout  # seconds to wait for each answer, None to wait as long as a game takes
+
+    def call(self, method, game_id="", **fields):
+        """Calls an RPC with the fields of its request, giving its response as a dict, or raising BrokerError."""
+        request = dict(fields, GameID=game_id)
+        request.setdefault("RequestID", new_id())
+        body = json.dumps(request).encode("utf-8")
+        http = urllib.request.Request(self.url + "/api/" + method, data=body,
+                                      headers={"Content-Type": "application/json"})
+        try:
+            with urllib.request.urlopen(http, timeout=self.timeout) as answer:
+                response = json.load(answer)
+        except urllib.error.HTTPError as error:  # an unknown method or a request that isn't valid JSON
+            raise BrokerError("InvalidParams", error.read().decode("utf-8", "replace").strip()) from None
+        if response.get("Error"):
+            raise BrokerError(response["Error"]["Code"], response["Error"]["Message"])
+        return response
+
+    def methods(self):
+        """Lists the RPCs the broker serves, each with a request and response of zero values showing their fields."""
+        with urllib.request.urlopen(self.url + "/api/", timeout=self.timeout) as answer:
+            return json.load(answer)
+
+    def games(self):
+        """Lists the games the broker is running."""
+        return self.call("Games")["Games"] or []
+
+    def running_game(self):
+        """Gives the ID of the game the broker is running, raising BrokerError if there isn't one."""
+        games = self.games()
+        if not games:
+            raise BrokerError("NoGame", "the broker isn't running a game")
+        return games[0]["ID"]
+
+    def start_game(self, board, turns, game_id=None, **fields):
+        """Runs a game from a board for a number of turns, waiting for it to finish.
+
+        Any other fields of StartGameRequest can be given, such as Rule, Edge, StopEarly or Census. The response has
+        FinishedBoard decoded, and the game's ID added as GameID. Run it in a thread to look at the game as it runs.
+        """
+        game_id = game_id or new_id()
+        response = self.call("StartGame", game_id, StartingBoard=encode_board(board), Width=len(board[0]),
+                             Height=len(board), Turns=turns, **fields)
+        response["FinishedBoard"] = decode_board(response.get("FinishedBoard"))
+        response["GameID"] = game_id
+        return response
+
+    def statistics(self, game_id=""):
+        """Gives the running game's turn, alive cell count and ages, without its board."""
+        return self.call("AliveCellCount", game_id)
+
+    def region(self, x, y, width, height, game_id=""):
+        """Gives a rectangle of the running game's board and the turn it is from."""
+        response = self.call("GetRegion", game_id, X=x, Y=y, Width=width, Height=height)
+        return decode_board(response["Cells"]), response["CompletedTurns"]
+
+    def set_cells(self, cells, controller="", game_id=""):
+        """Sets cells of the running game's board between turns, from (x, y, value) tuples."""
+        edits = [{"X": x, "Y": y, "Value": value} for x, y, value in cells]
+        return self.call("SetCells", game_id, Controller=controller, Cells=edits)
+
+    def inject_pattern(self, name, x, y, controller="", game_id=""):
+        """Places a known object, such as glider or lwss, on the running game's board with its top left at x, y."""
+        return self.call("InjectPattern", game_id, Controller=controller, Name=name, X=x, Y=y)
+
+    def pause(self, game_id=""):
+        """Pauses the running game once its current turn has finished."""
+        return self.call("Pause", game_id)
+
+    def resume(self, game_id=""):
+        """Carries on with the paused game."""
+        return self.call("Resume", game_id)
+
+    def history(self, game_id="", first=0, last=0):
+        """Gives the statistics of the game's turns from first to last, 0 for the latest, as a list of dicts."""
+        turns = []
+        while True:
+            response = self.call("History", game_id, From=first, To=last, Limit=10000)
+            if last == 0:  # stop at the turn the game had reached when it was asked, rather than chasing it
+                last = response["Latest"]
+            turns.extend(response["Turns"] or [])
+            if not response["Turns"] or response["Next"] > last:
+                return turns
+            first = response["Next"]
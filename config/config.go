@@ -0,0 +1,281 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Version is the version of the gol binary, shared by every subcommand
+const Version = "1.0.0"
+
+// Defaults used when no flags are given, matching a single-machine setup
+const (
+	DefaultBrokerPort    = "8030"
+	DefaultWorkerPort    = "8031"
+	DefaultBrokerAddress = "127.0.0.1:8030"
+)
+
+// DefaultWorkers are the worker addresses the broker dials if none are given
+var DefaultWorkers = []string{"127.0.0.1:8031", "127.0.0.1:8032", "127.0.0.1:8033", "127.0.0.1:8034"}
+
+// Config holds the settings shared by the broker, worker and controller subcommands
+type Config struct {
+	Port          string   // port the broker or worker listens on
+	Socket        string   // Unix socket the broker or worker listens on instead of Port, empty to use Port
+	QUIC          bool     // listen for QUIC on the UDP Port instead of TCP
+	QUICInsecure  bool     // dial QUIC addresses without a certificate fingerprint, see stubs.QUICInsecure
+	BrokerAddress string   // address used to reach the broker
+	Workers       []string // addresses of the workers the broker uses
+	AddressFile   string   // file to write the address actually listened on to, for scripts
+	Bind          string   // host or IP to listen on, empty for every interface
+	Advertise     string   // host or IP others should dial to reach us, if not the one listened on
+	LogFile       string   // file to write the log to as well as the terminal, empty for just the terminal
+	HealthAddress string   // address to answer HTTP health probes on, empty for none
+	LogMaxSize    int      // megabytes the log file can reach before it is rotated
+	LogKeep       int      // rotated log files to keep
+	showVersion   bool
+	portSet       bool // whether -port was given, rather than left as the default
+}
+
+// addressList lets a comma-separated list of addresses be passed as a single flag
+type addressList []string
+
+func (list *addressList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *addressList) Set(value string) error {
+	*list = nil
+	for _, address := range strings.Split(value, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			*list = append(*list, address)
+		}
+	}
+	return nil
+}
+
+// VersionString describes the binary version and the platform it was built for
+func VersionString() string {
+	return fmt.Sprintf("gol %s (%s %s/%s)", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// NewFlagSet creates the flag set for a subcommand with the shared flags already registered
+// Only subcommands that listen, the broker and worker, give a default port, and only they get the flags saying
+// where to listen.
+func (c *Config) NewFlagSet(name string, defaultPort string) *flag.FlagSet {
+	c.Workers = append([]string(nil), DefaultWorkers...)
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	if defaultPort != "" {
+		flags.StringVar(&c.Port, "port", defaultPort, "Port to listen on, a range such as 8031-8040 to use the first free one, or 0 for any free port. If the default is taken, any free port is used.")
+		flags.StringVar(&c.AddressFile, "addressFile", "", "Write the address actually listened on to this file.")
+		flags.StringVar(&c.Bind, "bind", "", "Host name or IP address to listen on, e.g. 10.0.0.5 or ::1. Defaults to every interface.")
+		flags.StringVar(&c.Advertise, "advertise", "", "Host name or IP address others should use to reach this process, if not the one it listens on.")
+		flags.StringVar(&c.Socket, "socket", "", "Unix socket to listen on instead of a TCP port, e.g. /tmp/gol-worker-1.sock, dialled by others as unix:/tmp/gol-worker-1.sock. Avoids port clashes on shared machines.")
+		flags.BoolVar(&c.QUIC, "quic", false, "Listen for QUIC over UDP on the port instead of TCP, dialled by others as quic:host:port#fingerprint with the fingerprint printed. Recovers from lost packets faster than TCP on lossy wide-area links, and carries on when a peer's address changes. Needs gol built with -tags quic.")
+	}
+	flags.BoolVar(&c.QUICInsecure, "quicInsecure", false, "Dial QUIC addresses that don't give the fingerprint of the certificate expected at them, accepting whichever answers.")
+	flags.StringVar(&c.BrokerAddress, "broker", DefaultBrokerAddress, "Address of the broker.")
+	flags.Var((*addressList)(&c.Workers), "workers", "Comma-separated list of worker addresses.")
+	flags.StringVar(&c.HealthAddress, "health", "", "Address to answer /healthz and /readyz HTTP probes on, e.g. :9030, which the broker also serves its JSON API, /chart.svg, /board.pgm and the browser viewer on. Defaults to none.")
+	flags.StringVar(&c.LogFile, "logFile", "", "Also write the log to this file, rotating it when it gets too big.")
+	flags.IntVar(&c.LogMaxSize, "logMaxSize", 10, "Megabytes the log file can reach before it is rotated.")
+	flags.IntVar(&c.LogKeep, "logKeep", 5, "Number of rotated log files to keep.")
+	flags.BoolVar(&c.showVersion, "version", false, "Print version information and exit.")
+	return flags
+}
+
+// Parse parses the subcommand arguments, printing the version and exiting if requested
+func (c *Config) Parse(flags *flag.FlagSet, args []string) {
+	_ = flags.Parse(args) // flag.ExitOnError means errors never reach here
+	if c.showVersion {
+		fmt.Println(VersionString())
+		os.Exit(0)
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			c.portSet = true
+		}
+	})
+	var err error
+	logWriters := []io.Writer{os.Stderr, Recent}
+	if c.LogFile != "" {
+		logFile, err := OpenRotatingFile(c.LogFile, int64(c.LogMaxSize)<<20, c.LogKeep)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Log file error:", err)
+			os.Exit(2)
+		}
+		logWriters = append(logWriters, logFile)
+	}
+	log.SetOutput(io.MultiWriter(logWriters...))
+	stubs.QUICInsecure = c.QUICInsecure
+	if c.BrokerAddress, err = NormaliseAddress(c.BrokerAddress, DefaultBrokerPort); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for i := range c.Workers {
+		if c.Workers[i], err = NormaliseAddress(c.Workers[i], DefaultWorkerPort); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+}
+
+// NormaliseAddress turns a host name, IP address or either with a port into an address that can be dialled,
+// adding the default port if none is given, e.g. "::1" becomes "[::1]:8031" and "worker-1" becomes "worker-1:8031"
+// Unix socket addresses, such as "unix:/tmp/gol-worker-1.sock", are left as they are, and QUIC addresses, such as
+// "quic:worker-1", keep their prefix and any certificate fingerprint.
+func NormaliseAddress(address string, defaultPort string) (string, error) {
+	switch network, path := stubs.Network(address); network {
+	case "unix":
+		if path == "" {
+			return "", fmt.Errorf("invalid address %q, expected unix: followed by the socket's path", address)
+		}
+		return address, nil
+	case "quic":
+		path, fingerprint := stubs.SplitFingerprint(path)
+		if inner, _ := stubs.Network(path); inner != "tcp" {
+			return "", fmt.Errorf("invalid address %q, expected quic: followed by a host and port", address)
+		}
+		if strings.Contains(address, "#") {
+			if decoded, err := hex.DecodeString(fingerprint); err != nil || len(decoded) != sha256.Size {
+				return "", fmt.Errorf("invalid certificate fingerprint in address %q, expected the SHA-256 of the certificate in hex", address)
+			}
+		}
+		normalised, err := NormaliseAddress(path, defaultPort)
+		if err != nil {
+			return "", err
+		}
+		if fingerprint != "" {
+			normalised += "#" + strings.ToLower(fingerprint)
+		}
+		return stubs.QUICPrefix + normalised, nil
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if _, err = strconv.Atoi(port); err != nil {
+			return "", fmt.Errorf("invalid port in address %q", address)
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if host == "" || strings.ContainsAny(host, "[] ") {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	return net.JoinHostPort(host, defaultPort), nil
+}
+
+// Listen listens on the first free port in the -port range, or on any free port if the default port is taken
+// The address listened on is printed, and written to the -addressFile if one was given, so it can be found
+// whichever port was chosen. With -socket it listens on that Unix socket instead, and with -quic it listens for QUIC
+// on the UDP port.
+func (c *Config) Listen(name string) (net.Listener, error) {
+	listener, err := c.listen()
+	if err != nil {
+		return nil, err
+	}
+	address := AdvertisedAddress(listener, c.Advertise)
+	log.Println(name, "listening on", address)
+	if c.AddressFile != "" {
+		if err = ioutil.WriteFile(c.AddressFile, []byte(address+"\n"), 0644); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// AdvertisedAddress gives the address others should dial to reach a listener, using the advertised host if there is one
+// A listener on every interface is advertised on the loopback address, which only suits a single machine.
+func AdvertisedAddress(listener net.Listener, advertise string) string {
+	if socket, ok := listener.Addr().(*net.UnixAddr); ok {
+		return stubs.UnixPrefix + socket.Name
+	}
+	ip, port, prefix, suffix := net.IP(nil), 0, "", ""
+	switch address := listener.Addr().(type) {
+	case *net.UDPAddr: // only QUIC listens on UDP
+		ip, port, prefix = address.IP, address.Port, stubs.QUICPrefix
+		if pinned, ok := listener.(interface{ Fingerprint() string }); ok {
+			suffix = "#" + pinned.Fingerprint()
+		}
+	case *net.TCPAddr:
+		ip, port = address.IP, address.Port
+	}
+	host := ip.String()
+	if advertise != "" {
+		host = strings.TrimSuffix(strings.TrimPrefix(advertise, "["), "]")
+	} else if ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return prefix + net.JoinHostPort(host, strconv.Itoa(port)) + suffix
+}
+
+// listen listens on the -socket, or on the first free port in the -port range, falling back to any free port
+func (c *Config) listen() (net.Listener, error) {
+	if c.Socket != "" {
+		return listenUnix(c.Socket)
+	}
+	first, last, err := parsePortRange(c.Port)
+	if err != nil {
+		return nil, err
+	}
+	listen := func(address string) (net.Listener, error) {
+		return net.Listen("tcp", address)
+	}
+	if c.QUIC {
+		listen = stubs.ListenQUIC
+	}
+	var listener net.Listener
+	for port := first; port <= last; port++ {
+		if listener, err = listen(net.JoinHostPort(c.Bind, strconv.Itoa(port))); err == nil {
+			break
+		}
+	}
+	if err != nil && !c.portSet { // someone else is using the default port, so pick another
+		listener, err = listen(net.JoinHostPort(c.Bind, "0"))
+	}
+	return listener, err
+}
+
+// listenUnix listens on a Unix socket, first removing one left behind by a process that was killed
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if connection, err := net.Dial("unix", path); err == nil {
+			_ = connection.Close()
+			return nil, fmt.Errorf("%s is already being listened on", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// parsePortRange reads a port, or a range of ports written as first-last
+func parsePortRange(text string) (int, int, error) {
+	bounds := strings.SplitN(text, "-", 2)
+	first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", text)
+	}
+	last := first
+	if len(bounds) == 2 {
+		if last, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid port range %q", text)
+		}
+	}
+	if first < 0 || last > 65535 {
+		return 0, 0, fmt.Errorf("port %q is out of range", text)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// RecentLog keeps the last lines written to the log, so they can be fetched over RPC without access to the machine
+type RecentLog struct {
+	mutex   sync.Mutex
+	lines   []string
+	next    int // where the next line goes once the buffer is full
+	partial []byte
+}
+
+// recentLogLines is how many lines of the log are kept for diagnostics
+const recentLogLines = 500
+
+// Recent holds the end of this process's log, written to by every log call once the flags are parsed
+var Recent = &RecentLog{}
+
+var started = time.Now()
+
+func (recent *RecentLog) Write(data []byte) (int, error) {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+	recent.partial = append(recent.partial, data...)
+	for {
+		end := bytes.IndexByte(recent.partial, '\n')
+		if end < 0 {
+			break
+		}
+		line := string(recent.partial[:end])
+		recent.partial = recent.partial[end+1:]
+		if len(recent.lines) < recentLogLines {
+			recent.lines = append(recent.lines, line)
+		} else {
+			recent.lines[recent.next] = line
+			recent.next = (recent.next + 1) % recentLogLines
+		}
+	}
+	return len(data), nil
+}
+
+// Lines gives up to the last count lines of the log, oldest first
+func (recent *RecentLog) Lines(count int) []string {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+	ordered := append(append([]string(nil), recent.lines[recent.next:]...), recent.lines[:recent.next]...)
+	if count < len(ordered) {
+		ordered = ordered[len(ordered)-count:]
+	}
+	return ordered
+}
+
+// Diagnose describes this process's runtime state along with the last lines of its log
+func Diagnose(lines int) stubs.Diagnostics {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	host, _ := os.Hostname()
+	return stubs.Diagnostics{
+		Host:       host,
+		Version:    Version,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		Uptime:     time.Since(started),
+		Goroutines: runtime.NumGoroutine(),
+		HeapBytes:  memory.HeapAlloc,
+		GCRuns:     memory.NumGC,
+		Log:        Recent.Lines(lines),
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a log file that is moved aside once it reaches a maximum size
+// The current log is always at Path, the previous one at Path.1, the one before that at Path.2
+// and so on, with the oldest deleted once there are more than Keep old files.
+type RotatingFile struct {
+	Path    string
+	MaxSize int64 // bytes written before rotating
+	Keep    int   // old files to keep
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+}
+
+// OpenRotatingFile opens a log file for appending, creating it if needed
+func OpenRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("maximum log size must be positive")
+	}
+	rotating := &RotatingFile{Path: path, MaxSize: maxSize, Keep: keep}
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+func (rotating *RotatingFile) open() error {
+	file, err := os.OpenFile(rotating.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	rotating.file, rotating.size = file, info.Size()
+	return nil
+}
+
+// Write appends to the log, rotating first if the write would take it past the maximum size
+func (rotating *RotatingFile) Write(data []byte) (int, error) {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+	if rotating.size > 0 && rotating.size+int64(len(data)) > rotating.MaxSize {
+		if err := rotating.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	written, err := rotating.file.Write(data)
+	rotating.size += int64(written)
+	return written, err
+}
+
+// rotate shifts every old file along by one, dropping the oldest, and starts a new log
+func (rotating *RotatingFile) rotate() error {
+	if err := rotating.file.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(rotating.oldPath(rotating.Keep))
+	for i := rotating.Keep - 1; i >= 1; i-- {
+		_ = os.Rename(rotating.oldPath(i), rotating.oldPath(i+1)) // older files may not exist yet
+	}
+	if rotating.Keep > 0 {
+		if err := os.Rename(rotating.Path, rotating.oldPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(rotating.Path); err != nil {
+		return err
+	}
+	return rotating.open()
+}
+
+func (rotating *RotatingFile) oldPath(i int) string {
+	return fmt.Sprintf("%s.%d", rotating.Path, i)
+}
+
+// Close closes the current log file
+func (rotating *RotatingFile) Close() error {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+	return rotating.file.Close()
+}
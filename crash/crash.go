@@ -0,0 +1,105 @@
+package crash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory is where crash dumps are written
+const Directory = "crash"
+
+// Dump is what a broker or worker knows about the work it was doing when it panicked
+type Dump struct {
+	Role    string // broker or worker
+	Turn    int
+	Details []string                // anything else needed to carry on from the board, such as the rule
+	Board   [][]uint8               // cells of the board, or section of it, being worked on
+	WriteTo func(path string) error // writes the board as a PGM image instead, when it's too big to hold, e.g. tiled
+}
+
+// Write saves the dump as a text file with the panic and its stack, and the board beside it as a PGM image,
+// giving the path of the text file
+// Writing the board can fail if the board is what was broken, so the text file is always written first.
+func Write(dump Dump, recovered interface{}, stack []byte) (string, error) {
+	if err := os.MkdirAll(Directory, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := filepath.Join(Directory, dump.Role+"-"+time.Now().Format("20060102-150405"))
+	report := []string{
+		fmt.Sprintf("gol %s panicked at %s", dump.Role, time.Now().Format(time.RFC3339)),
+		fmt.Sprintf("panic: %v", recovered),
+		fmt.Sprintf("turn: %d", dump.Turn),
+	}
+	report = append(report, dump.Details...)
+	if dump.Board != nil || dump.WriteTo != nil {
+		report = append(report, "board: "+name+".pgm")
+	}
+	report = append(report, "", string(stack))
+	if err := writeFile(name+".txt", []byte(strings.Join(report, "\n"))); err != nil {
+		return "", err
+	}
+	writeTo := dump.WriteTo
+	if dump.Board != nil {
+		writeTo = func(path string) error {
+			return WritePGM(path, dump.Board)
+		}
+	}
+	if writeTo == nil {
+		return name + ".txt", nil
+	}
+	return name + ".txt", writeBoard(name+".pgm", writeTo)
+}
+
+// writeBoard writes the board, recovering from a board too broken to be written
+func writeBoard(path string, writeTo func(path string) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("board couldn't be written: %v", recovered)
+		}
+	}()
+	return writeTo(path)
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WritePGM writes the cells as a binary greyscale image
+func WritePGM(path string, cells [][]uint8) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = WritePGMTo(file, cells); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WritePGMTo writes the cells as a binary greyscale image to a writer, such as one that encrypts them
+func WritePGMTo(w io.Writer, cells [][]uint8) error {
+	writer := bufio.NewWriter(w)
+	width := 0
+	if len(cells) > 0 {
+		width = len(cells[0])
+	}
+	fmt.Fprintf(writer, "P5\n%d %d\n255\n", width, len(cells))
+	for _, row := range cells {
+		_, _ = writer.Write(row)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+const ctlUsage = `Usage: gol ctl [flags] <command>
+
+Commands:
+  status    show whether the broker is idle, running, paused or closing
+  games     list the games the broker is running
+  pause     pause the running game
+  resume    carry on with the paused game
+  snapshot  save the running game's current board as an image in out
+  workers   show each of the broker's workers and whether it answers
+  logs      show the runtime state and recent log of the broker and each worker
+  history   print the statistics of each turn of a game as CSV
+  set       set the cell at -x,-y of the running game's board to -value
+  inject    place -pattern on the running game's board with its top left corner at -x,-y
+  region    save the -w by -h rectangle of the running game's board at -x,-y as an image in out
+  bookmark  keep the running game's current turn on the broker as -name
+  jump      take the paused game back to the bookmark -name
+  bookmarks list the running game's bookmarks
+  claim     ask for the turn to change the running game's board as -as, or wait in line for it
+  release   give up the turn to change the running game's board as -as, or stop waiting for it
+  watch     print each cell of the -w by -h rectangle at -x,-y as it changes, as CSV, until the game ends
+  shutdown  close the broker and its workers
+
+Flags:
+`
+
+// runCtl administers a running broker from the command line, without needing a controller window
+func runCtl(args []string) {
+	var cfg config.Config
+	flags := cfg.NewFlagSet("ctl", "")
+	lines := flags.Int("lines", 20, "Lines of each log to show with logs.")
+	keepPaused := flags.Bool("keepPaused", false, "Leave the game paused after taking a snapshot.")
+	gameID := flags.String("game", "", "Game to print the history of, the running game if empty.")
+	from := flags.Int("from", 0, "First turn of the history to print.")
+	to := flags.Int("to", 0, "Last turn of the history to print, 0 for the latest.")
+	x := flags.Int("x", 0, "Column of the cell to set, or of the left of the pattern to inject or region to save or watch.")
+	y := flags.Int("y", 0, "Row of the cell to set, or of the top of the pattern to inject or region to save or watch.")
+	width := flags.Int("w", 64, "Width of the region to save or watch.")
+	height := flags.Int("h", 64, "Height of the region to save or watch.")
+	value := flags.Int("value", 255, "Value to set the cell to with set, as stored in images: 255 for alive and 0 for dead.")
+	pattern := flags.String("pattern", "glider", "Pattern to inject: a known object such as glider, block or lwss, or rows separated by / with # for alive cells and . for dead ones, e.g. .#./..#/###.")
+	name := flags.String("name", "", "Name of the bookmark to keep or jump to: a bookmark is named after its turn if empty, and the latest is jumped to.")
+	as := flags.String("as", "", "Controller to set, inject, claim or release as, when controllers share a game and take turns changing its board.")
+	timeout := flags.Duration("timeout", 10*time.Second, "How long the broker has to take a snapshot before giving up, rather than waiting for a long turn to end.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, ctlUsage)
+		flags.PrintDefaults()
+	}
+	cfg.Parse(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if flags.Arg(0) == "workers" { // works even when the broker is stuck, as it only asks for the worker list
+		handleError("Workers error", ctlWorkers(cfg.BrokerAddress))
+		return
+	}
+	broker, err := stubs.DialBroker(cfg.BrokerAddress)
+	handleError("Dial broker error", err)
+	defer broker.Close()
+	switch flags.Arg(0) {
+	case "status":
+		err = ctlStatus(broker)
+	case "games":
+		err = ctlGames(broker)
+	case "pause":
+		err = ctlPause(broker, true)
+	case "resume":
+		err = ctlPause(broker, false)
+	case "snapshot":
+		err = ctlSnapshot(broker, *timeout, *keepPaused)
+	case "logs":
+		err = ctlLogs(broker, *lines)
+	case "history":
+		err = ctlHistory(broker, *gameID, *from, *to)
+	case "set":
+		err = ctlSet(broker, *as, *x, *y, *value)
+	case "inject":
+		err = ctlInject(broker, *as, *x, *y, *pattern)
+	case "region":
+		err = ctlRegion(broker, *x, *y, *width, *height)
+	case "bookmark", "jump", "bookmarks":
+		err = ctlBookmark(broker, flags.Arg(0), *name)
+	case "claim", "release":
+		err = ctlWriteTurn(broker, *as, flags.Arg(0) == "release")
+	case "watch":
+		err = ctlWatch(broker, *x, *y, *width, *height)
+	case "shutdown":
+		err = ctlShutdown(broker)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	handleError(flags.Arg(0)+" error", err)
+}
+
+// ctlStatus prints the broker's state and how far its game has got
+func ctlStatus(broker *stubs.Broker) error {
+	response := new(stubs.StatusResponse)
+	if err := broker.Status(stubs.StatusRequest{Header: stubs.NewHeader("")}, response); err != nil {
+		return err
+	}
+	fmt.Printf("%s for %v, %d games or batches running\n", response.State, time.Since(response.Since).Round(time.Second), response.Running)
+	if response.GameID != "" {
+		fmt.Printf("game %s at turn %d of %d\n", response.GameID, response.CompletedTurns, response.Turns)
+	}
+	return nil
+}
+
+// ctlGames prints a line for each game the broker is running
+func ctlGames(broker *stubs.Broker) error {
+	response := new(stubs.GamesResponse)
+	if err := broker.Games(stubs.GamesRequest{Header: stubs.NewHeader("")}, response); err != nil {
+		return err
+	}
+	if response.Running == 0 {
+		fmt.Println("No games running")
+		return nil
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "GAME\tSIZE\tTURN\tOF\tENGINE\tWORKERS\tPRIORITY\tSTATE")
+	for _, game := range response.Games {
+		engine := game.Engine
+		if game.Tiled {
+			engine += " (tiled)"
+		}
+		state := "running"
+		if game.Paused {
+			state = "paused"
+		}
+		fmt.Fprintf(table, "%s\t%dx%d\t%d\t%d\t%s\t%d\t%d\t%s\n", game.ID, game.Width, game.Height, game.CompletedTurns, game.Turns, engine, game.Workers, game.Priority, state)
+	}
+	_ = table.Flush()
+	if batches := response.Running - len(response.Games); batches > 0 {
+		fmt.Println("and", batches, "batches")
+	}
+	return nil
+}
+
+// runningGame gets the game the broker is running, failing if there isn't one
+func runningGame(broker *stubs.Broker) (stubs.GameStatus, error) {
+	response := new(stubs.GamesResponse)
+	if err := broker.Games(stubs.GamesRequest{Header: stubs.NewHeader("")}, response); err != nil {
+		return stubs.GameStatus{}, err
+	}
+	if len(response.Games) == 0 {
+		return stubs.GameStatus{}, errors.New("no game is running")
+	}
+	return response.Games[0], nil
+}
+
+// ctlPause pauses or resumes the running game, doing nothing if it is already as asked
+func ctlPause(broker *stubs.Broker, pause bool) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	if game.Paused == pause {
+		fmt.Println("Already", map[bool]string{true: "paused", false: "running"}[pause], "at turn", game.CompletedTurns)
+		return nil
+	}
+	response := new(stubs.PauseResponse)
+	request := stubs.PauseRequest{Header: stubs.NewHeader(game.ID)}
+	if pause {
+		err = broker.Pause(request, response)
+	} else {
+		err = broker.Resume(request, response)
+	}
+	if err != nil {
+		return err
+	}
+	if pause {
+		fmt.Println("Paused after turn", response.CompletedTurns)
+	} else {
+		fmt.Println("Continuing from turn", response.CompletedTurns)
+	}
+	return nil
+}
+
+// ctlSnapshot saves the running game's board in out, named like the controller's images
+// The game is paused between turns while the board is taken, so the board matches its turn, unless -keepPaused.
+// A tiled board is too big to send, so the broker saves it where it runs instead.
+func ctlSnapshot(broker *stubs.Broker, timeout time.Duration, keepPaused bool) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	response := new(stubs.SnapshotResponse)
+	request := stubs.SnapshotRequest{Header: stubs.NewHeader(game.ID).Within(timeout), Resume: !keepPaused}
+	if err = broker.Snapshot(request, response); err != nil {
+		return err
+	}
+	if response.Paused {
+		fmt.Println("Game paused at turn", response.CompletedTurns)
+	}
+	if response.ImagePath != "" {
+		fmt.Println("Broker saved turn", response.CompletedTurns, "as", response.ImagePath)
+		return nil
+	}
+	if err = os.MkdirAll("out", os.ModePerm); err != nil {
+		return err
+	}
+	name := gol.SnapshotName(response.Width, response.Height, response.CompletedTurns)
+	path := filepath.Join("out", name+".pgm")
+	if err = writePGM(path, response.Board); err != nil {
+		return err
+	}
+	fmt.Println("Saved turn", response.CompletedTurns, "as", path)
+	return gol.WriteSnapshotInfo(name, gol.SnapshotInfo{Game: game.ID, Turn: response.CompletedTurns, Width: response.Width,
+		Height: response.Height, Rule: game.Rule, Edge: game.Edge, Seed: game.Seed, BirthProbability: game.BirthProbability,
+		DeathProbability: game.DeathProbability, Engine: game.Engine, Checksum: stubs.Sum(response.Board)})
+}
+
+// writePGM writes a board as a binary greyscale image
+func writePGM(path string, cells [][]uint8) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	height, width := len(cells), 0
+	if height > 0 {
+		width = len(cells[0])
+	}
+	fmt.Fprintf(writer, "P5\n%d %d\n255\n", width, height)
+	for _, row := range cells {
+		_, _ = writer.Write(row)
+	}
+	if err = writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ctlWorkers asks the broker for its workers and checks each one answers, like doctor does
+func ctlWorkers(brokerAddress string) error {
+	version, err := callVersion(brokerAddress, false)
+	if err != nil {
+		return err
+	}
+	if len(version.Workers) == 0 {
+		fmt.Println("The broker has no workers")
+		return nil
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "WORKER\tVERSION\tSTATUS")
+	for _, address := range version.Workers {
+		start := time.Now()
+		workerVersion, err := callVersion(address, true)
+		if err != nil {
+			fmt.Fprintf(table, "%s\t-\t%v\n", address, err)
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\tanswered in %v\n", address, workerVersion.Version, time.Since(start).Round(time.Millisecond))
+	}
+	return table.Flush()
+}
+
+// ctlLogs prints the runtime state and the end of the log of the broker and each of its workers
+func ctlLogs(broker *stubs.Broker, lines int) error {
+	response := new(stubs.DiagnosticsResponse)
+	if err := broker.Diagnostics(stubs.DiagnosticsRequest{Header: stubs.NewHeader(""), Lines: lines}, response); err != nil {
+		return err
+	}
+	printDiagnostics("broker", response.Broker)
+	for _, worker := range response.Workers {
+		printDiagnostics("worker "+worker.Address, worker)
+	}
+	return nil
+}
+
+func printDiagnostics(name string, diagnostics stubs.Diagnostics) {
+	fmt.Println("==", name)
+	if diagnostics.Error != "" {
+		fmt.Println("unavailable:", diagnostics.Error)
+		fmt.Println()
+		return
+	}
+	fmt.Printf("%s, version %s on %s with %d CPUs, up %v\n", diagnostics.Host, diagnostics.Version, diagnostics.Platform,
+		diagnostics.CPUs, diagnostics.Uptime.Round(time.Second))
+	fmt.Printf("%d goroutines, %.1fMB heap, %d garbage collections\n", diagnostics.Goroutines,
+		float64(diagnostics.HeapBytes)/(1<<20), diagnostics.GCRuns)
+	for _, line := range diagnostics.Log {
+		fmt.Println("  " + line)
+	}
+	fmt.Println()
+}
+
+// historyPage is how many turns of a history are fetched at a time
+const historyPage = 10000
+
+// ctlHistory prints the statistics of each turn of a game from from to to, a page at a time
+func ctlHistory(broker *stubs.Broker, gameID string, from int, to int) error {
+	fmt.Println("turn,population,births,deaths,density")
+	for {
+		response := new(stubs.HistoryResponse)
+		err := broker.History(stubs.HistoryRequest{Header: stubs.NewHeader(gameID), From: from, To: to, Limit: historyPage}, response)
+		if err != nil {
+			return err
+		}
+		if to == 0 { // stop at the turn the game had reached when it was asked, rather than chasing it
+			to = response.Latest
+		}
+		for _, turn := range response.Turns {
+			fmt.Printf("%d,%d,%d,%d,%g\n", turn.Turn, turn.Population, turn.Births, turn.Deaths, turn.Density)
+		}
+		if len(response.Turns) == 0 || response.Next > to {
+			return nil
+		}
+		from = response.Next
+	}
+}
+
+// ctlSet sets a cell of the running game's board between two turns
+func ctlSet(broker *stubs.Broker, as string, x int, y int, value int) error {
+	if value < 0 || value > 255 {
+		return fmt.Errorf("value %d isn't between 0 and 255", value)
+	}
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	response := new(stubs.SetCellsResponse)
+	request := stubs.SetCellsRequest{Header: stubs.NewHeader(game.ID), Controller: as, Cells: []stubs.CellEdit{{X: x, Y: y, Value: uint8(value)}}}
+	if err = broker.SetCells(request, response); err != nil {
+		return err
+	}
+	fmt.Println("Changed", response.Changed, "cells after turn", response.CompletedTurns)
+	return nil
+}
+
+// ctlInject places a pattern on the running game's board between two turns
+func ctlInject(broker *stubs.Broker, as string, x int, y int, pattern string) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	request := stubs.InjectPatternRequest{Header: stubs.NewHeader(game.ID), Controller: as, X: x, Y: y}
+	if strings.ContainsAny(pattern, "#O./") {
+		request.Rows = strings.Split(pattern, "/")
+	} else {
+		request.Name = pattern
+	}
+	response := new(stubs.SetCellsResponse)
+	if err = broker.InjectPattern(request, response); err != nil {
+		return err
+	}
+	fmt.Println("Changed", response.Changed, "cells after turn", response.CompletedTurns)
+	return nil
+}
+
+// ctlRegion saves a rectangle of the running game's board in out, without fetching the rest of it
+func ctlRegion(broker *stubs.Broker, x int, y int, width int, height int) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	response := new(stubs.RegionResponse)
+	request := stubs.RegionRequest{Header: stubs.NewHeader(game.ID), X: x, Y: y, Width: width, Height: height}
+	if err = broker.GetRegion(request, response); err != nil {
+		return err
+	}
+	if err = os.MkdirAll("out", os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join("out", fmt.Sprintf("%dx%dx%d-region-%d,%d.pgm", width, height, response.CompletedTurns, x, y))
+	if err = writePGM(path, response.Cells); err != nil {
+		return err
+	}
+	fmt.Println("Saved turn", response.CompletedTurns, "of the region as", path)
+	return nil
+}
+
+// ctlBookmark keeps, jumps to or lists the running game's bookmarks, then lists them
+func ctlBookmark(broker *stubs.Broker, command string, name string) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	request := stubs.BookmarkRequest{Header: stubs.NewHeader(game.ID), Name: name}
+	response := new(stubs.BookmarkResponse)
+	switch command {
+	case "bookmark":
+		err = broker.Bookmark(request, response)
+	case "jump":
+		err = broker.JumpToBookmark(request, response)
+	default:
+		err = broker.Bookmarks(request, response)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Game at turn", response.CompletedTurns)
+	for _, mark := range response.Bookmarks {
+		fmt.Printf("%-20s turn %d\n", mark.Name, mark.Turn)
+	}
+	return nil
+}
+
+// ctlWriteTurn asks for, or gives up, the turn to change the running game's board, then shows whose turn it is
+func ctlWriteTurn(broker *stubs.Broker, as string, release bool) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	request := stubs.WriteTurnRequest{Header: stubs.NewHeader(game.ID), Controller: as, Release: release}
+	response := new(stubs.WriteTurnResponse)
+	if err = broker.WriteTurn(request, response); err != nil {
+		return err
+	}
+	if response.Holder == "" {
+		fmt.Println("Nobody has the turn, so anyone can change the board")
+		return nil
+	}
+	fmt.Println(response.Holder, "has the turn until", response.Expires.Format(time.Stamp))
+	for i, waiting := range response.Waiting {
+		fmt.Printf("%d. %s\n", i+1, waiting)
+	}
+	return nil
+}
+
+// watchWait is how long each WatchRegion call waits for a change before asking again
+const watchWait = 30 * time.Second
+
+// ctlWatch prints the cells of a region of the running game's board as they change, starting with every cell of it
+// that isn't dead, until the game ends
+func ctlWatch(broker *stubs.Broker, x int, y int, width int, height int) error {
+	game, err := runningGame(broker)
+	if err != nil {
+		return err
+	}
+	fmt.Println("turn,x,y,value")
+	request := stubs.WatchRequest{X: x, Y: y, Width: width, Height: height, Wait: watchWait}
+	for {
+		request.Header = stubs.NewHeader(game.ID)
+		response := new(stubs.WatchResponse)
+		err = broker.WatchRegion(request, response)
+		if stubs.Code(err) == stubs.NoGame { // the game has finished
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		request.WatchID = response.WatchID
+		for _, change := range response.Changes {
+			fmt.Printf("%d,%d,%d,%d\n", response.CompletedTurns, change.X, change.Y, change.Value)
+		}
+	}
+}
+
+// ctlShutdown closes the broker, which closes its workers, whether or not a game is running
+func ctlShutdown(broker *stubs.Broker) error {
+	header := stubs.NewHeader("")
+	if game, err := runningGame(broker); err == nil {
+		header = stubs.NewHeader(game.ID)
+	}
+	response := new(stubs.CloseResponse)
+	if err := broker.CloseBroker(stubs.CloseRequest{Header: header}, response); err != nil {
+		return err
+	}
+	for _, skipped := range response.Skipped {
+		fmt.Println("Skipped", skipped)
+	}
+	fmt.Println("Broker and workers closed")
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"uk.ac.bris.cs/gameoflife/seal"
+)
+
+// runDecrypt prints a file the broker encrypted with -encryptionKey, such as a checkpoint, turn log or history,
+// so it can be read with the usual tools. Files that aren't encrypted are printed as they are.
+func runDecrypt(args []string) {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gol decrypt <file> > <decrypted file>")
+		flags.PrintDefaults()
+	}
+	keyFlag := flags.String("encryptionKey", "", "Key the broker encrypted the file with, as given to the broker. Empty reads it from "+seal.KeyVariable+".")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	key, err := seal.LoadKey(*keyFlag)
+	handleError("Encryption key error", err)
+	file, err := os.Open(flags.Arg(0))
+	handleError("Open error", err)
+	defer file.Close()
+	reader, err := key.NewReader(file)
+	handleError("Decrypt error", err)
+	_, err = io.Copy(os.Stdout, reader)
+	handleError("Decrypt error", err)
+}
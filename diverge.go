@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/seal"
+)
+
+// divergeCells is the most differing cells diverge prints
+const divergeCells = 20
+
+// loggedTurn is a turn from a broker's turn log
+type loggedTurn struct {
+	checksum string
+	rows     []string // the checksum of each row
+	sections string   // how the turn was split between the workers, empty for the starting board
+}
+
+// turnLog is every turn of a turn log, where a turn played again after jumping to a bookmark replaces the first
+type turnLog struct {
+	path  string
+	key   *seal.Key // decrypts the log, and the boards saved beside it, if the broker encrypted them
+	turns map[int]loggedTurn
+}
+
+// readTurnLog reads a turn log written by a broker started with -turnLog
+func readTurnLog(path string, key *seal.Key) (*turnLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := key.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	turnLog := &turnLog{path: path, key: key, turns: make(map[int]loggedTurn)}
+	sections := ""
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<30) // a row checksum takes 8 characters, so a line can be long
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+		case fields[0] == "sections":
+			sections = strings.Join(fields[1:], " ")
+		case fields[0] == "turn" && len(fields) == 4 && len(fields[3])%8 == 0:
+			turn, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %q isn't a turn", path, line, fields[1])
+			}
+			logged := loggedTurn{checksum: fields[2], sections: sections}
+			for i := 0; i < len(fields[3]); i += 8 {
+				logged.rows = append(logged.rows, fields[3][i:i+8])
+			}
+			turnLog.turns[turn] = logged
+		default:
+			return nil, fmt.Errorf("%s:%d: isn't a line of a turn log", path, line)
+		}
+	}
+	return turnLog, scanner.Err()
+}
+
+// runDiverge compares the turn logs of two runs of the same game, printing the first turn whose boards differ, the
+// rows that differ and the sections and workers that worked them out, and the cells that differ if boards were saved
+func runDiverge(args []string) {
+	flags := flag.NewFlagSet("diverge", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gol diverge <first.turns> <second.turns>")
+		flags.PrintDefaults()
+	}
+	keyFlag := flags.String("encryptionKey", "", "Key the broker encrypted the turn logs with, as given to the broker. Empty reads it from "+seal.KeyVariable+".")
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	key, err := seal.LoadKey(*keyFlag)
+	handleError("Encryption key error", err)
+	first, err := readTurnLog(flags.Arg(0), key)
+	handleError("Read turn log error", err)
+	second, err := readTurnLog(flags.Arg(1), key)
+	handleError("Read turn log error", err)
+
+	var common []int
+	for turn := range first.turns {
+		if _, ok := second.turns[turn]; ok {
+			common = append(common, turn)
+		}
+	}
+	sort.Ints(common)
+	if len(common) == 0 {
+		handleError("Compare error", fmt.Errorf("the logs have no turns in common"))
+	}
+	for i, turn := range common {
+		a, b := first.turns[turn], second.turns[turn]
+		if a.checksum == b.checksum {
+			continue
+		}
+		if i == 0 {
+			fmt.Printf("The runs differ from the first turn they both logged, %d\n", turn)
+		} else {
+			fmt.Printf("The runs agree up to turn %d and first differ after turn %d\n", common[i-1], turn)
+		}
+		if len(a.rows) != len(b.rows) {
+			fmt.Printf("The boards are different sizes: %d rows and %d rows\n", len(a.rows), len(b.rows))
+			os.Exit(1)
+		}
+		for _, rows := range differingRows(a.rows, b.rows) {
+			fmt.Printf("Rows %d-%d differ, worked out by\n", rows[0], rows[1])
+			fmt.Printf("  %s: %s\n", first.path, sectionsCovering(a.sections, rows))
+			fmt.Printf("  %s: %s\n", second.path, sectionsCovering(b.sections, rows))
+		}
+		printDifferingCells(first, second, turn, common[i:])
+		os.Exit(1)
+	}
+	fmt.Printf("The runs agree on all %d turns they both logged, %d to %d\n", len(common), common[0], common[len(common)-1])
+}
+
+// differingRows gives the ranges of rows whose checksums differ, each as its first row and the row after its last
+func differingRows(a []string, b []string) [][2]int {
+	var ranges [][2]int
+	for y := range a {
+		if a[y] == b[y] {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == y {
+			ranges[n-1][1] = y + 1
+		} else {
+			ranges = append(ranges, [2]int{y, y + 1})
+		}
+	}
+	return ranges
+}
+
+// sectionsCovering describes the sections of a turn that overlap a range of rows, and the workers they went to
+func sectionsCovering(sections string, rows [2]int) string {
+	if sections == "" {
+		return "nobody, as it is the starting board"
+	}
+	var covering []string
+	for i, section := range strings.Fields(sections) {
+		parts := strings.SplitN(section, "@", 2)
+		bounds := strings.SplitN(parts[0], "-", 2)
+		start, _ := strconv.Atoi(bounds[0])
+		end, _ := strconv.Atoi(bounds[1])
+		if start < rows[1] && end > rows[0] {
+			covering = append(covering, fmt.Sprintf("section %d, rows %d-%d, on %s", i+1, start, end, parts[1]))
+		}
+	}
+	return strings.Join(covering, "; ")
+}
+
+// printDifferingCells compares the first boards both runs saved beside their logs from the turn they diverged on
+func printDifferingCells(first *turnLog, second *turnLog, diverged int, turns []int) {
+	for _, turn := range turns {
+		a, errA := readPGMBoard(savedBoard(first.path, turn), first.key)
+		b, errB := readPGMBoard(savedBoard(second.path, turn), second.key)
+		if errA != nil || errB != nil {
+			continue
+		}
+		if turn == diverged {
+			fmt.Printf("Cells that differ after turn %d:\n", turn)
+		} else {
+			fmt.Printf("Cells that differ after turn %d, the first saved since:\n", turn)
+		}
+		found := 0
+		for y := range a {
+			for x := range a[y] {
+				if a[y][x] == b[y][x] {
+					continue
+				}
+				if found < divergeCells {
+					fmt.Printf("  %d,%d: %d and %d\n", x, y, a[y][x], b[y][x])
+				}
+				found++
+			}
+		}
+		if found > divergeCells {
+			fmt.Printf("  and %d more\n", found-divergeCells)
+		}
+		return
+	}
+	fmt.Println("Neither run saved its board from then on to compare cells, see -turnLogBoards")
+}
+
+// savedBoard gives the path of the board saved beside a turn log after a turn
+func savedBoard(logPath string, turn int) string {
+	return strings.TrimSuffix(logPath, filepath.Ext(logPath)) + "-" + strconv.Itoa(turn) + ".pgm"
+}
+
+// readPGMBoard reads a binary PGM image as rows of cells, decrypting it if it was encrypted
+func readPGMBoard(path string, key *seal.Key) ([][]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decrypted, err := key.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	reader := bufio.NewReader(decrypted)
+	var magic string
+	var width, height, maxValue int
+	if _, err = fmt.Fscan(reader, &magic, &width, &height, &maxValue); err != nil || magic != "P5" {
+		return nil, fmt.Errorf("%s isn't a binary PGM image", path)
+	}
+	_, _ = reader.ReadByte() // the whitespace ending the header
+	cells := make([][]uint8, height)
+	for y := range cells {
+		cells[y] = make([]uint8, width)
+		if _, err = io.ReadFull(reader, cells[y]); err != nil {
+			return nil, fmt.Errorf("%s ends at row %d of %d", path, y, height)
+		}
+	}
+	return cells, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// doctorTimeout is how long each check waits for a reply, so a check can't hang like the thing being diagnosed
+const doctorTimeout = 3 * time.Second
+
+// doctorReport collects the result of each check, remembering whether any failed
+type doctorReport struct {
+	failed bool
+}
+
+func (report *doctorReport) check(name string, err error, detail string) {
+	if err != nil {
+		report.failed = true
+		fmt.Printf("FAIL  %-40s %v\n", name, err)
+		return
+	}
+	fmt.Printf("ok    %-40s %s\n", name, detail)
+}
+
+// runDoctor checks the things most often behind a game that hangs: the broker or a worker being unreachable,
+// running a different version, or a port already being in use
+func runDoctor(args []string) {
+	var cfg config.Config
+	flags := cfg.NewFlagSet("doctor", "")
+	cfg.Parse(flags, args)
+	report := &doctorReport{}
+	fmt.Println(config.VersionString())
+
+	for _, port := range []string{config.DefaultBrokerPort, config.DefaultWorkerPort} {
+		listener, err := net.Listen("tcp", ":"+port)
+		if err == nil {
+			_ = listener.Close()
+			report.check("port "+port+" on this machine", nil, "free")
+		} else {
+			fmt.Printf("info  %-40s in use, by a broker or worker already running here or by something else\n", "port "+port+" on this machine")
+		}
+	}
+
+	workers := cfg.Workers
+	brokerVersion, err := callVersion(cfg.BrokerAddress, false)
+	if err == nil {
+		err = checkCompatible(brokerVersion.Version)
+	}
+	report.check("broker "+cfg.BrokerAddress, err, "version "+brokerVersion.Version)
+	if err == nil && len(brokerVersion.Workers) > 0 {
+		workers = brokerVersion.Workers // check the workers the broker will actually use
+		fmt.Println("      broker uses workers", strings.Join(workers, ","))
+	}
+	for _, address := range workers {
+		workerVersion, err := callVersion(address, true)
+		if err == nil {
+			err = checkCompatible(workerVersion.Version)
+		}
+		report.check("worker "+address, err, "version "+workerVersion.Version)
+	}
+
+	if report.failed {
+		os.Exit(1)
+	}
+	fmt.Println("Everything looks fine")
+}
+
+// callVersion dials the broker, or a worker, and asks it for its version, giving up after doctorTimeout
+func callVersion(address string, worker bool) (stubs.VersionResponse, error) {
+	var response stubs.VersionResponse
+	connection, err := stubs.DialTimeout(address, doctorTimeout)
+	if err != nil {
+		return response, fmt.Errorf("can't connect: %v", err)
+	}
+	defer connection.Close()
+	request, done := stubs.VersionRequest{Header: stubs.NewHeader("")}, make(chan *rpc.Call, 1)
+	var call *rpc.Call
+	if worker {
+		call = (&stubs.Worker{Client: connection}).GoVersion(request, &response, done)
+	} else {
+		call = (&stubs.Broker{Client: connection}).GoVersion(request, &response, done)
+	}
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return response, fmt.Errorf("connected, but it didn't answer as expected (an older version?): %v", call.Error)
+		}
+		return response, nil
+	case <-time.After(doctorTimeout):
+		return response, fmt.Errorf("connected, but no reply after %v", doctorTimeout)
+	}
+}
+
+// checkCompatible checks another process runs the same major version as us
+func checkCompatible(version string) error {
+	if strings.SplitN(version, ".", 2)[0] != strings.SplitN(config.Version, ".", 2)[0] {
+		return fmt.Errorf("version %s isn't compatible with this version %s", version, config.Version)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package ec2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the EC2 query API the requests are written for
+const apiVersion = "2016-11-15"
+
+// Provisioner launches and terminates worker instances from a launch template
+// The template's user data must start 'gol worker' on Port when the instance boots. Instances are tagged
+// so they can be found in the console, and every instance launched is terminated by Scale(0).
+type Provisioner struct {
+	Region      string
+	TemplateID  string // launch template, e.g. lt-0123456789abcdef0
+	Port        string // port the workers listen on
+	UsePublicIP bool   // dial workers on their public addresses, for a broker outside the VPC
+	credentials credentials
+	client      *http.Client
+	instances   []instance // instances launched so far, oldest first
+}
+
+type credentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+type instance struct {
+	id, address string
+}
+
+// NewProvisioner creates a provisioner using the credentials in the standard AWS environment variables
+func NewProvisioner(region string, templateID string, port string, usePublicIP bool) (*Provisioner, error) {
+	creds := credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return &Provisioner{
+		Region:      region,
+		TemplateID:  templateID,
+		Port:        port,
+		UsePublicIP: usePublicIP,
+		credentials: creds,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Scale launches or terminates instances until there are the given number, returning the address of each worker
+// Newly launched workers are waited for until they are accepting connections.
+func (provisioner *Provisioner) Scale(workers int) ([]string, error) {
+	if extra := len(provisioner.instances) - workers; extra > 0 {
+		// terminate the newest instances first, so the workers already warmed up are kept
+		if err := provisioner.terminate(provisioner.instances[workers:]); err != nil {
+			return nil, err
+		}
+		provisioner.instances = provisioner.instances[:workers]
+	} else if extra < 0 {
+		launched, err := provisioner.launch(-extra)
+		if err != nil {
+			return nil, err
+		}
+		provisioner.instances = append(provisioner.instances, launched...)
+	}
+	addresses := make([]string, len(provisioner.instances))
+	for i, launched := range provisioner.instances {
+		addresses[i] = net.JoinHostPort(launched.address, provisioner.Port)
+	}
+	return addresses, nil
+}
+
+// launch starts instances from the template and waits for their workers to be ready
+func (provisioner *Provisioner) launch(count int) ([]instance, error) {
+	parameters := url.Values{
+		"LaunchTemplate.LaunchTemplateId": {provisioner.TemplateID},
+		"MinCount":                        {strconv.Itoa(count)},
+		"MaxCount":                        {strconv.Itoa(count)},
+		"TagSpecification.1.ResourceType": {"instance"},
+		"TagSpecification.1.Tag.1.Key":    {"Name"},
+		"TagSpecification.1.Tag.1.Value":  {"gol-worker"},
+	}
+	var response struct {
+		Instances []struct {
+			ID string `xml:"instanceId"`
+		} `xml:"instancesSet>item"`
+	}
+	if err := provisioner.call("RunInstances", parameters, &response); err != nil {
+		return nil, err
+	}
+	launched := make([]instance, len(response.Instances))
+	for i, item := range response.Instances {
+		launched[i].id = item.ID
+	}
+	if err := provisioner.waitForAddresses(launched); err != nil {
+		_ = provisioner.terminate(launched)
+		return nil, err
+	}
+	for _, item := range launched {
+		if err := waitForWorker(net.JoinHostPort(item.address, provisioner.Port)); err != nil {
+			_ = provisioner.terminate(launched)
+			return nil, err
+		}
+	}
+	return launched, nil
+}
+
+// waitForAddresses polls until every instance is running and has an address, giving up after five minutes
+func (provisioner *Provisioner) waitForAddresses(instances []instance) error {
+	parameters := url.Values{}
+	for i, item := range instances {
+		parameters.Set("InstanceId."+strconv.Itoa(i+1), item.id)
+	}
+	deadline := time.Now().Add(5 * time.Minute)
+	for time.Now().Before(deadline) {
+		var response struct {
+			Instances []struct {
+				ID        string `xml:"instanceId"`
+				State     string `xml:"instanceState>name"`
+				PrivateIP string `xml:"privateIpAddress"`
+				PublicIP  string `xml:"ipAddress"`
+			} `xml:"reservationSet>item>instancesSet>item"`
+		}
+		if err := provisioner.call("DescribeInstances", parameters, &response); err != nil {
+			return err
+		}
+		ready := 0
+		for _, described := range response.Instances {
+			address := described.PrivateIP
+			if provisioner.UsePublicIP {
+				address = described.PublicIP
+			}
+			for i := range instances {
+				if instances[i].id == described.ID && described.State == "running" && address != "" {
+					instances[i].address = address
+					ready++
+				}
+			}
+		}
+		if ready == len(instances) {
+			return nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return fmt.Errorf("instances weren't running after five minutes")
+}
+
+// waitForWorker waits for the worker on an instance to start listening, giving up after three minutes
+func waitForWorker(address string) error {
+	var err error
+	for deadline := time.Now().Add(3 * time.Minute); time.Now().Before(deadline); time.Sleep(2 * time.Second) {
+		var connection net.Conn
+		if connection, err = net.DialTimeout("tcp", address, 2*time.Second); err == nil {
+			return connection.Close()
+		}
+	}
+	return fmt.Errorf("worker at %s didn't start: %v", address, err)
+}
+
+func (provisioner *Provisioner) terminate(instances []instance) error {
+	if len(instances) == 0 {
+		return nil
+	}
+	parameters := url.Values{}
+	for i, item := range instances {
+		parameters.Set("InstanceId."+strconv.Itoa(i+1), item.id)
+	}
+	return provisioner.call("TerminateInstances", parameters, nil)
+}
+
+// call sends a signed request to the EC2 query API, decoding the XML response into result if it isn't nil
+func (provisioner *Provisioner) call(action string, parameters url.Values, result interface{}) error {
+	parameters.Set("Action", action)
+	parameters.Set("Version", apiVersion)
+	body := parameters.Encode()
+	host := "ec2." + provisioner.Region + ".amazonaws.com"
+	request, err := http.NewRequest("POST", "https://"+host+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	provisioner.sign(request, host, body, time.Now().UTC())
+	response, err := provisioner.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Code    string `xml:"Errors>Error>Code"`
+			Message string `xml:"Errors>Error>Message"`
+		}
+		if xml.Unmarshal(data, &failure) == nil && failure.Code != "" {
+			return fmt.Errorf("%s: %s: %s", action, failure.Code, failure.Message)
+		}
+		return fmt.Errorf("%s: %s", action, response.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, result)
+}
+
+// sign adds an AWS Signature Version 4 authorization header to the request
+func (provisioner *Provisioner) sign(request *http.Request, host string, body string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("Host", host)
+	request.Header.Set("X-Amz-Date", amzDate)
+	if provisioner.credentials.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", provisioner.credentials.sessionToken)
+	}
+
+	var names []string
+	for name := range request.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(request.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{"POST", "/", "", canonicalHeaders.String(), signedHeaders, hashHex(body)}, "\n")
+
+	scope := date + "/" + provisioner.Region + "/ec2/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex(canonicalRequest)}, "\n")
+	key := hmacSHA256([]byte("AWS4"+provisioner.credentials.secretKey), date)
+	for _, part := range []string{provisioner.Region, "ec2", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+provisioner.credentials.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	request.Host = host
+}
+
+func hashHex(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, text string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(text))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// runEquivalence plays the same random game on the broker once for each number of sections, and checks every one
+// finishes with the same board, which it won't if splitting turns between workers or sharing edge rows goes wrong
+func runEquivalence(args []string) {
+	var cfg config.Config
+	var game stubs.BatchGame
+	flags := cfg.NewFlagSet("equivalence", "")
+	flags.IntVar(&game.Width, "w", 512, "Width of the board.")
+	flags.IntVar(&game.Height, "h", 512, "Height of the board.")
+	flags.IntVar(&game.Turns, "turns", 100, "Number of turns to run the game for.")
+	flags.StringVar(&game.Rule, "rule", rules.Default, "Rule to play the game by, e.g. B3/S23 or highlife.")
+	flags.StringVar(&game.Edge, "edge", "toroidal", "What lies beyond the edge of the board: toroidal, dead or mirrored.")
+	flags.Int64Var(&game.Seed, "seed", 1, "Seed for the starting board, and for the random births and deaths.")
+	flags.Float64Var(&game.Density, "density", 0.5, "Fraction of the starting board that is alive, between 0 and 1.")
+	flags.Float64Var(&game.BirthProbability, "pbirth", 0, "Probability of a dead cell being born spontaneously each turn.")
+	flags.Float64Var(&game.DeathProbability, "pdeath", 0, "Probability of an alive cell dying spontaneously each turn.")
+	sectionList := flags.String("sections", "1,4,16", "Comma-separated list of how many sections to split each turn into, handed to the broker's workers in turn.")
+	cfg.Parse(flags, args)
+
+	request := stubs.BatchRequest{Header: stubs.NewHeader(stubs.NewID())}
+	for _, field := range strings.Split(*sectionList, ",") {
+		sections, err := strconv.Atoi(strings.TrimSpace(field))
+		handleError("Invalid sections", err)
+		if sections < 1 {
+			handleError("Invalid sections", fmt.Errorf("%d sections can't be worked out, the fewest is 1", sections))
+		}
+		game.Sections = sections
+		request.Games = append(request.Games, game)
+	}
+
+	broker, err := stubs.DialBroker(cfg.BrokerAddress)
+	handleError("Dial broker error", err)
+	err = broker.Negotiate(config.Version, stubs.BrokerCapabilities)
+	handleError("Negotiate with broker error", err)
+	if !broker.Capabilities.Has(stubs.Sections) {
+		handleError("Broker error", fmt.Errorf("the broker at %s is too old to split games into a given number of sections", cfg.BrokerAddress))
+	}
+	fmt.Printf("Running a %dx%d game for %d turns split into %s sections\n", game.Width, game.Height, game.Turns, *sectionList)
+	response := new(stubs.BatchResponse)
+	err = broker.RunBatch(request, response)
+	handleError("Call broker error", err)
+	_ = broker.Close()
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "sections\tturns\talive\tchecksum\tseconds\t")
+	expected := response.Results[0]
+	matched := true
+	for _, result := range response.Results {
+		same := result.CompletedTurns == expected.CompletedTurns && *result.Checksum == *expected.Checksum
+		matched = matched && same
+		verdict := ""
+		if !same {
+			verdict = fmt.Sprintf("differs from %d sections", expected.Game.Sections)
+		}
+		fmt.Fprintf(writer, "%d\t%d\t%d\t%08x\t%.3f\t%s\n", result.Game.Sections, result.CompletedTurns, result.AliveCount,
+			result.Checksum.CRC, result.Duration.Seconds(), verdict)
+	}
+	_ = writer.Flush()
+	if !matched {
+		fmt.Println("FAIL: the final boards differ")
+		os.Exit(1)
+	}
+	fmt.Println("ok: every final board is the same")
+}
@@ -1,8 +1,15 @@
 module uk.ac.bris.cs/gameoflife
 
-go 1.12
+go 1.24
 
 require (
+	github.com/quic-go/quic-go v0.59.1
 	github.com/veandco/go-sdl2 v0.4.4
+)
+
+require (
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/perf v0.0.0-20211012211434-03971e389cd3 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
@@ -0,0 +1,62 @@
+package gol
+
+import "sync"
+
+// eventBus passes the events sent by the distributor and the goroutines it starts on to every subscriber, in the
+// order they were sent. It is the only thing that sends on or closes the subscribers' channels, so an event sent
+// by a goroutine that is still finishing once the game has ended is dropped, rather than sent on a closed channel.
+type eventBus struct {
+	mutex       sync.RWMutex // held for reading while an event is sent, and for writing to subscribe or close
+	subscribers []chan<- Event
+	closed      bool
+}
+
+// newEventBus makes a bus sending its events on to each of the given channels
+func newEventBus(subscribers ...chan<- Event) *eventBus {
+	bus := new(eventBus)
+	for _, events := range subscribers {
+		bus.subscribe(events)
+	}
+	return bus
+}
+
+// subscribe adds a channel that is sent every event from now on, and closed along with the bus
+// A nil channel is left out, as nothing would ever receive from it.
+func (bus *eventBus) subscribe(events chan<- Event) {
+	if events == nil {
+		return
+	}
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.closed {
+		close(events)
+		return
+	}
+	bus.subscribers = append(bus.subscribers, events)
+}
+
+// publish sends an event to every subscriber, reporting false if it was dropped as the bus has closed
+func (bus *eventBus) publish(event Event) bool {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+	if bus.closed {
+		return false
+	}
+	for _, events := range bus.subscribers {
+		events <- event
+	}
+	return true
+}
+
+// close closes every subscriber's channel once the events being sent have been, doing nothing if already closed
+func (bus *eventBus) close() {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.closed {
+		return
+	}
+	bus.closed = true
+	for _, events := range bus.subscribers {
+		close(events)
+	}
+}
@@ -3,19 +3,23 @@ package gol
 import (
 	"fmt"
 	"log"
-	"net/rpc"
+	"math"
 	"os"
 	"strconv"
 	"time"
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/rules"
 	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type distributorChannels struct {
-	events     chan<- Event
+	events     *eventBus
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
 	ioFilename chan<- string
 	ioOutput   chan<- uint8
+	ioSize     chan<- imageSize
 	ioInput    <-chan uint8
 	keys <-chan rune
 }
@@ -40,92 +44,287 @@ func createInputBoard(height int, width int, c distributorChannels) [][]uint8 {
 	return cells
 }
 
-// MonitorKeyPresses follows the rules when certain keys are pressed
-func MonitorKeyPresses(p Params, c distributorChannels, broker *rpc.Client, gameOver chan bool, pauseTicker chan bool) {
-	gamePaused := false
-	for {
-		key := <-c.keys
-		switch key {
-		case 's': // retrieve current board state and write it as image
-			request := new(stubs.Request)
-			response := new(stubs.Response)
-			err := broker.Call(stubs.CurrentBoardHandler, request, &response)
-			handleError("Call broker error", err)
-			WriteImage(p, c, response.FinishedBoard, response.CompletedTurns)
-		case 'q': // close controller
-			err := broker.Call(stubs.ControllerClosedHandler, new(stubs.Request), new(stubs.Response))
-			handleError("Call broker error", err)
-			err = broker.Close()
-			handleError("Close broker error", err)
-			os.Exit(0)
-		case 'k': // kill controller, broker and workers
-			gameOver <- true
-			request := new(stubs.Request)
-			response := new(stubs.Response)
-			err := broker.Call(stubs.CurrentBoardHandler, request, &response) // get current board state
-			handleError("Call broker error", err)
-			WriteImage(p, c, response.FinishedBoard, response.CompletedTurns) // write board as image
-			err = broker.Call(stubs.CloseBrokerHandler, request, &response) // close broker which closes workers
-			handleError("Call broker error", err)
-			err = broker.Close()
-			handleError("Close broker error", err)
-			os.Exit(0)
-		case 'p': // pause processing
-			request := new(stubs.Request)
-			response := new(stubs.Response)
-			err := broker.Call(stubs.PauseBrokerHandler, request, &response)
-			handleError("Call broker error", err)
-			if gamePaused { // game was paused
-				fmt.Println("Continuing")
-				gamePaused = false
-			} else { // game un-paused
-				fmt.Println("Paused after turn: ", response.CompletedTurns + 1)
-				gamePaused = true
+// sendInitialCells tells the GUI about every cell that isn't dead when the image is loaded in
+func sendInitialCells(p Params, c distributorChannels, board [][]uint8) {
+	rule, err := rules.Parse(p.Rule)
+	multiState := err == nil && rule.States > 2
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if multiState && board[y][x] != 0 {
+				c.events.publish(CellStateChanged{0, util.Cell{X: x, Y: y}, board[y][x]})
+			} else if board[y][x] == 255 {
+				c.events.publish(CellFlipped{0, util.Cell{X: x, Y: y}})
 			}
-			pauseTicker <- gamePaused // tell cell count ticker to continue/stop based on paused state
 		}
 	}
+	c.events.publish(TurnComplete{0})
 }
 
+// queryTimeout is how long the broker has to answer a question about the game, such as a snapshot, before
+// giving up rather than waiting for a long turn to end
+const queryTimeout = 5 * time.Second
+
+// heartbeatInterval is how often the broker is told the controller is still there, well within its -controllerTimeout
+const heartbeatInterval = 2 * time.Second
+
 // MonitorAliveCellCount gets the number of alive cells every 2sec from the broker, and submits the event
-func MonitorAliveCellCount(broker *rpc.Client, c distributorChannels, gameOver chan bool, pauseTicker chan bool) {
-	response := new(stubs.Response)
-	request := new(stubs.Request)
+// It waits between ticks rather than spinning, and skips ticks while the game is paused or still on the turn it last reported.
+func MonitorAliveCellCount(broker *stubs.Broker, c distributorChannels, gameID string, gameOver chan bool, pauseTicker chan bool) {
+	cycleReported := false
+	recommended, active := 0, 0
+	reportedTurn := -1 // so a turn that takes longer than the interval isn't reported twice
+	degraded := false
+	paused := false
 	ticker := time.NewTicker(2 * time.Second) // every 2 seconds
+	defer ticker.Stop()
 	for {
 		select {
 		case <-gameOver: // check if process has been killed by (pressing k)
 			return
-		case <-pauseTicker: // check if process paused (by pressing p)
-			<-pauseTicker
+		case paused = <-pauseTicker: // nothing changes while the game is paused, so there's nothing to report
+			continue
 		case <-ticker.C: // +2 seconds has passed
-			err := broker.Call(stubs.AliveCellCountHandler, request, &response)
-			handleError("Call broker error", err)
-			// get cell count from broker
-			c.events <- AliveCellsCount{response.CompletedTurns, len(response.AliveCells)}
-		default:
+		}
+		if paused {
+			continue
+		}
+		response := new(stubs.AliveCellCountResponse) // a new one each time, as fields left at zero aren't sent
+		err := broker.AliveCellCount(stubs.AliveCellCountRequest{Header: stubs.NewHeader(gameID).Within(queryTimeout)}, response)
+		if code := stubs.Code(err); code == stubs.NoGame || code == stubs.DeadlineExceeded { // not started yet, or a turn is taking too long
+			continue
+		}
+		if stubs.Unanswered(err) { // the broker has gone, which StartGame deals with
+			continue
+		}
+		handleError("Call broker error", err)
+		if response.Degraded != degraded { // checked first, as the turn doesn't change while the game is degraded
+			degraded = response.Degraded
+			if degraded {
+				c.events.publish(Degraded{response.CompletedTurns, response.ActiveWorkers, response.MinWorkers})
+			} else {
+				c.events.publish(StateChange{response.CompletedTurns, Executing})
+			}
+		}
+		if response.CompletedTurns == reportedTurn { // still on the same turn, or paused by someone else
+			continue
+		}
+		reportedTurn = response.CompletedTurns
+		// get cell count from broker
+		c.events.publish(AliveCellsCount{response.CompletedTurns, response.AliveCount})
+		c.events.publish(AgeStatistics{response.CompletedTurns, response.MeanAge, int(response.MaxAge)})
+		if broker.Capabilities.Has(stubs.TurnStatistics) {
+			publishTurnStats(broker, c, gameID)
+		}
+		if response.CyclePeriod > 0 && !cycleReported {
+			c.events.publish(CycleDetected{response.CompletedTurns, response.CycleStart, response.CyclePeriod})
+			cycleReported = true
+		}
+		if response.RecommendedWorkers > 0 && (response.RecommendedWorkers != recommended || response.ActiveWorkers != active) {
+			recommended, active = response.RecommendedWorkers, response.ActiveWorkers
+			c.events.publish(WorkersRecommended{response.CompletedTurns, response.TurnsPerSecond, recommended, active})
+		}
+	}
+}
 
+// publishTurnStats sends how the game's last turn changed its board, if the broker keeps track of it for the game
+func publishTurnStats(broker *stubs.Broker, c distributorChannels, gameID string) {
+	response := new(stubs.TurnStatsResponse)
+	err := broker.TurnStats(stubs.TurnStatsRequest{Header: stubs.NewHeader(gameID).Within(queryTimeout)}, response)
+	if code := stubs.Code(err); code == stubs.NoGame || code == stubs.InvalidParams || code == stubs.DeadlineExceeded || stubs.Unanswered(err) {
+		return // finished, a tiled or hashlife game, busy or gone
+	}
+	handleError("Call broker error", err)
+	stats := response.TurnStats
+	c.events.publish(TurnStatistics{stats.Turn, stats.Population, stats.Births, stats.Deaths, stats.Density})
+}
+
+// shutDown saves the game's board, then closes the broker, its workers and the controller, in that order
+// The game is paused first, so the board saved is from a whole turn rather than one partway through, and the image
+// is written out before anything is closed.
+func shutDown(p Params, c distributorChannels, broker *stubs.Broker, gameID string) {
+	header := stubs.NewHeader(gameID)
+	response := new(stubs.SnapshotResponse)
+	var err error
+	if broker.Capabilities.Has(stubs.Snapshots) { // answers once the turn being worked out has finished
+		err = broker.Snapshot(stubs.SnapshotRequest{Header: header}, response)
+	} else {
+		err = broker.CurrentBoard(stubs.CurrentBoardRequest{Header: header}, &response.CurrentBoardResponse)
+	}
+	if stubs.Code(err) != stubs.NoGame { // there's nothing to write if the game never started
+		handleError("Call broker error", err)
+		WriteImage(p, c, response.Board, response.CompletedTurns, response.ImagePath)
+		c.ioCommand <- ioCheckIdle // wait until the image has been written
+		<-c.ioIdle
+	}
+	closed := new(stubs.CloseResponse)
+	err = broker.CloseBroker(stubs.CloseRequest{Header: stubs.NewHeader(gameID)}, closed) // close broker which closes workers
+	handleError("Call broker error", err)
+	for _, skipped := range closed.Skipped {
+		fmt.Println("Closing the broker skipped", skipped)
+	}
+	err = broker.Close()
+	handleError("Close broker error", err)
+	c.events.publish(StateChange{response.CompletedTurns, Quitting})
+	os.Exit(0)
+}
+
+// SendHeartbeats tells the broker the controller is still there every heartbeatInterval until done is closed,
+// so the game isn't given up on while it waits for the result
+func SendHeartbeats(broker *stubs.Broker, gameID string, done chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// a missed heartbeat is fine, and the game may not have started yet
+			_ = broker.Heartbeat(stubs.HeartbeatRequest{Header: stubs.NewHeader(gameID)}, new(stubs.HeartbeatResponse))
 		}
 	}
 }
 
-// WriteImage outputs the final state of the board as a PGM image
-func WriteImage(p Params, c distributorChannels, finishedBoard [][]uint8, completedTurns int) {
+// fetchAliveCells gets a finished game's alive cells from the broker a page at a time,
+// so no single message has to hold every one of them
+func fetchAliveCells(broker *stubs.Broker, gameID string, pageSize int, count int) []util.Cell {
+	cells := make([]util.Cell, 0, count)
+	request := stubs.AliveCellsRequest{Limit: pageSize}
+	for {
+		request.Header = stubs.NewHeader(gameID)
+		response := new(stubs.AliveCellsResponse)
+		err := broker.AliveCells(request, response)
+		handleError("Call broker error", err)
+		cells = append(cells, response.Cells...)
+		if response.Done {
+			return cells
+		}
+		request.After = response.Next
+	}
+}
+
+// WriteImage outputs the state of the board as a PGM image
+// Boards that have grown in expanding mode are written at their full size, and tiled boards have already
+// been written by the broker to imagePath.
+func WriteImage(p Params, c distributorChannels, finishedBoard [][]uint8, completedTurns int, imagePath string) {
+	if imagePath != "" {
+		fmt.Println("Broker wrote image to", imagePath)
+		c.events.publish(ImageOutputComplete{completedTurns, imagePath})
+		return
+	}
+	width, height := p.ImageWidth, p.ImageHeight
+	if len(finishedBoard) > 0 && (len(finishedBoard) != height || len(finishedBoard[0]) != width) { // the board has grown
+		width, height = len(finishedBoard[0]), len(finishedBoard)
+	}
+	filename := strconv.Itoa(width) + "x" + strconv.Itoa(height) + "x" + strconv.Itoa(completedTurns)
+	writeBoard(c, filename, width, height, func(x int, y int) uint8 {
+		return finishedBoard[y][x]
+	})
+	fmt.Println("Wrote image")
+	c.events.publish(ImageOutputComplete{completedTurns, filename})
+}
+
+// WriteAgeImage outputs the age of every cell as a PGM image, with cells older than 255 turns shown as 255
+func WriteAgeImage(p Params, c distributorChannels, ages [][]uint32, completedTurns int) {
+	width, height := p.ImageWidth, p.ImageHeight
+	if len(ages) > 0 && (len(ages) != height || len(ages[0]) != width) { // the board has grown
+		width, height = len(ages[0]), len(ages)
+	}
+	filename := strconv.Itoa(width) + "x" + strconv.Itoa(height) + "x" + strconv.Itoa(completedTurns) + "-ages"
+	writeAges(c, filename, width, height, ages)
+	c.events.publish(ImageOutputComplete{completedTurns, filename})
+}
+
+// WriteHeatmap outputs how active each cell was over the game as a PGM image, brighter for cells that came alive or
+// died more often, on a log scale so the busiest few cells don't leave the rest of the board dark
+func WriteHeatmap(c distributorChannels, flips [][]uint32, completedTurns int) {
+	height, width := len(flips), len(flips[0])
+	var most uint32
+	for _, row := range flips {
+		for _, count := range row {
+			if count > most {
+				most = count
+			}
+		}
+	}
+	scale := 255 / math.Log1p(float64(most))
+	filename := strconv.Itoa(width) + "x" + strconv.Itoa(height) + "x" + strconv.Itoa(completedTurns) + "-heatmap"
+	writeBoard(c, filename, width, height, func(x int, y int) uint8 {
+		if most == 0 {
+			return 0
+		}
+		return uint8(math.Log1p(float64(flips[y][x])) * scale)
+	})
+	c.events.publish(ImageOutputComplete{completedTurns, filename})
+}
+
+// writeAges sends the age of every cell to the io goroutine to be written as a PGM image, capped at 255
+func writeAges(c distributorChannels, filename string, width int, height int, ages [][]uint32) {
+	writeBoard(c, filename, width, height, func(x int, y int) uint8 {
+		if ages[y][x] > 255 {
+			return 255
+		}
+		return uint8(ages[y][x])
+	})
+}
+
+// writeBoard sends every cell of a board to the io goroutine to be written as a PGM image
+func writeBoard(c distributorChannels, filename string, width int, height int, value func(x int, y int) uint8) {
 	c.ioCommand <- ioOutput
-	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(completedTurns)
 	c.ioFilename <- filename
-
-	for j := 0; j < p.ImageHeight; j++ { // loop through all the cells
-		for i := 0; i < p.ImageWidth; i++ {
-			c.ioOutput <- finishedBoard[j][i]
+	c.ioSize <- imageSize{width, height}
+	for j := 0; j < height; j++ { // loop through all the cells
+		for i := 0; i < width; i++ {
+			c.ioOutput <- value(i, j)
 		}
 	}
-	fmt.Println("Wrote image")
-	c.events <- ImageOutputComplete{completedTurns, filename}
+}
+
+// brokerAddress gives the address of the broker to run the game on
+func brokerAddress(p Params) string {
+	if p.BrokerAddress == "" {
+		return config.DefaultBrokerAddress
+	}
+	return p.BrokerAddress
+}
+
+// gameRequest makes the request that starts the game described by the parameters
+func gameRequest(p Params, header stubs.Header, startingBoard [][]uint8, seed int64) stubs.StartGameRequest {
+	request := stubs.StartGameRequest{Header: header, StartingBoard: startingBoard, Height: p.ImageHeight, Width: p.ImageWidth, Turns: p.Turns, Rule: p.Rule, Edge: p.Edge,
+		Seed: seed, BirthProbability: p.BirthProbability, DeathProbability: p.DeathProbability, IncludeAges: p.IncludeAges,
+		StopEarly: p.StopEarly, CycleWindow: p.CycleWindow, Census: p.Census,
+		StopConditions: p.StopConditions, Expand: p.Expand, TileSize: p.TileSize, Engine: p.Engine,
+		TargetTurnsPerSecond: p.TargetTurnsPerSecond, Autoscale: p.Autoscale, PageAliveCells: p.AliveCellsPageSize > 0,
+		Detach: p.Detach, StopRunning: p.StopRunning, TimeTurns: p.Report, Heatmap: p.Heatmap, SharedImage: p.SharedImage,
+		Priority: p.Priority, Halo: p.Halo, StreamTurns: p.Stream}
+	if startingBoard != nil {
+		request.Checksum = stubs.Sum(startingBoard)
+	}
+	return request
+}
+
+// Validate asks the broker whether it would run the game described by the parameters, and how,
+// without loading the image or starting the game
+func Validate(p Params) (*stubs.ValidateResponse, error) {
+	broker, err := stubs.DialBroker(brokerAddress(p))
+	if err != nil {
+		return nil, err
+	}
+	defer broker.Close()
+	request := stubs.ValidateRequest{Header: stubs.NewHeader(""), Game: gameRequest(p, stubs.Header{}, nil, p.Seed)}
+	response := new(stubs.ValidateResponse)
+	if err = broker.Validate(request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
 // distributor initialises the game and the connections required, also monitors alive cell count and key presses
 func distributor(p Params, c distributorChannels) {
+	if p.Join != "" {
+		follow(p, c)
+		return
+	}
+	times := runTimes{start: time.Now()}
 	// make the filename and pass it through channel
 	var filename string
 	filename = strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight)
@@ -133,35 +332,143 @@ func distributor(p Params, c distributorChannels) {
 	c.ioFilename <- filename // pass the filename of the image
 
 	inputBoard := createInputBoard(p.ImageHeight, p.ImageWidth, c) // create cells from input
+	sendInitialCells(p, c, inputBoard)
+	times.readImage = time.Since(times.start)
 
-	broker, err := rpc.Dial("tcp","127.0.0.1:8030") // connect to our broker
+	broker, err := stubs.DialBroker(brokerAddress(p)) // connect to our broker
 	handleError("Dial broker error", err)
+	err = broker.Negotiate(config.Version, stubs.BrokerCapabilities)
+	handleError("Negotiate with broker error", err)
 	fmt.Println("Connection done")
-	defer func(broker *rpc.Client) {
+	if p.Detach && !broker.Capabilities.Has(stubs.Detach) {
+		fmt.Println("The broker can't finish games without their controller, so quitting ends the game")
+	}
+	if p.Priority != 0 && !broker.Capabilities.Has(stubs.Priorities) {
+		fmt.Println("The broker can't prioritise games, so the game shares the workers equally")
+	}
+	if p.Halo && !broker.Capabilities.Has(stubs.Halos) {
+		fmt.Println("The broker can't have its workers keep the board, so it will send it to them each turn")
+		p.Halo = false
+	}
+	if p.Stream && !broker.Capabilities.Has(stubs.TurnDiffs) {
+		fmt.Println("The broker can't stream the game's turns, so the window only shows the starting board")
+		p.Stream = false
+	} else if p.Stream && (p.TileSize > 0 || p.Engine == stubs.EngineHashLife || p.Halo || p.Expand) {
+		fmt.Println("Tiled, hashlife, halo and expanding games aren't streamed, so the window only shows the starting board")
+		p.Stream = false
+	}
+	if p.SharedImage && !broker.Capabilities.Has(stubs.SharedImages) {
+		fmt.Println("The broker can't have its workers write the finished board, so it will be sent back")
+		p.SharedImage = false
+	}
+	defer func(broker *stubs.Broker) {
 		err := broker.Close()
 		handleError("Close broker error", err)
 	}(broker)
 
-	request := stubs.Request{StartingBoard: inputBoard, Height: p.ImageHeight, Width: p.ImageWidth, Turns: p.Turns}
-	response := new(stubs.Response)
+	seed := p.Seed
+	if seed == 0 && (p.BirthProbability > 0 || p.DeathProbability > 0) {
+		seed = time.Now().UnixNano()
+		fmt.Println("Seed:", seed) // so the run can be repeated
+	}
+	p.Seed = seed // so snapshots record the seed actually used
+	gameID := stubs.NewID()
+	fmt.Println("Game", gameID)
+	header := stubs.NewHeader(gameID)
+	if p.Deadline > 0 {
+		header = header.Within(p.Deadline)
+	}
+	request := gameRequest(p, header, inputBoard, seed)
+	response := new(stubs.StartGameResponse)
+
+	last := &lastBoard{cells: inputBoard}
 
 	gameOver := make(chan bool, 1)
 	pauseTicker := make(chan bool)
-	go MonitorKeyPresses(p, c, broker, gameOver, pauseTicker) // monitor which keys are pressed in SDL window
-	go MonitorAliveCellCount(broker, c, gameOver, pauseTicker) // monitor and retrieve alive cell count every 2s
-	err = broker.Call(stubs.StartGameHandler, request, &response) // tell the broker to begin processing
+	if p.RecordKeys != "" || p.ReplayKeys != "" {
+		c.keys = scriptKeys(p, c.keys, broker, gameID)
+	}
+	keys := &keyHandler{p: p, c: c, broker: broker, gameID: gameID, name: controllerName(p), last: last, gameOver: gameOver, pauseTicker: pauseTicker}
+	go MonitorKeyPresses(keys) // monitor which keys are pressed in SDL window
+	go MonitorAliveCellCount(broker, c, gameID, gameOver, pauseTicker) // monitor and retrieve alive cell count every 2s
+	heartbeating := make(chan struct{})
+	if broker.Capabilities.Has(stubs.Heartbeats) {
+		go SendHeartbeats(broker, gameID, heartbeating) // show the broker we're still waiting for the game
+	}
+	if p.CheckpointInterval > 0 && broker.Capabilities.Has(stubs.Snapshots) {
+		go keepCheckpoints(broker, gameID, p.CheckpointInterval, last, heartbeating)
+	}
+	finished, streamStopped := make(chan *stubs.StartGameResponse, 1), make(chan struct{})
+	if p.Stream {
+		go streamTurns(p, c, broker, gameID, inputBoard, finished, streamStopped) // show each turn as it's worked out
+	} else {
+		close(streamStopped)
+	}
+	gameStarted := time.Now()
+	err = broker.StartGame(request, response) // tell the broker to begin processing
+	if keys.isEnding() { // q or k stopped the game, and end the controller once they have finished with the broker
+		select {}
+	}
+	for stubs.Unanswered(err) && reattach(p, c, broker, gameID, last, err, &request) { // the broker went, taking the game
+		response = new(stubs.StartGameResponse)
+		err = broker.StartGame(request, response)
+	}
+	times.game = time.Since(gameStarted)
+	close(heartbeating)
 	handleError("Call broker error", err)
 	gameOver <- true // broadcasts to monitor cell count goroutine that the game processing is finished
+	finished <- response
+	<-streamStopped // so the final turn is shown before FinalTurnComplete
+	if request.PageAliveCells {
+		response.AliveCells = fetchAliveCells(broker, gameID, p.AliveCellsPageSize, response.AliveCount)
+	}
 
-	c.events <- FinalTurnComplete{response.CompletedTurns,response.AliveCells}
+	if response.CyclePeriod > 0 {
+		c.events.publish(CycleDetected{response.CompletedTurns, response.CycleStart, response.CyclePeriod})
+	}
+	if p.Census {
+		c.events.publish(CensusComplete{response.CompletedTurns, response.Census})
+	}
+	if response.StopReason != "" {
+		c.events.publish(GameStoppedEarly{response.CompletedTurns, response.StopReason})
+	}
+	if p.WorkerMetrics { // written first, as the controller can be ended as soon as the final turn is sent
+		name := fmt.Sprintf("%dx%dx%d-workers", response.Width, response.Height, response.CompletedTurns)
+		if len(response.WorkerMetrics) == 0 { // the hashlife engine, tiled boards and older brokers
+			fmt.Println("The broker didn't measure its workers for this game")
+		} else if path, err := writeWorkerMetrics(name, response.WorkerMetrics); err != nil {
+			fmt.Println("Error writing worker metrics:", err)
+		} else {
+			fmt.Println("Wrote worker metrics to", path)
+		}
+	}
+	c.events.publish(FinalTurnComplete{response.CompletedTurns, response.AliveCells, response.Ages})
 
-	WriteImage(p,c,response.FinishedBoard,response.CompletedTurns)
+	writing := time.Now()
+	WriteImage(p, c, response.FinishedBoard, response.CompletedTurns, response.ImagePath)
+	if p.IncludeAges {
+		WriteAgeImage(p, c, response.Ages, response.CompletedTurns)
+	}
+	if p.Heatmap && response.Flips != nil {
+		WriteHeatmap(c, response.Flips, response.CompletedTurns)
+	} else if p.Heatmap { // an older broker, which doesn't count them
+		fmt.Println("The broker didn't count how often cells changed, so there's no heatmap")
+	}
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
+	times.writeImage = time.Since(writing)
+	if p.Report {
+		name := fmt.Sprintf("%dx%dx%d-report", response.Width, response.Height, response.CompletedTurns)
+		if path, err := writeReport(name, gameID, times, response); err != nil {
+			fmt.Println("Error writing performance report:", err)
+		} else {
+			fmt.Println("Wrote performance report to", path)
+		}
+	}
 
-	c.events <- StateChange{response.CompletedTurns, Quitting}
+	c.events.publish(StateChange{response.CompletedTurns, Quitting})
 
 	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
-	close(c.events)
+	c.events.close()
 }
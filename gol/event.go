@@ -2,6 +2,8 @@ package gol
 
 import (
 	"fmt"
+
+	"uk.ac.bris.cs/gameoflife/census"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -52,6 +54,15 @@ type CellFlipped struct { // implements Event
 	Cell           util.Cell
 }
 
+// CellStateChanged is an Event notifying the GUI that a cell has moved to a new state under a multi-state rule,
+// such as Wireworld or Brian's Brain. Value is the cell's new value as it is stored in the board and output image.
+// Two state rules use CellFlipped instead.
+type CellStateChanged struct { // implements Event
+	CompletedTurns int
+	Cell           util.Cell
+	Value          uint8
+}
+
 // TurnComplete is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
 // All CellFlipped events must be sent *before* TurnComplete.
@@ -59,12 +70,86 @@ type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
 
+// AgeStatistics is an Event notifying the user about how long the alive cells have been alive for.
+// This Event is sent alongside AliveCellsCount.
+type AgeStatistics struct { // implements Event
+	CompletedTurns int
+	MeanAge        float64
+	MaxAge         int
+}
+
+// TurnStatistics is an Event notifying the user how the last turn changed the board: the cells Born and that Died
+// during it, and the Population and Density of alive cells after it.
+// This Event is sent alongside AliveCellsCount by brokers that keep them, which they don't for tiled or hashlife games.
+type TurnStatistics struct { // implements Event
+	CompletedTurns int
+	Population     int
+	Born           int
+	Died           int
+	Density        float64
+}
+
+// CycleDetected is an Event notifying the user that the board has started repeating itself.
+// The board after turn Start is the same as the board after turn Start+Period, and so on.
+// This Event is sent the first time the cycle is noticed, and again just before FinalTurnComplete.
+type CycleDetected struct { // implements Event
+	CompletedTurns int
+	Start          int
+	Period         int
+}
+
+// CensusComplete is an Event listing how many of each known object (blocks, blinkers, gliders...) are on the board.
+// This Event is sent when a census is requested by pressing 'c', and before FinalTurnComplete if Params.Census is set.
+type CensusComplete struct { // implements Event
+	CompletedTurns int
+	Counts         census.Census
+}
+
+// GameStoppedEarly is an Event notifying the user that the game stopped before reaching its turn count.
+// Reason is stubs.StopExtinct if no cells are left alive, stubs.StopStable if the board stopped changing,
+// stubs.StopCycle if the board started repeating a cycle, stubs.StopDeadline if the -deadline passed,
+// or the description of the stop condition that held.
+// This Event is sent just before FinalTurnComplete.
+type GameStoppedEarly struct { // implements Event
+	CompletedTurns int
+	Reason         string
+}
+
+// WorkersRecommended is an Event notifying the user how many workers the broker thinks are needed to reach
+// Params.TargetTurnsPerSecond, given the TurnsPerSecond it measured with the Active workers it is using.
+// This Event is sent alongside AliveCellsCount whenever the recommendation or the workers in use change.
+type WorkersRecommended struct { // implements Event
+	CompletedTurns int
+	TurnsPerSecond float64
+	Recommended    int
+	Active         int
+}
+
+// Degraded is an Event notifying the user that the broker has paused the game, as fewer of its workers are Healthy
+// than the Required number it was started with, -minWorkers. A StateChange to Executing is sent once enough are back.
+type Degraded struct { // implements Event
+	CompletedTurns int
+	Healthy        int
+	Required       int
+}
+
+// BrokerLost is an Event notifying the user that the connection to the broker dropped while the game was running.
+// CompletedTurns is the turn of the last board the controller has, which is written out when this Event is sent.
+// Reattaching is set if the controller is waiting for the broker to come back, to carry on from that board.
+type BrokerLost struct { // implements Event
+	CompletedTurns int
+	Err            string
+	Reattaching    bool
+}
+
 // FinalTurnComplete is an Event notifying the testing framework about the new world state after execution finished.
 // The data included with this Event is used directly by the tests.
 // SDL closes the window when this Event is sent.
+// Ages holds the number of turns each cell has been alive for, indexed [y][x], if Params.IncludeAges is set.
 type FinalTurnComplete struct {
 	CompletedTurns int
 	Alive          []util.Cell
+	Ages           [][]uint32
 }
 
 // String methods allow the different types of Events and States to be printed.
@@ -98,6 +183,73 @@ func (event AliveCellsCount) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event AgeStatistics) String() string {
+	return fmt.Sprintf("Mean age %.1f, oldest %v", event.MeanAge, event.MaxAge)
+}
+
+func (event AgeStatistics) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event TurnStatistics) String() string {
+	return fmt.Sprintf("%v born, %v died, %.1f%% alive", event.Born, event.Died, 100*event.Density)
+}
+
+func (event TurnStatistics) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CycleDetected) String() string {
+	return fmt.Sprintf("Cycle of period %v found, starting at turn %v", event.Period, event.Start)
+}
+
+func (event CycleDetected) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CensusComplete) String() string {
+	return fmt.Sprintf("Census %v", event.Counts)
+}
+
+func (event CensusComplete) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event GameStoppedEarly) String() string {
+	return fmt.Sprintf("Stopped early, board is %v", event.Reason)
+}
+
+func (event GameStoppedEarly) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event WorkersRecommended) String() string {
+	return fmt.Sprintf("%.1f turns/s with %v workers, %v recommended", event.TurnsPerSecond, event.Active, event.Recommended)
+}
+
+func (event WorkersRecommended) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event Degraded) String() string {
+	return fmt.Sprintf("Paused, %v of the %v workers needed are healthy", event.Healthy, event.Required)
+}
+
+func (event Degraded) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event BrokerLost) String() string {
+	if event.Reattaching {
+		return fmt.Sprintf("Lost the broker (%v), waiting for it to come back", event.Err)
+	}
+	return fmt.Sprintf("Lost the broker (%v)", event.Err)
+}
+
+func (event BrokerLost) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event ImageOutputComplete) String() string {
 	return fmt.Sprintf("File %v output complete", event.Filename)
 }
@@ -114,6 +266,14 @@ func (event CellFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellStateChanged) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellStateChanged) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return fmt.Sprintf("")
 }
@@ -1,11 +1,51 @@
 package gol
 
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
-	Turns       int
-	Threads     int
-	ImageWidth  int
-	ImageHeight int
+	Turns                int
+	Threads              int
+	ImageWidth           int
+	ImageHeight          int
+	BrokerAddress        string                // defaults to the local broker if empty
+	Rule                 string                // rulestring in B/S notation, defaults to B3/S23 if empty
+	Edge                 string                // edge behaviour (toroidal, dead or mirrored), defaults to toroidal if empty
+	Seed                 int64                 // seed for random births and deaths, chosen at random if 0
+	BirthProbability     float64               // probability of a dead cell being born spontaneously each turn
+	DeathProbability     float64               // probability of an alive cell dying spontaneously each turn
+	IncludeAges          bool                  // include cell ages in the final event and write age images with snapshots
+	StopEarly            bool                  // stop before Turns once the board is empty, stops changing or starts cycling
+	CycleWindow          int                   // how many previous turns to check for repeats, 0 to not look for cycles
+	Census               bool                  // count the known objects on the final board
+	StopConditions       []stubs.StopCondition // stop before Turns once any of these hold
+	Expand               bool                  // grow the board when cells reach its edge, rather than wrapping
+	TileSize             int                   // have the broker store the board as tiles of this size, 0 to keep it in memory
+	Engine               string                // how the broker works out turns, workers or hashlife, defaults to workers if empty
+	TargetTurnsPerSecond float64               // throughput the broker should recommend a number of workers for, 0 for none
+	Autoscale            bool                  // have the broker change the number of workers it uses to reach the target
+	AliveCellsPageSize   int                   // fetch the final alive cells in pages of this many, 0 to get them all at once
+	Deadline             time.Duration         // stop the game once this long has passed, 0 for no deadline
+	Detach               bool                  // have the broker finish the game and write its board if the controller quits
+	StopRunning          bool                  // stop the game the broker is running to start this one
+	Priority             int                   // the game's share of the workers while batches want them too, 0 for an equal share
+	CheckpointInterval   time.Duration         // fetch the board this often, to write out if the broker is lost, 0 to not
+	Reattach             time.Duration         // how long to wait for a lost broker to come back and carry on, 0 to not
+	WorkerMetrics        bool                  // write how each worker performed to out as CSV once the game has finished
+	Report               bool                  // write where the run's time went to out once the game has finished
+	Heatmap              bool                  // write how often each cell came alive or died as an image once the game has finished
+	RecordKeys           string                // write every key pressed, with the turn it was pressed at, to this script file
+	ReplayKeys           string                // press the keys of this script file once the game reaches each one's turn
+	SharedImage          bool                  // have the workers write the finished board to storage shared with the broker
+	Halo                 bool                  // have the workers keep the board between turns, only sending each other the rows between them
+	Stream               bool                  // send the window every turn's flipped cells as the broker works them out
+	Join                 string                // ID of a game another controller started to watch and help change, or JoinRunning
+	Name                 string                // who the controller takes turns changing the board as, made up if empty
+	Pattern              string                // the known object i places on the board, a glider if empty
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
@@ -16,25 +56,28 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	filename := make(chan string)
+	size := make(chan imageSize)
 	startingBoard := make(chan uint8)
 	finishedBoard := make(chan uint8)
 	ioChannels := ioChannels{
 		command:  ioCommand,
 		idle:     ioIdle,
 		filename: filename,
+		size:     size,
 		output:   finishedBoard,
 		input:    startingBoard,
 	}
 	go startIo(p, ioChannels)
 
 	distributorChannels := distributorChannels{
-		events:     events,
+		events:     newEventBus(events),
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
 		ioFilename: filename,
 		ioOutput:   finishedBoard,
+		ioSize:     size,
 		ioInput:    startingBoard,
-		keys: keyPresses,
+		keys:       keyPresses,
 	}
 	distributor(p, distributorChannels)
 }
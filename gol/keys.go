@@ -0,0 +1,222 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// keyQueue is how many presses of a key can wait while an earlier one is handled, beyond which more are ignored
+const keyQueue = 8
+
+// keyHandler carries out what each key does, for one game
+type keyHandler struct {
+	p           Params
+	c           distributorChannels
+	broker      *stubs.Broker
+	gameID      string
+	name        string // who the controller takes turns changing the board as, see Params.Name
+	last        *lastBoard
+	gameOver    chan bool
+	pauseTicker chan bool
+	gamePaused  bool  // only used by the goroutine handling p
+	wantTurn    int32 // set atomically while the controller has, or is waiting for, the turn to change the board
+	ending      int32 // set atomically once q or k has been pressed, after which the other keys do nothing
+}
+
+// MonitorKeyPresses follows the rules when certain keys are pressed
+// Each key's presses are queued and handled by a goroutine of its own, so a key isn't held up, or lost, while the
+// broker answers an earlier one: p then s pauses the game and saves its board without s waiting for the pause.
+// Presses of the same key are handled in order.
+func MonitorKeyPresses(keys *keyHandler) {
+	ending := make(chan rune, 1) // q and k share a queue, as only the first of them is carried out
+	queues := map[rune]chan rune{
+		's': make(chan rune, keyQueue),
+		'c': make(chan rune, keyQueue),
+		'p': make(chan rune, keyQueue),
+		'b': make(chan rune, keyQueue),
+		'j': make(chan rune, keyQueue),
+		'w': make(chan rune, keyQueue),
+		'i': make(chan rune, keyQueue),
+		'q': ending,
+		'k': ending,
+	}
+	go keys.handle(queues['s'], keys.saveBoard)
+	go keys.handle(queues['c'], keys.countObjects)
+	go keys.handle(queues['p'], keys.togglePause)
+	go keys.handle(queues['b'], keys.bookmark)
+	go keys.handle(queues['j'], keys.jumpBack)
+	go keys.handle(queues['w'], keys.toggleTurn)
+	go keys.handle(queues['i'], keys.injectPattern)
+	go keys.handle(ending, keys.end)
+	for key := range keys.c.keys {
+		queue, ok := queues[key]
+		if !ok {
+			continue
+		}
+		if key == 'q' || key == 'k' {
+			atomic.StoreInt32(&keys.ending, 1)
+		}
+		select {
+		case queue <- key:
+		default:
+			fmt.Printf("Still handling earlier presses of %c, ignoring this one\n", key)
+		}
+	}
+}
+
+// handle carries out a key's action for each press queued, in order
+func (keys *keyHandler) handle(queue chan rune, action func(key rune)) {
+	for key := range queue {
+		action(key)
+	}
+}
+
+// isEnding checks whether q or k has been pressed, in which case the controller is ended by their goroutine
+func (keys *keyHandler) isEnding() bool {
+	return atomic.LoadInt32(&keys.ending) == 1
+}
+
+// saveBoard retrieves the current board state between turns and writes it as an image
+func (keys *keyHandler) saveBoard(rune) {
+	if keys.isEnding() {
+		return
+	}
+	p, broker := keys.p, keys.broker
+	header := stubs.NewHeader(keys.gameID).Within(queryTimeout)
+	response := new(stubs.SnapshotResponse)
+	var err error
+	if broker.Capabilities.Has(stubs.Snapshots) {
+		err = broker.Snapshot(stubs.SnapshotRequest{Header: header, IncludeAges: p.IncludeAges, Resume: true}, response)
+	} else { // older brokers can only give the board as it is, which may be partway through a turn
+		err = broker.CurrentBoard(stubs.CurrentBoardRequest{Header: header, IncludeAges: p.IncludeAges}, &response.CurrentBoardResponse)
+	}
+	if stubs.Code(err) == stubs.NoGame { // the broker hasn't started the game yet
+		fmt.Println("No board to save yet")
+		return
+	}
+	if stubs.Code(err) == stubs.DeadlineExceeded {
+		fmt.Println("Broker too busy to save the board, try again:", err.(*stubs.Error).Message)
+		return
+	}
+	if stubs.Unanswered(err) { // the last board is written out anyway once the game is found to be lost
+		fmt.Println("Can't reach the broker to save the board:", err)
+		return
+	}
+	handleError("Call broker error", err)
+	keys.last.update(response.Board, response.CompletedTurns)
+	saveSnapshot(p, keys.c, keys.gameID, response)
+}
+
+// countObjects counts the known objects on the current board
+func (keys *keyHandler) countObjects(rune) {
+	if keys.isEnding() {
+		return
+	}
+	response := new(stubs.CensusResponse)
+	err := keys.broker.Census(stubs.CensusRequest{Header: stubs.NewHeader(keys.gameID).Within(queryTimeout)}, response)
+	if code := stubs.Code(err); code == stubs.NoGame || code == stubs.InvalidParams || code == stubs.DeadlineExceeded { // not started yet, a tiled board or busy
+		fmt.Println("Can't count objects:", err.(*stubs.Error).Message)
+		return
+	}
+	handleError("Call broker error", err)
+	keys.c.events.publish(CensusComplete{response.CompletedTurns, response.Census})
+}
+
+// togglePause pauses processing, or carries on with it if it's paused
+func (keys *keyHandler) togglePause(rune) {
+	if keys.isEnding() { // k pauses the game itself to save the board
+		return
+	}
+	broker := keys.broker
+	request := stubs.PauseRequest{Header: stubs.NewHeader(keys.gameID), Action: stubs.PauseGame}
+	if keys.gamePaused {
+		request.Action = stubs.ResumeGame
+	}
+	response := new(stubs.PauseResponse)
+	var err error
+	switch {
+	case !broker.Capabilities.Has(stubs.PauseResume): // an older broker
+		err = broker.PauseBroker(request, response)
+	case keys.gamePaused:
+		err = broker.Resume(request, response)
+	default:
+		err = broker.Pause(request, response)
+	}
+	if stubs.Code(err) == stubs.NoGame {
+		fmt.Println("No game to pause yet")
+		return
+	}
+	handleError("Call broker error", err)
+	if response.Paused {
+		fmt.Println("Paused after turn: ", response.CompletedTurns)
+	} else {
+		fmt.Println("Continuing")
+	}
+	if response.Paused != keys.gamePaused {
+		keys.gamePaused = response.Paused
+		keys.pauseTicker <- keys.gamePaused // tell cell count ticker to continue/stop based on paused state
+	}
+}
+
+// bookmark has the broker keep the game as it is at the end of the current turn, so j can take it back there
+func (keys *keyHandler) bookmark(rune) {
+	if keys.isEnding() {
+		return
+	}
+	if !keys.broker.Capabilities.Has(stubs.Bookmarks) {
+		fmt.Println("The broker can't keep bookmarks")
+		return
+	}
+	response := new(stubs.BookmarkResponse)
+	err := keys.broker.Bookmark(stubs.BookmarkRequest{Header: stubs.NewHeader(keys.gameID).Within(queryTimeout)}, response)
+	if code := stubs.Code(err); code == stubs.NoGame || code == stubs.InvalidParams || code == stubs.DeadlineExceeded { // not started yet, a tiled board or busy
+		fmt.Println("Can't bookmark the game:", err.(*stubs.Error).Message)
+		return
+	}
+	handleError("Call broker error", err)
+	latest := response.Bookmarks[len(response.Bookmarks)-1]
+	fmt.Println("Bookmarked turn", latest.Turn, "as", latest.Name)
+}
+
+// jumpBack takes the paused game back to the latest bookmark, leaving it paused there
+func (keys *keyHandler) jumpBack(rune) {
+	if keys.isEnding() || !keys.broker.Capabilities.Has(stubs.Bookmarks) {
+		return
+	}
+	response := new(stubs.BookmarkResponse)
+	err := keys.broker.JumpToBookmark(stubs.BookmarkRequest{Header: stubs.NewHeader(keys.gameID).Within(queryTimeout)}, response)
+	if code := stubs.Code(err); code == stubs.NoGame || code == stubs.InvalidParams || code == stubs.DeadlineExceeded { // not paused or no bookmarks yet
+		fmt.Println("Can't jump to a bookmark:", err.(*stubs.Error).Message)
+		return
+	}
+	handleError("Call broker error", err)
+	fmt.Println("Jumped back to turn", response.CompletedTurns)
+}
+
+// end closes the controller for q, or the controller, broker and workers for k
+// A controller that joined another's game only leaves it.
+func (keys *keyHandler) end(key rune) {
+	if keys.p.Join != "" {
+		keys.leave()
+		return
+	}
+	broker := keys.broker
+	if key == 'k' {
+		keys.gameOver <- true
+		shutDown(keys.p, keys.c, broker, keys.gameID)
+		return
+	}
+	err := broker.ControllerClosed(stubs.CloseRequest{Header: stubs.NewHeader(keys.gameID)}, new(stubs.CloseResponse))
+	if stubs.Code(err) != stubs.NoGame { // there's no game to stop if it never started
+		handleError("Call broker error", err)
+	}
+	if keys.p.Detach && broker.Capabilities.Has(stubs.Detach) {
+		fmt.Println("The broker will finish the game and write its board to its out directory")
+	}
+	err = broker.Close()
+	handleError("Close broker error", err)
+	os.Exit(0)
+}
@@ -0,0 +1,63 @@
+package gol
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// writeWorkerMetrics writes how each worker performed over the game to out/name.csv, for scalability reports,
+// giving the path written
+func writeWorkerMetrics(name string, metrics []stubs.WorkerMetrics) (string, error) {
+	if err := os.MkdirAll("out", os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join("out", name+".csv")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"worker", "sections", "cells", "compute_s", "round_trip_s", "mean_latency_ms", "bytes_sent", "bytes_received", "bytes_per_turn", "encodings", "cells_per_s"})
+	for _, worker := range metrics {
+		rate := 0.0
+		if worker.Compute > 0 {
+			rate = float64(worker.Cells) / worker.Compute.Seconds()
+		}
+		_ = writer.Write([]string{
+			worker.Address,
+			strconv.Itoa(worker.Sections),
+			strconv.Itoa(worker.Cells),
+			fmt.Sprintf("%.6f", worker.Compute.Seconds()),
+			fmt.Sprintf("%.6f", worker.RoundTrip.Seconds()),
+			fmt.Sprintf("%.3f", float64(worker.Latency())/1e6),
+			strconv.FormatInt(worker.BytesSent, 10),
+			strconv.FormatInt(worker.BytesReceived, 10),
+			strconv.FormatInt(worker.BytesPerSection(), 10),
+			describeEncodings(worker.Encodings),
+			fmt.Sprintf("%.0f", rate),
+		})
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// describeEncodings lists how many boards and sections went each way in each encoding, as in dense:2 sparse:198
+func describeEncodings(encodings map[stubs.Encoding]int) string {
+	var counts []string
+	for encoding, count := range encodings {
+		counts = append(counts, fmt.Sprintf("%s:%d", encoding, count))
+	}
+	sort.Strings(counts)
+	return strings.Join(counts, " ")
+}
@@ -0,0 +1,88 @@
+package gol
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// reattachInterval is how often a lost broker is checked for while waiting for it to come back
+const reattachInterval = time.Second
+
+// lastBoard is the latest board the controller has of its game, from its start, a snapshot or a checkpoint,
+// which is what is written out, and carried on from, if the broker is lost
+type lastBoard struct {
+	sync.Mutex
+	cells [][]uint8
+	turn  int
+}
+
+// update records a board from the broker, unless the one recorded is from a later turn
+func (last *lastBoard) update(cells [][]uint8, turn int) {
+	if cells == nil { // the broker saves tiled boards itself, without sending them
+		return
+	}
+	last.Lock()
+	defer last.Unlock()
+	if turn >= last.turn {
+		last.cells, last.turn = cells, turn
+	}
+}
+
+func (last *lastBoard) get() ([][]uint8, int) {
+	last.Lock()
+	defer last.Unlock()
+	return last.cells, last.turn
+}
+
+// keepCheckpoints fetches the game's board every interval, without pausing it, so less of the game is lost
+// if the broker goes
+func keepCheckpoints(broker *stubs.Broker, gameID string, interval time.Duration, last *lastBoard, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		response := new(stubs.SnapshotResponse)
+		header := stubs.NewHeader(gameID).Within(queryTimeout)
+		// the game may not have started yet, or the broker may be busy, in which case the next one will do
+		if err := broker.Snapshot(stubs.SnapshotRequest{Header: header, Resume: true}, response); err == nil {
+			last.update(response.Board, response.CompletedTurns)
+		}
+	}
+}
+
+// reattach writes out the last board the controller has once the broker is lost, then waits up to Params.Reattach
+// for the broker to come back, changing request to carry on from that board. It reports whether the broker came back.
+func reattach(p Params, c distributorChannels, broker *stubs.Broker, gameID string, last *lastBoard, lost error, request *stubs.StartGameRequest) bool {
+	cells, turn := last.get()
+	waiting := p.Reattach > 0 && broker.Capabilities.Has(stubs.StartTurn)
+	c.events.publish(BrokerLost{turn, lost.Error(), waiting})
+	fmt.Println("Lost the broker:", lost)
+	saved := p
+	saved.IncludeAges = false // the controller only keeps the board
+	saveSnapshot(saved, c, gameID, &stubs.SnapshotResponse{CurrentBoardResponse: stubs.CurrentBoardResponse{Board: cells, CompletedTurns: turn}})
+	if !waiting {
+		return false
+	}
+	fmt.Println("Waiting up to", p.Reattach, "for the broker to come back")
+	for giveUp := time.Now().Add(p.Reattach); time.Now().Before(giveUp); time.Sleep(reattachInterval) {
+		if broker.Version(stubs.VersionRequest{Header: stubs.NewHeader("")}, new(stubs.VersionResponse)) != nil {
+			continue
+		}
+		fmt.Println("Broker is back, carrying on from turn", turn)
+		deadline := request.Deadline
+		request.Header = stubs.NewHeader(gameID)
+		request.Deadline = deadline
+		request.StartingBoard, request.Checksum, request.StartTurn = cells, stubs.Sum(cells), turn
+		request.Width, request.Height = len(cells[0]), len(cells)
+		return true
+	}
+	fmt.Println("The broker didn't come back")
+	return false
+}
@@ -0,0 +1,100 @@
+package gol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// runTimes is how long the controller spent on each part of a run, for the performance report
+type runTimes struct {
+	start      time.Time
+	readImage  time.Duration
+	game       time.Duration // waiting for the broker to finish the game, including sending the board and getting it back
+	writeImage time.Duration
+}
+
+// writeReport writes where the run's time went to out/name.txt, and where each turn's went to out/name-turns.csv,
+// giving the path of the report
+func writeReport(name string, gameID string, times runTimes, response *stubs.StartGameResponse) (string, error) {
+	if err := os.MkdirAll("out", os.ModePerm); err != nil {
+		return "", err
+	}
+	wall := time.Since(times.start)
+	var report strings.Builder
+	line := func(indent int, label string, d time.Duration) {
+		fmt.Fprintf(&report, "%-40s %10.3fs %6.1f%%\n", strings.Repeat("  ", indent)+label, d.Seconds(), 100*d.Seconds()/wall.Seconds())
+	}
+	fmt.Fprintf(&report, "gol performance report for game %s, written %s\n", gameID, time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&report, "%dx%d board, %d turns, %d workers\n\n", response.Width, response.Height, response.CompletedTurns, len(response.WorkerMetrics))
+	line(0, "wall time", wall)
+	line(1, "reading the image", times.readImage)
+	if response.Elapsed > 0 {
+		line(1, "sending the game and getting it back", times.game-response.Elapsed)
+		line(1, "the broker working out the turns", response.Elapsed)
+	} else { // older brokers don't say how long they took
+		line(1, "waiting for the broker", times.game)
+	}
+	var total stubs.TurnTiming
+	for _, turn := range response.TurnTimings {
+		total.Total += turn.Total
+		total.Compute += turn.Compute
+		total.Network += turn.Network
+		total.Reassembly += turn.Reassembly
+	}
+	if len(response.TurnTimings) > 0 {
+		line(2, "worker compute", total.Compute)
+		line(2, "network", total.Network)
+		line(2, "reassembly", total.Reassembly)
+		line(2, "other work on each turn", total.Total-total.Compute-total.Network-total.Reassembly)
+		line(2, "outside turns", response.Elapsed-total.Total)
+	}
+	line(1, "writing the image", times.writeImage)
+	line(1, "other", wall-times.readImage-times.game-times.writeImage)
+	if len(response.TurnTimings) == 0 {
+		report.WriteString("\nThe broker didn't time each turn, which it only does for games whose turns are split between workers.\n")
+	} else {
+		report.WriteString("\nThe compute and network time of each turn are those of the last worker to send its section back.\n\n")
+		fmt.Fprintf(&report, "%-16s %12s %12s\n", "per turn", "mean", "max")
+		perTurn := func(label string, value func(stubs.TurnTiming) time.Duration) {
+			var sum, most time.Duration
+			for _, turn := range response.TurnTimings {
+				sum += value(turn)
+				if value(turn) > most {
+					most = value(turn)
+				}
+			}
+			mean := sum / time.Duration(len(response.TurnTimings))
+			fmt.Fprintf(&report, "  %-14s %10.3fms %10.3fms\n", label, milliseconds(mean), milliseconds(most))
+		}
+		perTurn("total", func(turn stubs.TurnTiming) time.Duration { return turn.Total })
+		perTurn("compute", func(turn stubs.TurnTiming) time.Duration { return turn.Compute })
+		perTurn("network", func(turn stubs.TurnTiming) time.Duration { return turn.Network })
+		perTurn("reassembly", func(turn stubs.TurnTiming) time.Duration { return turn.Reassembly })
+		if err := writeTurnTimings(name+"-turns", response.TurnTimings); err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join("out", name+".txt")
+	return path, ioutil.WriteFile(path, []byte(report.String()), 0644)
+}
+
+// writeTurnTimings writes where the time of each turn went to out/name.csv
+func writeTurnTimings(name string, timings []stubs.TurnTiming) error {
+	var csv strings.Builder
+	csv.WriteString("turn,total_ms,compute_ms,network_ms,reassembly_ms\n")
+	for _, turn := range timings {
+		fmt.Fprintf(&csv, "%d,%.3f,%.3f,%.3f,%.3f\n", turn.Turn, milliseconds(turn.Total), milliseconds(turn.Compute),
+			milliseconds(turn.Network), milliseconds(turn.Reassembly))
+	}
+	return ioutil.WriteFile(filepath.Join("out", name+".csv"), []byte(csv.String()), 0644)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
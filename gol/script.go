@@ -0,0 +1,119 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// scriptInterval is how often a replayed script checks whether the game has reached the turn of its next key
+const scriptInterval = 20 * time.Millisecond
+
+// scriptedKey is a key press from a script, made once the game has completed Turn turns
+type scriptedKey struct {
+	Turn int
+	Key  rune
+}
+
+// readKeyScript reads a script of key presses, one to a line as the turn followed by the key, e.g. "100 p"
+// Blank lines and lines starting with # are skipped, and the turns can't go backwards.
+func readKeyScript(path string) ([]scriptedKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var script []scriptedKey
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || utf8.RuneCountInString(fields[1]) != 1 {
+			return nil, fmt.Errorf("%s:%d: expected a turn and a key, e.g. \"100 p\"", path, line)
+		}
+		turn, err := strconv.Atoi(fields[0])
+		if err != nil || turn < 0 {
+			return nil, fmt.Errorf("%s:%d: %q isn't a turn", path, line, fields[0])
+		}
+		if len(script) > 0 && turn < script[len(script)-1].Turn {
+			return nil, fmt.Errorf("%s:%d: turn %d comes before the line above", path, line, turn)
+		}
+		key, _ := utf8.DecodeRuneInString(fields[1])
+		script = append(script, scriptedKey{turn, key})
+	}
+	return script, scanner.Err()
+}
+
+// completedTurns asks the broker how many turns the game has completed, reporting false if it can't say
+// A game the broker hasn't started yet has completed none.
+func completedTurns(broker *stubs.Broker, gameID string) (int, bool) {
+	response := new(stubs.AliveCellCountResponse)
+	err := broker.AliveCellCount(stubs.AliveCellCountRequest{Header: stubs.NewHeader(gameID).Within(queryTimeout)}, response)
+	if stubs.Code(err) == stubs.NoGame {
+		return 0, true
+	}
+	return response.CompletedTurns, err == nil
+}
+
+// scriptKeys gives the key presses to act on when recording or replaying a script: those from the window, along with
+// the script's once their turns are reached, with each written to Params.RecordKeys along with the turn it was made at
+func scriptKeys(p Params, keys <-chan rune, broker *stubs.Broker, gameID string) <-chan rune {
+	merged := make(chan rune)
+	go func() {
+		for key := range keys {
+			merged <- key
+		}
+	}()
+	if p.ReplayKeys != "" {
+		script, err := readKeyScript(p.ReplayKeys)
+		handleError("Read key script error", err)
+		fmt.Println("Replaying", len(script), "key presses from", p.ReplayKeys)
+		go replayKeys(script, broker, gameID, merged)
+	}
+	if p.RecordKeys == "" {
+		return merged
+	}
+	file, err := os.Create(p.RecordKeys)
+	handleError("Create key script error", err)
+	recorded := make(chan rune)
+	go recordKeys(file, broker, gameID, merged, recorded)
+	return recorded
+}
+
+// replayKeys presses each key of the script once the game has completed its turn
+func replayKeys(script []scriptedKey, broker *stubs.Broker, gameID string, keys chan<- rune) {
+	for _, scripted := range script {
+		for {
+			if turn, ok := completedTurns(broker, gameID); ok && turn >= scripted.Turn {
+				break
+			}
+			time.Sleep(scriptInterval)
+		}
+		keys <- scripted.Key
+	}
+}
+
+// recordKeys passes on every key press, first writing it to the script with the turn the game had reached
+// Each line is written as soon as its key is pressed, as q and k end the controller without closing the file.
+func recordKeys(file *os.File, broker *stubs.Broker, gameID string, keys <-chan rune, recorded chan<- rune) {
+	last := 0 // used when the broker is too busy to say, so the turns still don't go backwards
+	for key := range keys {
+		if turn, ok := completedTurns(broker, gameID); ok && turn > last {
+			last = turn
+		}
+		if _, err := fmt.Fprintf(file, "%d %c\n", last, key); err != nil {
+			fmt.Println("Error recording key press:", err)
+		}
+		recorded <- key
+	}
+	_ = file.Close()
+}
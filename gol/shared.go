@@ -0,0 +1,223 @@
+package gol
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// JoinRunning is the Params.Join that joins whichever game the broker is running
+const JoinRunning = "running"
+
+// writeTurnPoll is how often a controller waiting for the turn to change the board checks whether it has come
+const writeTurnPoll = time.Second
+
+// JoinGame fills in the size, rule and turns of the game Params.Join names, which another controller started, so
+// the window can be made for it before it is joined
+func JoinGame(p Params) (Params, error) {
+	broker, err := stubs.DialBroker(brokerAddress(p))
+	if err != nil {
+		return p, err
+	}
+	defer broker.Close()
+	response := new(stubs.GamesResponse)
+	if err = broker.Games(stubs.GamesRequest{Header: stubs.NewHeader("")}, response); err != nil {
+		return p, err
+	}
+	for _, game := range response.Games {
+		if p.Join == JoinRunning || p.Join == game.ID {
+			p.Join, p.ImageWidth, p.ImageHeight, p.Turns = game.ID, game.Width, game.Height, game.Turns
+			p.Rule, p.Edge = game.Rule, game.Edge
+			return p, nil
+		}
+	}
+	if p.Join == JoinRunning {
+		return p, fmt.Errorf("the broker isn't running a game")
+	}
+	return p, fmt.Errorf("the broker isn't running game %s", p.Join)
+}
+
+// controllerName gives the name the controller takes turns changing the board under, Params.Name or one made up
+func controllerName(p Params) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// follow shows the game Params.Join, which another controller started, as it runs, until it finishes or q is pressed
+// The board is watched with WatchRegion, and the keys work as they do for the controller that started it, other
+// than q and k only leaving the game.
+func follow(p Params, c distributorChannels) {
+	broker, err := stubs.DialBroker(brokerAddress(p))
+	handleError("Dial broker error", err)
+	err = broker.Negotiate(config.Version, stubs.BrokerCapabilities)
+	handleError("Negotiate with broker error", err)
+	if !broker.Capabilities.Has(stubs.Watches) || !broker.Capabilities.Has(stubs.WriteTurns) {
+		handleError("Join error", fmt.Errorf("the broker can't share games between controllers"))
+	}
+	name := controllerName(p)
+	fmt.Println("Joined game", p.Join, "as", name)
+
+	gameOver := make(chan bool, 1)
+	pauseTicker := make(chan bool)
+	keys := &keyHandler{p: p, c: c, broker: broker, gameID: p.Join, name: name, last: &lastBoard{}, gameOver: gameOver, pauseTicker: pauseTicker}
+	go MonitorKeyPresses(keys)
+	go MonitorAliveCellCount(broker, c, p.Join, gameOver, pauseTicker)
+	completedTurns := watchBoard(p, c, broker)
+	gameOver <- true
+	if keys.isEnding() { // q or k is leaving the game
+		select {}
+	}
+	fmt.Println("Game", p.Join, "finished after turn", completedTurns)
+	c.events.publish(StateChange{completedTurns, Quitting})
+	c.events.close()
+}
+
+// watchBoard sends the changes to the whole board of the game being followed as they happen, giving the last turn
+// seen once the game has finished
+func watchBoard(p Params, c distributorChannels, broker *stubs.Broker) int {
+	rule, err := rules.Parse(p.Rule)
+	multiState := err == nil && rule.States > 2
+	board := make([][]uint8, p.ImageHeight)
+	for y := range board {
+		board[y] = make([]uint8, p.ImageWidth)
+	}
+	request := stubs.WatchRequest{Width: p.ImageWidth, Height: p.ImageHeight}
+	completedTurns := 0
+	for {
+		request.Header = stubs.NewHeader(p.Join)
+		response := new(stubs.WatchResponse)
+		err := broker.WatchRegion(request, response)
+		if stubs.Code(err) == stubs.NoGame {
+			return completedTurns
+		}
+		handleError("Call broker error", err)
+		request.WatchID, completedTurns = response.WatchID, response.CompletedTurns
+		showChanges(c, board, response.Changes, completedTurns, multiState)
+		if len(response.Changes) > 0 {
+			c.events.publish(TurnComplete{completedTurns})
+		}
+	}
+}
+
+// toggleTurn asks for the turn to change the board, for w, waiting in line if another controller has it, or gives
+// the turn up if this controller has it or is waiting for it
+func (keys *keyHandler) toggleTurn(rune) {
+	if keys.isEnding() {
+		return
+	}
+	if !keys.broker.Capabilities.Has(stubs.WriteTurns) {
+		fmt.Println("The broker can't share games between controllers")
+		return
+	}
+	release := atomic.LoadInt32(&keys.wantTurn) == 1
+	response, err := keys.writeTurn(release)
+	if err != nil {
+		fmt.Println("Can't take turns changing the board:", err.(*stubs.Error).Message)
+		return
+	}
+	switch {
+	case release:
+		atomic.StoreInt32(&keys.wantTurn, 0)
+		fmt.Println("Gave up the turn to change the board")
+	case response.Holder == keys.name:
+		atomic.StoreInt32(&keys.wantTurn, 1)
+		fmt.Println("Your turn to change the board, press i to place a", keys.pattern())
+	default:
+		atomic.StoreInt32(&keys.wantTurn, 1)
+		ahead := 0
+		for ahead < len(response.Waiting) && response.Waiting[ahead] != keys.name {
+			ahead++
+		}
+		fmt.Println("Waiting for the turn to change the board, which", response.Holder, "has, with", ahead, "others ahead")
+		go keys.awaitTurn()
+	}
+}
+
+// awaitTurn checks whether the turn to change the board has come, until it has or w gives up waiting for it
+func (keys *keyHandler) awaitTurn() {
+	for range time.Tick(writeTurnPoll) {
+		if atomic.LoadInt32(&keys.wantTurn) == 0 || keys.isEnding() {
+			return
+		}
+		response, err := keys.writeTurn(false)
+		if err != nil {
+			return
+		}
+		if response.Holder == keys.name {
+			fmt.Println("Your turn to change the board, press i to place a", keys.pattern())
+			return
+		}
+	}
+}
+
+// writeTurn asks the broker for the turn to change the board, or gives it up
+func (keys *keyHandler) writeTurn(release bool) (*stubs.WriteTurnResponse, error) {
+	request := stubs.WriteTurnRequest{Header: stubs.NewHeader(keys.gameID).Within(queryTimeout), Controller: keys.name, Release: release}
+	response := new(stubs.WriteTurnResponse)
+	err := keys.broker.WriteTurn(request, response)
+	if code := stubs.Code(err); code != "" && code != stubs.Internal { // not started, finished or busy
+		return nil, err
+	}
+	handleError("Call broker error", err)
+	return response, nil
+}
+
+// pattern gives the name of the pattern i places
+func (keys *keyHandler) pattern() string {
+	if keys.p.Pattern == "" {
+		return "glider"
+	}
+	return keys.p.Pattern
+}
+
+// injectPattern places Params.Pattern somewhere on the board at random, for i, as long as nobody else has the turn
+// to change the board
+func (keys *keyHandler) injectPattern(rune) {
+	if keys.isEnding() {
+		return
+	}
+	if !keys.broker.Capabilities.Has(stubs.SetCells) {
+		fmt.Println("The broker can't change the board of a running game")
+		return
+	}
+	rows, known := census.Pattern(keys.pattern())
+	if !known {
+		fmt.Println("No pattern is called", keys.pattern())
+		return
+	}
+	if len(rows) > keys.p.ImageHeight || len(rows[0]) > keys.p.ImageWidth {
+		fmt.Println("A", keys.pattern(), "doesn't fit on the board")
+		return
+	}
+	request := stubs.InjectPatternRequest{Header: stubs.NewHeader(keys.gameID).Within(queryTimeout), Controller: keys.name,
+		X: rand.Intn(keys.p.ImageWidth - len(rows[0]) + 1), Y: rand.Intn(keys.p.ImageHeight - len(rows) + 1), Rows: rows}
+	response := new(stubs.SetCellsResponse)
+	err := keys.broker.InjectPattern(request, response)
+	if code := stubs.Code(err); code == stubs.NoGame || code == stubs.InvalidParams || code == stubs.DeadlineExceeded { // someone else's turn, or busy
+		fmt.Println("Can't place a", keys.pattern()+":", err.(*stubs.Error).Message)
+		return
+	}
+	handleError("Call broker error", err)
+	fmt.Println("Placed a", keys.pattern(), "at", request.X, request.Y, "after turn", response.CompletedTurns)
+}
+
+// leave gives up the turn to change the board, if this controller has it, and ends the controller without stopping
+// the game it joined, for q and k
+func (keys *keyHandler) leave() {
+	if keys.broker.Capabilities.Has(stubs.WriteTurns) {
+		_, _ = keys.writeTurn(true)
+	}
+	err := keys.broker.Close()
+	handleError("Close broker error", err)
+	os.Exit(0)
+}
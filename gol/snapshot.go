@@ -0,0 +1,114 @@
+package gol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// SnapshotInfo describes a saved board, and is written as a text file beside its image so the image can be
+// understood, and the game carried on from it, without knowing how it was made
+type SnapshotInfo struct {
+	Game                               string
+	Turn                               int
+	Width, Height                      int
+	Rule                               string
+	Edge                               string
+	Seed                               int64
+	BirthProbability, DeathProbability float64
+	Engine                             string
+	Checksum                           *stubs.Checksum // of the board, as sent by the broker
+}
+
+// SnapshotName chooses a name for a snapshot of a board at a turn that nothing in out has yet, so a second snapshot
+// of the same turn is kept beside the first rather than overwriting it
+// Names end in a number from 1, which also keeps them apart from the final image of a game ending on that turn.
+func SnapshotName(width int, height int, turn int) string {
+	base := strconv.Itoa(width) + "x" + strconv.Itoa(height) + "x" + strconv.Itoa(turn)
+	for n := 1; ; n++ {
+		name := base + "-" + strconv.Itoa(n)
+		if !exists(filepath.Join("out", name+".pgm")) && !exists(filepath.Join("out", name+".txt")) {
+			return name
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
+
+// WriteSnapshotInfo writes the description of the snapshot with the given name to out, beside its image
+func WriteSnapshotInfo(name string, info SnapshotInfo) error {
+	if err := os.MkdirAll("out", os.ModePerm); err != nil {
+		return err
+	}
+	lines := []string{
+		fmt.Sprintf("gol snapshot saved at %s", time.Now().Format(time.RFC3339)),
+		fmt.Sprintf("image: %s.pgm", name),
+		fmt.Sprintf("game: %s", info.Game),
+		fmt.Sprintf("turn: %d", info.Turn),
+		fmt.Sprintf("size: %dx%d", info.Width, info.Height),
+		fmt.Sprintf("rule: %s", info.Rule),
+		fmt.Sprintf("edge: %s", info.Edge),
+		fmt.Sprintf("engine: %s", info.Engine),
+	}
+	if info.BirthProbability > 0 || info.DeathProbability > 0 {
+		lines = append(lines,
+			fmt.Sprintf("seed: %d", info.Seed),
+			fmt.Sprintf("birth probability: %g", info.BirthProbability),
+			fmt.Sprintf("death probability: %g", info.DeathProbability))
+	}
+	if info.Checksum != nil {
+		lines = append(lines, fmt.Sprintf("crc32: %08x", info.Checksum.CRC))
+	}
+	return ioutil.WriteFile(filepath.Join("out", name+".txt"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// saveSnapshot writes a snapshot's board, and its ages if asked for, under a name of its own, with a text file
+// describing it beside them
+func saveSnapshot(p Params, c distributorChannels, gameID string, response *stubs.SnapshotResponse) {
+	if response.ImagePath != "" { // the broker saves tiled boards itself
+		WriteImage(p, c, nil, response.CompletedTurns, response.ImagePath)
+		return
+	}
+	board := response.Board
+	width, height := p.ImageWidth, p.ImageHeight
+	if len(board) > 0 && (len(board) != height || len(board[0]) != width) { // the board has grown
+		width, height = len(board[0]), len(board)
+	}
+	name := SnapshotName(width, height, response.CompletedTurns)
+	writeBoard(c, name, width, height, func(x int, y int) uint8 {
+		return board[y][x]
+	})
+	c.events.publish(ImageOutputComplete{response.CompletedTurns, name})
+	if p.IncludeAges {
+		writeAges(c, name+"-ages", width, height, response.Ages)
+		c.events.publish(ImageOutputComplete{response.CompletedTurns, name + "-ages"})
+	}
+	rule, edge, engine := p.Rule, p.Edge, p.Engine
+	if rule == "" {
+		rule = rules.Default
+	}
+	if edge == "" {
+		edge = rules.Toroidal.String()
+	}
+	if engine == "" {
+		engine = stubs.EngineWorkers
+	}
+	info := SnapshotInfo{Game: gameID, Turn: response.CompletedTurns, Width: width, Height: height, Rule: rule, Edge: edge,
+		Seed: p.Seed, BirthProbability: p.BirthProbability, DeathProbability: p.DeathProbability, Engine: engine,
+		Checksum: stubs.Sum(board)}
+	if err := WriteSnapshotInfo(name, info); err != nil {
+		fmt.Println("Error describing snapshot:", err)
+		return
+	}
+	fmt.Println("Wrote image", name)
+}
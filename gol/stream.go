@@ -0,0 +1,82 @@
+package gol
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// streamWait is how long each GetTurnDiff call waits for a turn, so the stream notices soon after the game finishes
+const streamWait = time.Second
+
+// streamRetry is how long to wait before asking again for the turns of a game that hasn't started yet or has
+// finished, or whose broker has gone
+const streamRetry = 100 * time.Millisecond
+
+// streamTurns shows every turn of the game on the window as the broker works it out, from the starting board, until
+// the game's final response is sent on finished, which has the final board shown if it has one, closing stopped once
+// it has. Turns the controller falls too far behind on are skipped, the broker sending the whole board instead.
+func streamTurns(p Params, c distributorChannels, broker *stubs.Broker, gameID string, board [][]uint8, finished <-chan *stubs.StartGameResponse, stopped chan<- struct{}) {
+	defer close(stopped)
+	rule, err := rules.Parse(p.Rule)
+	multiState := err == nil && rule.States > 2
+	shown := make([][]uint8, len(board))
+	for y, row := range board {
+		shown[y] = append([]uint8(nil), row...)
+	}
+	next := 0
+	for {
+		select {
+		case final := <-finished:
+			if final.FinishedBoard != nil && len(final.FinishedBoard) == len(shown) {
+				showBoard(c, shown, final.FinishedBoard, final.CompletedTurns, multiState)
+			}
+			return
+		default:
+		}
+		response := new(stubs.TurnDiffResponse)
+		err := broker.GetTurnDiff(stubs.TurnDiffRequest{Header: stubs.NewHeader(gameID), Next: next, Wait: streamWait}, response)
+		if stubs.Code(err) == stubs.NoGame || stubs.Unanswered(err) { // not started yet or finished, or the broker has gone, which StartGame deals with
+			time.Sleep(streamRetry)
+			continue
+		}
+		handleError("Call broker error", err)
+		next = response.Next
+		if response.Board != nil { // fallen behind, so the turns missed are shown all at once
+			showBoard(c, shown, response.Board, response.Turn, multiState)
+		}
+		for _, diff := range response.Diffs {
+			showChanges(c, shown, diff.Changes, diff.Turn, multiState)
+			c.events.publish(TurnComplete{diff.Turn})
+		}
+	}
+}
+
+// showBoard sends the window the turn that brings the board it shows up to date with another
+func showBoard(c distributorChannels, shown [][]uint8, board [][]uint8, completedTurns int, multiState bool) {
+	var changes []stubs.CellChange
+	for y, row := range board {
+		for x, value := range row {
+			if value != shown[y][x] {
+				changes = append(changes, stubs.CellChange{X: x, Y: y, Value: value})
+			}
+		}
+	}
+	showChanges(c, shown, changes, completedTurns, multiState)
+	c.events.publish(TurnComplete{completedTurns})
+}
+
+// showChanges sends the window the cells that have changed on the board it shows, keeping the board up to date
+func showChanges(c distributorChannels, board [][]uint8, changes []stubs.CellChange, completedTurns int, multiState bool) {
+	for _, change := range changes {
+		cell := util.Cell{X: change.X, Y: change.Y}
+		if multiState {
+			c.events.publish(CellStateChanged{completedTurns, cell, change.Value})
+		} else if (change.Value == 255) != (board[change.Y][change.X] == 255) {
+			c.events.publish(CellFlipped{completedTurns, cell})
+		}
+		board[change.Y][change.X] = change.Value
+	}
+}
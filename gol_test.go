@@ -11,12 +11,14 @@ import (
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
-// TestGol tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns using 1-16 worker threads.
+// TestGol tests 16x16, 64x64, 512x512 and the non-square 64x512 and 512x64 images on 0, 1 and 100 turns using 1-16 worker threads.
 func TestGol(t *testing.T) {
 	tests := []gol.Params{
 		{ImageWidth: 16, ImageHeight: 16},
 		{ImageWidth: 64, ImageHeight: 64},
 		{ImageWidth: 512, ImageHeight: 512},
+		{ImageWidth: 64, ImageHeight: 512},
+		{ImageWidth: 512, ImageHeight: 64},
 	}
 	for _, p := range tests {
 		for _, turns := range []int{0, 1, 100} {
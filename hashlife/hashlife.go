@@ -0,0 +1,327 @@
+package hashlife
+
+import (
+	"fmt"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// node is a square of 2^level cells, made of four nodes of the level below
+// Nodes are shared, so two squares with the same cells are always the same node,
+// which is what lets results be remembered and reused.
+type node struct {
+	nw, ne, sw, se *node
+	level          int
+	population     int
+}
+
+// maxNodes is how many nodes are kept before the ones no longer in use are thrown away, along with every result
+const maxNodes = 1 << 22
+
+type resultKey struct {
+	node *node
+	j    int // the result is 2^j turns on
+}
+
+// Universe is an unbounded board advanced with the HashLife algorithm
+// Large, structured patterns can be run for huge numbers of turns, as every repeated square and its
+// future is only worked out once. Only rules with two states and a radius of 1 are supported.
+type Universe struct {
+	rule        rules.Rule
+	dead, alive *node
+	nodes       map[[4]*node]*node
+	results     map[resultKey]*node
+	empties     []*node // the empty node of each level
+	root        *node
+	rootX       int // position of the root's top left cell
+	rootY       int
+}
+
+// New creates an empty universe for the rule
+func New(rule rules.Rule) (*Universe, error) {
+	if rule.States != 2 || rule.Colours > 0 || rule.Radius != 1 {
+		return nil, fmt.Errorf("hashlife only supports two state rules with a radius of 1")
+	}
+	if rule.Birth[0] {
+		return nil, fmt.Errorf("hashlife doesn't support rules where cells are born with no neighbours")
+	}
+	universe := &Universe{
+		rule:    rule,
+		dead:    &node{},
+		alive:   &node{population: 1},
+		nodes:   make(map[[4]*node]*node),
+		results: make(map[resultKey]*node),
+	}
+	universe.empties = []*node{universe.dead}
+	universe.root = universe.empty(3)
+	return universe, nil
+}
+
+// join finds the node made of four quadrants, creating it the first time it is needed
+func (universe *Universe) join(nw *node, ne *node, sw *node, se *node) *node {
+	key := [4]*node{nw, ne, sw, se}
+	if existing, ok := universe.nodes[key]; ok {
+		return existing
+	}
+	joined := &node{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population}
+	universe.nodes[key] = joined
+	return joined
+}
+
+// empty gives the node of a level with every cell dead
+func (universe *Universe) empty(level int) *node {
+	for len(universe.empties) <= level {
+		smaller := universe.empties[len(universe.empties)-1]
+		universe.empties = append(universe.empties, universe.join(smaller, smaller, smaller, smaller))
+	}
+	return universe.empties[level]
+}
+
+// Load replaces the universe with a board, with the board's top left cell at (0, 0)
+func (universe *Universe) Load(cells [][]uint8, alive func(value uint8) bool) {
+	size := 0
+	for _, row := range cells {
+		if len(row) > size {
+			size = len(row)
+		}
+	}
+	if len(cells) > size {
+		size = len(cells)
+	}
+	level := 3
+	for 1<<uint(level) < size {
+		level++
+	}
+	universe.root = universe.build(cells, alive, 0, 0, level)
+	universe.rootX, universe.rootY = 0, 0
+}
+
+// build creates the node for the square of the board at (x, y)
+func (universe *Universe) build(cells [][]uint8, alive func(value uint8) bool, x int, y int, level int) *node {
+	if y >= len(cells) || x >= len(cells[0]) {
+		return universe.empty(level)
+	}
+	if level == 0 {
+		if x < len(cells[y]) && alive(cells[y][x]) {
+			return universe.alive
+		}
+		return universe.dead
+	}
+	half := 1 << uint(level-1)
+	return universe.join(
+		universe.build(cells, alive, x, y, level-1),
+		universe.build(cells, alive, x+half, y, level-1),
+		universe.build(cells, alive, x, y+half, level-1),
+		universe.build(cells, alive, x+half, y+half, level-1))
+}
+
+// Population is the number of alive cells
+func (universe *Universe) Population() int {
+	return universe.root.population
+}
+
+// Step advances the universe by a number of turns, jumping by the largest power of two it can each time
+func (universe *Universe) Step(turns int) {
+	for turns > 0 {
+		j := 0
+		for 1<<uint(j+1) <= turns {
+			j++
+		}
+		// the root needs enough empty space around the pattern that nothing can reach past the result
+		for universe.root.level < j+3 || !universe.padded(universe.root) {
+			universe.expand()
+		}
+		universe.expand()
+		quarter := 1 << uint(universe.root.level-2)
+		universe.root = universe.successor(universe.root, j)
+		universe.rootX += quarter
+		universe.rootY += quarter
+		turns -= 1 << uint(j)
+		if len(universe.nodes) > maxNodes {
+			universe.collect()
+		}
+	}
+}
+
+// collect throws away every node and result, then rebuilds just the nodes the root needs
+func (universe *Universe) collect() {
+	universe.nodes = make(map[[4]*node]*node)
+	universe.results = make(map[resultKey]*node)
+	universe.empties = []*node{universe.dead}
+	universe.root = universe.rebuild(universe.root, make(map[*node]*node))
+}
+
+func (universe *Universe) rebuild(n *node, rebuilt map[*node]*node) *node {
+	if n.level == 0 {
+		return n
+	}
+	if existing, ok := rebuilt[n]; ok {
+		return existing
+	}
+	result := universe.join(universe.rebuild(n.nw, rebuilt), universe.rebuild(n.ne, rebuilt),
+		universe.rebuild(n.sw, rebuilt), universe.rebuild(n.se, rebuilt))
+	rebuilt[n] = result
+	return result
+}
+
+// expand doubles the size of the root, keeping it centred in the same place
+func (universe *Universe) expand() {
+	root := universe.root
+	border := universe.empty(root.level - 1)
+	universe.root = universe.join(
+		universe.join(border, border, border, root.nw),
+		universe.join(border, border, root.ne, border),
+		universe.join(border, root.sw, border, border),
+		universe.join(root.se, border, border, border))
+	half := 1 << uint(root.level-1)
+	universe.rootX -= half
+	universe.rootY -= half
+}
+
+// padded checks that every alive cell of a node is within its central square
+func (universe *Universe) padded(n *node) bool {
+	return n.population == n.nw.se.population+n.ne.sw.population+n.sw.ne.population+n.se.nw.population
+}
+
+// successor gives the central square of a node, half its size, 2^j turns on
+func (universe *Universe) successor(n *node, j int) *node {
+	if n.population == 0 {
+		return universe.empty(n.level - 1)
+	}
+	if j > n.level-2 {
+		j = n.level - 2
+	}
+	key := resultKey{n, j}
+	if result, ok := universe.results[key]; ok {
+		return result
+	}
+	var result *node
+	if n.level == 2 {
+		result = universe.step4x4(n)
+	} else {
+		// nine overlapping squares, each half the size of n, advanced on their own
+		c1 := universe.successor(n.nw, j)
+		c2 := universe.successor(universe.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), j)
+		c3 := universe.successor(n.ne, j)
+		c4 := universe.successor(universe.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), j)
+		c5 := universe.successor(universe.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw), j)
+		c6 := universe.successor(universe.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne), j)
+		c7 := universe.successor(n.sw, j)
+		c8 := universe.successor(universe.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), j)
+		c9 := universe.successor(n.se, j)
+		if j < n.level-2 { // the nine squares are already far enough on, so just take their centres
+			result = universe.join(
+				universe.join(c1.se, c2.sw, c4.ne, c5.nw),
+				universe.join(c2.se, c3.sw, c5.ne, c6.nw),
+				universe.join(c4.se, c5.sw, c7.ne, c8.nw),
+				universe.join(c5.se, c6.sw, c8.ne, c9.nw))
+		} else { // advance the four squares they overlap into by the same number of turns again
+			result = universe.join(
+				universe.successor(universe.join(c1, c2, c4, c5), j),
+				universe.successor(universe.join(c2, c3, c5, c6), j),
+				universe.successor(universe.join(c4, c5, c7, c8), j),
+				universe.successor(universe.join(c5, c6, c8, c9), j))
+		}
+	}
+	universe.results[key] = result
+	return result
+}
+
+// step4x4 advances the centre 2x2 cells of a 4x4 node by a single turn
+func (universe *Universe) step4x4(n *node) *node {
+	var cells [4][4]bool
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			quadrant := n.nw
+			switch {
+			case x >= 2 && y >= 2:
+				quadrant = n.se
+			case y >= 2:
+				quadrant = n.sw
+			case x >= 2:
+				quadrant = n.ne
+			}
+			leaf := quadrant.nw
+			switch {
+			case x%2 == 1 && y%2 == 1:
+				leaf = quadrant.se
+			case y%2 == 1:
+				leaf = quadrant.sw
+			case x%2 == 1:
+				leaf = quadrant.ne
+			}
+			cells[y][x] = leaf == universe.alive
+		}
+	}
+	next := func(x int, y int) *node {
+		neighbours := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if universe.rule.InNeighbourhood(dx, dy) && cells[y+dy][x+dx] {
+					neighbours++
+				}
+			}
+		}
+		if universe.rule.Next(cells[y][x], neighbours) {
+			return universe.alive
+		}
+		return universe.dead
+	}
+	return universe.join(next(1, 1), next(2, 1), next(1, 2), next(2, 2))
+}
+
+// Bounds gives the smallest rectangle holding every alive cell, or ok as false if there are none
+func (universe *Universe) Bounds() (x int, y int, width int, height int, ok bool) {
+	if universe.root.population == 0 {
+		return 0, 0, 0, 0, false
+	}
+	minX, minY, maxX, maxY := 0, 0, 0, 0
+	first := true
+	universe.visit(universe.root, universe.rootX, universe.rootY, func(cellX int, cellY int) {
+		if first || cellX < minX {
+			minX = cellX
+		}
+		if first || cellX > maxX {
+			maxX = cellX
+		}
+		if first || cellY < minY {
+			minY = cellY
+		}
+		if first || cellY > maxY {
+			maxY = cellY
+		}
+		first = false
+	})
+	return minX, minY, maxX - minX + 1, maxY - minY + 1, true
+}
+
+// Cells copies a rectangle of the universe, with alive cells as 255
+func (universe *Universe) Cells(x int, y int, width int, height int) [][]uint8 {
+	cells := make([][]uint8, height)
+	for j := range cells {
+		cells[j] = make([]uint8, width)
+	}
+	universe.visit(universe.root, universe.rootX, universe.rootY, func(cellX int, cellY int) {
+		if cellX >= x && cellX < x+width && cellY >= y && cellY < y+height {
+			cells[cellY-y][cellX-x] = 255
+		}
+	})
+	return cells
+}
+
+// visit calls found for every alive cell in a node whose top left cell is at (x, y)
+func (universe *Universe) visit(n *node, x int, y int, found func(x int, y int)) {
+	if n.population == 0 {
+		return
+	}
+	if n.level == 0 {
+		found(x, y)
+		return
+	}
+	half := 1 << uint(n.level-1)
+	universe.visit(n.nw, x, y, found)
+	universe.visit(n.ne, x+half, y, found)
+	universe.visit(n.sw, x, y+half, found)
+	universe.visit(n.se, x+half, y+half, found)
+}
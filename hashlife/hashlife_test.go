@@ -0,0 +1,207 @@
+package hashlife
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+type cell struct {
+	x, y int
+}
+
+// pattern reads a pattern drawn with '#' for alive cells, one string per row
+func pattern(rows ...string) [][]uint8 {
+	cells := make([][]uint8, len(rows))
+	for y, row := range rows {
+		cells[y] = make([]uint8, len(row))
+		for x, c := range row {
+			if c == '#' {
+				cells[y][x] = 255
+			}
+		}
+	}
+	return cells
+}
+
+// soup makes a square of random cells, about a third of them alive
+func soup(size int, seed int64) [][]uint8 {
+	random := rand.New(rand.NewSource(seed))
+	cells := make([][]uint8, size)
+	for y := range cells {
+		cells[y] = make([]uint8, size)
+		for x := range cells[y] {
+			if random.Intn(3) == 0 {
+				cells[y][x] = 255
+			}
+		}
+	}
+	return cells
+}
+
+// simulate advances a set of alive cells on an unbounded board a turn at a time
+func simulate(rule rules.Rule, alive map[cell]bool, turns int) map[cell]bool {
+	for turn := 0; turn < turns; turn++ {
+		neighbours := make(map[cell]int)
+		for c := range alive {
+			neighbours[c] += 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if rule.InNeighbourhood(dx, dy) {
+						neighbours[cell{c.x + dx, c.y + dy}]++
+					}
+				}
+			}
+		}
+		next := make(map[cell]bool)
+		for c, n := range neighbours {
+			if rule.Next(alive[c], n) {
+				next[c] = true
+			}
+		}
+		alive = next
+	}
+	return alive
+}
+
+// aliveCells gives the alive cells of a universe
+func aliveCells(universe *Universe) map[cell]bool {
+	alive := make(map[cell]bool)
+	x, y, width, height, ok := universe.Bounds()
+	if !ok {
+		return alive
+	}
+	for j, row := range universe.Cells(x, y, width, height) {
+		for i, value := range row {
+			if value == 255 {
+				alive[cell{x + i, y + j}] = true
+			}
+		}
+	}
+	return alive
+}
+
+func describe(alive map[cell]bool) string {
+	var cells []string
+	for c := range alive {
+		cells = append(cells, fmt.Sprintf("(%d,%d)", c.x, c.y))
+		if len(cells) == 10 {
+			cells = append(cells, "...")
+			break
+		}
+	}
+	return strings.Join(cells, " ")
+}
+
+// TestStep checks Step gives the same cells as advancing a turn at a time, for several rules, patterns and steps,
+// including patterns that grow or move far beyond the root they start in.
+func TestStep(t *testing.T) {
+	patterns := map[string][][]uint8{
+		"blinker":     pattern("###"),
+		"glider":      pattern(".#.", "..#", "###"),
+		"r-pentomino": pattern(".##", "##.", ".#."),
+		"acorn":       pattern(".#.....", "...#...", "##..###"),
+		"soup":        soup(20, 1),
+	}
+	tests := []struct {
+		rule  string
+		steps []int
+	}{
+		{"B3/S23", []int{1, 2, 3, 7, 16, 33, 100}},
+		{"B3/S23", []int{64, 64, 64}},
+		{"B36/S23", []int{1, 5, 8, 31, 64}},
+		{"B2/S", []int{1, 2, 4, 9, 16}},
+	}
+	for _, test := range tests {
+		rule, err := rules.Parse(test.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, cells := range patterns {
+			t.Run(fmt.Sprintf("%s/%s/%v", test.rule, name, test.steps), func(t *testing.T) {
+				universe, err := New(rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				universe.Load(cells, rule.Alive)
+				expected := make(map[cell]bool)
+				for y, row := range cells {
+					for x, value := range row {
+						if value == 255 {
+							expected[cell{x, y}] = true
+						}
+					}
+				}
+				turns := 0
+				for _, step := range test.steps {
+					universe.Step(step)
+					expected = simulate(rule, expected, step)
+					turns += step
+					got := aliveCells(universe)
+					if universe.Population() != len(expected) {
+						t.Fatalf("turn %d: population %d, want %d", turns, universe.Population(), len(expected))
+					}
+					for c := range expected {
+						if !got[c] {
+							t.Fatalf("turn %d: (%d,%d) should be alive, have %s", turns, c.x, c.y, describe(got))
+						}
+					}
+					for c := range got {
+						if !expected[c] {
+							t.Fatalf("turn %d: (%d,%d) should be dead, want %s", turns, c.x, c.y, describe(expected))
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestCollect checks the universe is still right after its nodes are thrown away and rebuilt.
+func TestCollect(t *testing.T) {
+	rule, _ := rules.Parse("B3/S23")
+	universe, err := New(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := soup(32, 2)
+	universe.Load(cells, rule.Alive)
+	universe.Step(50)
+	universe.collect()
+	universe.Step(50)
+
+	expected := make(map[cell]bool)
+	for y, row := range cells {
+		for x, value := range row {
+			if value == 255 {
+				expected[cell{x, y}] = true
+			}
+		}
+	}
+	expected = simulate(rule, expected, 100)
+	got := aliveCells(universe)
+	if len(got) != len(expected) {
+		t.Fatalf("%d cells alive after 100 turns, want %d", len(got), len(expected))
+	}
+	for c := range expected {
+		if !got[c] {
+			t.Fatalf("(%d,%d) should be alive after 100 turns", c.x, c.y)
+		}
+	}
+}
+
+// TestUnsupported checks New refuses rules HashLife can't run.
+func TestUnsupported(t *testing.T) {
+	for _, rulestring := range []string{"B03/S23", "B2/S/C3", "R2,C0,M0,S2..3,B3..3,NM", "Wireworld", "QuadLife"} {
+		rule, err := rules.Parse(rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(rule); err == nil {
+			t.Errorf("New accepted %s", rulestring)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package health
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Serve answers HTTP health probes on the address, for container orchestrators and load balancers
+// /healthz answers 200 whenever the process is running. /readyz answers 200 only when ready returns nil,
+// and 503 with the reason otherwise. Any other pages the process serves, such as the broker's chart, are
+// given by their paths in pages.
+func Serve(address string, ready func() error, pages map[string]http.HandlerFunc) {
+	mux := http.NewServeMux()
+	for path, page := range pages {
+		mux.HandleFunc(path, page)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	log.Println("Health probes on", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Println("Health probe error:", err)
+	}
+}
@@ -1,49 +1,462 @@
 package main
 
 import (
-	"flag"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
 	"runtime"
+	"strings"
+	"time"
 
+	"uk.ac.bris.cs/gameoflife/broker"
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/ec2"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/health"
+	"uk.ac.bris.cs/gameoflife/rules"
 	"uk.ac.bris.cs/gameoflife/sdl"
+	"uk.ac.bris.cs/gameoflife/seal"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/worker"
 )
 
+const usage = `Usage: gol <command> [flags]
+
+Commands:
+  controller  load an image, run it on the broker and visualise it (default)
+  broker      distribute games across the workers
+  worker      advance slices of the board for the broker
+  up          start a broker and workers on this machine, wired together
+  batch       run a sweep of random games over rules, seeds and densities on the broker
+  equivalence run one random game split between different numbers of sections and check the final boards match
+  diverge     find the first turn and cells where two runs' turn logs differ, and the workers that worked them out
+  decrypt     print a checkpoint, turn log or history the broker encrypted
+  service     install or uninstall a broker or worker that starts on boot
+  ctl         list, pause, resume, snapshot or shut down the broker's games
+  doctor      check the broker and workers can be reached and are compatible
+  version     print version information
+
+Run 'gol <command> -help' for the flags of each command.
+`
+
+// stopConditionList collects every -stopWhen flag given to the controller
+type stopConditionList []stubs.StopCondition
+
+func (list *stopConditionList) String() string {
+	return fmt.Sprint(*list)
+}
+
+func (list *stopConditionList) Set(value string) error {
+	condition, err := stubs.ParseStopCondition(value)
+	if err == nil {
+		*list = append(*list, condition)
+	}
+	return err
+}
+
+func handleError(message string, err error) {
+	if err != nil {
+		log.Fatal(message, ": ", err)
+	}
+}
+
 // main is the function called when starting Game of Life with 'go run .'
+// The first argument selects the subcommand, with the controller used if none is given.
 func main() {
+	args := os.Args[1:]
+	command := "controller"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "controller":
+		runController(args)
+	case "broker":
+		runBroker(args)
+	case "worker":
+		runWorker(args)
+	case "up":
+		runUp(args)
+	case "batch":
+		runBatch(args)
+	case "equivalence":
+		runEquivalence(args)
+	case "diverge":
+		runDiverge(args)
+	case "decrypt":
+		runDecrypt(args)
+	case "service":
+		runService(args)
+	case "ctl":
+		runCtl(args)
+	case "doctor":
+		runDoctor(args)
+	case "version":
+		fmt.Println(config.VersionString())
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// runBroker starts the broker, which blocks until it is closed
+func runBroker(args []string) {
+	var cfg config.Config
+	var options broker.Options
+	flags := cfg.NewFlagSet("broker", config.DefaultBrokerPort)
+	flags.StringVar(&options.TileDirectory, "tileDir", os.TempDir(), "Directory for the tiles of tiled boards that don't fit in memory.")
+	flags.IntVar(&options.MaxResidentTiles, "maxTiles", broker.DefaultMaxResidentTiles, "Most tiles of a tiled board to keep in memory at once.")
+	template := flags.String("ec2Template", "", "EC2 launch template to start workers from for each game, instead of using -workers.")
+	region := flags.String("ec2Region", "us-east-1", "AWS region to start EC2 workers in.")
+	flags.IntVar(&options.ScaleWorkers, "ec2Workers", 4, "Number of EC2 workers to start for each game.")
+	publicIP := flags.Bool("ec2PublicIP", false, "Dial EC2 workers on their public addresses, for a broker outside their VPC.")
+	flags.IntVar(&options.Limits.MaxWidth, "maxWidth", 0, "Widest starting board to accept, 0 for no limit.")
+	flags.IntVar(&options.Limits.MaxHeight, "maxHeight", 0, "Tallest starting board to accept, 0 for no limit.")
+	flags.IntVar(&options.Limits.MaxTurns, "maxTurns", 0, "Most turns a game can ask for, 0 for no limit.")
+	flags.IntVar(&options.Limits.MaxGames, "maxGames", 0, "Most games or batches to run at once, 0 for no limit.")
+	flags.IntVar(&options.Limits.MaxMemory, "maxMemory", 0, "Most megabytes of broker memory a game's boards can need, 0 for no limit.")
+	flags.BoolVar(&options.OrderByLatency, "latencyAware", false, "Order the workers by measured latency, so neighbouring slices go to nearby workers.")
+	flags.DurationVar(&options.ControllerTimeout, "controllerTimeout", 30*time.Second, "How long a controller can go without a heartbeat before its game is written to out and stopped, 0 to never.")
+	flags.StringVar(&options.WhileRunning, "whileRunning", broker.RejectNewGames, "What a new game does while another controller's game runs: reject it, queue until it finishes, or stop it if the new one asks with -stopRunning.")
+	flags.IntVar(&options.MinWorkers, "minWorkers", 1, "Fewest healthy workers to carry on a game with: when a worker fails its rows go to the others, and below it the game waits, then carries on once enough are back. 0 ends the game when a worker fails.")
+	flags.StringVar(&options.HistoryDirectory, "historyDir", "", "Directory to write each game's turn statistics to as CSV, so all of a long game's history can be fetched. Empty keeps only the latest turns, in memory.")
+	flags.IntVar(&options.HistoryTurns, "historyTurns", broker.DefaultHistoryTurns, "Most turns of each game's statistics to keep in memory, 0 for no limit.")
+	flags.StringVar(&options.Hook, "hook", "", "Program, with its arguments, to run on each game's board every -hookEvery turns. It is sent the board as a PGM image on stdin, can print a changed board to stdout, and has what it writes to stderr logged.")
+	flags.IntVar(&options.HookEvery, "hookEvery", 1, "How many turns apart -hook is run.")
+	flags.StringVar(&options.TurnLogDirectory, "turnLog", "", "Directory to log the checksum of each game's board, and of every row of it, after each turn, for gol diverge to compare runs with.")
+	flags.IntVar(&options.TurnLogBoards, "turnLogBoards", 0, "Save the board beside the turn log every this many turns, so gol diverge can show the cells that differ. 0 saves none.")
+	flags.StringVar(&options.SharedImageDirectory, "sharedImages", "", "Directory on storage shared with the workers, at the same path on each, such as an NFS mount, for them to write the finished boards of games started with -sharedImage to.")
+	flags.StringVar(&options.SharedMemoryDirectory, "sharedMemory", "", "Directory in memory, such as /dev/shm, to share boards through with workers dialled on a loopback address, rather than sending them each turn. Empty sends every worker the board.")
+	encodings := flags.String("encodings", broker.DefaultEncodings, "Encodings the broker can pack boards in for workers, choosing between them and sending boards whole each turn by how dense the board is, how much of it changed and how fast each worker's link is. Empty always sends boards whole.")
+	flags.IntVar(&options.TurnSlots, "turnSlots", broker.DefaultTurnSlots, "How many turns of games and batches competing for the workers are worked out at once, taking turns by priority. A game or batch on its own runs as many as it likes.")
+	flags.IntVar(&options.HaloEvery, "haloEvery", broker.DefaultHaloEvery, "How many turns apart games started with -halo fetch their whole board from the workers, which is as many turns as are worked out again if a worker is lost. 0 only fetches it when it is needed.")
+	flags.BoolVar(&options.Cull, "cull", true, "Only send workers the rows of the board that could change each turn, those near a row that changed the turn before, so boards that have settled into still debris are quick to work out.")
+	encryptionKey := flags.String("encryptionKey", "", "AES key, as 32, 48 or 64 hex digits, to encrypt the checkpoints, turn logs and histories the broker writes with. Empty reads it from "+seal.KeyVariable+", which keeps it out of the process list, and writes them unencrypted if that isn't set either.")
+	viewer := flags.String("viewer", "", "Directory of the browser viewer built from ./viewer, to serve at /view/ on -health for spectators.")
+	cfg.Parse(flags, args)
+	var err error
+	options.Encodings, err = stubs.ParseEncodings(*encodings)
+	handleError("Encodings error", err)
+	options.EncryptionKey, err = seal.LoadKey(*encryptionKey)
+	handleError("Encryption key error", err)
+	if options.TurnSlots < 1 {
+		handleError("Turn slots error", fmt.Errorf("-turnSlots %d must be at least 1", options.TurnSlots))
+	}
+	if *template != "" {
+		provisioner, err := ec2.NewProvisioner(*region, *template, config.DefaultWorkerPort, *publicIP)
+		handleError("EC2 error", err)
+		options.Scaler = provisioner
+	} else {
+		options.ScaleWorkers = 0 // the workers given are used as they are
+	}
+	listener, err := cfg.Listen("Broker")
+	handleError("Listener error", err)
+	if cfg.HealthAddress != "" {
+		pages := map[string]http.HandlerFunc{"/chart.svg": broker.Chart, "/board.pgm": broker.BoardImage, "/api/": broker.API}
+		if *viewer != "" {
+			pages["/view/"] = http.StripPrefix("/view/", http.FileServer(http.Dir(*viewer))).ServeHTTP
+		}
+		go health.Serve(cfg.HealthAddress, broker.Ready, pages)
+	} else if *viewer != "" {
+		fmt.Println("The viewer is only served with -health")
+	}
+	broker.Run(listener, cfg.Workers, options)
+}
+
+// runWorker starts a worker, which blocks until it is closed
+func runWorker(args []string) {
+	var cfg config.Config
+	flags := cfg.NewFlagSet("worker", config.DefaultWorkerPort)
+	register := flags.Bool("register", false, "Announce the worker to the -broker, which then splits its games between it and its other workers, rather than waiting to be listed in the broker's -workers. It is announced again every few seconds, so a broker started later finds it too.")
+	cfg.Parse(flags, args)
+	listener, err := cfg.Listen("Worker")
+	handleError("Listener error", err)
+	if *register {
+		go worker.Register(cfg.BrokerAddress, config.AdvertisedAddress(listener, cfg.Advertise))
+	}
+	if cfg.HealthAddress != "" {
+		go health.Serve(cfg.HealthAddress, worker.Ready, nil)
+	}
+	worker.Run(listener)
+}
+
+// validate prints what the broker would do with the game, exiting with an error if it would reject it
+func validate(params gol.Params) {
+	response, err := gol.Validate(params)
+	handleError("Validate error", err)
+	fmt.Printf("%s engine, %dx%d for %d turns, about %.1fMB of broker memory\n", response.Engine, params.ImageWidth,
+		params.ImageHeight, params.Turns, float64(response.MemoryBytes)/(1<<20))
+	if response.Tiled {
+		fmt.Println("Stored as tiles of", params.TileSize)
+	}
+	if response.ScaleWorkers > 0 {
+		fmt.Println("The broker would start", response.ScaleWorkers, "workers")
+	} else if response.Engine == stubs.EngineWorkers {
+		fmt.Println("Workers:", strings.Join(response.Workers, ", "))
+	}
+	if len(response.Problems) == 0 {
+		fmt.Println("The broker would run this game")
+		return
+	}
+	fmt.Println("The broker would reject this game:")
+	for _, problem := range response.Problems {
+		fmt.Println(" -", problem)
+	}
+	os.Exit(1)
+}
+
+// runController loads the image, starts the game on the broker and runs the SDL window
+func runController(args []string) {
 	runtime.LockOSThread()
 	var params gol.Params
+	var cfg config.Config
+	flags := cfg.NewFlagSet("controller", "")
 
-	flag.IntVar(
+	flags.IntVar(
 		&params.Threads,
 		"t",
 		8,
 		"Specify the number of worker threads to use. Defaults to 8.")
 
-	flag.IntVar(
+	flags.IntVar(
 		&params.ImageWidth,
 		"w",
 		512,
 		"Specify the width of the image. Defaults to 512.")
 
-	flag.IntVar(
+	flags.IntVar(
 		&params.ImageHeight,
 		"h",
 		512,
 		"Specify the height of the image. Defaults to 512.")
 
-	flag.IntVar(
+	flags.IntVar(
 		&params.Turns,
 		"turns",
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
-	noVis := flag.Bool(
+	flags.StringVar(
+		&params.Rule,
+		"rule",
+		rules.Default,
+		"Specify the rule in B/S notation (e.g. B36/S23), B/S/C notation for Generations rules (e.g. B2/S/C3), Larger than Life notation (e.g. R5,C0,M1,S34..58,B34..45,NM) or by name (e.g. highlife, wireworld, quadlife). Defaults to B3/S23.")
+
+	flags.StringVar(
+		&params.Edge,
+		"edge",
+		"toroidal",
+		"Specify what lies beyond the edge of the board: toroidal, dead or mirrored. Defaults to toroidal.")
+
+	flags.Int64Var(
+		&params.Seed,
+		"seed",
+		0,
+		"Specify the seed for random births and deaths. Defaults to a random seed, which is printed.")
+
+	flags.Float64Var(
+		&params.BirthProbability,
+		"pbirth",
+		0,
+		"Specify the probability of a dead cell being born spontaneously each turn. Defaults to 0.")
+
+	flags.Float64Var(
+		&params.DeathProbability,
+		"pdeath",
+		0,
+		"Specify the probability of an alive cell dying spontaneously each turn. Defaults to 0.")
+
+	flags.BoolVar(
+		&params.IncludeAges,
+		"ages",
+		false,
+		"Include cell ages in the final output and write an age image alongside each snapshot.")
+
+	flags.BoolVar(
+		&params.StopEarly,
+		"stopEarly",
+		false,
+		"Stop before the turn count once every cell is dead, the board stops changing or a cycle is found.")
+
+	flags.IntVar(
+		&params.CycleWindow,
+		"cycleWindow",
+		0,
+		"Specify how many previous turns to check for a repeating cycle. Defaults to 0, which disables checking.")
+
+	flags.BoolVar(
+		&params.Census,
+		"census",
+		false,
+		"Count the blocks, blinkers, gliders and other known objects on the final board. Press c to count at any time.")
+
+	flags.Var(
+		(*stopConditionList)(&params.StopConditions),
+		"stopWhen",
+		"Stop before the turn count once population<N, population>N or empty:x,y,w,h holds. Can be given more than once.")
+
+	flags.BoolVar(
+		&params.Expand,
+		"expand",
+		false,
+		"Grow the board whenever cells reach its edge, so spaceships can travel forever. Images are written at the grown size.")
+
+	flags.IntVar(
+		&params.TileSize,
+		"tileSize",
+		0,
+		"Have the broker store the board as tiles of this size, keeping only active tiles in memory. Defaults to 0, which keeps the whole board in memory.")
+
+	flags.StringVar(
+		&params.Engine,
+		"engine",
+		stubs.EngineWorkers,
+		"Specify how turns are worked out: workers splits every turn between the workers, hashlife jumps many turns at once on an unbounded board, which is far faster for large structured patterns. Defaults to workers.")
+
+	flags.Float64Var(
+		&params.TargetTurnsPerSecond,
+		"targetRate",
+		0,
+		"Specify a target number of turns per second, so the broker recommends how many workers are needed. Defaults to 0, which gives no recommendation.")
+
+	flags.BoolVar(
+		&params.Autoscale,
+		"autoscale",
+		false,
+		"Have the broker change how many workers it uses to reach -targetRate as the measured throughput drifts.")
+
+	flags.IntVar(
+		&params.AliveCellsPageSize,
+		"alivePageSize",
+		0,
+		"Fetch the final alive cells from the broker in pages of this many, for boards with too many to send in one message. Defaults to 0, which sends them all with the final board.")
+
+	flags.DurationVar(
+		&params.Deadline,
+		"deadline",
+		0,
+		"Stop the game once this long has passed (e.g. 10m), writing the board as it was. Defaults to 0, which gives no deadline.")
+
+	flags.BoolVar(
+		&params.StopRunning,
+		"stopRunning",
+		false,
+		"Stop the game the broker is running to start this one, if the broker was started with -whileRunning stop.")
+
+	flags.IntVar(
+		&params.Priority,
+		"priority",
+		0,
+		"Share of the broker's workers the game gets while batches want them too, each level up doubling it, from -10 to 10. Defaults to 0, an equal share.")
+
+	flags.BoolVar(
+		&params.Detach,
+		"detach",
+		false,
+		"Have the broker carry on to the turn count if the controller quits or loses its connection, writing the final board to its own out directory.")
+
+	flags.DurationVar(
+		&params.CheckpointInterval,
+		"checkpoint",
+		0,
+		"Fetch the board from the broker this often (e.g. 1m) without pausing the game, so it can be written out if the broker is lost. Defaults to 0, which only keeps the board from the start and from snapshots.")
+
+	flags.DurationVar(
+		&params.Reattach,
+		"reattach",
+		0,
+		"If the broker is lost, wait this long (e.g. 5m) for it to come back and carry on from the last board the controller has. Defaults to 0, which gives up once the board is written.")
+
+	flags.BoolVar(
+		&params.WorkerMetrics,
+		"workerMetrics",
+		false,
+		"Once the game has finished, write each worker's compute time, latency and bytes sent and received to out as CSV, for scalability reports.")
+
+	flags.BoolVar(
+		&params.Report,
+		"report",
+		false,
+		"Once the game has finished, write a report to out of where the time went: reading and writing images, the network, worker compute and reassembly, for each turn and overall.")
+
+	flags.BoolVar(
+		&params.Heatmap,
+		"heatmap",
+		false,
+		"Count how often each cell comes alive or dies over the game, and write the counts as a heatmap image once it has finished, brighter for busier cells.")
+
+	flags.StringVar(
+		&params.RecordKeys,
+		"recordKeys",
+		"",
+		"Write every key pressed to this script file, along with the turn the game had reached, so the run can be replayed with -replayKeys.")
+
+	flags.StringVar(
+		&params.ReplayKeys,
+		"replayKeys",
+		"",
+		"Press the keys in this script file, one \"<turn> <key>\" per line, once the game reaches each one's turn. Keys pressed in the window still work.")
+
+	flags.BoolVar(
+		&params.SharedImage,
+		"sharedImage",
+		false,
+		"Have the workers write the finished board straight to the broker's -sharedImages directory, rather than sending it back to be written to out, for boards too big to download.")
+
+	flags.BoolVar(
+		&params.Halo,
+		"halo",
+		false,
+		"Have each worker keep its strip of the board between turns, the broker passing only the rows along each strip's edges between them, rather than sending the whole board every turn. Can't be used with ages, -stopEarly, cycles, -census, stop conditions, -expand, -heatmap, -sharedImage, tiles or hashlife.")
+
+	flags.StringVar(
+		&params.Join,
+		"join",
+		"",
+		"Join a game another controller started, by its ID or \"running\" for whichever game the broker is running, to watch it and take turns changing its board with w and i, rather than starting one.")
+
+	flags.StringVar(
+		&params.Name,
+		"name",
+		"",
+		"Who this controller takes turns changing the board as, shown to the other controllers sharing the game. Defaults to the host name and process ID.")
+
+	flags.StringVar(
+		&params.Pattern,
+		"pattern",
+		"glider",
+		"Known object, such as glider or lwss, that pressing i places somewhere on the board at random.")
+
+	dryRun := flags.Bool(
+		"dryRun",
+		false,
+		"Ask the broker whether it would run the game, and how, without starting it.")
+
+	stream := flags.Bool(
+		"stream",
+		true,
+		"Stream every turn's flipped cells from the broker to the SDL window as they are worked out. Use -stream=false for headless benchmark runs, which -noVis does too.")
+
+	noVis := flags.Bool(
 		"noVis",
 		false,
 		"Disables the SDL window, so there is no visualisation during the tests.")
 
-	flag.Parse()
+	cfg.Parse(flags, args)
+	params.BrokerAddress = cfg.BrokerAddress
+	if params.Join != "" {
+		var err error
+		params, err = gol.JoinGame(params)
+		handleError("Join game error", err)
+	}
+	params.Stream = *stream && !*noVis && params.Join == "" // a game that is joined is watched with WatchRegion instead
+	if *dryRun {
+		validate(params)
+		return
+	}
 
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
@@ -56,13 +469,7 @@ func main() {
 	if !(*noVis) {
 		sdl.Run(params, events, keyPresses)
 	} else {
-		complete := false
-		for !complete {
-			event := <-events
-			switch event.(type) {
-			case gol.FinalTurnComplete:
-				complete = true
-			}
+		for range events { // closed once the final board has been written out
 		}
 	}
 }
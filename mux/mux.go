@@ -0,0 +1,367 @@
+// Package mux carries several streams over one connection, so a small message on one stream isn't held up
+// behind a large one being sent on another.
+// Every write is split into frames of at most maxFrame bytes, and frames of different streams take turns
+// on the connection. Each stream can only have window bytes on their way to the other side that it hasn't read
+// yet, and the reader gives the writer more as it reads them, so a slow reader holds up its own stream's writer
+// rather than filling the other side's memory.
+package mux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Magic starts every multiplexed connection, so Serve can tell them from plain ones
+const Magic = "GOLMUX2\n"
+
+// maxFrame is the most bytes of a stream sent before another stream gets a turn
+const maxFrame = 16 << 10
+
+// window is how many bytes a stream can send that the other side hasn't read yet
+const window = 256 << 10
+
+// headerSize is the length of a frame's header: the stream ID, the frame's kind and the length of its payload
+const headerSize = 9
+
+const (
+	frameOpen byte = iota
+	frameData
+	frameClose
+	frameWindow // lets the other side send as many more bytes on the stream as the payload's number
+)
+
+// ErrClosed is given by streams and sessions used after they are closed
+var ErrClosed = errors.New("mux: closed")
+
+// Session is one connection carrying many streams
+type Session struct {
+	conn      io.ReadWriteCloser
+	writing   sync.Mutex // held while a frame is written, so frames aren't interleaved
+	mutex     sync.Mutex
+	streams   map[uint32]*Stream
+	nextID    uint32
+	accepted  chan *Stream
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(conn io.ReadWriteCloser, reader io.Reader, firstID uint32) *Session {
+	session := &Session{
+		conn:     conn,
+		streams:  make(map[uint32]*Stream),
+		nextID:   firstID,
+		accepted: make(chan *Stream, 16),
+		closed:   make(chan struct{}),
+	}
+	go session.read(reader)
+	return session
+}
+
+// Client starts a session on a connection that has just been dialled
+func Client(conn net.Conn) (*Session, error) {
+	if _, err := conn.Write([]byte(Magic)); err != nil {
+		return nil, err
+	}
+	return newSession(conn, conn, 1), nil // the dialling side opens odd streams
+}
+
+// Open starts a new stream
+func (session *Session) Open() (*Stream, error) {
+	session.mutex.Lock()
+	id := session.nextID
+	session.nextID += 2
+	stream := session.newStream(id)
+	session.mutex.Unlock()
+	if err := session.writeFrame(id, frameOpen, nil); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Accept waits for the other side to open a stream
+func (session *Session) Accept() (*Stream, error) {
+	select {
+	case stream := <-session.accepted:
+		return stream, nil
+	case <-session.closed:
+		return nil, ErrClosed
+	}
+}
+
+// Close closes the connection and every stream on it
+func (session *Session) Close() error {
+	var err error
+	session.closeOnce.Do(func() {
+		close(session.closed)
+		err = session.conn.Close()
+		session.mutex.Lock()
+		for _, stream := range session.streams {
+			stream.end()
+		}
+		session.streams = nil
+		session.mutex.Unlock()
+	})
+	return err
+}
+
+// newStream registers a stream, which must be done with the session locked
+func (session *Session) newStream(id uint32) *Stream {
+	stream := &Stream{id: id, session: session, window: window}
+	stream.ready = sync.NewCond(&stream.mutex)
+	if session.streams == nil { // the session has closed
+		stream.end()
+	} else {
+		session.streams[id] = stream
+	}
+	return stream
+}
+
+// writeFrame sends one frame, waiting for any frame already being sent
+func (session *Session) writeFrame(id uint32, kind byte, payload []byte) error {
+	frame := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], id)
+	frame[4] = kind
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(payload)))
+	copy(frame[headerSize:], payload)
+	session.writing.Lock()
+	defer session.writing.Unlock()
+	select {
+	case <-session.closed:
+		return ErrClosed
+	default:
+	}
+	if _, err := session.conn.Write(frame); err != nil {
+		_ = session.Close()
+		return err
+	}
+	return nil
+}
+
+// read hands each frame that arrives to its stream, until the connection fails
+func (session *Session) read(reader io.Reader) {
+	defer session.Close()
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		id := binary.BigEndian.Uint32(header[0:4])
+		length := binary.BigEndian.Uint32(header[5:9])
+		if length > maxFrame {
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return
+		}
+		session.mutex.Lock()
+		if header[4] == frameOpen {
+			stream := session.newStream(id)
+			session.mutex.Unlock()
+			select {
+			case session.accepted <- stream:
+			case <-session.closed:
+				return
+			}
+			continue
+		}
+		stream := session.streams[id]
+		if header[4] == frameClose {
+			delete(session.streams, id)
+		}
+		session.mutex.Unlock()
+		if stream == nil { // already closed on this side
+			continue
+		}
+		switch header[4] {
+		case frameData:
+			if !stream.push(payload) { // the other side sent more than its window
+				return
+			}
+		case frameWindow:
+			if len(payload) != 4 {
+				return
+			}
+			stream.grant(int(binary.BigEndian.Uint32(payload)))
+		default:
+			stream.end()
+		}
+	}
+}
+
+// Stream is one of a session's streams, which can be used like a connection of its own
+type Stream struct {
+	id      uint32
+	session *Session
+	mutex   sync.Mutex
+	ready   *sync.Cond // signalled when data arrives, more of the window is given, or the stream ends
+	buffer  []byte
+	window  int  // bytes that can be sent before the other side gives more
+	unread  int  // bytes read since the other side was last given more of the window
+	ended   bool // the other side has closed the stream, or the connection has gone
+	closed  bool // this side has closed the stream
+}
+
+// push adds data that has arrived to what is waiting to be read, reporting false if it is more than the window
+func (stream *Stream) push(data []byte) bool {
+	stream.mutex.Lock()
+	if len(stream.buffer)+len(data) > window {
+		stream.mutex.Unlock()
+		return false
+	}
+	stream.buffer = append(stream.buffer, data...)
+	stream.mutex.Unlock()
+	stream.ready.Broadcast()
+	return true
+}
+
+// grant lets the stream send more bytes, once the other side has read as many
+func (stream *Stream) grant(bytes int) {
+	stream.mutex.Lock()
+	stream.window += bytes
+	stream.mutex.Unlock()
+	stream.ready.Broadcast()
+}
+
+// end marks that nothing more will arrive, so reads give io.EOF once the buffer is empty
+func (stream *Stream) end() {
+	stream.mutex.Lock()
+	stream.ended = true
+	stream.mutex.Unlock()
+	stream.ready.Broadcast()
+}
+
+// Read reads data sent on the stream, waiting for some to arrive
+// Once half the window has been read the other side is given it back, so it can carry on writing.
+func (stream *Stream) Read(p []byte) (int, error) {
+	stream.mutex.Lock()
+	for len(stream.buffer) == 0 && !stream.ended && !stream.closed {
+		stream.ready.Wait()
+	}
+	if stream.closed {
+		stream.mutex.Unlock()
+		return 0, ErrClosed
+	}
+	if len(stream.buffer) == 0 {
+		stream.mutex.Unlock()
+		return 0, io.EOF
+	}
+	n := copy(p, stream.buffer)
+	stream.buffer = stream.buffer[n:]
+	if len(stream.buffer) == 0 {
+		stream.buffer = nil // so the memory of a large message isn't kept
+	}
+	stream.unread += n
+	given := 0
+	if stream.unread >= window/2 && !stream.ended {
+		given, stream.unread = stream.unread, 0
+	}
+	stream.mutex.Unlock()
+	if given > 0 { // sent without the stream locked, so data arriving meanwhile isn't held up
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, uint32(given))
+		_ = stream.session.writeFrame(stream.id, frameWindow, payload)
+	}
+	return n, nil
+}
+
+// Write sends data on the stream, a frame at a time so other streams aren't held up, waiting whenever the window is
+// used up for the other side to read some of it
+func (stream *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		stream.mutex.Lock()
+		for stream.window == 0 && !stream.closed && !stream.ended {
+			stream.ready.Wait()
+		}
+		if stream.closed || stream.ended {
+			stream.mutex.Unlock()
+			return written, ErrClosed
+		}
+		chunk := p
+		if len(chunk) > maxFrame {
+			chunk = chunk[:maxFrame]
+		}
+		if len(chunk) > stream.window {
+			chunk = chunk[:stream.window]
+		}
+		stream.window -= len(chunk)
+		stream.mutex.Unlock()
+		if err := stream.session.writeFrame(stream.id, frameData, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Close closes the stream on both sides, leaving the session's other streams open
+func (stream *Stream) Close() error {
+	stream.mutex.Lock()
+	if stream.closed {
+		stream.mutex.Unlock()
+		return nil
+	}
+	stream.closed = true
+	stream.mutex.Unlock()
+	stream.ready.Broadcast()
+	session := stream.session
+	session.mutex.Lock()
+	if session.streams != nil {
+		delete(session.streams, stream.id)
+	}
+	session.mutex.Unlock()
+	err := session.writeFrame(stream.id, frameClose, nil)
+	if err == ErrClosed {
+		return nil
+	}
+	return err
+}
+
+// Serve calls serve with every connection accepted by listener, or, for multiplexed connections,
+// with every stream opened on them, returning when the listener fails
+func Serve(listener net.Listener, serve func(conn io.ReadWriteCloser)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Print("mux: accept: ", err)
+			return
+		}
+		go serveConn(conn, serve)
+	}
+}
+
+// bufferedConn is a connection whose first bytes have been peeked at
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn bufferedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+// serveConn serves a connection as a session if it starts with Magic, or on its own otherwise
+func serveConn(conn net.Conn, serve func(conn io.ReadWriteCloser)) {
+	reader := bufio.NewReader(conn)
+	start, err := reader.Peek(len(Magic))
+	if err != nil || string(start) != Magic {
+		serve(bufferedConn{conn, reader})
+		return
+	}
+	_, _ = reader.Discard(len(Magic))
+	session := newSession(conn, reader, 2)
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		go serve(stream)
+	}
+}
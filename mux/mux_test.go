@@ -0,0 +1,344 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer serves connections on a local port, each stream or plain connection starting with a byte saying what
+// to do with it: 'e' echoes everything back, 'h' reads nothing until hold is closed and then discards everything,
+// 'r' reads until EOF and sends what it read on received, and 'w' writes "bye" and closes.
+type testServer struct {
+	listener net.Listener
+	hold     chan struct{}
+	received chan []byte
+}
+
+func newTestServer(t *testing.T) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testServer{listener: listener, hold: make(chan struct{}), received: make(chan []byte, 1)}
+	go Serve(listener, server.serve)
+	t.Cleanup(func() { _ = listener.Close() })
+	return server
+}
+
+func (server *testServer) serve(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	command := make([]byte, 1)
+	if _, err := io.ReadFull(conn, command); err != nil {
+		return
+	}
+	switch command[0] {
+	case 'e':
+		_, _ = io.Copy(conn, conn)
+	case 'h':
+		<-server.hold
+		_, _ = io.Copy(ioutil.Discard, conn)
+	case 'r':
+		data, _ := ioutil.ReadAll(conn)
+		server.received <- data
+	case 'w':
+		_, _ = conn.Write([]byte("bye"))
+	}
+}
+
+func (server *testServer) session(t *testing.T) *Session {
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := Client(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func open(t *testing.T, session *Session, command byte) *Stream {
+	stream, err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write([]byte{command}); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func randomBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// writeFrame writes a frame straight to a connection, as the other side of a session would
+func writeFrame(t *testing.T, conn net.Conn, id uint32, kind byte, payload []byte) {
+	frame := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], id)
+	frame[4] = kind
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(payload)))
+	copy(frame[headerSize:], payload)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads a frame straight from a connection
+func readFrame(t *testing.T, conn net.Conn) (uint32, byte, []byte) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[5:9]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatal(err)
+	}
+	return binary.BigEndian.Uint32(header[0:4]), header[4], payload
+}
+
+// TestFrames speaks the protocol by hand, checking a stream is opened, echoed and closed with the frames expected.
+func TestFrames(t *testing.T) {
+	server := newTestServer(t)
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte(Magic)); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, conn, 1, frameOpen, nil)
+	writeFrame(t, conn, 1, frameData, []byte("ehello"))
+	id, kind, payload := readFrame(t, conn)
+	if id != 1 || kind != frameData || string(payload) != "hello" {
+		t.Fatalf("got frame %d/%d %q, want the echo %q on stream 1", id, kind, payload, "hello")
+	}
+	writeFrame(t, conn, 1, frameClose, nil)
+	id, kind, _ = readFrame(t, conn)
+	if id != 1 || kind != frameClose {
+		t.Fatalf("got frame %d/%d, want stream 1 closed", id, kind)
+	}
+}
+
+// TestOversizedFrame checks a frame longer than maxFrame ends the session rather than being read.
+func TestOversizedFrame(t *testing.T) {
+	server := newTestServer(t)
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte(Magic)); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, conn, 1, frameOpen, nil)
+	writeFrame(t, conn, 1, frameData, make([]byte, maxFrame+1))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the session carried on after a frame longer than maxFrame")
+	}
+}
+
+// TestEcho echoes messages many times the window and maxFrame on several streams at once, checking each comes back
+// intact.
+func TestEcho(t *testing.T) {
+	server := newTestServer(t)
+	session := server.session(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		stream := open(t, session, 'e')
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer stream.Close()
+			sent := randomBytes(4*window+i*1000+7, int64(i))
+			go func() {
+				_, _ = stream.Write(sent)
+			}()
+			received := make([]byte, len(sent))
+			if _, err := io.ReadFull(stream, received); err != nil {
+				t.Errorf("stream %d: %v", i, err)
+				return
+			}
+			if !bytes.Equal(sent, received) {
+				t.Errorf("stream %d: echo differs from what was sent", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestFlowControl checks a stream whose reader has stopped holds up its writer at the window, without holding up
+// other streams on the same connection, and that the writer carries on once the reader does.
+func TestFlowControl(t *testing.T) {
+	server := newTestServer(t)
+	session := server.session(t)
+	held := open(t, session, 'h')
+	var written int64
+	done := make(chan error, 1)
+	go func() {
+		chunk := make([]byte, 1024)
+		for i := 0; i < 4*window/len(chunk); i++ {
+			if _, err := held.Write(chunk); err != nil {
+				done <- err
+				return
+			}
+			atomic.AddInt64(&written, int64(len(chunk)))
+		}
+		done <- nil
+	}()
+
+	// wait for the writer to stop
+	last := int64(0)
+	for {
+		time.Sleep(100 * time.Millisecond)
+		now := atomic.LoadInt64(&written)
+		if now == last && now > 0 {
+			break
+		}
+		last = now
+	}
+	if last >= 4*window || last < window-1024 {
+		t.Fatalf("writer stopped after %d bytes, want about the window of %d", last, window)
+	}
+
+	echo := open(t, session, 'e')
+	defer echo.Close()
+	if _, err := echo.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(echo, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("got %q, %v from another stream while the first was held up, want %q", reply, err, "ping")
+	}
+	if written := atomic.LoadInt64(&written); written != last {
+		t.Fatalf("held up writer went on from %d to %d bytes before its reader read", last, written)
+	}
+
+	close(server.hold)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("writer still held up after %d bytes once its reader carried on", atomic.LoadInt64(&written))
+	}
+}
+
+// TestOverrunWindow checks a session ends if the other side sends more than the window without it being read.
+func TestOverrunWindow(t *testing.T) {
+	server := newTestServer(t)
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte(Magic)); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, conn, 1, frameOpen, nil)
+	writeFrame(t, conn, 1, frameData, []byte("h"))
+	for sent := 1; sent <= window; sent += maxFrame {
+		writeFrame(t, conn, 1, frameData, make([]byte, maxFrame))
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the session carried on after the window was overrun")
+	}
+	close(server.hold)
+}
+
+// TestClose checks closing a stream gives the other side io.EOF once it has read everything sent before, and gives
+// ErrClosed on this side, and that closing a session closes its streams.
+func TestClose(t *testing.T) {
+	server := newTestServer(t)
+	session := server.session(t)
+
+	reader := open(t, session, 'r')
+	sent := randomBytes(3*maxFrame, 1)
+	if _, err := reader.Write(sent); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case received := <-server.received:
+		if !bytes.Equal(sent, received) {
+			t.Fatalf("other side read %d bytes before EOF, want the %d sent", len(received), len(sent))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("other side never saw EOF")
+	}
+	if _, err := reader.Read(make([]byte, 1)); err != ErrClosed {
+		t.Fatalf("read after Close gave %v, want ErrClosed", err)
+	}
+	if _, err := reader.Write([]byte("x")); err != ErrClosed {
+		t.Fatalf("write after Close gave %v, want ErrClosed", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("second Close gave %v", err)
+	}
+
+	writer := open(t, session, 'w')
+	received, err := ioutil.ReadAll(writer)
+	if err != nil || string(received) != "bye" {
+		t.Fatalf("got %q, %v from a stream the other side closed, want %q then EOF", received, err, "bye")
+	}
+
+	held := open(t, session, 'h')
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := held.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read from a stream of a closed session gave %v, want io.EOF", err)
+	}
+	if _, err := held.Write([]byte("x")); err != ErrClosed {
+		t.Fatalf("write to a stream of a closed session gave %v, want ErrClosed", err)
+	}
+	if _, err := session.Accept(); err != ErrClosed {
+		t.Fatalf("Accept on a closed session gave %v, want ErrClosed", err)
+	}
+	if _, err := session.Open(); err != ErrClosed {
+		t.Fatalf("Open on a closed session gave %v, want ErrClosed", err)
+	}
+	close(server.hold)
+}
+
+// TestPlain checks connections that don't start with Magic are served as they are, including ones that send fewer
+// bytes than Magic before closing their side.
+func TestPlain(t *testing.T) {
+	server := newTestServer(t)
+	for _, message := range []string{"not multiplexed, but long enough to peek at", "ab", "", Magic[:len(Magic)-1]} {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write([]byte("e" + message)); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		received, err := ioutil.ReadAll(conn)
+		if err != nil || string(received) != message {
+			t.Errorf("got %q, %v back from a plain connection, want %q", received, err, message)
+		}
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edge is how cells beyond the edge of the board are treated when counting neighbours
+type Edge int
+
+const (
+	Toroidal Edge = iota // the board wraps around, so opposite edges are neighbours
+	Dead                 // cells beyond the edge are always dead
+	Mirrored             // the board is reflected at its edges, so edge cells neighbour themselves
+)
+
+// ParseEdge reads an edge mode by name, giving Toroidal for an empty string
+func ParseEdge(name string) (Edge, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "toroidal", "wrap":
+		return Toroidal, nil
+	case "dead":
+		return Dead, nil
+	case "mirrored", "reflective":
+		return Mirrored, nil
+	default:
+		return Toroidal, fmt.Errorf("invalid edge mode %q: expected toroidal, dead or mirrored", name)
+	}
+}
+
+func (edge Edge) String() string {
+	switch edge {
+	case Toroidal:
+		return "toroidal"
+	case Dead:
+		return "dead"
+	case Mirrored:
+		return "mirrored"
+	default:
+		return "Incorrect Edge"
+	}
+}
+
+// Resolve maps a coordinate on an axis of the given size onto the board
+// ok is false if the coordinate is off the board and the cell there should be treated as dead.
+func (edge Edge) Resolve(coordinate int, size int) (resolved int, ok bool) {
+	if coordinate >= 0 && coordinate < size {
+		return coordinate, true
+	}
+	switch edge {
+	case Dead:
+		return 0, false
+	case Mirrored:
+		for coordinate < 0 || coordinate >= size { // large neighbourhoods can reach past more than one reflection
+			if coordinate < 0 {
+				coordinate = -coordinate - 1
+			} else {
+				coordinate = 2*size - coordinate - 1
+			}
+		}
+		return coordinate, true
+	default:
+		return (coordinate%size + size) % size, true // need to add the size as Go modulus doesn't like negatives
+	}
+}
@@ -0,0 +1,62 @@
+package rules
+
+import "fmt"
+
+// Noise adds spontaneous births and deaths on top of a rule's normal transitions
+// The random number for each cell is derived from the seed, turn and cell position alone, so a seeded
+// game gives the same result however the board is split across workers.
+type Noise struct {
+	Seed  int64
+	Birth float64 // probability a cell that would be dead is born anyway
+	Death float64 // probability a cell that would be alive dies anyway
+}
+
+// Validate checks both probabilities are between 0 and 1
+func (noise Noise) Validate() error {
+	if noise.Birth < 0 || noise.Birth > 1 || noise.Death < 0 || noise.Death > 1 {
+		return fmt.Errorf("invalid noise: probabilities must be between 0 and 1, got birth %v and death %v", noise.Birth, noise.Death)
+	}
+	return nil
+}
+
+// Enabled reports whether the noise can ever change a cell
+func (noise Noise) Enabled() bool {
+	return noise.Birth > 0 || noise.Death > 0
+}
+
+// Random gives a number in [0, 1) that depends only on the seed, turn and cell position
+func (noise Noise) Random(turn int, x int, y int) float64 {
+	h := mix(uint64(noise.Seed))
+	h = mix(h ^ uint64(turn))
+	h = mix(h ^ uint64(x))
+	h = mix(h ^ uint64(y))
+	return float64(h>>11) / (1 << 53)
+}
+
+// Apply perturbs the state a cell was going to have next turn
+// Dead cells are born into state 1 (the first colour for coloured rules), and alive cells die, which for
+// Generations rules means starting to decay. Wireworld has no notion of birth or death so is never perturbed.
+func (noise Noise) Apply(rule Rule, next int, turn int, x int, y int) int {
+	if rule.Wireworld {
+		return next
+	}
+	alive := next == 1 || (rule.Colours > 0 && next > 0)
+	if next == 0 && noise.Birth > 0 && noise.Random(turn, x, y) < noise.Birth {
+		return 1
+	}
+	if alive && noise.Death > 0 && noise.Random(turn, x, y) < noise.Death {
+		if rule.Colours == 0 && rule.States > 2 {
+			return 2
+		}
+		return 0
+	}
+	return next
+}
+
+// mix is the SplitMix64 finaliser, which scrambles its input into an evenly distributed value
+func mix(z uint64) uint64 {
+	z += 0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
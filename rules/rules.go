@@ -0,0 +1,435 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Default is the rulestring for Conway's Game of Life
+const Default = "B3/S23"
+
+// Named maps the names of well known rules to their rulestrings
+var Named = map[string]string{
+	"life":        "B3/S23",
+	"highlife":    "B36/S23",
+	"daynight":    "B3678/S34678",
+	"seeds":       "B2/S",
+	"maze":        "B3/S12345",
+	"replicator":  "B1357/S1357",
+	"bosco":       "R5,C0,M1,S34..58,B34..45,NM",
+	"majority":    "R4,C0,M1,S41..81,B41..81,NM",
+	"briansbrain": "B2/S/C3",
+	"starwars":    "B2/S345/C4",
+	"wireworld":   "Wireworld",
+	"immigration": "Immigration",
+	"quadlife":    "QuadLife",
+}
+
+// Rule is an outer totalistic rule, either in B/S notation (e.g. B3/S23) or a Larger than Life rule
+// in Golly's notation (e.g. R5,C0,M1,S34..58,B34..45,NM) which counts neighbours within a larger radius.
+// Birth[n] is true if a dead cell with n alive neighbours becomes alive,
+// Survival[n] is true if an alive cell with n alive neighbours stays alive.
+//
+// Rules with more than two States are Generations rules (e.g. B2/S/C3 for Brian's Brain), where a cell
+// that doesn't survive goes through the dying states 2..States-1 before it is dead, or Wireworld.
+// Only cells in state 1 (alive, firing or an electron head) are counted as alive neighbours.
+//
+// Coloured rules (Immigration and QuadLife) play Life where every alive cell has one of 2 or 4 colours,
+// stored as states 1..Colours, and a newborn cell takes the majority colour of its parents.
+type Rule struct {
+	Radius     int  // how far away a cell can be and still count as a neighbour, 1 for B/S rules
+	Middle     bool // whether a cell counts itself as one of its neighbours
+	VonNeumann bool // use the diamond shaped neighbourhood rather than the square Moore neighbourhood
+	Birth      []bool
+	Survival   []bool
+	States     int  // number of cell states, 2 for Life-like rules
+	Wireworld  bool // states are empty, electron head, electron tail and conductor
+	Colours    int  // number of colours of alive cells for coloured rules, 0 otherwise
+}
+
+// Wireworld cell states
+const (
+	WireworldEmpty = iota
+	WireworldHead
+	WireworldTail
+	WireworldConductor
+)
+
+// Parse reads a rulestring such as "B36/S23", "R5,C0,M1,S34..58,B34..45,NM" or a name from Named
+// B/S rules may give B and S in either order and any case. An empty rulestring gives the Default rule.
+func Parse(rulestring string) (Rule, error) {
+	rulestring = strings.ToLower(strings.TrimSpace(rulestring))
+	if rulestring == "" {
+		rulestring = strings.ToLower(Default)
+	}
+	if named, ok := Named[rulestring]; ok {
+		rulestring = strings.ToLower(named)
+	}
+	if rulestring == "wireworld" {
+		rule := newRule(1, false, false)
+		rule.States = 4
+		rule.Wireworld = true
+		return rule, nil
+	}
+	if rulestring == "immigration" || rulestring == "quadlife" {
+		rule, _ := parseBS("b3/s23")
+		rule.Colours = 2
+		if rulestring == "quadlife" {
+			rule.Colours = 4
+		}
+		rule.States = rule.Colours + 1
+		return rule, nil
+	}
+	if strings.HasPrefix(rulestring, "r") {
+		return parseLargerThanLife(rulestring)
+	}
+	return parseBS(rulestring)
+}
+
+// parseBS reads a rule in B/S notation, or B/S/C notation for Generations rules
+func parseBS(rulestring string) (Rule, error) {
+	rule := newRule(1, false, false)
+	parts := strings.Split(rulestring, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return rule, fmt.Errorf("invalid rulestring %q: expected the form B<digits>/S<digits>", rulestring)
+	}
+	seen := map[byte]bool{}
+	for _, part := range parts {
+		if part == "" || (part[0] != 'b' && part[0] != 's' && part[0] != 'c') || seen[part[0]] {
+			return rule, fmt.Errorf("invalid rulestring %q: expected the form B<digits>/S<digits>", rulestring)
+		}
+		seen[part[0]] = true
+		if part[0] == 'c' {
+			states, err := strconv.Atoi(part[1:])
+			if err != nil || states < 2 || states > 255 {
+				return rule, fmt.Errorf("invalid rulestring %q: number of states must be between 2 and 255", rulestring)
+			}
+			rule.States = states
+			continue
+		}
+		counts := rule.Birth
+		if part[0] == 's' {
+			counts = rule.Survival
+		}
+		for _, digit := range part[1:] {
+			if digit < '0' || digit > '8' {
+				return rule, fmt.Errorf("invalid rulestring %q: neighbour count %q is not between 0 and 8", rulestring, digit)
+			}
+			counts[digit-'0'] = true
+		}
+	}
+	return rule, nil
+}
+
+// parseLargerThanLife reads a rule in Golly's Larger than Life notation, Rr,Cc,Mm,Smin..max,Bmin..max,Nn
+func parseLargerThanLife(rulestring string) (Rule, error) {
+	fields := map[byte]string{}
+	var births, survivals []string
+	for _, field := range strings.Split(rulestring, ",") {
+		if field == "" {
+			return Rule{}, fmt.Errorf("invalid rulestring %q: empty field", rulestring)
+		}
+		switch field[0] {
+		case 'b':
+			births = append(births, field[1:])
+		case 's':
+			survivals = append(survivals, field[1:])
+		case 'r', 'c', 'm', 'n':
+			fields[field[0]] = field[1:]
+		default:
+			return Rule{}, fmt.Errorf("invalid rulestring %q: unknown field %q", rulestring, field)
+		}
+	}
+
+	radius, err := strconv.Atoi(fields['r'])
+	if err != nil || radius < 1 || radius > 500 {
+		return Rule{}, fmt.Errorf("invalid rulestring %q: radius must be between 1 and 500", rulestring)
+	}
+	states := 2
+	if fields['c'] != "" {
+		states, err = strconv.Atoi(fields['c'])
+		if err != nil || states < 0 || states > 255 {
+			return Rule{}, fmt.Errorf("invalid rulestring %q: number of states must be between 0 and 255", rulestring)
+		}
+		if states < 2 { // Golly treats C0 and C1 as two states
+			states = 2
+		}
+	}
+	var middle, vonNeumann bool
+	switch fields['m'] {
+	case "", "0":
+	case "1":
+		middle = true
+	default:
+		return Rule{}, fmt.Errorf("invalid rulestring %q: M must be 0 or 1", rulestring)
+	}
+	switch fields['n'] {
+	case "", "m":
+	case "n":
+		vonNeumann = true
+	default:
+		return Rule{}, fmt.Errorf("invalid rulestring %q: neighbourhood must be NM or NN", rulestring)
+	}
+
+	rule := newRule(radius, middle, vonNeumann)
+	rule.States = states
+	for _, birth := range births {
+		if err := setRange(rule.Birth, birth); err != nil {
+			return Rule{}, fmt.Errorf("invalid rulestring %q: %v", rulestring, err)
+		}
+	}
+	for _, survival := range survivals {
+		if err := setRange(rule.Survival, survival); err != nil {
+			return Rule{}, fmt.Errorf("invalid rulestring %q: %v", rulestring, err)
+		}
+	}
+	return rule, nil
+}
+
+// setRange marks every neighbour count in a range such as "34..58" (or a single count) as true
+func setRange(counts []bool, countRange string) error {
+	bounds := strings.SplitN(countRange, "..", 2)
+	low, err := strconv.Atoi(bounds[0])
+	high := low
+	if err == nil && len(bounds) == 2 {
+		high, err = strconv.Atoi(bounds[1])
+	}
+	if err != nil || low < 0 || low > high || high >= len(counts) {
+		return fmt.Errorf("neighbour range %q must lie between 0 and %d", countRange, len(counts)-1)
+	}
+	for n := low; n <= high; n++ {
+		counts[n] = true
+	}
+	return nil
+}
+
+// newRule creates a rule where nothing is born and nothing survives
+func newRule(radius int, middle bool, vonNeumann bool) Rule {
+	rule := Rule{Radius: radius, Middle: middle, VonNeumann: vonNeumann, States: 2}
+	rule.Birth = make([]bool, rule.MaxNeighbours()+1)
+	rule.Survival = make([]bool, rule.MaxNeighbours()+1)
+	return rule
+}
+
+// MaxNeighbours is the largest number of alive neighbours a cell can have under this rule
+func (rule Rule) MaxNeighbours() int {
+	var cells int
+	if rule.VonNeumann {
+		cells = 2*rule.Radius*(rule.Radius+1) + 1
+	} else {
+		cells = (2*rule.Radius + 1) * (2*rule.Radius + 1)
+	}
+	if !rule.Middle {
+		cells-- // the cell itself isn't counted
+	}
+	return cells
+}
+
+// InNeighbourhood reports whether the cell at offset (dx, dy) is counted as a neighbour
+func (rule Rule) InNeighbourhood(dx int, dy int) bool {
+	if dx == 0 && dy == 0 {
+		return rule.Middle
+	}
+	if rule.VonNeumann {
+		return abs(dx)+abs(dy) <= rule.Radius
+	}
+	return abs(dx) <= rule.Radius && abs(dy) <= rule.Radius
+}
+
+// Next returns whether a cell is alive next turn, given whether it is alive now and its alive neighbour count
+func (rule Rule) Next(alive bool, neighbours int) bool {
+	if alive {
+		return rule.Survival[neighbours]
+	}
+	return rule.Birth[neighbours]
+}
+
+// NextState returns the state of a cell next turn, given its current state and alive neighbour count
+func (rule Rule) NextState(state int, neighbours int) int {
+	if rule.Wireworld {
+		switch state {
+		case WireworldHead:
+			return WireworldTail
+		case WireworldTail:
+			return WireworldConductor
+		case WireworldConductor:
+			if neighbours == 1 || neighbours == 2 {
+				return WireworldHead
+			}
+			return WireworldConductor
+		default:
+			return WireworldEmpty
+		}
+	}
+	switch {
+	case state == 0 && rule.Next(false, neighbours):
+		return 1 // born
+	case state == 0:
+		return 0
+	case state == 1 && rule.Next(true, neighbours):
+		return 1 // survives
+	default:
+		return (state + 1) % rule.States // dies, or moves on to the next dying state
+	}
+}
+
+// Alive reports whether a cell value counts as an alive neighbour
+func (rule Rule) Alive(value uint8) bool {
+	if rule.Colours > 0 {
+		return rule.State(value) != 0
+	}
+	return rule.State(value) == 1
+}
+
+// NextColour returns the state of a cell next turn under a coloured rule, given its current state and
+// colours[k], the number of its neighbours with colour k (colours[0] is unused).
+func (rule Rule) NextColour(state int, colours []int) int {
+	neighbours := 0
+	for _, count := range colours[1:] {
+		neighbours += count
+	}
+	if state != 0 {
+		if rule.Next(true, neighbours) {
+			return state // survivors keep their colour
+		}
+		return 0
+	}
+	if !rule.Next(false, neighbours) {
+		return 0
+	}
+	majority, present := 1, 0
+	for colour := 1; colour <= rule.Colours; colour++ {
+		if colours[colour] > colours[majority] {
+			majority = colour
+		}
+		if colours[colour] > 0 {
+			present++
+		}
+	}
+	if rule.Colours == 4 && present == 3 && colours[majority] == 1 { // three different parents give the fourth colour
+		for colour := 1; colour <= rule.Colours; colour++ {
+			if colours[colour] == 0 {
+				return colour
+			}
+		}
+	}
+	return majority
+}
+
+// NextValue is NextState for cell values as they are stored in boards and images
+func (rule Rule) NextValue(value uint8, neighbours int) uint8 {
+	return rule.Value(rule.NextState(rule.State(value), neighbours))
+}
+
+// Value gives the grey level used to store a state in boards and PGM images
+// Dead is always 0 and alive (state 1) is always 255, so two state boards are unchanged;
+// the remaining states are spread evenly between them.
+func (rule Rule) Value(state int) uint8 {
+	switch state {
+	case 0:
+		return 0
+	case 1:
+		return 255
+	default:
+		return uint8(255 * (rule.States - state) / (rule.States - 1))
+	}
+}
+
+// State gives the state stored as a grey level, choosing the closest state for levels that aren't exact
+// Two state rules treat anything other than 255 as dead, as the board has always done.
+func (rule Rule) State(value uint8) int {
+	if rule.States <= 2 {
+		if value == 255 {
+			return 1
+		}
+		return 0
+	}
+	closest, distance := 0, 256
+	for state := 0; state < rule.States; state++ {
+		if d := abs(int(rule.Value(state)) - int(value)); d < distance {
+			closest, distance = state, d
+		}
+	}
+	return closest
+}
+
+// IsLargerThanLife reports whether the rule needs Larger than Life notation to be written down
+func (rule Rule) IsLargerThanLife() bool {
+	return rule.Radius != 1 || rule.Middle || rule.VonNeumann
+}
+
+// String gives the rule back in canonical B/S, B/S/C or Larger than Life notation
+func (rule Rule) String() string {
+	if rule.Wireworld {
+		return "Wireworld"
+	}
+	if rule.Colours == 2 {
+		return "Immigration"
+	}
+	if rule.Colours == 4 {
+		return "QuadLife"
+	}
+	if rule.IsLargerThanLife() {
+		return rule.largerThanLifeString()
+	}
+	var builder strings.Builder
+	builder.WriteString("B")
+	for n, born := range rule.Birth {
+		if born {
+			builder.WriteByte(byte('0' + n))
+		}
+	}
+	builder.WriteString("/S")
+	for n, survives := range rule.Survival {
+		if survives {
+			builder.WriteByte(byte('0' + n))
+		}
+	}
+	if rule.States > 2 {
+		builder.WriteString(fmt.Sprintf("/C%d", rule.States))
+	}
+	return builder.String()
+}
+
+func (rule Rule) largerThanLifeString() string {
+	middle, neighbourhood := 0, "NM"
+	if rule.Middle {
+		middle = 1
+	}
+	if rule.VonNeumann {
+		neighbourhood = "NN"
+	}
+	states := 0
+	if rule.States > 2 {
+		states = rule.States
+	}
+	fields := []string{fmt.Sprintf("R%d", rule.Radius), fmt.Sprintf("C%d", states), fmt.Sprintf("M%d", middle)}
+	fields = append(fields, rangeFields("S", rule.Survival)...)
+	fields = append(fields, rangeFields("B", rule.Birth)...)
+	fields = append(fields, neighbourhood)
+	return strings.Join(fields, ",")
+}
+
+// rangeFields writes each run of true counts as a field such as S34..58
+func rangeFields(prefix string, counts []bool) []string {
+	var fields []string
+	for n := 0; n < len(counts); n++ {
+		if !counts[n] {
+			continue
+		}
+		start := n
+		for n+1 < len(counts) && counts[n+1] {
+			n++
+		}
+		fields = append(fields, fmt.Sprintf("%s%d..%d", prefix, start, n))
+	}
+	return fields
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,203 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseString checks rulestrings are read and written back in canonical form, and that the canonical form reads
+// as the same rule.
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		rulestring string
+		want       string
+	}{
+		{"B3/S23", "B3/S23"},
+		{"", "B3/S23"},
+		{" b36/s23 ", "B36/S23"},
+		{"S23/B3", "B3/S23"},
+		{"B2/S", "B2/S"},
+		{"B/S", "B/S"},
+		{"B012345678/S012345678", "B012345678/S012345678"},
+		{"B3678/S34678", "B3678/S34678"},
+		{"life", "B3/S23"},
+		{"HighLife", "B36/S23"},
+		{"seeds", "B2/S"},
+
+		{"B2/S/C3", "B2/S/C3"},
+		{"briansbrain", "B2/S/C3"},
+		{"s345/b2/c4", "B2/S345/C4"},
+		{"C4/B2/S345", "B2/S345/C4"},
+		{"B2/S/C2", "B2/S"},
+		{"B3/S23/C255", "B3/S23/C255"},
+		{"Wireworld", "Wireworld"},
+		{"immigration", "Immigration"},
+		{"QUADLIFE", "QuadLife"},
+
+		{"R5,C0,M1,S34..58,B34..45,NM", "R5,C0,M1,S34..58,B34..45,NM"},
+		{"bosco", "R5,C0,M1,S34..58,B34..45,NM"},
+		{"majority", "R4,C0,M1,S41..81,B41..81,NM"},
+		{"r2,c0,m0,s2..3,b3..3,nn", "R2,C0,M0,S2..3,B3..3,NN"},
+		{"R2,S2..3,B3", "R2,C0,M0,S2..3,B3..3,NM"},
+		{"R2,C0,M0,S2..3,S6..7,B3,NM", "R2,C0,M0,S2..3,S6..7,B3..3,NM"},
+		{"R2,C0,M0,S2..3,S4..5,B3,NM", "R2,C0,M0,S2..5,B3..3,NM"},
+		{"R3,C10,M0,S2..5,B3..4,NM", "R3,C10,M0,S2..5,B3..4,NM"},
+		{"R3,C1,M0,S2..5,B3..4,NM", "R3,C0,M0,S2..5,B3..4,NM"},
+		{"R2,C0,M1,S0..12,B1..13,NN", "R2,C0,M1,S0..12,B1..13,NN"},
+		{"R500,C0,M0,B1,NM", "R500,C0,M0,B1..1,NM"},
+		{"R1,C0,M0,S2..3,B3..3,NM", "B3/S23"},
+		{"R1,C3,M0,S2..3,B3..3,NM", "B3/S23/C3"},
+		{"R1,C0,M1,S3..4,B3..3,NM", "R1,C0,M1,S3..4,B3..3,NM"},
+	}
+	for _, test := range tests {
+		t.Run(test.rulestring, func(t *testing.T) {
+			rule, err := Parse(test.rulestring)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.String(); got != test.want {
+				t.Fatalf("read back as %q, want %q", got, test.want)
+			}
+			again, err := Parse(rule.String())
+			if err != nil {
+				t.Fatalf("canonical form %q: %v", rule.String(), err)
+			}
+			if !reflect.DeepEqual(again, rule) {
+				t.Fatalf("canonical form %q reads as %+v, want %+v", rule.String(), again, rule)
+			}
+		})
+	}
+}
+
+// TestParseFields checks a few rules are read with the neighbourhood and counts they say.
+func TestParseFields(t *testing.T) {
+	rule, err := Parse("R2,C4,M1,S3..5,B7..8,NN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Radius != 2 || !rule.Middle || !rule.VonNeumann || rule.States != 4 {
+		t.Fatalf("got %+v", rule)
+	}
+	if rule.MaxNeighbours() != 13 || len(rule.Birth) != 14 || len(rule.Survival) != 14 {
+		t.Fatalf("%d neighbours, want 13", rule.MaxNeighbours())
+	}
+	for n := range rule.Birth {
+		if rule.Birth[n] != (n == 7 || n == 8) || rule.Survival[n] != (n >= 3 && n <= 5) {
+			t.Fatalf("counts wrong at %d: birth %v, survival %v", n, rule.Birth[n], rule.Survival[n])
+		}
+	}
+	if !rule.InNeighbourhood(0, 0) || !rule.InNeighbourhood(1, 1) || rule.InNeighbourhood(2, 1) || !rule.InNeighbourhood(0, -2) {
+		t.Fatal("von Neumann neighbourhood of radius 2 is wrong")
+	}
+
+	life, _ := Parse("B3/S23")
+	if life.MaxNeighbours() != 8 || life.InNeighbourhood(0, 0) || !life.InNeighbourhood(-1, 1) || life.IsLargerThanLife() {
+		t.Fatalf("got %+v", life)
+	}
+	if !life.Next(false, 3) || life.Next(false, 2) || !life.Next(true, 2) || life.Next(true, 4) {
+		t.Fatal("B3/S23 births or survivals are wrong")
+	}
+}
+
+// TestParseInvalid checks malformed rulestrings are refused.
+func TestParseInvalid(t *testing.T) {
+	for _, rulestring := range []string{
+		"B3",
+		"23/3",
+		"B3/S23/C3/X",
+		"B3/B3",
+		"B3/S2/S3",
+		"X3/S23",
+		"B3//S23",
+		"B9/S23",
+		"B3/S2a",
+		"B3/S-1",
+		"B3/S23/C1",
+		"B3/S23/C256",
+		"B3/S23/Cx",
+		"B3/S23/C",
+		"nonsense",
+
+		"R",
+		"Rx,C0,M0,S2..3,B3..3,NM",
+		"R0,C0,M0,S2..3,B3..3,NM",
+		"R501,C0,M0,S2..3,B3..3,NM",
+		"R2,C256,M0,S2..3,B3..3,NM",
+		"R2,C-1,M0,S2..3,B3..3,NM",
+		"R2,C0,M2,S2..3,B3..3,NM",
+		"R2,C0,M0,S2..3,B3..3,NX",
+		"R2,C0,M0,S2..,B3..3,NM",
+		"R2,C0,M0,S3..2,B3..3,NM",
+		"R2,C0,M0,S2..25,B3..3,NM",
+		"R2,C0,M0,S2..3,B3..3,NN,S13",
+		"R2,C0,M0,S-1..3,B3..3,NM",
+		"R2,C0,M0,S2..3,Bx,NM",
+		"R2,C0,M0,,B3..3,NM",
+		"R2,C0,M0,S2..3,B3..3,NM,",
+		"R2,C0,M0,X2..3,B3..3,NM",
+	} {
+		if rule, err := Parse(rulestring); err == nil {
+			t.Errorf("accepted %q as %s", rulestring, rule)
+		}
+	}
+}
+
+// TestValueState checks every state of a rule is stored as a grey level that reads back as the same state.
+func TestValueState(t *testing.T) {
+	for _, rulestring := range []string{"B3/S23", "B2/S/C3", "B2/S345/C4", "B3/S23/C255", "Wireworld", "QuadLife"} {
+		rule, err := Parse(rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule.Value(0) != 0 || rule.Value(1) != 255 {
+			t.Fatalf("%s: dead is %d and alive %d, want 0 and 255", rulestring, rule.Value(0), rule.Value(1))
+		}
+		for state := 0; state < rule.States; state++ {
+			if got := rule.State(rule.Value(state)); got != state {
+				t.Fatalf("%s: state %d is stored as %d, which reads back as %d", rulestring, state, rule.Value(state), got)
+			}
+		}
+	}
+}
+
+// TestEdge checks edge modes are read by name and resolve coordinates beyond the board as they should.
+func TestEdge(t *testing.T) {
+	for name, want := range map[string]Edge{"": Toroidal, "wrap": Toroidal, " Dead ": Dead, "reflective": Mirrored} {
+		edge, err := ParseEdge(name)
+		if err != nil || edge != want {
+			t.Fatalf("%q read as %v, %v, want %v", name, edge, err, want)
+		}
+		if again, _ := ParseEdge(edge.String()); again != edge {
+			t.Fatalf("%v reads back as %v", edge, again)
+		}
+	}
+	if _, err := ParseEdge("klein"); err == nil {
+		t.Fatal("accepted an unknown edge mode")
+	}
+
+	tests := []struct {
+		edge       Edge
+		coordinate int
+		want       int
+		ok         bool
+	}{
+		{Toroidal, 3, 3, true},
+		{Toroidal, -1, 9, true},
+		{Toroidal, 10, 0, true},
+		{Toroidal, -21, 9, true},
+		{Dead, -1, 0, false},
+		{Dead, 10, 0, false},
+		{Dead, 9, 9, true},
+		{Mirrored, -1, 0, true},
+		{Mirrored, -3, 2, true},
+		{Mirrored, 10, 9, true},
+		{Mirrored, 12, 7, true},
+		{Mirrored, 25, 5, true},
+	}
+	for _, test := range tests {
+		got, ok := test.edge.Resolve(test.coordinate, 10)
+		if got != test.want && test.ok || ok != test.ok {
+			t.Errorf("%v edge resolved %d to %d, %v, want %d, %v", test.edge, test.coordinate, got, ok, test.want, test.ok)
+		}
+	}
+}
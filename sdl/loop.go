@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"github.com/veandco/go-sdl2/sdl"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/rules"
 )
 
 func Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
 	w := NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
+	rule, _ := rules.Parse(p.Rule) // the broker rejects invalid rules, so the default is fine until then
 
 sdlLoop:
 	for {
@@ -24,6 +26,16 @@ sdlLoop:
 					keyPresses <- 'q'
 				case sdl.K_k:
 					keyPresses <- 'k'
+				case sdl.K_c:
+					keyPresses <- 'c'
+				case sdl.K_b:
+					keyPresses <- 'b'
+				case sdl.K_j:
+					keyPresses <- 'j'
+				case sdl.K_w:
+					keyPresses <- 'w'
+				case sdl.K_i:
+					keyPresses <- 'i'
 				}
 			}
 		}
@@ -36,6 +48,9 @@ sdlLoop:
 			switch e := event.(type) {
 			case gol.CellFlipped:
 				w.FlipPixel(e.Cell.X, e.Cell.Y)
+			case gol.CellStateChanged:
+				r, g, b := colour(rule, e.Value)
+				w.SetPixelColour(e.Cell.X, e.Cell.Y, r, g, b)
 			case gol.TurnComplete:
 				w.RenderFrame()
 			case gol.FinalTurnComplete:
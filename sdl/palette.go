@@ -0,0 +1,30 @@
+package sdl
+
+import "uk.ac.bris.cs/gameoflife/rules"
+
+// colour picks the colour a cell value is drawn in under the given rule
+// Wireworld uses its usual blue heads, red tails and yellow wire, and coloured rules such as QuadLife
+// give each colour its own hue. Other rules draw alive cells white
+// and fade dying cells through grey, so the trail left behind by Brian's Brain and similar rules is visible.
+func colour(rule rules.Rule, value uint8) (r, g, b uint8) {
+	state := rule.State(value)
+	if rule.Wireworld {
+		switch state {
+		case rules.WireworldHead:
+			return 0x33, 0x99, 0xFF
+		case rules.WireworldTail:
+			return 0xFF, 0x44, 0x22
+		case rules.WireworldConductor:
+			return 0xFF, 0xCC, 0x00
+		default:
+			return 0, 0, 0
+		}
+	}
+	if rule.Colours > 0 && state > 0 {
+		colours := [][3]uint8{{0xFF, 0x33, 0x33}, {0x33, 0x99, 0xFF}, {0x33, 0xDD, 0x55}, {0xFF, 0xDD, 0x33}}
+		c := colours[(state-1)%len(colours)]
+		return c[0], c[1], c[2]
+	}
+	grey := rule.Value(state)
+	return grey, grey, grey
+}
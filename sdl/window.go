@@ -75,6 +75,15 @@ func (w *Window) SetPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = 0xFF
 }
 
+// SetPixelColour draws a cell in the given colour, for rules with more than two states
+func (w *Window) SetPixelColour(x, y int, r, g, b uint8) {
+	width := int(w.Width)
+	w.pixels[4*(y*width+x)+0] = b // ARGB8888 is stored little-endian
+	w.pixels[4*(y*width+x)+1] = g
+	w.pixels[4*(y*width+x)+2] = r
+	w.pixels[4*(y*width+x)+3] = 0xFF
+}
+
 func (w *Window) FlipPixel(x, y int) {
 	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
 		panic(fmt.Sprintf("CellFlipped event at (%d, %d) is outside the bounds of the window.", x, y))
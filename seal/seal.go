@@ -0,0 +1,220 @@
+// Package seal encrypts the files the broker keeps, such as checkpoints and turn logs, with AES-GCM, so a game's
+// boards aren't stored in the clear on disks other people can read
+//
+// An encrypted file starts with Header, then holds records, one to a line, each the base64 of a random nonce and
+// the sealed bytes. The bytes of the records, in order, are what was written. Files written a line at a time keep
+// each line in a record of its own, so they can still be counted and cut short by line.
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Header is the first line of every encrypted file
+const Header = "gol-encrypted aes-gcm\n"
+
+// KeyVariable is the environment variable a key is read from when it isn't given as a flag
+const KeyVariable = "GOL_ENCRYPTION_KEY"
+
+// recordSize is how many bytes of a file that isn't written a line at a time go in each record
+const recordSize = 64 * 1024
+
+// Key encrypts and decrypts files. A nil Key leaves them as they are.
+type Key struct {
+	aead cipher.AEAD
+}
+
+// ParseKey reads a key written in hex, which must be 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256
+func ParseKey(text string) (*Key, error) {
+	secret, err := hex.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key isn't hex: %v", err)
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, given as 32, 48 or 64 hex digits, not %d bytes", len(secret))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead: aead}, nil
+}
+
+// LoadKey reads the key given as a flag, or from KeyVariable if the flag is empty, giving nil if neither is set
+// The environment variable keeps the key out of the process list.
+func LoadKey(flag string) (*Key, error) {
+	if flag == "" {
+		flag = os.Getenv(KeyVariable)
+	}
+	if flag == "" {
+		return nil, nil
+	}
+	return ParseKey(flag)
+}
+
+// writer encrypts what is written to it into records
+type writer struct {
+	w       io.Writer
+	key     *Key
+	lines   bool   // whether each line goes in a record of its own
+	pending []byte // written but not yet sealed
+	started bool   // whether the header has been written
+}
+
+// NewWriter encrypts what is written to w, sealing each line into a record as soon as it is written if lines is
+// set, and up to recordSize bytes at a time if not. Close seals the rest, without closing w. A nil key writes to w
+// as it is.
+func (key *Key) NewWriter(w io.Writer, lines bool) io.WriteCloser {
+	if key == nil {
+		return nopCloser{w}
+	}
+	return &writer{w: w, key: key, lines: lines}
+}
+
+func (sealed *writer) Write(p []byte) (int, error) {
+	sealed.pending = append(sealed.pending, p...)
+	for {
+		end := len(sealed.pending)
+		if sealed.lines {
+			end = bytes.IndexByte(sealed.pending, '\n') + 1
+		} else if end < recordSize {
+			end = 0
+		} else {
+			end = recordSize
+		}
+		if end == 0 {
+			return len(p), nil
+		}
+		if err := sealed.seal(sealed.pending[:end]); err != nil {
+			return 0, err
+		}
+		sealed.pending = sealed.pending[end:]
+	}
+}
+
+// Close seals whatever is left, such as a last line without a newline
+func (sealed *writer) Close() error {
+	if len(sealed.pending) == 0 {
+		return nil
+	}
+	err := sealed.seal(sealed.pending)
+	sealed.pending = nil
+	return err
+}
+
+// seal writes plain as a record, after the header if it is the first
+func (sealed *writer) seal(plain []byte) error {
+	aead := sealed.key.aead
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	line := base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)) + "\n"
+	if !sealed.started {
+		line = Header + line
+	}
+	if _, err := io.WriteString(sealed.w, line); err != nil {
+		return err
+	}
+	sealed.started = true
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// file is an encrypted file being written, which Close finishes and closes
+type file struct {
+	io.WriteCloser
+	file *os.File
+}
+
+func (f file) Close() error {
+	if err := f.WriteCloser.Close(); err != nil {
+		_ = f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// Create creates a file that what is written to is encrypted into, as NewWriter does, closing the file once closed
+func (key *Key) Create(path string, lines bool) (io.WriteCloser, error) {
+	created, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return file{key.NewWriter(created, lines), created}, nil
+}
+
+// reader decrypts the records of an encrypted file
+type reader struct {
+	r      *bufio.Reader
+	key    *Key
+	plain  []byte // decrypted but not yet read
+	record int    // how many records have been read, for errors
+}
+
+// NewReader reads r, decrypting it if it is encrypted, so files written with or without a key can be read alike.
+// Reading an encrypted file without a key fails.
+func (key *Key) NewReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	start, err := buffered.Peek(len(Header))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if string(start) != Header {
+		return buffered, nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("it is encrypted: give its key with -encryptionKey or %s", KeyVariable)
+	}
+	_, _ = buffered.Discard(len(Header))
+	return &reader{r: buffered, key: key}, nil
+}
+
+func (opened *reader) Read(p []byte) (int, error) {
+	for len(opened.plain) == 0 {
+		line, err := opened.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return 0, err
+		}
+		opened.record++
+		if err = opened.open(bytes.TrimSuffix(line, []byte("\n"))); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, opened.plain)
+	opened.plain = opened.plain[n:]
+	return n, nil
+}
+
+// open decrypts a record
+func (opened *reader) open(line []byte) error {
+	aead := opened.key.aead
+	record := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(record, line)
+	if err != nil || n < aead.NonceSize() {
+		return fmt.Errorf("record %d is corrupted", opened.record)
+	}
+	opened.plain, err = aead.Open(nil, record[:aead.NonceSize()], record[aead.NonceSize():n], nil)
+	if err != nil {
+		return fmt.Errorf("record %d can't be decrypted: the key is wrong or the file is corrupted", opened.record)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package seal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func mustKey(t *testing.T, text string) *Key {
+	key, err := ParseKey(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// seal encrypts plain, written in pieces of the sizes given in turn
+func seal(t *testing.T, key *Key, plain []byte, lines bool, pieces ...int) []byte {
+	var sealed bytes.Buffer
+	w := key.NewWriter(&sealed, lines)
+	for i := 0; len(plain) > 0; i++ {
+		n := len(plain)
+		if len(pieces) > 0 && pieces[i%len(pieces)] < n {
+			n = pieces[i%len(pieces)]
+		}
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatal(err)
+		}
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sealed.Bytes()
+}
+
+// open decrypts sealed, giving what was read and the error that stopped it
+func open(key *Key, sealed []byte) ([]byte, error) {
+	r, err := key.NewReader(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// TestRoundTrip checks what is sealed opens as it was, in records of any size and written in any pieces.
+func TestRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	large := make([]byte, 3*recordSize+123)
+	random.Read(large)
+	tests := []struct {
+		name   string
+		plain  []byte
+		lines  bool
+		pieces []int
+	}{
+		{"empty", nil, false, nil},
+		{"short", []byte("hello"), false, nil},
+		{"exactly a record", large[:recordSize], false, nil},
+		{"several records", large, false, nil},
+		{"several records in small pieces", large, false, []int{1000, 7}},
+		{"lines", []byte("turn 1\nturn 2\nturn 3\n"), true, nil},
+		{"lines a byte at a time", []byte("turn 1\nturn 2\nturn 3\n"), true, []int{1}},
+		{"lines without a last newline", []byte("turn 1\nturn 2"), true, []int{3}},
+		{"empty lines", []byte("\n\n\n"), true, nil},
+	}
+	key := mustKey(t, testKey)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sealed := seal(t, key, test.plain, test.lines, test.pieces...)
+			if len(test.plain) > 0 && !strings.HasPrefix(string(sealed), Header) {
+				t.Fatal("sealed file doesn't start with the header")
+			}
+			if len(test.plain) > 4 && bytes.Contains(sealed, test.plain[:4]) {
+				t.Fatal("sealed file has what was written in the clear")
+			}
+			opened, err := open(key, sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened, test.plain) {
+				t.Fatalf("opened %d bytes, want the %d sealed", len(opened), len(test.plain))
+			}
+		})
+	}
+}
+
+// TestLines checks files written a line at a time, such as turn logs and histories, have a record for each line, so
+// they can be cut short by line as they are when the broker stops part way through writing one.
+func TestLines(t *testing.T) {
+	key := mustKey(t, testKey)
+	lines := []string{"{\"turn\":1}\n", "{\"turn\":2}\n", "{\"turn\":3}\n"}
+	sealed := seal(t, key, []byte(strings.Join(lines, "")), true, 5)
+	records := strings.SplitAfter(strings.TrimPrefix(string(sealed), Header), "\n")
+	records = records[:len(records)-1] // after the last newline
+	if len(records) != len(lines) {
+		t.Fatalf("%d records for %d lines", len(records), len(lines))
+	}
+	for n := 0; n <= len(lines); n++ {
+		opened, err := open(key, []byte(Header+strings.Join(records[:n], "")))
+		if err != nil {
+			t.Fatalf("first %d records: %v", n, err)
+		}
+		if want := strings.Join(lines[:n], ""); string(opened) != want {
+			t.Fatalf("first %d records opened as %q, want %q", n, opened, want)
+		}
+	}
+}
+
+// TestWrongKey checks a file sealed with one key can't be opened with another, or without one.
+func TestWrongKey(t *testing.T) {
+	sealed := seal(t, mustKey(t, testKey), []byte("a board"), false)
+	if _, err := open(mustKey(t, strings.Repeat("ab", 32)), sealed); err == nil {
+		t.Fatal("opened with the wrong key")
+	}
+	if _, err := open(mustKey(t, testKey[:32]), sealed); err == nil {
+		t.Fatal("opened with a shorter key")
+	}
+	if _, err := open(nil, sealed); err == nil || !strings.Contains(err.Error(), KeyVariable) {
+		t.Fatalf("opening without a key gave %v, want an error saying how to give one", err)
+	}
+}
+
+// TestDamaged checks records that have been cut short or changed fail to open rather than opening as something else.
+func TestDamaged(t *testing.T) {
+	key := mustKey(t, testKey)
+	sealed := seal(t, key, []byte("line one\nline two\n"), true)
+	last := bytes.LastIndexByte(sealed[:len(sealed)-1], '\n') + 1
+	flip := func(i int, to byte) []byte {
+		damaged := append([]byte(nil), sealed...)
+		damaged[i] = to
+		return damaged
+	}
+	tests := []struct {
+		name    string
+		damaged []byte
+	}{
+		{"cut mid-record", sealed[:len(sealed)-10]},
+		{"cut to a few bytes", sealed[:len(Header)+3]},
+		{"ciphertext changed", flip(last+20, sealed[last+20]^('A'^'B'))},
+		{"nonce changed", flip(last+1, sealed[last+1]^('A'^'B'))},
+		{"not base64", flip(last+5, '!')},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if opened, err := open(key, test.damaged); err == nil {
+				t.Fatalf("opened a damaged file as %q", opened)
+			}
+		})
+	}
+}
+
+// TestNoKey checks files are left as they are without a key, and that plain files can still be read with one.
+func TestNoKey(t *testing.T) {
+	plain := []byte("P5\n16 16\n255\n")
+	if sealed := seal(t, nil, plain, false); !bytes.Equal(sealed, plain) {
+		t.Fatalf("wrote %q without a key, want %q", sealed, plain)
+	}
+	for _, key := range []*Key{nil, mustKey(t, testKey)} {
+		for _, text := range [][]byte{plain, []byte("P5"), nil} {
+			opened, err := open(key, text)
+			if err != nil || !bytes.Equal(opened, text) {
+				t.Fatalf("read %q, %v from a plain file, want %q", opened, err, text)
+			}
+		}
+	}
+}
+
+// TestCreate checks Create seals what is written to the file it creates.
+func TestCreate(t *testing.T) {
+	key := mustKey(t, testKey)
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	w, err := key.Create(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("a checkpoint")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := open(key, sealed)
+	if err != nil || string(opened) != "a checkpoint" {
+		t.Fatalf("got %q, %v back from the file", opened, err)
+	}
+}
+
+// TestParseKey checks keys of the wrong length or not in hex are refused.
+func TestParseKey(t *testing.T) {
+	for _, text := range []string{testKey[:32], testKey[:48], testKey, " " + testKey + "\n"} {
+		if _, err := ParseKey(text); err != nil {
+			t.Errorf("%q: %v", text, err)
+		}
+	}
+	for _, text := range []string{"", testKey[:30], testKey + "00", "zz" + testKey[2:]} {
+		if _, err := ParseKey(text); err == nil {
+			t.Errorf("accepted %q", text)
+		}
+	}
+}
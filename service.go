@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// service describes a broker or worker installed to start when the machine boots and restart if it stops
+type service struct {
+	Name       string   // e.g. gol-worker
+	Executable string   // absolute path to the gol binary
+	Args       []string // subcommand and flags, e.g. worker -port 8031
+}
+
+// runService installs, uninstalls or prints the definition of a broker or worker service
+// For example 'gol service install worker -port 8031' installs a worker that starts on boot with those flags.
+func runService(args []string) {
+	flags := flag.NewFlagSet("service", flag.ExitOnError)
+	name := flags.String("name", "", "Name of the service. Defaults to gol-<command>, e.g. gol-worker.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gol service [-name name] install|uninstall|print broker|worker [flags for the broker or worker]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	args = flags.Args()
+	if len(args) < 2 || (args[1] != "broker" && args[1] != "worker") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	executable, err := os.Executable()
+	handleError("Find executable error", err)
+	s := service{Name: *name, Executable: executable, Args: args[1:]}
+	if s.Name == "" {
+		s.Name = "gol-" + args[1]
+	}
+	switch action {
+	case "install":
+		handleError("Install service error", s.install())
+		fmt.Println("Installed and started", s.Name)
+	case "uninstall":
+		handleError("Uninstall service error", s.uninstall())
+		fmt.Println("Stopped and removed", s.Name)
+	case "print":
+		definition, err := s.definition()
+		handleError("Service error", err)
+		fmt.Print(definition)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// commandLine gives the command the service runs, quoting any argument with spaces
+func (s service) commandLine() string {
+	parts := []string{quoteArgument(s.Executable)}
+	for _, arg := range s.Args {
+		parts = append(parts, quoteArgument(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteArgument(arg string) string {
+	if strings.ContainsAny(arg, " \t\"") {
+		return `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+	}
+	return arg
+}
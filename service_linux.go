@@ -0,0 +1,66 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// systemdDirectory is where unit files for system services go
+const systemdDirectory = "/etc/systemd/system"
+
+// definition gives the systemd unit for the service, which restarts it whenever it stops and starts it on boot
+func (s service) definition() (string, error) {
+	return fmt.Sprintf(`[Unit]
+Description=Game of Life %s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s
+WorkingDirectory=%s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, s.Args[0], s.commandLine(), filepath.Dir(s.Executable)), nil
+}
+
+func (s service) unitPath() string {
+	return filepath.Join(systemdDirectory, s.Name+".service")
+}
+
+// install writes the unit file, then enables and starts the service
+func (s service) install() error {
+	definition, _ := s.definition()
+	if err := ioutil.WriteFile(s.unitPath(), []byte(definition), 0644); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", s.Name)
+}
+
+// uninstall stops and disables the service, then removes its unit file
+func (s service) uninstall() error {
+	if err := systemctl("disable", "--now", s.Name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.unitPath()); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	command := exec.Command("systemctl", args...)
+	command.Stdout, command.Stderr = os.Stdout, os.Stderr
+	return command.Run()
+}
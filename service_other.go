@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (s service) definition() (string, error) {
+	return "", fmt.Errorf("services aren't supported on %s, run '%s' from your own startup script", runtime.GOOS, s.commandLine())
+}
+
+func (s service) install() error {
+	_, err := s.definition()
+	return err
+}
+
+func (s service) uninstall() error {
+	_, err := s.definition()
+	return err
+}
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// definition gives the scheduled task command used for the service
+// gol doesn't speak the Windows service control protocol, so it runs as a task the SYSTEM account starts at boot.
+func (s service) definition() (string, error) {
+	parts := []string{"schtasks"}
+	for _, arg := range s.taskArgs() {
+		parts = append(parts, quoteArgument(arg))
+	}
+	return strings.Join(parts, " ") + "\r\n", nil
+}
+
+func (s service) taskArgs() []string {
+	return []string{"/Create", "/F", "/TN", s.Name, "/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST", "/TR", s.commandLine()}
+}
+
+// install creates the task and starts it straight away
+func (s service) install() error {
+	if err := schtasks(s.taskArgs()...); err != nil {
+		return err
+	}
+	return schtasks("/Run", "/TN", s.Name)
+}
+
+// uninstall stops the task and deletes it
+func (s service) uninstall() error {
+	_ = schtasks("/End", "/TN", s.Name) // it may not be running
+	return schtasks("/Delete", "/F", "/TN", s.Name)
+}
+
+func schtasks(args ...string) error {
+	command := exec.Command("schtasks", args...)
+	command.Stdout, command.Stderr = os.Stdout, os.Stderr
+	return command.Run()
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package shm
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func mmap(file *os.File, size int, writable bool) ([]byte, error) {
+	return nil, fmt.Errorf("boards can't be shared in memory on %s", runtime.GOOS)
+}
+
+func munmap(data []byte) error {
+	return nil
+}
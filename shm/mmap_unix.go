@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package shm
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmap(file *os.File, size int, writable bool) ([]byte, error) {
+	protection := syscall.PROT_READ
+	if writable {
+		protection |= syscall.PROT_WRITE
+	}
+	return syscall.Mmap(int(file.Fd()), 0, size, protection, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
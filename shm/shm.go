@@ -0,0 +1,88 @@
+// Package shm maps boards kept in files into memory, so a broker and workers on the same host can share boards
+// through a directory held in memory, such as /dev/shm, rather than sending them over a connection.
+// A board's file is its cells a row after another, with nothing before them.
+package shm
+
+import (
+	"fmt"
+	"os"
+)
+
+// Board is a board mapped from a file, whose cells change as anything else mapping the file writes to them
+type Board struct {
+	Path   string
+	Width  int
+	Height int
+	Rows   [][]uint8 // each row of the mapping, which can't be used once the board is closed
+	data   []byte
+}
+
+// Create makes the file for a board of width by height dead cells at path, replacing any already there, and maps it
+func Create(path string, width int, height int) (*Board, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err = file.Truncate(int64(width * height)); err != nil {
+		return nil, err
+	}
+	return mapBoard(file, path, width, height, true)
+}
+
+// Open maps the file of a board of width by height cells that has already been made, to be written to if writable
+func Open(path string, width int, height int, writable bool) (*Board, error) {
+	flag := os.O_RDONLY
+	if writable {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != int64(width*height) {
+		return nil, fmt.Errorf("%s holds %d cells rather than %dx%d", path, info.Size(), width, height)
+	}
+	return mapBoard(file, path, width, height, writable)
+}
+
+// mapBoard maps a board's file, which can be closed once it has been
+func mapBoard(file *os.File, path string, width int, height int, writable bool) (*Board, error) {
+	board := &Board{Path: path, Width: width, Height: height, Rows: make([][]uint8, height)}
+	if width*height == 0 {
+		return board, nil // there's nothing to map
+	}
+	data, err := mmap(file, width*height, writable)
+	if err != nil {
+		return nil, err
+	}
+	board.data = data
+	for y := range board.Rows {
+		board.Rows[y] = data[y*width : (y+1)*width : (y+1)*width]
+	}
+	return board, nil
+}
+
+// Close unmaps the board, leaving its file where it is
+func (board *Board) Close() error {
+	data := board.data
+	board.data, board.Rows = nil, nil
+	if data == nil {
+		return nil
+	}
+	return munmap(data)
+}
+
+// Remove unmaps the board and removes its file
+func (board *Board) Remove() error {
+	err := board.Close()
+	if removeErr := os.Remove(board.Path); err == nil {
+		err = removeErr
+	}
+	return err
+}
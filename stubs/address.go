@@ -0,0 +1,48 @@
+package stubs
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// UnixPrefix starts the address of a broker or worker listening on a Unix socket rather than a TCP port,
+// as in unix:/tmp/gol-worker.sock
+const UnixPrefix = "unix:"
+
+// QUICPrefix starts the address of a broker or worker listening for QUIC over UDP rather than on a TCP port, as in
+// quic:worker-1:8031#<fingerprint>, the fingerprint being the SHA-256 of the listener's certificate in hex
+const QUICPrefix = "quic:"
+
+// QUICInsecure lets QUIC addresses without a fingerprint be dialled, taking whatever certificate answers at them
+var QUICInsecure bool
+
+// SplitFingerprint splits the host and port of a QUIC address from the fingerprint of the certificate expected at
+// them, which is empty if the address doesn't give one
+func SplitFingerprint(address string) (string, string) {
+	if i := strings.LastIndexByte(address, '#'); i >= 0 {
+		return address[:i], address[i+1:]
+	}
+	return address, ""
+}
+
+// Network splits an address into the network it is on, unix, quic or tcp, and the address on that network
+func Network(address string) (string, string) {
+	if strings.HasPrefix(address, UnixPrefix) {
+		return "unix", strings.TrimPrefix(address, UnixPrefix)
+	}
+	if strings.HasPrefix(address, QUICPrefix) {
+		return "quic", strings.TrimPrefix(address, QUICPrefix)
+	}
+	return "tcp", address
+}
+
+// DialConn connects to the broker or worker at address, on a Unix socket, with QUIC or over TCP, giving up after
+// timeout unless it is 0
+func DialConn(address string, timeout time.Duration) (net.Conn, error) {
+	network, path := Network(address)
+	if network == "quic" {
+		return dialQUIC(path, timeout)
+	}
+	return net.DialTimeout(network, path, timeout)
+}
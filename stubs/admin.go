@@ -0,0 +1,59 @@
+package stubs
+
+import "time"
+
+// GameStatus describes a game the broker is running, for the admin command
+type GameStatus struct {
+	ID                                 string
+	Width, Height                      int
+	Turns                              int // turns asked for
+	CompletedTurns                     int
+	Paused                             bool
+	Engine                             string // EngineWorkers or EngineHashLife
+	Tiled                              bool
+	Workers                            int // workers the game is using
+	Rule                               string
+	Edge                               string
+	Seed                               int64
+	BirthProbability, DeathProbability float64
+	Priority                           int
+}
+
+// GamesRequest asks the broker which games it is running
+type GamesRequest struct {
+	Header
+}
+
+// GamesResponse lists the games the broker is running
+type GamesResponse struct {
+	Header
+	Games   []GameStatus
+	Running int // games and batches running, including those listed
+}
+
+// BrokerState is where the broker is in its lifecycle, which decides the RPCs it carries out
+type BrokerState string
+
+const (
+	StateIdle     BrokerState = "idle"     // no games are running, so there is nothing to pause, count or save
+	StateRunning  BrokerState = "running"  // at least one game or batch is running
+	StatePaused   BrokerState = "paused"   // the controller's game is paused between turns
+	StateDraining BrokerState = "draining" // the broker is closing its workers, and starts no more games
+	StateClosed   BrokerState = "closed"   // the broker and its workers have closed
+)
+
+// StatusRequest asks the broker which state it is in
+type StatusRequest struct {
+	Header
+}
+
+// StatusResponse gives the broker's state, and the turn its current game has reached if it has one
+type StatusResponse struct {
+	Header
+	State          BrokerState
+	Since          time.Time // when the broker moved to State
+	Running        int       // games and batches running
+	GameID         string    // the controller's game, empty if it has none running
+	CompletedTurns int
+	Turns          int
+}
@@ -0,0 +1,18 @@
+package stubs
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// AliveCellsRequest asks for a page of a finished game's alive cells, for boards with too many to send at once
+// Pages are read in order, passing the Next of each page as the After of the one after it, starting from 0.
+type AliveCellsRequest struct {
+	Header     // GameID is the finished game
+	After  int // where to carry on from, the Next of the previous page
+	Limit  int // most cells to send back
+}
+
+type AliveCellsResponse struct {
+	Header
+	Cells []util.Cell
+	Next  int  // where the next page starts
+	Done  bool // whether this is the last page
+}
@@ -0,0 +1,43 @@
+package stubs
+
+import "time"
+
+// BatchGame describes one game of a batch, started from a random board so no image is needed
+type BatchGame struct {
+	Width, Height    int
+	Turns            int
+	Rule             string
+	Edge             string
+	Seed             int64   // seed for the starting board, and for the random births and deaths
+	Density          float64 // fraction of the starting board that is alive
+	BirthProbability float64
+	DeathProbability float64
+	StopEarly        bool // stop once the board is empty, stops changing or starts cycling
+	CycleWindow      int  // how many previous turns to check for repeats, 0 to not look for cycles
+	Sections         int  // how many sections each turn is split into, handed to the workers in turn, 0 for one per worker
+}
+
+// BatchResult is one row of the results table for a batch, in the same order as the games
+type BatchResult struct {
+	Game           BatchGame
+	CompletedTurns int
+	AliveCount     int
+	StopReason     string
+	CycleStart     int
+	CyclePeriod    int
+	Checksum       *Checksum     // of the final board, so games can be compared without sending their boards
+	Duration       time.Duration // how long the game took to run
+}
+
+// BatchRequest asks the broker to run many games, either one after another or interleaved so they share the workers
+type BatchRequest struct {
+	Header
+	Games      []BatchGame
+	Interleave bool
+	Priority   int // the batch's share of the workers, as StartGameRequest.Priority, which its games split between them
+}
+
+type BatchResponse struct {
+	Header
+	Results []BatchResult
+}
@@ -0,0 +1,20 @@
+package stubs
+
+// Bookmark is a turn of the running game the broker has kept, so the game can be taken back to it
+type Bookmark struct {
+	Name string
+	Turn int
+}
+
+// BookmarkRequest names a bookmark of the running game. Bookmark keeps the game as it is now under Name, named after
+// its turn if empty, and JumpToBookmark takes the paused game back to the bookmark, the latest kept if Name is empty.
+type BookmarkRequest struct {
+	Header
+	Name string
+}
+
+type BookmarkResponse struct {
+	Header
+	CompletedTurns int        // the turn the game is at now
+	Bookmarks      []Bookmark // every bookmark of the game, oldest first
+}
@@ -0,0 +1,188 @@
+package stubs
+
+import (
+	"net/rpc"
+	"strings"
+)
+
+// Broker is a connection to the broker, with a method for each of its RPCs
+type Broker struct {
+	*Client
+}
+
+// DialBroker connects to the broker at address, which has to answer now
+func DialBroker(address string) (*Broker, error) {
+	client, err := Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Broker{client}, nil
+}
+
+// StartGame runs a game, waiting until it has finished
+func (b *Broker) StartGame(request StartGameRequest, response *StartGameResponse) error {
+	return b.Call(startGame.name, request, response)
+}
+
+// AliveCellCount gets the running game's statistics, without its board
+func (b *Broker) AliveCellCount(request AliveCellCountRequest, response *AliveCellCountResponse) error {
+	return b.Call(aliveCellCount.name, request, response)
+}
+
+// CurrentBoard gets the running game's board as it is now
+func (b *Broker) CurrentBoard(request CurrentBoardRequest, response *CurrentBoardResponse) error {
+	return b.Call(currentBoard.name, request, response)
+}
+
+// CloseBroker closes the broker and its workers
+func (b *Broker) CloseBroker(request CloseRequest, response *CloseResponse) error {
+	return b.Call(closeBroker.name, request, response)
+}
+
+// PauseBroker pauses the running game or carries on with it, as the request's Action asks
+// Brokers that support PauseResume have Pause and Resume, which are safe to retry without remembering replies.
+func (b *Broker) PauseBroker(request PauseRequest, response *PauseResponse) error {
+	return b.Call(pauseBroker.name, request, response)
+}
+
+// Pause pauses the running game once the turn being worked out has finished, doing nothing if it's already paused
+func (b *Broker) Pause(request PauseRequest, response *PauseResponse) error {
+	return b.Call(pause.name, request, response)
+}
+
+// Resume carries on with the paused game, doing nothing if it's already running
+func (b *Broker) Resume(request PauseRequest, response *PauseResponse) error {
+	return b.Call(resume.name, request, response)
+}
+
+// ControllerClosed tells the broker the game's controller has gone, so the game is stopped
+func (b *Broker) ControllerClosed(request CloseRequest, response *CloseResponse) error {
+	return b.Call(controllerClosed.name, request, response)
+}
+
+// Census counts the objects on the running game's board
+func (b *Broker) Census(request CensusRequest, response *CensusResponse) error {
+	return b.Call(census.name, request, response)
+}
+
+// RunBatch runs every game of a batch, waiting until they have all finished
+func (b *Broker) RunBatch(request BatchRequest, response *BatchResponse) error {
+	return b.Call(runBatch.name, request, response)
+}
+
+// Version asks which version of gol the broker is running, and which workers it uses
+func (b *Broker) Version(request VersionRequest, response *VersionResponse) error {
+	return b.Call(brokerVersion.name, request, response)
+}
+
+// GoVersion asks for the broker's version in the background, like Client's Go
+func (b *Broker) GoVersion(request VersionRequest, response *VersionResponse, done chan *rpc.Call) *rpc.Call {
+	return b.Go(brokerVersion.name, request, response, done)
+}
+
+// Games lists the games the broker is running
+func (b *Broker) Games(request GamesRequest, response *GamesResponse) error {
+	return b.Call(games.name, request, response)
+}
+
+// AliveCells gets a page of a finished game's alive cells
+func (b *Broker) AliveCells(request AliveCellsRequest, response *AliveCellsResponse) error {
+	return b.Call(aliveCells.name, request, response)
+}
+
+// Diagnostics gets the runtime state of the broker and each of its workers
+func (b *Broker) Diagnostics(request DiagnosticsRequest, response *DiagnosticsResponse) error {
+	return b.Call(brokerDiagnose.name, request, response)
+}
+
+// Validate checks whether the broker would run a game, without starting it
+func (b *Broker) Validate(request ValidateRequest, response *ValidateResponse) error {
+	return b.Call(validate.name, request, response)
+}
+
+// Snapshot takes the running game's board between turns
+func (b *Broker) Snapshot(request SnapshotRequest, response *SnapshotResponse) error {
+	return b.Call(snapshot.name, request, response)
+}
+
+// Heartbeat tells the broker the game's controller is still there
+func (b *Broker) Heartbeat(request HeartbeatRequest, response *HeartbeatResponse) error {
+	return b.Call(heartbeat.name, request, response)
+}
+
+// Status asks which state the broker is in, and how far its current game has got
+func (b *Broker) Status(request StatusRequest, response *StatusResponse) error {
+	return b.Call(status.name, request, response)
+}
+
+// TurnStats gets how the running game's last turn changed its board
+func (b *Broker) TurnStats(request TurnStatsRequest, response *TurnStatsResponse) error {
+	return b.Call(turnStats.name, request, response)
+}
+
+// History gets a range of the turn statistics of the running game, or one of the broker's last few games
+func (b *Broker) History(request HistoryRequest, response *HistoryResponse) error {
+	return b.Call(history.name, request, response)
+}
+
+// SetCells changes cells of the running game's board between two turns
+func (b *Broker) SetCells(request SetCellsRequest, response *SetCellsResponse) error {
+	return b.Call(setCells.name, request, response)
+}
+
+// InjectPattern places a pattern on the running game's board between two turns
+func (b *Broker) InjectPattern(request InjectPatternRequest, response *SetCellsResponse) error {
+	return b.Call(injectPattern.name, request, response)
+}
+
+// GetRegion gets a rectangle of the running game's board, rather than the whole of it
+func (b *Broker) GetRegion(request RegionRequest, response *RegionResponse) error {
+	return b.Call(getRegion.name, request, response)
+}
+
+// WatchRegion waits for cells inside a watched region of the running game's board to change
+func (b *Broker) WatchRegion(request WatchRequest, response *WatchResponse) error {
+	return b.Call(watchRegion.name, request, response)
+}
+
+// GetTurnDiff waits for the running game's board to change, then sends the cells each turn changed since the last call
+func (b *Broker) GetTurnDiff(request TurnDiffRequest, response *TurnDiffResponse) error {
+	return b.Call(getTurnDiff.name, request, response)
+}
+
+// Bookmark keeps the running game as it is now, so it can be taken back to this turn later
+func (b *Broker) Bookmark(request BookmarkRequest, response *BookmarkResponse) error {
+	return b.Call(bookmark.name, request, response)
+}
+
+// JumpToBookmark takes the paused game back to one of its bookmarks
+func (b *Broker) JumpToBookmark(request BookmarkRequest, response *BookmarkResponse) error {
+	return b.Call(jumpToBookmark.name, request, response)
+}
+
+// Bookmarks lists the running game's bookmarks
+func (b *Broker) Bookmarks(request BookmarkRequest, response *BookmarkResponse) error {
+	return b.Call(bookmarks.name, request, response)
+}
+
+// WriteTurn asks for, or gives up, the turn to change the board of a game shared between controllers
+func (b *Broker) WriteTurn(request WriteTurnRequest, response *WriteTurnResponse) error {
+	return b.Call(writeTurn.name, request, response)
+}
+
+// RegisterWorker announces a worker to the broker, which uses it in its games from then on
+func (b *Broker) RegisterWorker(request RegisterWorkerRequest, response *RegisterWorkerResponse) error {
+	return b.Call(registerWorker.name, request, response)
+}
+
+// Negotiate agrees with the broker which of ours to use, recording them in the client's Capabilities
+func (b *Broker) Negotiate(version string, ours Capabilities) error {
+	return b.negotiate(brokerHello.name, version, ours)
+}
+
+// unknownMethod checks whether an error is the other side not serving the method called,
+// as brokers and workers from before the method was added don't
+func unknownMethod(err error) bool {
+	serverErr, ok := err.(rpc.ServerError)
+	return ok && strings.HasPrefix(string(serverErr), "rpc: can't find method")
+}
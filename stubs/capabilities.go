@@ -0,0 +1,95 @@
+package stubs
+
+// Capability is a feature of the protocol that a broker or worker may or may not have, so newer ones can
+// use it with each other and leave it out with older ones
+type Capability string
+
+const (
+	Checksums      Capability = "checksums"      // boards carry a Checksum, and corrupted ones are sent again
+	Multiplexing   Capability = "multiplexing/2" // connections starting with mux.Magic carry several streams, with flow control
+	Deadlines      Capability = "deadlines"      // work stops once the request's Deadline has passed
+	Noise          Capability = "noise"          // random births and deaths
+	LargerThanLife Capability = "rules/ltl"      // Larger than Life rules, with neighbourhoods beyond radius 1
+	Generations    Capability = "rules/gen"      // Generations rules and Wireworld, with more than two cell states
+	Coloured       Capability = "rules/coloured" // Immigration and QuadLife, with coloured alive cells
+	Snapshots      Capability = "snapshots"      // the Snapshot RPC
+	Heartbeats     Capability = "heartbeats"     // controllers that stop sending heartbeats have their games stopped
+	PauseResume    Capability = "pause-resume"   // the Pause and Resume RPCs, which answer once the game has paused
+	Detach         Capability = "detach"         // games asked to are finished without their controller once it goes
+	StartTurn      Capability = "start-turn"     // games can carry on from a board saved partway through, see StartGameRequest
+	TurnStatistics Capability = "turn-stats"     // workers count births and deaths, and the broker has the TurnStats RPC
+	History        Capability = "history"        // the History RPC, for the turn statistics of the broker's last few games
+	Sections       Capability = "sections"       // batch games can set how many sections their turns are split into
+	SetCells       Capability = "set-cells"      // the SetCells and InjectPattern RPCs, which change a running game's board
+	Regions        Capability = "regions"        // the GetRegion RPC, for part of a running game's board
+	Watches        Capability = "watches"        // the WatchRegion RPC, which waits for part of a running game's board to change
+	Bookmarks      Capability = "bookmarks"      // the Bookmark, JumpToBookmark and Bookmarks RPCs
+	WriteTurns     Capability = "write-turns"    // the WriteTurn RPC, for controllers sharing a game to take turns changing its board
+	WriteSections  Capability = "write-sections" // workers keep their sections when asked to, and write them into images with WriteSection
+	SharedImages   Capability = "shared-images"  // games can have their workers write the finished board, see StartGameRequest.SharedImage
+	SharedMemory   Capability = "shared-memory"  // workers on the broker's host can be sent boards in shared memory, see WorkerRequest.SharedBoard
+	PackedBoards   Capability = "packed-boards"  // workers can be sent boards, and send back sections, packed in an Encoding
+	Priorities     Capability = "priorities"     // games and batches share the workers by priority, see StartGameRequest.Priority
+	Halos          Capability = "halos"          // workers keep strips of halo games between turns, see StartGameRequest.Halo
+	TurnDiffs      Capability = "turn-diffs"     // the GetTurnDiff RPC, for the changes every turn of a game makes, see StartGameRequest.StreamTurns
+)
+
+// Capabilities is a set of capabilities, in no particular order
+type Capabilities []Capability
+
+// WorkerCapabilities is what workers built from this version support
+var WorkerCapabilities = Capabilities{Checksums, Multiplexing, Deadlines, Noise, LargerThanLife, Generations, Coloured, TurnStatistics, WriteSections, SharedMemory, PackedBoards, Halos}
+
+// BrokerCapabilities is what brokers built from this version support for their controllers
+var BrokerCapabilities = Capabilities{Checksums, Deadlines, Noise, LargerThanLife, Generations, Coloured, Snapshots, Heartbeats, PauseResume, Detach, StartTurn, TurnStatistics, History, Sections, SetCells, Regions, Watches, Bookmarks, WriteTurns, SharedImages, Priorities, Halos, TurnDiffs}
+
+// Has checks whether the set includes a capability
+func (capabilities Capabilities) Has(capability Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Common gives the capabilities in both sets
+func (capabilities Capabilities) Common(others Capabilities) Capabilities {
+	common := Capabilities{}
+	for _, c := range capabilities {
+		if others.Has(c) {
+			common = append(common, c)
+		}
+	}
+	return common
+}
+
+// HelloRequest tells the broker or a worker what the caller supports, when it first connects
+type HelloRequest struct {
+	Header
+	Version      string
+	Capabilities Capabilities
+}
+
+// HelloResponse gives the capabilities both sides support, which are the ones that can be used
+type HelloResponse struct {
+	Header
+	Version      string
+	Capabilities Capabilities
+}
+
+// negotiate says Hello with the given handler, recording the capabilities agreed in the client's Capabilities
+// Brokers and workers from before Hello was added don't know it, so are taken to support none of them.
+func (c *Client) negotiate(helloHandler string, version string, ours Capabilities) error {
+	response := new(HelloResponse)
+	err := c.Call(helloHandler, HelloRequest{Header: NewHeader(""), Version: version, Capabilities: ours}, response)
+	if unknownMethod(err) {
+		c.Capabilities = Capabilities{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.Capabilities = response.Capabilities
+	return nil
+}
@@ -0,0 +1,78 @@
+package stubs
+
+import "hash/crc32"
+
+// Checksum lets whoever receives a board check it arrived as it was sent, so a transfer corrupted on the way
+// fails with Corrupted rather than quietly changing the game
+// Messages carry a nil Checksum when their sender doesn't send one, which passes every check.
+type Checksum struct {
+	Rows    int
+	Columns int
+	CRC     uint32 // CRC-32 of every row in turn
+}
+
+// Sum works out the checksum of a board
+func Sum(board [][]uint8) *Checksum {
+	sum := &Checksum{Rows: len(board)}
+	if len(board) > 0 {
+		sum.Columns = len(board[0])
+	}
+	for _, row := range board {
+		sum.CRC = crc32.Update(sum.CRC, crc32.IEEETable, row)
+	}
+	return sum
+}
+
+// Same checks whether two boards have the same checksum, which boards without one never do
+func (sum *Checksum) Same(other *Checksum) bool {
+	return sum != nil && other != nil && *sum == *other
+}
+
+// Verify checks a board against its checksum
+func (sum *Checksum) Verify(board [][]uint8) error {
+	if sum == nil {
+		return nil
+	}
+	if len(board) != sum.Rows {
+		return Errorf(Corrupted, "board has %d rows, %d were sent", len(board), sum.Rows)
+	}
+	for y, row := range board {
+		if len(row) != sum.Columns {
+			return Errorf(Corrupted, "row %d of the board has %d cells, %d were sent", y, len(row), sum.Columns)
+		}
+	}
+	if got := Sum(board).CRC; got != sum.CRC {
+		return Errorf(Corrupted, "board checksum is %08x, %08x was sent", got, sum.CRC)
+	}
+	return nil
+}
+
+// Verify checks the advanced section arrived intact
+// A section written to shared memory or encoded isn't sent as it is, so is checked by the broker once it has read
+// or decoded it.
+func (response *WorkerResponse) Verify() error {
+	if response.Shared || response.Section != nil {
+		return nil
+	}
+	return response.Checksum.Verify(response.AdvancedMiniBoard)
+}
+
+// Verify checks the finished board arrived intact
+func (response *StartGameResponse) Verify() error {
+	return response.Checksum.Verify(response.FinishedBoard)
+}
+
+// Verify checks the current board arrived intact
+func (response *CurrentBoardResponse) Verify() error {
+	return response.Checksum.Verify(response.Board)
+}
+
+// Verify checks the strip arrived intact
+func (response *FetchStripResponse) Verify() error {
+	return response.Checksum.Verify(response.Rows)
+}
+
+// Verify checks the region arrived intact
+func (response *RegionResponse) Verify() error {
+	return response.Checksum.Verify(response.Cells)
+}
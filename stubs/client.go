@@ -0,0 +1,222 @@
+package stubs
+
+import (
+	"log"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/mux"
+)
+
+// redials is how many times a lost connection is dialled again before a call gives up, waiting twice as long
+// after each failed attempt, starting from redialDelay
+const (
+	redials     = 5
+	redialDelay = 100 * time.Millisecond
+)
+
+// unrepeatable lists the calls that can't be made again once a connection is lost partway through them,
+// because the first may already have been carried out and doing it twice would change the game again. The rest
+// only read, set something to what it already is, such as Pause, or, like CloseBroker, ControllerClosed and
+// PauseBroker, are answered from the broker's remembered responses when retried with the same request ID.
+var unrepeatable = map[string]bool{
+	startGame.name:      true,
+	runBatch.name:       true,
+	closeWorker.name:    true,
+	bookmark.name:       true,
+	jumpToBookmark.name: true,
+	writeTurn.name:      true,
+	setCells.name:       true,
+	injectPattern.name:  true,
+}
+
+// bulky lists the calls that send whole boards, which go on a stream of their own on multiplexed connections
+// so they don't hold up the others
+var bulky = map[string]bool{
+	advanceSection.name: true,
+	loadStrip.name:      true,
+	fetchStrip.name:     true,
+}
+
+// Client is an RPC connection that is dialled again when it's lost, so a dropped connection or a restarted
+// broker or worker doesn't end the caller. Calls that are safe to repeat are made again on the new connection.
+type Client struct {
+	Address      string
+	Capabilities Capabilities // agreed with the other side by Broker's or Worker's Negotiate, nil if they haven't been
+	multiplexed  bool
+	timeout      time.Duration // how long dialling can take, 0 for as long as the system allows
+	mutex        sync.Mutex
+	link         *link // nil until the lost connection is redialled
+	closed       bool
+	traffic      *Traffic // counted on every connection the client dials
+}
+
+// link is one connection, with a client for every call or, when multiplexed, one for bulky calls and one for the rest
+type link struct {
+	control *rpc.Client
+	bulk    *rpc.Client
+	session *mux.Session
+}
+
+// Dial connects to the broker or worker at address, which has to answer now
+func Dial(address string) (*Client, error) {
+	return dial(address, false, 0)
+}
+
+// DialTimeout connects like Dial, but gives up on dialling after timeout
+func DialTimeout(address string, timeout time.Duration) (*Client, error) {
+	return dial(address, false, timeout)
+}
+
+func dial(address string, multiplexed bool, timeout time.Duration) (*Client, error) {
+	traffic := new(Traffic)
+	link, err := dialLink(address, multiplexed, timeout, traffic)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Address: address, multiplexed: multiplexed, timeout: timeout, link: link, traffic: traffic}, nil
+}
+
+func dialLink(address string, multiplexed bool, timeout time.Duration, traffic *Traffic) (*link, error) {
+	raw, err := DialConn(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := countingConn{raw, traffic}
+	if !multiplexed {
+		client := rpc.NewClient(conn)
+		return &link{control: client, bulk: client}, nil
+	}
+	session, err := mux.Client(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	control, err := session.Open()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	bulk, err := session.Open()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	return &link{control: rpc.NewClient(control), bulk: rpc.NewClient(bulk), session: session}, nil
+}
+
+// client gives the RPC client a call is made on
+func (link *link) client(method string) *rpc.Client {
+	if bulky[method] {
+		return link.bulk
+	}
+	return link.control
+}
+
+func (link *link) close() error {
+	err := link.control.Close()
+	if link.session != nil {
+		_ = link.bulk.Close()
+		err = link.session.Close()
+	}
+	return err
+}
+
+// connection gives the current connection, redialling it if it has been lost
+func (c *Client) connection() (*link, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, rpc.ErrShutdown
+	}
+	if c.link != nil {
+		return c.link, nil
+	}
+	var err error
+	delay := redialDelay
+	for try := 0; try < redials; try++ {
+		if c.link, err = dialLink(c.Address, c.multiplexed, c.timeout, c.traffic); err == nil {
+			log.Println("Reconnected to", c.Address)
+			return c.link, nil
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return nil, err
+}
+
+// lost drops a connection that has failed, so the next call dials again
+func (c *Client) lost(link *link) {
+	c.mutex.Lock()
+	if c.link == link { // another call may have redialled already
+		log.Println("Lost connection to", c.Address+", redialling")
+		_ = c.link.close()
+		c.link = nil
+	}
+	c.mutex.Unlock()
+}
+
+// verifiable is a response carrying a board that can be checked against its checksum
+type verifiable interface {
+	Verify() error
+}
+
+// Call makes an RPC and gives back either the connection's error or the one recorded in the response
+// If the connection is lost, it is dialled again, and the call made again if it's safe to repeat. Calls whose
+// boards arrive corrupted are made again too, always if the request was damaged, since the other side did
+// nothing with it, and if it's safe to repeat if the response was.
+func (c *Client) Call(method string, request interface{}, response Reply) error {
+	var err error
+	for try := 0; try <= redials; try++ {
+		var link *link
+		if link, err = c.connection(); err != nil {
+			return err
+		}
+		err = Call(link.client(method), method, request, response)
+		if Code(err) == Corrupted {
+			continue
+		}
+		if board, ok := response.(verifiable); ok && err == nil {
+			if err = board.Verify(); err != nil && !unrepeatable[method] {
+				continue
+			}
+		}
+		if !Unanswered(err) {
+			return err
+		}
+		c.lost(link)
+		if unrepeatable[method] {
+			return err
+		}
+	}
+	return err
+}
+
+// Unanswered checks whether an error is the connection failing, rather than the other side answering with one,
+// as when the broker or worker has gone
+func Unanswered(err error) bool {
+	_, answered := err.(rpc.ServerError)
+	return err != nil && !answered && Code(err) == ""
+}
+
+// Go makes an RPC in the background like rpc.Client's Go, retrying it as Call does, and sends it on done once finished
+func (c *Client) Go(method string, request interface{}, response Reply, done chan *rpc.Call) *rpc.Call {
+	call := &rpc.Call{ServiceMethod: method, Args: request, Reply: response, Done: done}
+	go func() {
+		call.Error = c.Call(method, request, response)
+		call.Done <- call
+	}()
+	return call
+}
+
+// Close closes the connection, after which every call fails
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	if c.link == nil {
+		return nil
+	}
+	return c.link.close()
+}
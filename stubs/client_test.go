@@ -0,0 +1,134 @@
+package stubs
+
+import (
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// damagingBroker answers StartGame and CurrentBoard with a board, flipping a byte of it after its checksum is worked
+// out for the first damagedResponses calls, as if it were corrupted on the way back, and failing the first
+// damagedRequests with Corrupted, as if the request had been corrupted on the way there
+type damagingBroker struct {
+	mutex            sync.Mutex
+	calls            map[string]int
+	damagedRequests  int
+	damagedResponses int
+}
+
+var testBoard = [][]uint8{{0, 255, 0, 0}, {0, 0, 255, 0}, {255, 255, 255, 0}}
+
+// answer gives a board and its checksum, damaged if it should be, or fails as if the request was damaged
+func (broker *damagingBroker) answer(method string) ([][]uint8, *Checksum, error) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	broker.calls[method]++
+	call := broker.calls[method]
+	if call <= broker.damagedRequests {
+		return nil, nil, Errorf(Corrupted, "request board checksum doesn't match")
+	}
+	board := make([][]uint8, len(testBoard))
+	for y, row := range testBoard {
+		board[y] = append([]uint8(nil), row...)
+	}
+	sum := Sum(board)
+	if call <= broker.damagedRequests+broker.damagedResponses {
+		board[1][2] ^= 0x10
+	}
+	return board, sum, nil
+}
+
+func (broker *damagingBroker) StartGame(req StartGameRequest, res *StartGameResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	res.FinishedBoard, res.Checksum, err = broker.answer(startGame.name)
+	return err
+}
+
+func (broker *damagingBroker) CurrentBoard(req CurrentBoardRequest, res *CurrentBoardResponse) (err error) {
+	res.Header = req.Header
+	defer func() {
+		err = res.Fail(err)
+	}()
+	res.Board, res.Checksum, err = broker.answer(currentBoard.name)
+	return err
+}
+
+// serveDamaging serves a damagingBroker on a local port, giving a client connected to it
+func serveDamaging(t *testing.T, broker *damagingBroker) *Client {
+	broker.calls = make(map[string]int)
+	server := rpc.NewServer()
+	if err := server.RegisterName("SecretBrokerOperation", broker); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(listener)
+	client, err := Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = listener.Close()
+	})
+	return client
+}
+
+// TestCallCorrupted checks Client.Call makes a call again when its board arrives damaged if the call is safe to
+// repeat, or the damage was to the request, and otherwise gives back Corrupted.
+func TestCallCorrupted(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		damagedRequests  int
+		damagedResponses int
+		wantCode         ErrorCode
+		wantCalls        int
+	}{
+		{"repeatable intact", currentBoard.name, 0, 0, "", 1},
+		{"repeatable damaged once", currentBoard.name, 0, 1, "", 2},
+		{"repeatable damaged twice", currentBoard.name, 0, 2, "", 3},
+		{"repeatable always damaged", currentBoard.name, 0, 100, Corrupted, redials + 1},
+		{"repeatable request damaged", currentBoard.name, 1, 0, "", 2},
+		{"unrepeatable intact", startGame.name, 0, 0, "", 1},
+		{"unrepeatable damaged", startGame.name, 0, 1, Corrupted, 1},
+		{"unrepeatable request damaged", startGame.name, 2, 0, "", 3},
+		{"unrepeatable request then response damaged", startGame.name, 1, 1, Corrupted, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := &damagingBroker{damagedRequests: test.damagedRequests, damagedResponses: test.damagedResponses}
+			client := serveDamaging(t, broker)
+			var err error
+			var board [][]uint8
+			switch test.method {
+			case currentBoard.name:
+				response := new(CurrentBoardResponse)
+				err = client.Call(currentBoard.name, CurrentBoardRequest{}, response)
+				board = response.Board
+			case startGame.name:
+				response := new(StartGameResponse)
+				err = client.Call(startGame.name, StartGameRequest{}, response)
+				board = response.FinishedBoard
+			}
+			if Code(err) != test.wantCode || err != nil && test.wantCode == "" {
+				t.Fatalf("got %v, want code %q", err, test.wantCode)
+			}
+			if err == nil && !reflect.DeepEqual(board, testBoard) {
+				t.Fatalf("got board %v, want %v", board, testBoard)
+			}
+			broker.mutex.Lock()
+			defer broker.mutex.Unlock()
+			if calls := broker.calls[test.method]; calls != test.wantCalls {
+				t.Fatalf("called %d times, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
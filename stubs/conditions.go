@@ -0,0 +1,84 @@
+package stubs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of StopCondition
+const (
+	PopulationBelow = "populationBelow" // fewer than Population cells are alive
+	PopulationAbove = "populationAbove" // more than Population cells are alive
+	RegionEmpty     = "regionEmpty"     // no cells are alive in the region at X, Y of size Width x Height
+)
+
+// StopCondition ends a game before its turn count once it holds, checked by the broker after every turn
+type StopCondition struct {
+	Kind          string
+	Population    int
+	X, Y          int
+	Width, Height int
+}
+
+// ParseStopCondition reads a condition written as "population<N", "population>N" or "empty:x,y,w,h"
+func ParseStopCondition(text string) (StopCondition, error) {
+	text = strings.ToLower(strings.Replace(text, " ", "", -1))
+	switch {
+	case strings.HasPrefix(text, "population<"), strings.HasPrefix(text, "population>"):
+		population, err := strconv.Atoi(text[len("population<"):])
+		if err != nil {
+			return StopCondition{}, fmt.Errorf("invalid stop condition %q: population must be a whole number", text)
+		}
+		if text[len("population")] == '<' {
+			return StopCondition{Kind: PopulationBelow, Population: population}, nil
+		}
+		return StopCondition{Kind: PopulationAbove, Population: population}, nil
+	case strings.HasPrefix(text, "empty:"):
+		var numbers []int
+		for _, field := range strings.Split(text[len("empty:"):], ",") {
+			number, err := strconv.Atoi(field)
+			if err != nil {
+				return StopCondition{}, fmt.Errorf("invalid stop condition %q: region must be x,y,w,h", text)
+			}
+			numbers = append(numbers, number)
+		}
+		if len(numbers) != 4 {
+			return StopCondition{}, fmt.Errorf("invalid stop condition %q: region must be x,y,w,h", text)
+		}
+		return StopCondition{Kind: RegionEmpty, X: numbers[0], Y: numbers[1], Width: numbers[2], Height: numbers[3]}, nil
+	default:
+		return StopCondition{}, fmt.Errorf("invalid stop condition %q: expected population<N, population>N or empty:x,y,w,h", text)
+	}
+}
+
+// Validate checks the condition makes sense for a board of the given size
+func (condition StopCondition) Validate(width int, height int) error {
+	switch condition.Kind {
+	case PopulationBelow, PopulationAbove:
+		if condition.Population < 0 {
+			return fmt.Errorf("invalid stop condition %v: population can't be negative", condition)
+		}
+	case RegionEmpty:
+		if condition.X < 0 || condition.Y < 0 || condition.Width <= 0 || condition.Height <= 0 ||
+			condition.X+condition.Width > width || condition.Y+condition.Height > height {
+			return fmt.Errorf("invalid stop condition %v: region must lie within the %dx%d board", condition, width, height)
+		}
+	default:
+		return fmt.Errorf("invalid stop condition: unknown kind %q", condition.Kind)
+	}
+	return nil
+}
+
+func (condition StopCondition) String() string {
+	switch condition.Kind {
+	case PopulationBelow:
+		return fmt.Sprintf("population below %d", condition.Population)
+	case PopulationAbove:
+		return fmt.Sprintf("population above %d", condition.Population)
+	case RegionEmpty:
+		return fmt.Sprintf("region %d,%d %dx%d empty", condition.X, condition.Y, condition.Width, condition.Height)
+	default:
+		return condition.Kind
+	}
+}
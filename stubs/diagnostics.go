@@ -0,0 +1,32 @@
+package stubs
+
+import "time"
+
+// DiagnosticsRequest asks for the runtime state of the broker and every worker, with the last lines of their logs
+type DiagnosticsRequest struct {
+	Header
+	Lines int
+}
+
+// Diagnostics describes the runtime state of a broker or worker
+type Diagnostics struct {
+	Header
+	Address    string // as the broker dials it, empty for the broker itself
+	Error      string // why the rest is missing, if it couldn't be fetched
+	Host       string
+	Version    string
+	Platform   string
+	CPUs       int
+	Uptime     time.Duration
+	Goroutines int
+	HeapBytes  uint64
+	GCRuns     uint32
+	Log        []string // oldest first
+}
+
+// DiagnosticsResponse gives the broker's diagnostics and those of each of its workers, in the broker's order
+type DiagnosticsResponse struct {
+	Header
+	Broker  Diagnostics
+	Workers []Diagnostics
+}
@@ -0,0 +1,32 @@
+package stubs
+
+// CellEdit sets a cell of the board to Value, the grey level it is stored as in PGM images: 255 for alive and 0 for
+// dead, with the states of Generations and coloured rules in between
+type CellEdit struct {
+	X, Y  int
+	Value uint8
+}
+
+// SetCellsRequest asks the broker to change cells of the running game's board once its current turn has finished,
+// so the workers are sent the changed board with the next one. Every edit is checked before any is made.
+type SetCellsRequest struct {
+	Header
+	Controller string // who is changing the board, which must be whoever has the turn if anyone does, see WriteTurn
+	Cells      []CellEdit
+}
+
+// InjectPatternRequest asks the broker to place a pattern on the running game's board, with its top left corner at
+// X, Y, like SetCellsRequest. Both the pattern's alive and dead cells are set.
+type InjectPatternRequest struct {
+	Header
+	Controller string // as for SetCellsRequest
+	X, Y       int
+	Name       string   // a known object, such as glider or lwss, or empty to use Rows
+	Rows       []string // the pattern drawn with '#' or 'O' for alive cells and '.' for dead ones
+}
+
+type SetCellsResponse struct {
+	Header
+	CompletedTurns int // the turn the board was changed after
+	Changed        int // cells whose value changed, leaving out those that were already as asked
+}
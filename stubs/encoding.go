@@ -0,0 +1,199 @@
+package stubs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Encoding is how a board, or a section of one, is packed into bytes to be sent between the broker and a worker
+type Encoding string
+
+const (
+	Dense     Encoding = "dense"  // a byte per cell, sent as rows, as older brokers and workers do
+	BitPacked Encoding = "bits"   // a bit per cell, for boards whose cells are all 0 or 255
+	Sparse    Encoding = "sparse" // where the cells that aren't dead are, and their values
+	Delta     Encoding = "delta"  // where the cells that differ from a board the receiver already has are, and their values
+)
+
+// Encodings is a set of encodings, in no particular order
+type Encodings []Encoding
+
+// AllEncodings is every encoding there is
+var AllEncodings = Encodings{Dense, BitPacked, Sparse, Delta}
+
+// Has checks whether the set includes an encoding
+func (encodings Encodings) Has(encoding Encoding) bool {
+	for _, e := range encodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEncodings reads a comma-separated list of encodings, such as bits,sparse,delta
+func ParseEncodings(text string) (Encodings, error) {
+	var encodings Encodings
+	for _, name := range strings.Split(text, ",") {
+		encoding := Encoding(strings.TrimSpace(name))
+		if encoding == "" {
+			continue
+		}
+		if !AllEncodings.Has(encoding) {
+			return nil, fmt.Errorf("unknown encoding %q, expected some of %s, %s, %s and %s", encoding, Dense, BitPacked, Sparse, Delta)
+		}
+		encodings = append(encodings, encoding)
+	}
+	return encodings, nil
+}
+
+// EncodedBoard is a board packed with an Encoding other than Dense
+type EncodedBoard struct {
+	Encoding Encoding
+	Width    int
+	Height   int
+	Data     []byte
+	Base     *Checksum // of the board a Delta is from, so a receiver without it can say so rather than decode it wrongly
+}
+
+// changeSize is roughly how many bytes each cell listed by Sparse and Delta takes: the gap since the last one and its value
+const changeSize = 3
+
+// cellCost is roughly how long packing and unpacking each cell of a board takes in each encoding, in nanoseconds
+var cellCost = map[Encoding]float64{Dense: 0.5, BitPacked: 2, Sparse: 1.5, Delta: 2}
+
+// EncodedSize estimates how many bytes a board of cells takes in an encoding, when nonDead of them aren't dead and
+// changed of them differ from the board a Delta would be from
+func EncodedSize(encoding Encoding, cells int, nonDead int, changed int) int {
+	switch encoding {
+	case BitPacked:
+		return (cells + 7) / 8
+	case Sparse:
+		return nonDead * changeSize
+	case Delta:
+		return changed * changeSize
+	default:
+		return cells
+	}
+}
+
+// ChooseEncoding picks whichever of the encodings allowed should get a board of cells across fastest, counting the time
+// to pack and unpack it along with the time to send it at bytesPerSecond. Dense is always allowed, and until a link's
+// speed has been measured, giving 0, the smallest encoding is chosen.
+func ChooseEncoding(allowed Encodings, cells int, nonDead int, changed int, bytesPerSecond float64) Encoding {
+	best, bestCost := Dense, 0.0
+	for i, encoding := range append(Encodings{Dense}, allowed...) {
+		cost := float64(EncodedSize(encoding, cells, nonDead, changed))
+		if bytesPerSecond > 0 {
+			cost = cost/bytesPerSecond*1e9 + float64(cells)*cellCost[encoding]
+		}
+		if i == 0 || cost < bestCost {
+			best, bestCost = encoding, cost
+		}
+	}
+	return best
+}
+
+// Encode packs a board, reporting false if it can't be packed that way: BitPacked boards can only have cells of 0
+// and 255, and a Delta's base must be the size of the board. A Delta's Base is left to the caller to set, as it
+// usually has the base's checksum already.
+func Encode(board [][]uint8, encoding Encoding, base [][]uint8) (*EncodedBoard, bool) {
+	encoded := &EncodedBoard{Encoding: encoding, Height: len(board)}
+	if len(board) > 0 {
+		encoded.Width = len(board[0])
+	}
+	switch encoding {
+	case BitPacked:
+		encoded.Data = make([]byte, (encoded.Width*encoded.Height+7)/8)
+		i := 0
+		for _, row := range board {
+			for _, cell := range row {
+				if cell == 255 {
+					encoded.Data[i/8] |= 1 << uint(i%8)
+				} else if cell != 0 {
+					return nil, false
+				}
+				i++
+			}
+		}
+	case Sparse:
+		encoded.Data = appendDifferences(nil, board, nil)
+	case Delta:
+		if len(base) != len(board) || len(base) > 0 && len(base[0]) != encoded.Width {
+			return nil, false
+		}
+		encoded.Data = appendDifferences(nil, board, base)
+	default:
+		return nil, false
+	}
+	return encoded, true
+}
+
+// appendDifferences appends each cell that differs from base, a nil base being dead everywhere, as how many cells
+// were skipped since the last one and its value
+func appendDifferences(data []byte, board [][]uint8, base [][]uint8) []byte {
+	var gap [binary.MaxVarintLen64]byte
+	next := 0 // the cell after the last one appended
+	for y, row := range board {
+		for x, cell := range row {
+			if base == nil && cell == 0 || base != nil && cell == base[y][x] {
+				continue
+			}
+			index := y*len(row) + x
+			n := binary.PutUvarint(gap[:], uint64(index-next))
+			data = append(append(data, gap[:n]...), cell)
+			next = index + 1
+		}
+	}
+	return data
+}
+
+// Decode unpacks a board, from base for a Delta, which the caller has checked against the Delta's Base
+func (encoded *EncodedBoard) Decode(base [][]uint8) ([][]uint8, error) {
+	width, height := encoded.Width, encoded.Height
+	if width < 0 || height < 0 {
+		return nil, Errorf(Corrupted, "%s board is %dx%d", encoded.Encoding, width, height)
+	}
+	switch encoded.Encoding {
+	case BitPacked:
+		if len(encoded.Data) != (width*height+7)/8 {
+			return nil, Errorf(Corrupted, "bit-packed board has %d bytes for %dx%d cells", len(encoded.Data), width, height)
+		}
+	case Delta:
+		if len(base) != height || height > 0 && len(base[0]) != width {
+			return nil, Errorf(Stale, "the board the delta is from isn't %dx%d", width, height)
+		}
+	case Sparse:
+	default:
+		return nil, Errorf(InvalidParams, "unknown encoding %q", encoded.Encoding)
+	}
+	cells := make([]uint8, width*height)
+	board := make([][]uint8, height)
+	for y := range board {
+		board[y] = cells[y*width : (y+1)*width : (y+1)*width]
+	}
+	if encoded.Encoding == BitPacked {
+		for i := range cells {
+			if encoded.Data[i/8]>>uint(i%8)&1 == 1 {
+				cells[i] = 255
+			}
+		}
+		return board, nil
+	}
+	for y, row := range base { // only given for a Delta
+		copy(board[y], row)
+	}
+	next := 0
+	for data := encoded.Data; len(data) > 0; {
+		gap, n := binary.Uvarint(data)
+		if n <= 0 || len(data) == n || gap >= uint64(len(cells)-next) {
+			return nil, Errorf(Corrupted, "%s board lists a cell beyond its %dx%d", encoded.Encoding, width, height)
+		}
+		next += int(gap)
+		cells[next] = data[n]
+		next++
+		data = data[n+1:]
+	}
+	return board, nil
+}
@@ -0,0 +1,254 @@
+package stubs
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomBoard makes a board where about one cell in every sparseness is alive, with alive cells as 255, or as a
+// random value if multiState
+func randomBoard(width int, height int, sparseness int, multiState bool, seed int64) [][]uint8 {
+	random := rand.New(rand.NewSource(seed))
+	board := make([][]uint8, height)
+	for y := range board {
+		board[y] = make([]uint8, width)
+		for x := range board[y] {
+			if random.Intn(sparseness) == 0 {
+				board[y][x] = 255
+				if multiState {
+					board[y][x] = uint8(1 + random.Intn(254))
+				}
+			}
+		}
+	}
+	return board
+}
+
+// changed copies a board with a few cells flipped
+func changed(board [][]uint8, flips int, seed int64) [][]uint8 {
+	random := rand.New(rand.NewSource(seed))
+	copied := make([][]uint8, len(board))
+	for y, row := range board {
+		copied[y] = append([]uint8(nil), row...)
+	}
+	for i := 0; i < flips; i++ {
+		y, x := random.Intn(len(copied)), random.Intn(len(copied[0]))
+		copied[y][x] = 255 - copied[y][x]
+	}
+	return copied
+}
+
+// TestEncodeDecode checks boards come back from every encoding as they went in.
+func TestEncodeDecode(t *testing.T) {
+	base := randomBoard(64, 48, 3, false, 1)
+	tests := []struct {
+		name     string
+		board    [][]uint8
+		encoding Encoding
+		base     [][]uint8
+	}{
+		{"bits", base, BitPacked, nil},
+		{"bits not a multiple of 8", randomBoard(13, 7, 2, false, 2), BitPacked, nil},
+		{"bits empty board", [][]uint8{}, BitPacked, nil},
+		{"sparse", randomBoard(64, 48, 20, false, 3), Sparse, nil},
+		{"sparse multi-state", randomBoard(64, 48, 5, true, 4), Sparse, nil},
+		{"sparse all dead", randomBoard(64, 48, 1<<30, false, 5), Sparse, nil},
+		{"sparse all alive", randomBoard(32, 32, 1, false, 6), Sparse, nil},
+		{"sparse last cell", [][]uint8{{0, 0}, {0, 7}}, Sparse, nil},
+		{"sparse cells far apart", randomBoard(1024, 1024, 100000, false, 7), Sparse, nil},
+		{"delta", changed(base, 10, 8), Delta, base},
+		{"delta unchanged", base, Delta, base},
+		{"delta all changed", changed(base, 64*48*4, 9), Delta, base},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, ok := Encode(test.board, test.encoding, test.base)
+			if !ok {
+				t.Fatalf("couldn't encode the board as %s", test.encoding)
+			}
+			if encoded.Encoding != test.encoding {
+				t.Fatalf("encoded as %s, want %s", encoded.Encoding, test.encoding)
+			}
+			decoded, err := encoded.Decode(test.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(test.board) == 0 && len(decoded) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(decoded, test.board) {
+				t.Fatal("decoded board differs from the one encoded")
+			}
+			if err := Sum(test.board).Verify(decoded); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestEncodeRefuses checks boards that can't be packed in an encoding aren't.
+func TestEncodeRefuses(t *testing.T) {
+	board := randomBoard(16, 16, 3, false, 1)
+	tests := []struct {
+		name     string
+		board    [][]uint8
+		encoding Encoding
+		base     [][]uint8
+	}{
+		{"bits with other values", randomBoard(16, 16, 3, true, 2), BitPacked, nil},
+		{"delta from a shorter board", board, Delta, board[:8]},
+		{"delta from a narrower board", board, Delta, randomBoard(8, 16, 3, false, 3)},
+		{"dense", board, Dense, nil},
+		{"unknown", board, "zip", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, ok := Encode(test.board, test.encoding, test.base); ok {
+				t.Fatal("encoded a board that can't be")
+			}
+		})
+	}
+}
+
+// TestDeltaBase checks a Delta decoded from a board other than the one it is from is caught: by its Base when the
+// boards differ, which is what a receiver checks first, by the board's checksum should it be decoded anyway, and
+// with Stale when the boards aren't the same size.
+func TestDeltaBase(t *testing.T) {
+	base := randomBoard(32, 32, 3, false, 1)
+	board := changed(base, 20, 2)
+	encoded, ok := Encode(board, Delta, base)
+	if !ok {
+		t.Fatal("couldn't encode the delta")
+	}
+	encoded.Base = Sum(base)
+
+	other := changed(base, 1, 3)
+	if encoded.Base.Same(Sum(other)) {
+		t.Fatal("the delta's base has the same checksum as a different board")
+	}
+	if !encoded.Base.Same(Sum(base)) {
+		t.Fatal("the delta's base doesn't have the checksum of the board it is from")
+	}
+	if (*Checksum)(nil).Same(nil) {
+		t.Fatal("boards without checksums are the same")
+	}
+	decoded, err := encoded.Decode(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sum(board).Verify(decoded); Code(err) != Corrupted {
+		t.Fatalf("a delta decoded from the wrong board verified with %v, want Corrupted", err)
+	}
+
+	for _, wrong := range [][][]uint8{nil, base[:31], randomBoard(31, 32, 3, false, 4)} {
+		if _, err := encoded.Decode(wrong); Code(err) != Stale {
+			t.Fatalf("a delta decoded from a board of %d rows gave %v, want Stale", len(wrong), err)
+		}
+	}
+}
+
+// TestDecodeCorrupt checks truncated or corrupt data fails with Corrupted rather than decoding or panicking.
+func TestDecodeCorrupt(t *testing.T) {
+	board := randomBoard(16, 16, 10, false, 1)
+	bits, _ := Encode(board, BitPacked, nil)
+	sparse, _ := Encode(board, Sparse, nil)
+	tests := []struct {
+		name    string
+		encoded EncodedBoard
+	}{
+		{"bits truncated", EncodedBoard{Encoding: BitPacked, Width: 16, Height: 16, Data: bits.Data[:len(bits.Data)-1]}},
+		{"bits too long", EncodedBoard{Encoding: BitPacked, Width: 16, Height: 16, Data: append(bits.Data, 0)}},
+		{"bits for a larger board", EncodedBoard{Encoding: BitPacked, Width: 16, Height: 17, Data: bits.Data}},
+		{"sparse value missing", EncodedBoard{Encoding: Sparse, Width: 16, Height: 16, Data: sparse.Data[:len(sparse.Data)-1]}},
+		{"sparse gap truncated", EncodedBoard{Encoding: Sparse, Width: 16, Height: 16, Data: []byte{0x80}}},
+		{"sparse cell beyond the board", EncodedBoard{Encoding: Sparse, Width: 16, Height: 16, Data: []byte{0x80, 0x02, 255}}},
+		{"sparse for a smaller board", EncodedBoard{Encoding: Sparse, Width: 4, Height: 4, Data: sparse.Data}},
+		{"negative size", EncodedBoard{Encoding: Sparse, Width: -1, Height: 16}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.encoded.Decode(nil); Code(err) != Corrupted {
+				t.Fatalf("got %v, want Corrupted", err)
+			}
+		})
+	}
+	if _, err := (&EncodedBoard{Encoding: "zip"}).Decode(nil); Code(err) != InvalidParams {
+		t.Fatalf("unknown encoding gave %v, want InvalidParams", err)
+	}
+}
+
+// TestChooseEncoding checks the encoding chosen follows how many cells are alive or changed, and how fast the link
+// has been measured to be.
+func TestChooseEncoding(t *testing.T) {
+	const cells = 512 * 512
+	all := Encodings{BitPacked, Sparse, Delta}
+	tests := []struct {
+		name           string
+		allowed        Encodings
+		nonDead        int
+		changed        int
+		bytesPerSecond float64
+		want           Encoding
+	}{
+		{"unmeasured dense board", all, cells / 2, cells / 2, 0, BitPacked},
+		{"unmeasured sparse board", all, cells / 100, cells / 2, 0, Sparse},
+		{"unmeasured few changes", all, cells / 2, cells / 1000, 0, Delta},
+		{"unmeasured only dense allowed", nil, cells / 100, cells / 1000, 0, Dense},
+		{"unmeasured delta not allowed", Encodings{BitPacked, Sparse}, cells / 2, 10, 0, BitPacked},
+		{"slow link dense board", all, cells / 2, cells / 2, 1e6, BitPacked},
+		{"slow link sparse board", all, cells / 100, cells / 2, 1e6, Sparse},
+		{"slow link few changes", all, cells / 2, 100, 1e6, Delta},
+		{"fast link", all, cells / 2, cells / 2, 1e12, Dense},
+		{"fast link few changes", all, cells / 2, 100, 1e12, Dense},
+		{"medium link", all, cells / 2, cells / 2, 1e8, BitPacked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ChooseEncoding(test.allowed, cells, test.nonDead, test.changed, test.bytesPerSecond)
+			if got != test.want {
+				t.Fatalf("chose %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	// as a board fills up, the encoding chosen should move from Sparse to BitPacked and stay there
+	last := Sparse
+	for nonDead := 0; nonDead <= cells; nonDead += cells / 64 {
+		got := ChooseEncoding(Encodings{BitPacked, Sparse}, cells, nonDead, cells, 1e7)
+		if got != last && !(last == Sparse && got == BitPacked) {
+			t.Fatalf("chose %s after %s with %d cells alive", got, last, nonDead)
+		}
+		last = got
+	}
+	if last != BitPacked {
+		t.Fatalf("chose %s for a full board", last)
+	}
+
+	// as the link gets faster, packing stops being worth it
+	last = BitPacked
+	for bytesPerSecond := 1e5; bytesPerSecond <= 1e13; bytesPerSecond *= 10 {
+		got := ChooseEncoding(Encodings{BitPacked}, cells, cells/2, cells, bytesPerSecond)
+		if got != last && !(last == BitPacked && got == Dense) {
+			t.Fatalf("chose %s after %s at %g bytes a second", got, last, bytesPerSecond)
+		}
+		last = got
+	}
+	if last != Dense {
+		t.Fatalf("chose %s for the fastest link", last)
+	}
+}
+
+// TestParseEncodings checks lists of encodings are read, and unknown ones refused.
+func TestParseEncodings(t *testing.T) {
+	encodings, err := ParseEncodings(" bits, sparse,,delta ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(encodings, Encodings{BitPacked, Sparse, Delta}) {
+		t.Fatalf("got %v", encodings)
+	}
+	if _, err := ParseEncodings("bits,zip"); err == nil {
+		t.Fatal("accepted an unknown encoding")
+	}
+}
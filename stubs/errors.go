@@ -0,0 +1,94 @@
+package stubs
+
+import (
+	"fmt"
+	"net/rpc"
+)
+
+// ErrorCode says what kind of failure an RPC had, so callers can react to it without reading the message
+type ErrorCode string
+
+const (
+	NoGame            ErrorCode = "NoGame"            // there is no game, or not the one asked about
+	AlreadyRunning    ErrorCode = "AlreadyRunning"    // the broker is already running as many games as it can
+	WorkerUnavailable ErrorCode = "WorkerUnavailable" // a worker couldn't be reached or failed a turn
+	InvalidParams     ErrorCode = "InvalidParams"     // the request asks for something that can't be done
+	Draining          ErrorCode = "Draining"          // the broker is closing down and won't take new work
+	DeadlineExceeded  ErrorCode = "DeadlineExceeded"  // the request's deadline passed before it could be answered
+	Corrupted         ErrorCode = "Corrupted"         // a board arrived damaged, so the call should be made again
+	Stale             ErrorCode = "Stale"             // a board was sent as a delta from one the receiver doesn't have, so should be sent whole
+	Internal          ErrorCode = "Internal"          // anything else, such as a disk failing
+)
+
+// Error is a failed call, sent back in the response's Header rather than as an RPC error,
+// which net/rpc would turn into a plain string
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Errorf makes an error with a code
+func Errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WithCode gives an error a code, keeping the code of one that already has one, and leaving nil as nil
+func WithCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Code: code, Message: err.Error()}
+}
+
+// Code gives the code of an error returned by Call
+// An error from the connection itself, such as the broker having gone away, has no code, so gives "".
+func Code(err error) ErrorCode {
+	if coded, ok := err.(*Error); ok {
+		return coded.Code
+	}
+	return ""
+}
+
+// Fail records an RPC handler's error in the response, so it reaches the caller with its code
+// Handlers defer it on their response and return what it gives back, which is always nil.
+func (header *Header) Fail(err error) error {
+	if err != nil {
+		header.Error = WithCode(Internal, err).(*Error)
+	}
+	return nil
+}
+
+// Err gives the error recorded in a response, or nil if the call succeeded
+func (header *Header) Err() error {
+	if header.Error == nil {
+		return nil
+	}
+	return header.Error
+}
+
+// Reply is a response that can carry an error, which is any response embedding a Header
+type Reply interface {
+	Err() error
+	clearError()
+}
+
+// clearError forgets the error of an earlier call, since a reused response keeps fields the next reply leaves out
+func (header *Header) clearError() {
+	header.Error = nil
+}
+
+// Call makes an RPC and gives back either the connection's error or the one recorded in the response
+func Call(client *rpc.Client, method string, request interface{}, response Reply) error {
+	response.clearError()
+	if err := client.Call(method, request, response); err != nil {
+		return err
+	}
+	return response.Err()
+}
@@ -0,0 +1,56 @@
+package stubs
+
+import "time"
+
+// StripRequest gives a worker the rows of a halo game's board it keeps from then on, in place of any it kept for the
+// game before, see StartGameRequest.Halo
+type StripRequest struct {
+	Header
+	StartY           int
+	EndY             int
+	Rows             [][]uint8 // the board's rows StartY to EndY
+	Checksum         *Checksum // of Rows
+	Width            int
+	Height           int
+	Rule             string
+	Edge             string
+	Turn             int // the turn the rows are from
+	OriginX          int
+	OriginY          int
+	Seed             int64
+	BirthProbability float64
+	DeathProbability float64
+}
+
+type StripResponse struct {
+	Header
+}
+
+// HaloRequest asks a worker to advance the strip it keeps for a halo game by a turn, given the rows around it
+type HaloRequest struct {
+	Header
+	Turn  int       // the turn being worked out, which the strip must have got to already
+	Above [][]uint8 // the rule's radius of rows above the strip, as the board's edge makes them, dead beyond a dead edge
+	Below [][]uint8 // and below it
+}
+
+type HaloResponse struct {
+	Header
+	Top     [][]uint8 // the strip's first rows once advanced, the rule's radius of them, for its neighbours' halos
+	Bottom  [][]uint8 // and its last rows
+	Births  int
+	Deaths  int
+	Compute time.Duration
+}
+
+// FetchStripRequest asks a worker for the rows of the strip it keeps for a halo game, so the broker has the whole board
+type FetchStripRequest struct {
+	Header
+	Turn int // the turn the strip should have got to
+}
+
+type FetchStripResponse struct {
+	Header
+	Rows     [][]uint8
+	Checksum *Checksum // of Rows
+}
@@ -0,0 +1,40 @@
+package stubs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Header identifies a request and the game it is about
+// Every request carries one, and every response echoes the request's, so calls can be routed to the right game,
+// matched up across the controller, broker and worker logs, and retries spotted as duplicates.
+type Header struct {
+	GameID    string    // empty for requests that aren't about a game, such as Version
+	RequestID string    // unique to each request, but kept the same when a request is retried
+	Error     *Error    // why the call failed, only ever set on responses
+	Deadline  time.Time // when the caller stops waiting for an answer, zero for no deadline
+}
+
+// NewID makes a random identifier for a game or request
+func NewID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// NewHeader makes the header for a new request about a game
+func NewHeader(gameID string) Header {
+	return Header{GameID: gameID, RequestID: NewID()}
+}
+
+// Within gives the header a deadline the given time from now
+func (header Header) Within(timeout time.Duration) Header {
+	header.Deadline = time.Now().Add(timeout)
+	return header
+}
+
+// Expired reports whether the request's deadline has passed, which it never has for one without a deadline
+func (header Header) Expired() bool {
+	return !header.Deadline.IsZero() && time.Now().After(header.Deadline)
+}
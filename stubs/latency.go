@@ -0,0 +1,19 @@
+package stubs
+
+import "time"
+
+// LatencyRequest asks a worker how long it takes to reach each of the other workers
+type LatencyRequest struct {
+	Header
+	Addresses []string
+}
+
+// LatencyResponse gives the round trip time to each address in the request, in the same order
+// An address that couldn't be reached is given Unreachable.
+type LatencyResponse struct {
+	Header
+	Latencies []time.Duration
+}
+
+// Unreachable is the latency given to a worker that couldn't be reached at all
+const Unreachable = time.Hour
@@ -0,0 +1,105 @@
+package stubs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// method is an RPC served by the broker or a worker, with the types of its request and response
+type method struct {
+	name     string // in net/rpc's Service.Method form
+	request  interface{}
+	response interface{}
+}
+
+// Controller calls broker
+var (
+	startGame        = method{"SecretBrokerOperation.StartGame", StartGameRequest{}, new(StartGameResponse)}
+	aliveCellCount   = method{"SecretBrokerOperation.AliveCellCount", AliveCellCountRequest{}, new(AliveCellCountResponse)}
+	currentBoard     = method{"SecretBrokerOperation.CurrentBoard", CurrentBoardRequest{}, new(CurrentBoardResponse)}
+	closeBroker      = method{"SecretBrokerOperation.CloseBroker", CloseRequest{}, new(CloseResponse)}
+	pauseBroker      = method{"SecretBrokerOperation.PauseBroker", PauseRequest{}, new(PauseResponse)}
+	pause            = method{"SecretBrokerOperation.Pause", PauseRequest{}, new(PauseResponse)}
+	resume           = method{"SecretBrokerOperation.Resume", PauseRequest{}, new(PauseResponse)}
+	controllerClosed = method{"SecretBrokerOperation.ControllerClosed", CloseRequest{}, new(CloseResponse)}
+	census           = method{"SecretBrokerOperation.Census", CensusRequest{}, new(CensusResponse)}
+	runBatch         = method{"SecretBrokerOperation.RunBatch", BatchRequest{}, new(BatchResponse)}
+	brokerVersion    = method{"SecretBrokerOperation.Version", VersionRequest{}, new(VersionResponse)}
+	games            = method{"SecretBrokerOperation.Games", GamesRequest{}, new(GamesResponse)}
+	aliveCells       = method{"SecretBrokerOperation.AliveCells", AliveCellsRequest{}, new(AliveCellsResponse)}
+	brokerDiagnose   = method{"SecretBrokerOperation.Diagnostics", DiagnosticsRequest{}, new(DiagnosticsResponse)}
+	validate         = method{"SecretBrokerOperation.Validate", ValidateRequest{}, new(ValidateResponse)}
+	snapshot         = method{"SecretBrokerOperation.Snapshot", SnapshotRequest{}, new(SnapshotResponse)}
+	heartbeat        = method{"SecretBrokerOperation.Heartbeat", HeartbeatRequest{}, new(HeartbeatResponse)}
+	brokerHello      = method{"SecretBrokerOperation.Hello", HelloRequest{}, new(HelloResponse)}
+	status           = method{"SecretBrokerOperation.Status", StatusRequest{}, new(StatusResponse)}
+	turnStats        = method{"SecretBrokerOperation.TurnStats", TurnStatsRequest{}, new(TurnStatsResponse)}
+	history          = method{"SecretBrokerOperation.History", HistoryRequest{}, new(HistoryResponse)}
+	setCells         = method{"SecretBrokerOperation.SetCells", SetCellsRequest{}, new(SetCellsResponse)}
+	injectPattern    = method{"SecretBrokerOperation.InjectPattern", InjectPatternRequest{}, new(SetCellsResponse)}
+	getRegion        = method{"SecretBrokerOperation.GetRegion", RegionRequest{}, new(RegionResponse)}
+	watchRegion      = method{"SecretBrokerOperation.WatchRegion", WatchRequest{}, new(WatchResponse)}
+	getTurnDiff      = method{"SecretBrokerOperation.GetTurnDiff", TurnDiffRequest{}, new(TurnDiffResponse)}
+	bookmark         = method{"SecretBrokerOperation.Bookmark", BookmarkRequest{}, new(BookmarkResponse)}
+	jumpToBookmark   = method{"SecretBrokerOperation.JumpToBookmark", BookmarkRequest{}, new(BookmarkResponse)}
+	bookmarks        = method{"SecretBrokerOperation.Bookmarks", BookmarkRequest{}, new(BookmarkResponse)}
+	writeTurn        = method{"SecretBrokerOperation.WriteTurn", WriteTurnRequest{}, new(WriteTurnResponse)}
+)
+
+// Worker calls broker
+var registerWorker = method{"SecretBrokerOperation.RegisterWorker", RegisterWorkerRequest{}, new(RegisterWorkerResponse)}
+
+// Broker calls worker
+var (
+	advanceSection = method{"SecretWorkerOperation.AdvanceSection", WorkerRequest{}, new(WorkerResponse)}
+	closeWorker    = method{"SecretWorkerOperation.CloseWorker", CloseRequest{}, new(CloseResponse)}
+	workerVersion  = method{"SecretWorkerOperation.Version", VersionRequest{}, new(VersionResponse)}
+	measureLatency = method{"SecretWorkerOperation.MeasureLatency", LatencyRequest{}, new(LatencyResponse)}
+	workerDiagnose = method{"SecretWorkerOperation.Diagnostics", DiagnosticsRequest{}, new(Diagnostics)}
+	workerHello    = method{"SecretWorkerOperation.Hello", HelloRequest{}, new(HelloResponse)}
+	writeSection   = method{"SecretWorkerOperation.WriteSection", WriteSectionRequest{}, new(WriteSectionResponse)}
+	loadStrip      = method{"SecretWorkerOperation.LoadStrip", StripRequest{}, new(StripResponse)}
+	advanceStrip   = method{"SecretWorkerOperation.AdvanceStrip", HaloRequest{}, new(HaloResponse)}
+	fetchStrip     = method{"SecretWorkerOperation.FetchStrip", FetchStripRequest{}, new(FetchStripResponse)}
+)
+
+var brokerMethods = []method{startGame, aliveCellCount, currentBoard, closeBroker, pauseBroker, pause, resume,
+	controllerClosed, census, runBatch, brokerVersion, games, aliveCells, brokerDiagnose, validate, snapshot, heartbeat,
+	brokerHello, status, turnStats, history, setCells, injectPattern, getRegion, watchRegion, getTurnDiff,
+	bookmark, jumpToBookmark, bookmarks, writeTurn, registerWorker}
+
+var workerMethods = []method{advanceSection, closeWorker, workerVersion, measureLatency, workerDiagnose, workerHello, writeSection,
+	loadStrip, advanceStrip, fetchStrip}
+
+// CheckBroker makes sure the broker's RPC receiver serves every method the Broker client calls, taking the same
+// request and response types, so a renamed or changed handler stops the broker starting rather than failing
+// the first call made to it
+func CheckBroker(receiver interface{}) error {
+	return checkRegistered(receiver, brokerMethods)
+}
+
+// CheckWorker makes sure the worker's RPC receiver serves every method the Worker client calls, like CheckBroker
+func CheckWorker(receiver interface{}) error {
+	return checkRegistered(receiver, workerMethods)
+}
+
+func checkRegistered(receiver interface{}, methods []method) error {
+	receiverType := reflect.TypeOf(receiver)
+	service := reflect.Indirect(reflect.ValueOf(receiver)).Type().Name()
+	for _, m := range methods {
+		names := strings.SplitN(m.name, ".", 2)
+		if names[0] != service {
+			return fmt.Errorf("%s is served by %s, not %s", m.name, names[0], service)
+		}
+		handler, ok := receiverType.MethodByName(names[1])
+		if !ok {
+			return fmt.Errorf("%s isn't served, as %s has no %s method", m.name, service, names[1])
+		}
+		handlerType := handler.Type // the receiver is the first argument
+		if handlerType.NumIn() != 3 || handlerType.In(1) != reflect.TypeOf(m.request) || handlerType.In(2) != reflect.TypeOf(m.response) {
+			return fmt.Errorf("%s is served as %v, but clients call it with (%T, %T)", m.name, handlerType, m.request, m.response)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !quic
+
+package stubs
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// errNoQUIC is given for QUIC addresses by builds without QUIC, which leave github.com/quic-go/quic-go out
+var errNoQUIC = errors.New("this gol wasn't built with QUIC, build it with go build -tags quic")
+
+func dialQUIC(address string, timeout time.Duration) (net.Conn, error) {
+	return nil, errNoQUIC
+}
+
+// ListenQUIC fails, as QUIC isn't built in
+func ListenQUIC(address string) (net.Listener, error) {
+	return nil, errNoQUIC
+}
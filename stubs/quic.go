@@ -0,0 +1,179 @@
+//go:build quic
+
+package stubs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// quicProtocol is the ALPN protocol both ends of a QUIC connection agree on, so nothing else is mistaken for gol
+const quicProtocol = "gol"
+
+// quicConfig keeps QUIC connections between calls alive across the long gaps of a game that is paused or waiting for
+// workers, and gives up on a peer that has gone quiet for longer than the broker's heartbeats allow
+var quicConfig = &quic.Config{KeepAlivePeriod: 10 * time.Second, MaxIdleTimeout: time.Minute}
+
+// quicConn is a QUIC connection carrying a single stream, which stands in for a TCP connection
+// Everything gol sends between two processes goes on the one stream, multiplexed as over TCP if both ends can, so
+// QUIC's own streams aren't needed. What QUIC adds is recovering from lost packets without holding up the stream
+// behind them as long as TCP does, and carrying on when a peer's address changes, such as a NAT rebinding.
+type quicConn struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the whole connection, rather than only the stream's sending side as closing a stream does
+func (c *quicConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+// dialQUIC connects to the broker or worker listening for QUIC at address, giving up after timeout unless it is 0
+// Listeners make their own certificates, so there is no authority to check them against. Instead the address gives
+// the fingerprint of the certificate the listener printed, and any other is refused. Addresses without one are only
+// dialled with QUICInsecure, as then QUIC encrypts the connection but doesn't stop something else answering.
+func dialQUIC(address string, timeout time.Duration) (net.Conn, error) {
+	address, fingerprint := SplitFingerprint(address)
+	if fingerprint == "" && !QUICInsecure {
+		return nil, fmt.Errorf("QUIC address %s has no certificate fingerprint, give it as %s%s#<fingerprint> as the listener printed it, or dial it with -quicInsecure", address, QUICPrefix, address)
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{quicProtocol}} // checked by fingerprint instead
+	if fingerprint != "" {
+		tlsConfig.VerifyPeerCertificate = func(certificates [][]byte, _ [][]*x509.Certificate) error {
+			if len(certificates) == 0 || fingerprintOf(certificates[0]) != fingerprint {
+				return fmt.Errorf("certificate at %s doesn't have fingerprint %s", address, fingerprint)
+			}
+			return nil
+		}
+	}
+	conn, err := quic.DialAddr(ctx, address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+	return &quicConn{Stream: stream, conn: conn}, nil
+}
+
+// quicListener accepts QUIC connections as if they were TCP connections, each once the dialler has opened its stream
+type quicListener struct {
+	listener    *quic.Listener
+	fingerprint string // of the listener's certificate, for its address
+	conns       chan net.Conn
+	failed      chan struct{} // closed once the listener stops accepting connections, with err set
+	err         error
+}
+
+// ListenQUIC listens for QUIC over UDP at address, with a certificate made up for the purpose
+func ListenQUIC(address string) (net.Listener, error) {
+	certificate, err := selfSigned()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: []string{quicProtocol}}
+	listener, err := quic.ListenAddr(address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	l := &quicListener{listener: listener, fingerprint: fingerprintOf(certificate.Certificate[0]), conns: make(chan net.Conn), failed: make(chan struct{})}
+	go l.accept()
+	return l, nil
+}
+
+// accept accepts connections until the listener is closed, handing each on once its stream has been opened, so a
+// dialler that never opens one doesn't hold up the rest
+func (l *quicListener) accept() {
+	for {
+		conn, err := l.listener.Accept(context.Background())
+		if err != nil {
+			l.err = err
+			close(l.failed)
+			return
+		}
+		go func() {
+			stream, err := conn.AcceptStream(conn.Context())
+			if err != nil {
+				_ = conn.CloseWithError(0, "")
+				return
+			}
+			select {
+			case l.conns <- &quicConn{Stream: stream, conn: conn}:
+			case <-l.failed:
+				_ = conn.CloseWithError(0, "")
+			}
+		}()
+	}
+}
+
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.failed:
+		return nil, l.err
+	}
+}
+
+func (l *quicListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *quicListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Fingerprint gives the fingerprint of the listener's certificate, which others dial it with
+func (l *quicListener) Fingerprint() string {
+	return l.fingerprint
+}
+
+// fingerprintOf gives the SHA-256 of a certificate in hex
+func fingerprintOf(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	return hex.EncodeToString(sum[:])
+}
+
+// selfSigned makes a certificate for a QUIC listener, which QUIC needs to encrypt its connections
+func selfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "gol"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(10, 0, 0)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,119 @@
+//go:build quic
+
+package stubs
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenQUIC listens for QUIC on a local port, giving the listener and the address it is dialled with, fingerprint
+// and all
+func listenQUIC(t *testing.T) (net.Listener, string) {
+	listener, err := ListenQUIC("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	fingerprint := listener.(interface{ Fingerprint() string }).Fingerprint()
+	return listener, QUICPrefix + listener.Addr().String() + "#" + fingerprint
+}
+
+// TestQUICEcho checks what is written over a QUIC connection arrives at the listener, and what it writes back comes
+// back, on more than one connection at once.
+func TestQUICEcho(t *testing.T) {
+	listener, address := listenQUIC(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := DialConn(address, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i, conn := range conns {
+		sent := bytes.Repeat([]byte{byte('a' + i)}, 100000)
+		go func() { _, _ = conn.Write(sent) }()
+		received := make([]byte, len(sent))
+		if _, err := io.ReadFull(conn, received); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(received, sent) {
+			t.Fatalf("connection %d echoed different bytes", i)
+		}
+	}
+}
+
+// TestQUICFingerprint checks a listener whose certificate doesn't have the fingerprint in the address is refused,
+// and that addresses without one are only dialled when QUICInsecure says to.
+func TestQUICFingerprint(t *testing.T) {
+	listener, address := listenQUIC(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	unpinned, _ := SplitFingerprint(address)
+	wrong := unpinned + "#" + strings.Repeat("00", 32)
+	if conn, err := DialConn(wrong, 5*time.Second); err == nil {
+		_ = conn.Close()
+		t.Fatal("dialled a listener with the wrong fingerprint")
+	}
+	if conn, err := DialConn(unpinned, 5*time.Second); err == nil {
+		_ = conn.Close()
+		t.Fatal("dialled an address without a fingerprint")
+	}
+	QUICInsecure = true
+	defer func() { QUICInsecure = false }()
+	conn, err := DialConn(unpinned, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dialling an address without a fingerprint with QUICInsecure: %v", err)
+	}
+	_ = conn.Close()
+}
+
+// TestQUICCall checks a client's calls reach a broker listening for QUIC and are answered.
+func TestQUICCall(t *testing.T) {
+	broker := &damagingBroker{calls: make(map[string]int)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("SecretBrokerOperation", broker); err != nil {
+		t.Fatal(err)
+	}
+	listener, address := listenQUIC(t)
+	go server.Accept(listener)
+	client, err := Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	response := new(CurrentBoardResponse)
+	if err = client.Call(currentBoard.name, CurrentBoardRequest{}, response); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(response.Board, testBoard) {
+		t.Fatalf("got board %v, want %v", response.Board, testBoard)
+	}
+}
@@ -0,0 +1,17 @@
+package stubs
+
+// RegionRequest asks for a rectangle of the running game's board, Width by Height cells with its top left cell at
+// X, Y, where 0,0 is the top left cell of the starting board even once the board has grown. Cells beyond the board
+// are sent as dead.
+type RegionRequest struct {
+	Header
+	X, Y          int
+	Width, Height int
+}
+
+type RegionResponse struct {
+	Header
+	Cells          [][]uint8
+	Checksum       *Checksum // of Cells
+	CompletedTurns int
+}
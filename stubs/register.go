@@ -0,0 +1,15 @@
+package stubs
+
+// RegisterWorkerRequest announces a worker to the broker, which adds it to the workers it splits games between once
+// it has dialled it back. Workers started with -register announce themselves again every few seconds, so a broker
+// that restarts, or forgot them while they couldn't be reached, learns of them again.
+type RegisterWorkerRequest struct {
+	Header
+	Address string // where the broker can dial the worker
+}
+
+type RegisterWorkerResponse struct {
+	Header
+	New     bool     // whether the broker didn't already have the worker
+	Workers []string // every worker the broker now has
+}
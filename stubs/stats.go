@@ -0,0 +1,38 @@
+package stubs
+
+// TurnStats is how a turn changed the board, for following a game more closely than its alive count
+type TurnStats struct {
+	Turn       int     // the turn the board is after
+	Population int     // alive cells
+	Births     int     // cells that came alive during the turn
+	Deaths     int     // cells that died during the turn
+	Density    float64 // fraction of the board's cells that are alive
+}
+
+// TurnStatsRequest asks for the statistics of the running game's last turn
+type TurnStatsRequest struct {
+	Header
+}
+
+type TurnStatsResponse struct {
+	Header
+	TurnStats
+}
+
+// HistoryRequest asks for a range of a game's turn statistics, which the broker keeps for its last few games
+// Long ranges are read a page at a time, passing the Next of each page as the From of the one after it.
+type HistoryRequest struct {
+	Header     // GameID is the game, the broker's current game if empty
+	From   int // first turn wanted, which is moved on to the earliest turn kept if it is older
+	To     int // last turn wanted, the latest turn recorded if 0
+	Limit  int // most turns to send back
+}
+
+type HistoryResponse struct {
+	Header
+	Turns    []TurnStats // oldest first
+	Earliest int         // the oldest turn that can be fetched
+	Latest   int         // the newest turn recorded so far
+	Next     int         // where the next page starts
+	Finished bool        // whether the game has finished, so no more turns will be recorded
+}
@@ -1,42 +1,230 @@
 package stubs
 
 import (
+	"time"
+
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
-// Distributor calls broker
-var StartGameHandler = "SecretBrokerOperation.StartGame"
-var AliveCellCountHandler = "SecretBrokerOperation.AliveCellCount"
-var CurrentBoardHandler = "SecretBrokerOperation.CurrentBoard"
-var CloseBrokerHandler = "SecretBrokerOperation.CloseBroker"
-var PauseBrokerHandler = "SecretBrokerOperation.PauseBroker"
-var ControllerClosedHandler = "SecretBrokerOperation.ControllerClosed"
+// Reasons a game can stop before reaching its turn count
+// A game stopped by one of the request's StopConditions gives the condition's description instead.
+const (
+	StopExtinct  = "extinct"  // no cells are alive
+	StopStable   = "stable"   // the board is the same as it was last turn
+	StopCycle    = "cycling"  // the board is repeating a cycle of earlier turns
+	StopDeadline = "deadline" // the deadline of the request that started the game passed
+)
+
+// Engines a game can be run with
+const (
+	EngineWorkers  = "workers"  // every turn is split between the workers, best for dense or random boards
+	EngineHashLife = "hashlife" // the broker jumps whole powers of two turns at once, best for huge structured patterns
+)
+
+// StartGameRequest gives the broker a board to run and how to run it
+type StartGameRequest struct {
+	Header
+	StartingBoard        [][]uint8
+	Checksum             *Checksum // of StartingBoard
+	Height               int
+	Width                int
+	Turns                int
+	Rule                 string // rulestring in B/S notation, e.g. B36/S23
+	Edge                 string // edge behaviour: toroidal, dead or mirrored
+	Seed                 int64  // seed for the random births and deaths
+	BirthProbability     float64
+	DeathProbability     float64
+	IncludeAges          bool            // send back the age of every cell with the board
+	StopEarly            bool            // stop once the board is empty or stops changing
+	CycleWindow          int             // how many previous turns to check for repeats, 0 to not look for cycles
+	Census               bool            // take a census of the objects on the final board
+	StopConditions       []StopCondition // stop once any of these hold
+	Expand               bool            // grow the board whenever cells get close to its edge, rather than wrapping
+	TileSize             int             // store the board as tiles of this size, mostly on disk, 0 to keep it all in memory
+	Engine               string          // how turns are worked out, EngineWorkers if empty
+	TargetTurnsPerSecond float64         // throughput to recommend a number of workers for, 0 for no recommendation
+	Autoscale            bool            // change the number of workers to match the recommendation
+	PageAliveCells       bool            // leave AliveCells out of the response, to be fetched a page at a time instead
+	Detach               bool            // finish the game on the broker, writing its board there, if the controller goes
+	StopRunning          bool            // stop the game the broker is running to start this one, if it allows that
+	StartTurn            int             // the turn StartingBoard is from, when carrying on with a game, 0 for a new one
+	TimeTurns            bool            // send back where the time of every turn went, see TurnTiming
+	Heatmap              bool            // count how often each cell comes alive or dies, sent back as Flips
+	SharedImage          bool            // have the workers write the finished board to the broker's shared directory, sent back as ImagePath
+	Priority             int             // share of the workers while other games want them, each level up doubling it, 0 for an equal share
+	Halo                 bool            // have each worker keep its strip of the board between turns, sent only the rows around it, see StripRequest
+	StreamTurns          bool            // keep the cells each turn changes, to be fetched with GetTurnDiff
+}
+
+// StartGameResponse is the board once the game has finished, and how it got there
+type StartGameResponse struct {
+	Header
+	FinishedBoard  [][]uint8
+	Checksum       *Checksum // of FinishedBoard
+	CompletedTurns int
+	AliveCells     []util.Cell     // empty if PageAliveCells was requested, see AliveCellsRequest
+	AliveCount     int             // number of alive cells, sent even when AliveCells isn't
+	Ages           [][]uint32      // turns each cell has been alive for, only sent if IncludeAges was requested
+	MeanAge        float64         // mean age of the alive cells
+	MaxAge         uint32          // age of the oldest alive cell
+	StopReason     string          // why the game stopped before its turn count, empty if it didn't
+	CycleStart     int             // the turn the board started repeating from
+	CyclePeriod    int             // how many turns the board takes to repeat, 0 if no cycle has been found
+	Census         map[string]int  // how many of each known object are on the board, if a census was taken
+	Width, Height  int             // size of the board, bigger than requested if it has grown in expanding mode
+	OriginX        int             // where the top left of the starting board is on a board that has grown,
+	OriginY        int             // so AliveCells are relative to this point
+	ImagePath      string          // where the broker wrote the board itself, for tiled boards too big to send back
+	WorkerMetrics  []WorkerMetrics // how each worker the game used performed, in the order they were first used
+	Elapsed        time.Duration   // how long the broker took over the game, from the request arriving to answering it
+	TurnTimings    []TurnTiming    // where the time of each turn went, if TimeTurns was requested
+	Flips          [][]uint32      // how many times each cell came alive or died over the game, if Heatmap was requested
+}
+
+// AliveCellCountRequest asks for the running game's statistics, without its board
+type AliveCellCountRequest struct {
+	Header
+}
+
+type AliveCellCountResponse struct {
+	Header
+	CompletedTurns     int
+	AliveCount         int
+	MeanAge            float64 // mean age of the alive cells
+	MaxAge             uint32  // age of the oldest alive cell
+	CycleStart         int     // the turn the board started repeating from
+	CyclePeriod        int     // how many turns the board takes to repeat, 0 if no cycle has been found yet
+	TurnsPerSecond     float64 // throughput measured over the last few seconds, if a target was given
+	RecommendedWorkers int     // workers needed to reach the target, 0 until throughput has been measured
+	ActiveWorkers      int     // workers the game is using
+	Degraded           bool    // waiting for at least MinWorkers workers to be healthy before carrying on
+	MinWorkers         int     // fewest healthy workers the broker carries on with, 0 if it has no minimum
+}
+
+// CurrentBoardRequest asks for the running game's board as it is now
+type CurrentBoardRequest struct {
+	Header
+	IncludeAges bool // send back the age of every cell with the board
+}
+
+type CurrentBoardResponse struct {
+	Header
+	Board          [][]uint8
+	Checksum       *Checksum // of Board
+	CompletedTurns int
+	Ages           [][]uint32 // only sent if IncludeAges was requested
+	Width, Height  int
+	OriginX        int    // where the top left of the starting board is on a board that has grown,
+	OriginY        int    // so Ages line up with AliveCells from StartGame
+	ImagePath      string // where the broker wrote the board itself, for tiled boards too big to send back
+}
+
+// PauseAction says whether a PauseRequest wants the game paused or running
+type PauseAction string
+
+const (
+	TogglePause PauseAction = ""       // pause a running game or resume a paused one, as older clients expect
+	PauseGame   PauseAction = "pause"  // pause the game, doing nothing if it's already paused
+	ResumeGame  PauseAction = "resume" // carry on with the game, doing nothing if it's already running
+)
+
+// PauseRequest pauses the running game or carries on with it
+// Action is only read by PauseBroker, where clients should ask for PauseGame or ResumeGame, so a retried
+// request can't undo the first.
+type PauseRequest struct {
+	Header
+	Action PauseAction
+}
+
+type PauseResponse struct {
+	Header
+	CompletedTurns int  // the turn the board has reached, which a paused game stays at
+	Paused         bool // whether the game is now paused
+}
 
-// Broker calls worker
-var AdvanceSection = "SecretWorkerOperation.AdvanceSection"
-var CloseWorkerHandler = "SecretWorkerOperation.CloseWorker"
+// CensusRequest asks for a census of the objects on the running game's board
+type CensusRequest struct {
+	Header
+}
 
-type Response struct {
-	FinishedBoard [][]uint8
+type CensusResponse struct {
+	Header
 	CompletedTurns int
-	AliveCells []util.Cell
+	Census         map[string]int
 }
 
-type Request struct {
-	StartingBoard [][]uint8
-	Height int
-	Width int
-	Turns int
+// CloseRequest tells the broker or a worker to close, or the broker that the controller has gone
+type CloseRequest struct {
+	Header
+}
+
+type CloseResponse struct {
+	Header
+	Skipped []string // what the broker couldn't close, and why, such as workers that had already gone
+}
+
+// VersionRequest asks the broker or a worker which version it is running
+type VersionRequest struct {
+	Header
+}
+
+// VersionResponse tells a client which version of gol the broker or worker is running
+type VersionResponse struct {
+	Header
+	Version string
+	Workers []string // addresses of the workers the broker uses, empty from a worker
 }
 
 type WorkerResponse struct {
+	Header
 	AdvancedMiniBoard [][]uint8
+	Checksum          *Checksum     // of AdvancedMiniBoard
+	Births, Deaths    int           // cells in the section that came alive and died, from workers with TurnStatistics
+	Compute           time.Duration // how long the worker took to advance the section, 0 from older workers
+	Shared            bool          // the section was written to the request's SharedAdvanced rather than sent back
+	Section           *EncodedBoard // the section, sent instead of AdvancedMiniBoard in one of the request's Encodings
 }
 
 type WorkerRequest struct {
-	StartY int
-	EndY int
-	CurrentBoard [][]uint8
-	Width int
-	Height int
+	Header
+	StartY           int
+	EndY             int
+	CurrentBoard     [][]uint8
+	Checksum         *Checksum // of CurrentBoard
+	Width            int
+	Height           int
+	Rule             string
+	Edge             string
+	Turn             int // the turn being computed, needed for the random births and deaths
+	OriginX          int // where the top left of the starting board now is, so the random births and deaths
+	OriginY          int // don't change when the board grows
+	Seed             int64
+	BirthProbability float64
+	DeathProbability float64
+	KeepSection      bool          // keep the advanced section until the game's next turn, for WriteSection
+	SharedBoard      string        // file in shared memory holding the board, sent instead of CurrentBoard to a worker on the same host
+	SharedAdvanced   string        // file in shared memory, the size of the board, to write the advanced section's rows into
+	Board            *EncodedBoard // the board, sent instead of CurrentBoard in an encoding the worker supports
+	Encodings        Encodings     // encodings the section can be sent back in, a Delta being from the request's board
+	BytesPerSecond   float64       // how fast the broker has found the link to the worker, for choosing between them
+}
+
+// SnapshotRequest pauses the game between turns and takes its board, so the board and its turn always match
+// The game carries on afterwards if Resume is set, unless it was already paused.
+type SnapshotRequest struct {
+	Header
+	IncludeAges bool
+	Resume      bool
+}
+type SnapshotResponse struct {
+	CurrentBoardResponse
+	Paused bool // whether the game is paused now the snapshot has been taken
+}
+
+// HeartbeatRequest tells the broker the game's controller is still there
+type HeartbeatRequest struct {
+	Header
+}
+type HeartbeatResponse struct {
+	Header
 }
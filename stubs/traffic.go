@@ -0,0 +1,75 @@
+package stubs
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Traffic is how many bytes have been sent and received on a client's connections, including any it has redialled
+type Traffic struct {
+	Sent     int64
+	Received int64
+}
+
+// countingConn is a connection adding the bytes it sends and receives to a client's Traffic
+type countingConn struct {
+	net.Conn
+	traffic *Traffic
+}
+
+func (conn countingConn) Read(b []byte) (int, error) {
+	n, err := conn.Conn.Read(b)
+	atomic.AddInt64(&conn.traffic.Received, int64(n))
+	return n, err
+}
+
+func (conn countingConn) Write(b []byte) (int, error) {
+	n, err := conn.Conn.Write(b)
+	atomic.AddInt64(&conn.traffic.Sent, int64(n))
+	return n, err
+}
+
+// Traffic gives how many bytes the client has sent and received so far
+func (c *Client) Traffic() Traffic {
+	return Traffic{Sent: atomic.LoadInt64(&c.traffic.Sent), Received: atomic.LoadInt64(&c.traffic.Received)}
+}
+
+// WorkerMetrics is how a worker performed over a game, for working out how well the game scaled
+// RoundTrip includes Compute, so the time spent sending sections and their results is the difference.
+type WorkerMetrics struct {
+	Address       string
+	Sections      int              // sections of turns the worker advanced
+	Cells         int              // cells in those sections
+	Compute       time.Duration    // time the worker spent advancing them, as it measured it
+	RoundTrip     time.Duration    // time from sending each section to getting it back, as the broker measured it
+	BytesSent     int64            // sent to the worker by the broker during the game
+	BytesReceived int64            // received from the worker by the broker during the game
+	Encodings     map[Encoding]int // how many boards were sent to the worker, and sections back, in each encoding
+}
+
+// Latency gives the mean time each section spent being sent to and from the worker, rather than advanced
+func (metrics WorkerMetrics) Latency() time.Duration {
+	if metrics.Sections == 0 {
+		return 0
+	}
+	return (metrics.RoundTrip - metrics.Compute) / time.Duration(metrics.Sections)
+}
+
+// BytesPerSection gives the mean bytes sent to and from the worker for each section, which is each turn it worked on
+func (metrics WorkerMetrics) BytesPerSection() int64 {
+	if metrics.Sections == 0 {
+		return 0
+	}
+	return (metrics.BytesSent + metrics.BytesReceived) / int64(metrics.Sections)
+}
+
+// TurnTiming is where the time the broker took over one turn went, for games whose turns are split between workers
+// The sections are advanced at once, so Compute and Network are those of the worker that came back last.
+type TurnTiming struct {
+	Turn       int           // the turn the board is after
+	Total      time.Duration // from the broker starting the turn to finishing it
+	Compute    time.Duration // the time the last worker back spent advancing its section
+	Network    time.Duration // the rest of that worker's round trip, sending it the section and getting it back
+	Reassembly time.Duration // putting the sections back together and checking the new board
+}
@@ -0,0 +1,26 @@
+package stubs
+
+import "time"
+
+// TurnDiffRequest waits for a game started with StreamTurns to change its board after the changes already sent, then
+// sends every turn's changes since. Next is the Next of the last response, 0 for the first call, which starts from
+// the game's starting board.
+type TurnDiffRequest struct {
+	Header
+	Next int
+	Wait time.Duration // how long to wait for a change before answering with none, at most a minute
+}
+
+// TurnDiff is the cells one turn changed, or that were changed between turns, such as by SetCells
+type TurnDiff struct {
+	Turn    int // the turn the board is at once the changes are made
+	Changes []CellChange
+}
+
+type TurnDiffResponse struct {
+	Header
+	Diffs []TurnDiff // oldest first
+	Board [][]uint8  // the whole board as of Turn instead, if the changes after Next are no longer kept
+	Turn  int
+	Next  int // what to ask for next
+}
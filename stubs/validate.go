@@ -0,0 +1,20 @@
+package stubs
+
+// ValidateRequest asks the broker whether it would run a game, without starting it
+// The game's StartingBoard can be left out, as only its size is checked.
+type ValidateRequest struct {
+	Header
+	Game StartGameRequest
+}
+
+// ValidateResponse says what the broker would do with a game
+type ValidateResponse struct {
+	Header
+	Problems           []string // every reason the game would be rejected, empty if it would run
+	Engine             string   // EngineWorkers or EngineHashLife
+	Tiled              bool
+	Workers            []string // the workers the game would be split between
+	UnreachableWorkers []string // workers that can't be reached now
+	ScaleWorkers       int      // workers the broker would start for the game, if it starts its own
+	MemoryBytes        int      // estimated broker memory the game's boards need
+}
@@ -0,0 +1,29 @@
+package stubs
+
+import "time"
+
+// CellChange is a cell inside a watched region that has changed, where 0,0 is the top left cell of the starting
+// board, like RegionRequest
+type CellChange struct {
+	X, Y  int
+	Value uint8 // what the cell is now
+}
+
+// WatchRequest waits until cells inside a region of the running game's board have changed since the last call with
+// the same WatchID, then sends the ones that did. A call without a WatchID starts a watch on the Width by Height
+// region at X, Y, sending every cell of it that isn't dead along with the WatchID to pass from then on.
+type WatchRequest struct {
+	Header
+	WatchID       string
+	X, Y          int
+	Width, Height int
+	Wait          time.Duration // how long to wait for a change before answering with none, at most a minute
+	Stop          bool          // stop watching, answering straight away
+}
+
+type WatchResponse struct {
+	Header
+	WatchID        string
+	Changes        []CellChange // every change since the last call, however many turns ago it was made
+	CompletedTurns int
+}
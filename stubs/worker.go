@@ -0,0 +1,89 @@
+package stubs
+
+import (
+	"net/rpc"
+)
+
+// Worker is a connection to a worker, with a method for each of its RPCs
+type Worker struct {
+	*Client
+}
+
+// DialWorker connects to the worker at address, which has to answer now
+func DialWorker(address string) (*Worker, error) {
+	client, err := Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Worker{client}, nil
+}
+
+// DialMultiplexed connects to a worker like DialWorker, but sends bulky calls on a stream of their own,
+// so control calls such as liveness checks aren't stuck behind a board being sent
+func DialMultiplexed(address string) (*Worker, error) {
+	client, err := dial(address, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Worker{client}, nil
+}
+
+// AdvanceSection works out the next turn of a slice of the board
+func (w *Worker) AdvanceSection(request WorkerRequest, response *WorkerResponse) error {
+	return w.Call(advanceSection.name, request, response)
+}
+
+// GoAdvanceSection works out the next turn of a slice of the board in the background, like Client's Go
+func (w *Worker) GoAdvanceSection(request WorkerRequest, response *WorkerResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(advanceSection.name, request, response, done)
+}
+
+// GoLoadStrip gives the worker the strip of a halo game's board it keeps, in the background, like Client's Go
+func (w *Worker) GoLoadStrip(request StripRequest, response *StripResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(loadStrip.name, request, response, done)
+}
+
+// GoAdvanceStrip works out the next turn of the strip the worker keeps in the background, like Client's Go
+func (w *Worker) GoAdvanceStrip(request HaloRequest, response *HaloResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(advanceStrip.name, request, response, done)
+}
+
+// GoFetchStrip fetches the strip the worker keeps in the background, like Client's Go
+func (w *Worker) GoFetchStrip(request FetchStripRequest, response *FetchStripResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(fetchStrip.name, request, response, done)
+}
+
+// GoWriteSection writes a section the worker kept into an image in the background, like Client's Go
+func (w *Worker) GoWriteSection(request WriteSectionRequest, response *WriteSectionResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(writeSection.name, request, response, done)
+}
+
+// CloseWorker closes the worker
+func (w *Worker) CloseWorker(request CloseRequest, response *CloseResponse) error {
+	return w.Call(closeWorker.name, request, response)
+}
+
+// Version asks which version of gol the worker is running
+func (w *Worker) Version(request VersionRequest, response *VersionResponse) error {
+	return w.Call(workerVersion.name, request, response)
+}
+
+// GoVersion asks for the worker's version in the background, like Client's Go
+func (w *Worker) GoVersion(request VersionRequest, response *VersionResponse, done chan *rpc.Call) *rpc.Call {
+	return w.Go(workerVersion.name, request, response, done)
+}
+
+// MeasureLatency asks the worker how long it takes to connect to each of the given workers
+func (w *Worker) MeasureLatency(request LatencyRequest, response *LatencyResponse) error {
+	return w.Call(measureLatency.name, request, response)
+}
+
+// GoDiagnostics gets the worker's runtime state in the background, like Client's Go
+func (w *Worker) GoDiagnostics(request DiagnosticsRequest, response *Diagnostics, done chan *rpc.Call) *rpc.Call {
+	return w.Go(workerDiagnose.name, request, response, done)
+}
+
+// Negotiate agrees with the worker which of ours to use, recording them in the client's Capabilities
+func (w *Worker) Negotiate(version string, ours Capabilities) error {
+	return w.negotiate(workerHello.name, version, ours)
+}
@@ -0,0 +1,17 @@
+package stubs
+
+// WriteSectionRequest asks a worker to write a section of a game's board it kept, see WorkerRequest.KeepSection, into
+// a PGM image on storage it shares with the broker. The broker creates the image at its full size, so each worker
+// writes its rows in place and the broker need not be sent them again.
+type WriteSectionRequest struct {
+	Header
+	Turn         int    // the Turn of the WorkerRequest that advanced the section
+	StartY, EndY int    // the rows of the section
+	Path         string // of the image
+	Offset       int64  // where the image's first row starts, after its header
+}
+
+type WriteSectionResponse struct {
+	Header
+	Checksum *Checksum // of the rows written, for the broker to check against its own
+}
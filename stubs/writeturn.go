@@ -0,0 +1,19 @@
+package stubs
+
+import "time"
+
+// WriteTurnRequest asks for the turn to change the running game's board, shared between the controllers watching
+// it, or gives the turn up. A controller asking while another has the turn waits in line for it, and one giving it
+// up while waiting leaves the line.
+type WriteTurnRequest struct {
+	Header
+	Controller string // the name of the controller asking, chosen by it
+	Release    bool   // give the turn up rather than ask for it
+}
+
+type WriteTurnResponse struct {
+	Header
+	Holder  string    // the controller whose turn it is, empty if nobody's, when anyone can change the board
+	Expires time.Time // when the turn passes on if the holder hasn't changed the board or asked again
+	Waiting []string  // the controllers waiting for the turn, next first
+}
@@ -0,0 +1,311 @@
+package tiles
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+)
+
+// Key identifies a tile by its position in the grid of tiles, so tile (1, 0) starts at cell (Size, 0)
+type Key struct {
+	X, Y int
+}
+
+// Store holds a board as square tiles, keeping at most a fixed number of them in memory
+// Tiles where every cell is dead aren't stored at all, and the least recently used tiles are written
+// to files in the store's directory when too many are resident, so the board can be far bigger than memory.
+// A Store isn't safe for concurrent use.
+type Store struct {
+	Width, Height int
+	Size          int // width and height of each tile, apart from the last row and column which can be smaller
+	directory     string
+	maxResident   int
+	resident      map[Key]*list.Element // tiles in memory, ordered in recent from most recently used
+	recent        *list.List
+	onDisk        map[Key]bool // tiles which have been written out and not changed since
+}
+
+type tile struct {
+	key   Key
+	cells [][]uint8
+	dirty bool // changed since it was last written to disk
+}
+
+// NewStore creates an empty store for a board of the given size in a new directory inside parent
+func NewStore(parent string, width int, height int, size int, maxResident int) (*Store, error) {
+	if size <= 0 || maxResident <= 0 {
+		return nil, fmt.Errorf("tile size and resident tile count must be positive")
+	}
+	if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+		return nil, err
+	}
+	directory, err := ioutil.TempDir(parent, "tiles")
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		Width:       width,
+		Height:      height,
+		Size:        size,
+		directory:   directory,
+		maxResident: maxResident,
+		resident:    make(map[Key]*list.Element),
+		recent:      list.New(),
+		onDisk:      make(map[Key]bool),
+	}, nil
+}
+
+// Columns is the number of tiles across the board
+func (store *Store) Columns() int {
+	return (store.Width + store.Size - 1) / store.Size
+}
+
+// Rows is the number of tiles down the board
+func (store *Store) Rows() int {
+	return (store.Height + store.Size - 1) / store.Size
+}
+
+// Bounds gives the position of a tile's top left cell and its size
+func (store *Store) Bounds(key Key) (x int, y int, width int, height int) {
+	x, y = key.X*store.Size, key.Y*store.Size
+	width, height = store.Size, store.Size
+	if x+width > store.Width {
+		width = store.Width - x
+	}
+	if y+height > store.Height {
+		height = store.Height - y
+	}
+	return x, y, width, height
+}
+
+// Keys lists every tile that has at least one cell that isn't dead
+func (store *Store) Keys() []Key {
+	keys := make([]Key, 0, len(store.resident)+len(store.onDisk))
+	for key := range store.resident {
+		keys = append(keys, key)
+	}
+	for key := range store.onDisk {
+		if _, ok := store.resident[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Tile gives the cells of a tile, or nil if every cell is dead
+// The cells must not be changed; use Put to replace a tile.
+func (store *Store) Tile(key Key) ([][]uint8, error) {
+	if element, ok := store.resident[key]; ok {
+		store.recent.MoveToFront(element)
+		return element.Value.(*tile).cells, nil
+	}
+	if !store.onDisk[key] {
+		return nil, nil
+	}
+	_, _, width, height := store.Bounds(key)
+	data, err := ioutil.ReadFile(store.filename(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != width*height {
+		return nil, fmt.Errorf("tile %v is %d bytes on disk, expected %d", key, len(data), width*height)
+	}
+	cells := make([][]uint8, height)
+	for y := range cells {
+		cells[y] = data[y*width : (y+1)*width]
+	}
+	return cells, store.makeResident(&tile{key: key, cells: cells})
+}
+
+// Put replaces the cells of a tile, dropping it altogether if every cell is dead
+func (store *Store) Put(key Key, cells [][]uint8) error {
+	if empty(cells) {
+		if element, ok := store.resident[key]; ok {
+			store.recent.Remove(element)
+			delete(store.resident, key)
+		}
+		if store.onDisk[key] {
+			delete(store.onDisk, key)
+			return os.Remove(store.filename(key))
+		}
+		return nil
+	}
+	if element, ok := store.resident[key]; ok {
+		element.Value = &tile{key: key, cells: cells, dirty: true}
+		store.recent.MoveToFront(element)
+		return nil
+	}
+	return store.makeResident(&tile{key: key, cells: cells, dirty: true})
+}
+
+// makeResident adds a tile to memory, writing out the least recently used tiles if there are too many
+func (store *Store) makeResident(t *tile) error {
+	store.resident[t.key] = store.recent.PushFront(t)
+	for store.recent.Len() > store.maxResident {
+		oldest := store.recent.Back()
+		evicted := oldest.Value.(*tile)
+		if evicted.dirty {
+			if err := store.write(evicted); err != nil {
+				return err
+			}
+		}
+		store.recent.Remove(oldest)
+		delete(store.resident, evicted.key)
+	}
+	return nil
+}
+
+func (store *Store) write(t *tile) error {
+	file, err := os.Create(store.filename(t.key))
+	if err != nil {
+		return err
+	}
+	for _, row := range t.cells {
+		if _, err = file.Write(row); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	store.onDisk[t.key] = true
+	return file.Close()
+}
+
+func (store *Store) filename(key Key) string {
+	return filepath.Join(store.directory, "tile_"+strconv.Itoa(key.X)+"_"+strconv.Itoa(key.Y))
+}
+
+// Get retrieves the value of a single cell
+func (store *Store) Get(x int, y int) (uint8, error) {
+	key := Key{x / store.Size, y / store.Size}
+	cells, err := store.Tile(key)
+	if err != nil || cells == nil {
+		return 0, err
+	}
+	return cells[y-key.Y*store.Size][x-key.X*store.Size], nil
+}
+
+// Region copies a rectangle of cells, which may extend past the edge of the board, where the edge mode
+// decides which cells are used instead. This is how a tile is given the halo of cells around it.
+func (store *Store) Region(x int, y int, width int, height int, edge rules.Edge) ([][]uint8, error) {
+	region := make([][]uint8, height)
+	for j := range region {
+		region[j] = make([]uint8, width)
+		boardY, insideY := edge.Resolve(y+j, store.Height)
+		if !insideY {
+			continue
+		}
+		for i := 0; i < width; i++ {
+			boardX, insideX := edge.Resolve(x+i, store.Width)
+			if !insideX {
+				continue
+			}
+			value, err := store.Get(boardX, boardY)
+			if err != nil {
+				return nil, err
+			}
+			region[j][i] = value
+		}
+	}
+	return region, nil
+}
+
+// Load fills the store from a whole board
+func (store *Store) Load(cells [][]uint8) error {
+	for ty := 0; ty < store.Rows(); ty++ {
+		for tx := 0; tx < store.Columns(); tx++ {
+			key := Key{tx, ty}
+			x, y, width, height := store.Bounds(key)
+			tileCells := make([][]uint8, height)
+			for j := range tileCells {
+				tileCells[j] = append([]uint8(nil), cells[y+j][x:x+width]...)
+			}
+			if err := store.Put(key, tileCells); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Population counts the cells whose values are alive
+func (store *Store) Population(alive [256]bool) (int, error) {
+	count := 0
+	for _, key := range store.Keys() {
+		cells, err := store.Tile(key)
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range cells {
+			for _, value := range row {
+				if alive[value] {
+					count++
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// WritePGM writes the whole board as a PGM image, one row of tiles at a time
+func (store *Store) WritePGM(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = store.WritePGMTo(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WritePGMTo writes the whole board as a PGM image to a writer, such as one that encrypts it
+func (store *Store) WritePGMTo(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(writer, "P5\n%d %d\n255\n", store.Width, store.Height)
+	blank := make([]uint8, store.Size)
+	for ty := 0; ty < store.Rows(); ty++ {
+		_, _, _, height := store.Bounds(Key{0, ty})
+		for j := 0; j < height; j++ {
+			for tx := 0; tx < store.Columns(); tx++ {
+				key := Key{tx, ty}
+				_, _, width, _ := store.Bounds(key)
+				cells, err := store.Tile(key)
+				if err != nil {
+					return err
+				}
+				row := blank[:width]
+				if cells != nil {
+					row = cells[j]
+				}
+				if _, err = writer.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// Close deletes every tile written to disk
+func (store *Store) Close() error {
+	return os.RemoveAll(store.directory)
+}
+
+func empty(cells [][]uint8) bool {
+	for _, row := range cells {
+		for _, value := range row {
+			if value != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/config"
+)
+
+// runUp starts a broker and a number of workers on this machine as child processes, wired together on free ports
+// It waits until the broker exits, for example when the controller presses k, and stops everything on Ctrl+C.
+func runUp(args []string) {
+	flags := flag.NewFlagSet("up", flag.ExitOnError)
+	workers := flags.Int("workers", 4, "Number of workers to start.")
+	port := flags.String("port", config.DefaultBrokerPort, "Port for the broker to listen on. If the default is taken, any free port is used.")
+	_ = flags.Parse(args)
+	if *workers <= 0 {
+		log.Fatal("Need at least one worker")
+	}
+	executable, err := os.Executable()
+	handleError("Find executable error", err)
+	directory, err := ioutil.TempDir("", "gol-up")
+	handleError("Create directory error", err)
+	defer os.RemoveAll(directory)
+
+	var children []*exec.Cmd
+	var addressFiles []string
+	for i := 0; i < *workers; i++ {
+		addressFile := filepath.Join(directory, "worker"+strconv.Itoa(i))
+		children = append(children, startChild(executable, "worker", "-port", "0", "-addressFile", addressFile))
+		addressFiles = append(addressFiles, addressFile)
+	}
+	var addresses []string
+	for _, addressFile := range addressFiles {
+		address, err := waitForAddress(addressFile)
+		handleError("Worker didn't start", err)
+		addresses = append(addresses, address)
+	}
+	brokerArgs := []string{"broker", "-workers", strings.Join(addresses, ","), "-addressFile", filepath.Join(directory, "broker")}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "port" { // otherwise leave the broker to fall back to a free port if the default is taken
+			brokerArgs = append(brokerArgs, "-port", *port)
+		}
+	})
+	broker := startChild(executable, brokerArgs...)
+	children = append(children, broker)
+	brokerAddress, err := waitForAddress(filepath.Join(directory, "broker"))
+	handleError("Broker didn't start", err)
+	fmt.Println("Workers:", strings.Join(addresses, ","))
+	fmt.Println("Broker:", brokerAddress)
+	fmt.Println("Run './gol controller -broker " + brokerAddress + "' to start a game, or press Ctrl+C to stop")
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	brokerExited := make(chan struct{})
+	go func() {
+		_ = broker.Wait()
+		close(brokerExited)
+	}()
+	select {
+	case <-interrupts:
+	case <-brokerExited:
+	}
+	for _, child := range children { // workers closed by the broker have already gone, so errors are expected
+		_ = child.Process.Kill()
+	}
+}
+
+// startChild runs the gol binary with a subcommand, sharing our output
+func startChild(executable string, args ...string) *exec.Cmd {
+	child := exec.Command(executable, args...)
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	handleError("Start "+args[0]+" error", child.Start())
+	return child
+}
+
+// waitForAddress waits for a broker or worker to write the address it is listening on, giving up after a few seconds
+func waitForAddress(addressFile string) (string, error) {
+	var err error
+	for attempt := 0; attempt < 50; attempt++ {
+		var data []byte
+		if data, err = ioutil.ReadFile(addressFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			return strings.TrimSpace(string(data)), nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return "", fmt.Errorf("no address written to %s: %v", addressFile, err)
+}
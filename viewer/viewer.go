@@ -0,0 +1,101 @@
+//go:build js && wasm
+// +build js,wasm
+
+// The viewer shows the broker's running game in a browser, as it runs, for spectators without Go or SDL.
+// It follows the game by fetching /board.pgm from the broker's -health address, which serves it at /view/.
+// Build it with GOOS=js GOARCH=wasm go build -o viewer/viewer.wasm ./viewer, and copy wasm_exec.js beside it.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"syscall/js"
+	"time"
+)
+
+// retryInterval is how long the viewer waits to ask again after the broker fails to send a board
+const retryInterval = 2 * time.Second
+
+// board is a board the broker sent, with the game and turn it is from
+type board struct {
+	game          string
+	turn          int
+	width, height int
+	cells         []byte
+}
+
+func main() {
+	document := js.Global().Get("document")
+	canvas := document.Call("getElementById", "board")
+	status := document.Call("getElementById", "status")
+	context := canvas.Call("getContext", "2d")
+	game, turn := "", -1
+	for {
+		b, err := fetchBoard(game, turn)
+		if err != nil {
+			status.Set("textContent", "Waiting for a game: "+err.Error())
+			game, turn = "", -1
+			time.Sleep(retryInterval)
+			continue
+		}
+		if b.turn == turn && b.game == game { // nothing happened while the broker waited, such as the game being paused
+			continue
+		}
+		game, turn = b.game, b.turn
+		draw(canvas, context, b)
+		status.Set("textContent", fmt.Sprintf("Game %s, %dx%d, after turn %d", b.game, b.width, b.height, b.turn))
+	}
+}
+
+// fetchBoard asks the broker for the board once a turn after the one given has finished, of any game if game is empty
+func fetchBoard(game string, turn int) (*board, error) {
+	url := "/board.pgm?after=" + strconv.Itoa(turn)
+	if game != "" {
+		url += "&game=" + game
+	}
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("%s", message)
+	}
+	b := &board{game: response.Header.Get("X-Game")}
+	if b.turn, err = strconv.Atoi(response.Header.Get("X-Completed-Turns")); err != nil {
+		return nil, fmt.Errorf("the board came without its turn")
+	}
+	reader := bufio.NewReader(response.Body)
+	var magic string
+	var maxValue int
+	if _, err = fmt.Fscan(reader, &magic, &b.width, &b.height, &maxValue); err != nil || magic != "P5" {
+		return nil, fmt.Errorf("the board isn't a PGM image")
+	}
+	_, _ = reader.ReadByte() // the whitespace ending the header
+	b.cells = make([]byte, b.width*b.height)
+	if _, err = io.ReadFull(reader, b.cells); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// draw puts a board on the canvas, a pixel for each cell in its grey level, resizing the canvas to fit it
+func draw(canvas js.Value, context js.Value, b *board) {
+	if canvas.Get("width").Int() != b.width || canvas.Get("height").Int() != b.height {
+		canvas.Set("width", b.width)
+		canvas.Set("height", b.height)
+	}
+	pixels := make([]byte, 4*len(b.cells))
+	for i, cell := range b.cells {
+		pixels[4*i], pixels[4*i+1], pixels[4*i+2], pixels[4*i+3] = cell, cell, cell, 255
+	}
+	data := js.Global().Get("Uint8ClampedArray").New(len(pixels))
+	js.CopyBytesToJS(data, pixels)
+	image := js.Global().Get("ImageData").New(data, b.width, b.height)
+	context.Call("putImageData", image, 0, 0)
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"uk.ac.bris.cs/gameoflife/crash"
+)
+
+// dumpOnPanic saves the section being advanced if the goroutine is panicking, then carries on panicking
+// Sections are small and sent again each turn, but the dump shows the cells that caused the bug.
+func dumpOnPanic(game *Game, startY int, endY int) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := debug.Stack()
+	dump := crash.Dump{Role: "worker", Turn: game.turn, Details: []string{
+		"rule: " + game.rule.String(),
+		fmt.Sprintf("rows: %d to %d", startY, endY),
+		fmt.Sprintf("origin: %d,%d", game.originX, game.originY),
+	}}
+	if game.current != nil {
+		dump.Board = game.current.cells
+		dump.Details = append(dump.Details, "edge: "+game.current.edge.String())
+	}
+	if path, err := crash.Write(dump, recovered, stack); err != nil {
+		log.Println("Crash dump error:", err)
+	} else {
+		log.Println("Crash dump written to", path)
+	}
+	panic(recovered)
+}
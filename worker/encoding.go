@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// keptBoard is the latest board a game sent the worker, for the next to be sent as a Delta from
+type keptBoard struct {
+	sum   *stubs.Checksum
+	cells [][]uint8
+}
+
+// boards is the board kept for each game whose broker may send deltas, for as many games as sections are kept
+var boards = struct {
+	sync.Mutex
+	games  []string // oldest first
+	boards map[string]keptBoard
+}{boards: make(map[string]keptBoard)}
+
+// keepBoard keeps the board a request sent, replacing the game's last one
+func keepBoard(gameID string, board keptBoard) {
+	boards.Lock()
+	defer boards.Unlock()
+	if _, known := boards.boards[gameID]; !known {
+		boards.games = append(boards.games, gameID)
+		if len(boards.games) > keptGames {
+			delete(boards.boards, boards.games[0])
+			boards.games = boards.games[1:]
+		}
+	}
+	boards.boards[gameID] = board
+}
+
+// decodeBoard unpacks the board a request sent in an encoding, failing with Stale if it is a Delta from a board the
+// worker hasn't kept, so the broker sends it whole
+func decodeBoard(request stubs.WorkerRequest) ([][]uint8, error) {
+	var base [][]uint8
+	if request.Board.Encoding == stubs.Delta {
+		boards.Lock()
+		kept, found := boards.boards[request.GameID]
+		boards.Unlock()
+		if !found || !kept.sum.Same(request.Board.Base) {
+			return nil, stubs.Errorf(stubs.Stale, "worker hasn't kept the board turn %d of game %s is a delta from", request.Turn, request.GameID)
+		}
+		base = kept.cells
+	}
+	return request.Board.Decode(base)
+}
+
+// encodeSection packs an advanced section in whichever of the request's encodings should get it back to the broker
+// fastest, a Delta being from the section as it was before, giving nil if it is best sent as it is
+func encodeSection(request stubs.WorkerRequest, section [][]uint8, was [][]uint8, changed int) *stubs.EncodedBoard {
+	nonDead := 0
+	for _, row := range section {
+		for _, cell := range row {
+			if cell != 0 {
+				nonDead++
+			}
+		}
+	}
+	cells := len(section) * request.Width
+	encoding := stubs.ChooseEncoding(request.Encodings, cells, nonDead, changed, request.BytesPerSecond)
+	if encoding == stubs.Dense {
+		return nil
+	}
+	encoded, ok := stubs.Encode(section, encoding, was)
+	if !ok || len(encoded.Data) >= cells { // it can't be packed that way, or packing it didn't make it smaller
+		return nil
+	}
+	return encoded
+}
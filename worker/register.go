@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"log"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// registerInterval is how often a worker announces itself to its broker again
+const registerInterval = 5 * time.Second
+
+// Register announces the worker, reachable at address, to the broker at brokerAddress, so the broker splits its games
+// between it and its other workers. It carries on announcing it every registerInterval until the worker closes, so
+// a broker started after the worker, restarted, or that forgot the worker while it couldn't reach it, has it again.
+func Register(brokerAddress string, address string) {
+	registered, failing := false, false
+	for {
+		err := register(brokerAddress, address)
+		if err != nil && !failing { // logged once it starts failing, rather than every time
+			log.Printf("Register with broker %s error: %v", brokerAddress, err)
+		} else if err == nil && !registered {
+			log.Println("Registered with broker", brokerAddress, "as", address)
+		}
+		registered, failing = err == nil, err != nil
+		select {
+		case <-closed:
+			return
+		case <-time.After(registerInterval):
+		}
+	}
+}
+
+// register announces the worker to the broker once
+func register(brokerAddress string, address string) error {
+	broker, err := stubs.DialBroker(brokerAddress)
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+	request := stubs.RegisterWorkerRequest{Header: stubs.NewHeader(""), Address: address}
+	return broker.RegisterWorker(request, new(stubs.RegisterWorkerResponse))
+}
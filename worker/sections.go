@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"os"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// keptGames is how many games a worker keeps sections for at once, forgetting the oldest game's beyond it
+const keptGames = 4
+
+// keptSection is a section the worker advanced, kept until the game's next turn for WriteSection
+type keptSection struct {
+	turn, startY, endY int
+	cells              [][]uint8
+}
+
+// kept is the sections of the latest turn of each game that asked for them to be kept
+var kept = struct {
+	sync.Mutex
+	games    []string // oldest first
+	sections map[string][]keptSection
+}{sections: make(map[string][]keptSection)}
+
+// keepSection keeps a section the worker has advanced, dropping the game's sections of earlier turns
+func keepSection(gameID string, section keptSection) {
+	kept.Lock()
+	defer kept.Unlock()
+	sections, known := kept.sections[gameID]
+	if !known {
+		kept.games = append(kept.games, gameID)
+		if len(kept.games) > keptGames {
+			delete(kept.sections, kept.games[0])
+			kept.games = kept.games[1:]
+		}
+	}
+	if len(sections) > 0 && sections[0].turn != section.turn {
+		sections = nil
+	}
+	kept.sections[gameID] = append(sections, section)
+}
+
+// keptSectionFor finds a section the worker kept, reporting false if it has been dropped or was never kept
+func keptSectionFor(request stubs.WriteSectionRequest) (keptSection, bool) {
+	kept.Lock()
+	defer kept.Unlock()
+	for _, section := range kept.sections[request.GameID] {
+		if section.turn == request.Turn && section.startY == request.StartY && section.endY == request.EndY {
+			return section, true
+		}
+	}
+	return keptSection{}, false
+}
+
+// WriteSection writes a section the worker kept into its rows of an image the broker has made on shared storage
+func (s *SecretWorkerOperation) WriteSection(request stubs.WriteSectionRequest, response *stubs.WriteSectionResponse) (err error) {
+	response.Header = request.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	section, found := keptSectionFor(request)
+	if !found {
+		return stubs.Errorf(stubs.InvalidParams, "rows %d-%d of turn %d of game %s weren't kept", request.StartY, request.EndY, request.Turn, request.GameID)
+	}
+	file, err := os.OpenFile(request.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return stubs.WithCode(stubs.Internal, err)
+	}
+	var rows []byte
+	for _, row := range section.cells {
+		rows = append(rows, row...)
+	}
+	offset := request.Offset
+	if len(section.cells) > 0 {
+		offset += int64(request.StartY * len(section.cells[0]))
+	}
+	if _, err = file.WriteAt(rows, offset); err != nil {
+		_ = file.Close()
+		return stubs.WithCode(stubs.Internal, err)
+	}
+	if err = file.Close(); err != nil {
+		return stubs.WithCode(stubs.Internal, err)
+	}
+	response.Checksum = stubs.Sum(section.cells)
+	return nil
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"uk.ac.bris.cs/gameoflife/shm"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// openShared maps the board a broker on this host put in shared memory, and the board to write the advanced section to
+// Both are mapped for each section, so a worker keeps nothing mapped between turns.
+func openShared(request stubs.WorkerRequest) (*shm.Board, *shm.Board, error) {
+	board, err := shm.Open(request.SharedBoard, request.Width, request.Height, false)
+	if err != nil {
+		return nil, nil, stubs.Errorf(stubs.InvalidParams, "can't map the shared board: %v", err)
+	}
+	advanced, err := shm.Open(request.SharedAdvanced, request.Width, request.Height, true)
+	if err != nil {
+		_ = board.Close()
+		return nil, nil, stubs.Errorf(stubs.InvalidParams, "can't map the shared board to advance into: %v", err)
+	}
+	return board, advanced, nil
+}
+
+// copyRows copies a section out of shared memory, to keep once it has been unmapped
+func copyRows(rows [][]uint8) [][]uint8 {
+	copied := make([][]uint8, len(rows))
+	for y, row := range rows {
+		copied[y] = append([]uint8(nil), row...)
+	}
+	return copied
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/rules"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// strip is the rows of a halo game's board that a worker keeps between turns
+// Its boards have the rule's radius of rows above and below the strip's own, filled in from each turn's request, so
+// the strip is advanced like a section of a board that is only as tall as the strip and its halos.
+type strip struct {
+	sync.Mutex
+	game *Game // whose boards are swapped each turn
+	rows int   // the strip's own rows, which start after the halo
+	halo int
+	turn int // the turn the strip has got to
+}
+
+// strips is the strip each halo game gave the worker, for as many games as sections are kept
+var strips = struct {
+	sync.Mutex
+	games  []string // oldest first
+	strips map[string]*strip
+}{strips: make(map[string]*strip)}
+
+// stripFor finds the strip the worker keeps for a game, at the turn given, locking it
+func stripFor(gameID string, turn int) (*strip, error) {
+	strips.Lock()
+	kept := strips.strips[gameID]
+	strips.Unlock()
+	if kept == nil {
+		return nil, stubs.Errorf(stubs.Stale, "worker has no strip of game %s", gameID)
+	}
+	kept.Lock()
+	if kept.turn != turn {
+		kept.Unlock()
+		return nil, stubs.Errorf(stubs.Stale, "worker's strip of game %s is at turn %d, not %d", gameID, kept.turn, turn)
+	}
+	return kept, nil
+}
+
+// LoadStrip keeps a strip of a halo game's board, to be advanced a turn at a time with AdvanceStrip
+func (s *SecretWorkerOperation) LoadStrip(request stubs.StripRequest, response *stubs.StripResponse) (err error) {
+	response.Header = request.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	if err = request.Checksum.Verify(request.Rows); err != nil {
+		return err
+	}
+	rule, err := rules.Parse(request.Rule)
+	if err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	edge, err := rules.ParseEdge(request.Edge)
+	if err != nil {
+		return stubs.WithCode(stubs.InvalidParams, err)
+	}
+	rows, halo := request.EndY-request.StartY, rule.Radius
+	if rows != len(request.Rows) || rows < halo {
+		return stubs.Errorf(stubs.InvalidParams, "strip of rows %d-%d has %d rows, and needs at least %d", request.StartY, request.EndY, len(request.Rows), halo)
+	}
+	cells := make([][]uint8, 0, rows+2*halo)
+	for y := 0; y < halo; y++ {
+		cells = append(cells, make([]uint8, request.Width))
+	}
+	cells = append(cells, request.Rows...)
+	for y := 0; y < halo; y++ {
+		cells = append(cells, make([]uint8, request.Width))
+	}
+	game := createGame(request.Width, len(cells), cells, nil, rule, edge)
+	game.noise = rules.Noise{Seed: request.Seed, Birth: request.BirthProbability, Death: request.DeathProbability}
+	game.originX = request.OriginX
+	game.originY = request.OriginY - request.StartY + halo // keeps the random births and deaths where they'd be on the whole board
+	kept := &strip{game: game, rows: rows, halo: halo, turn: request.Turn}
+	strips.Lock()
+	defer strips.Unlock()
+	if _, known := strips.strips[request.GameID]; !known {
+		strips.games = append(strips.games, request.GameID)
+		if len(strips.games) > keptGames {
+			delete(strips.strips, strips.games[0])
+			strips.games = strips.games[1:]
+		}
+	}
+	strips.strips[request.GameID] = kept
+	return nil
+}
+
+// AdvanceStrip advances the strip the worker keeps for a halo game by a turn, sending back its first and last rows
+// for the strips either side of it
+func (s *SecretWorkerOperation) AdvanceStrip(request stubs.HaloRequest, response *stubs.HaloResponse) (err error) {
+	response.Header = request.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	if request.Expired() {
+		return stubs.Errorf(stubs.DeadlineExceeded, "strip of turn %d arrived after its deadline", request.Turn)
+	}
+	kept, err := stripFor(request.GameID, request.Turn)
+	if err != nil {
+		return err
+	}
+	defer kept.Unlock()
+	game, halo, end := kept.game, kept.halo, kept.halo+kept.rows
+	if len(request.Above) != halo || len(request.Below) != halo {
+		return stubs.Errorf(stubs.InvalidParams, "strip of game %s needs %d rows either side, not %d and %d", request.GameID, halo, len(request.Above), len(request.Below))
+	}
+	for y := 0; y < halo; y++ {
+		copy(game.current.cells[y], request.Above[y])
+		copy(game.current.cells[end+y], request.Below[y])
+	}
+	game.turn, game.deadline = request.Turn, request.Deadline
+	defer dumpOnPanic(game, halo, end)
+	start := time.Now()
+	if !game.advanceRows(0, game.current.width, halo, end) {
+		return stubs.Errorf(stubs.Draining, "worker closed during turn %d", request.Turn)
+	}
+	response.Compute = time.Since(start)
+	select {
+	case <-closed: // the sub-workers stopped partway, so the strip wasn't all advanced
+		return stubs.Errorf(stubs.Draining, "worker closed during turn %d", request.Turn)
+	default:
+	}
+	if request.Expired() { // the sub-workers may have given up partway, leaving the strip as it was
+		return stubs.Errorf(stubs.DeadlineExceeded, "turn %d passed its deadline", request.Turn)
+	}
+	response.Births, response.Deaths = game.countChanges(0, game.current.width, halo, end)
+	game.current, game.advanced = game.advanced, game.current
+	kept.turn++
+	response.Top = copyRows(game.current.cells[halo : 2*halo])
+	response.Bottom = copyRows(game.current.cells[end-halo : end])
+	return nil
+}
+
+// FetchStrip sends back the rows of the strip the worker keeps for a halo game, for the broker to have the whole board
+func (s *SecretWorkerOperation) FetchStrip(request stubs.FetchStripRequest, response *stubs.FetchStripResponse) (err error) {
+	response.Header = request.Header
+	defer func() {
+		err = response.Fail(err)
+	}()
+	kept, err := stripFor(request.GameID, request.Turn)
+	if err != nil {
+		return err
+	}
+	defer kept.Unlock()
+	response.Rows = copyRows(kept.game.current.cells[kept.halo : kept.halo+kept.rows])
+	response.Checksum = stubs.Sum(response.Rows)
+	return nil
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestAdvanceStripRetried checks a strip is only advanced once for each turn, so an AdvanceStrip sent again, such as
+// after its response was lost, is refused as Stale rather than advancing the strip a second time.
+func TestAdvanceStripRetried(t *testing.T) {
+	rows := [][]uint8{make([]uint8, 8), {0, 255, 255, 255, 0, 0, 0, 0}, make([]uint8, 8)} // a blinker on its side
+	header := stubs.Header{GameID: t.Name()}
+	load := stubs.StripRequest{Header: header, StartY: 0, EndY: 3, Rows: rows, Checksum: stubs.Sum(rows), Width: 8, Height: 3, Edge: "dead"}
+	var loaded stubs.StripResponse
+	_ = new(SecretWorkerOperation).LoadStrip(load, &loaded)
+	if err := loaded.Err(); err != nil { // the worker's methods give their errors back in the response
+		t.Fatal(err)
+	}
+	halo := [][]uint8{make([]uint8, 8)}
+	advance := stubs.HaloRequest{Header: header, Turn: 0, Above: halo, Below: halo}
+	var advanced stubs.HaloResponse
+	_ = new(SecretWorkerOperation).AdvanceStrip(advance, &advanced)
+	if err := advanced.Err(); err != nil {
+		t.Fatal(err)
+	}
+	upright := [][]uint8{{0, 0, 255, 0, 0, 0, 0, 0}, {0, 0, 255, 0, 0, 0, 0, 0}, {0, 0, 255, 0, 0, 0, 0, 0}}
+	if !reflect.DeepEqual(advanced.Top, upright[:1]) || !reflect.DeepEqual(advanced.Bottom, upright[2:]) {
+		t.Fatalf("got top %v and bottom %v, want %v and %v", advanced.Top, advanced.Bottom, upright[:1], upright[2:])
+	}
+	var retried stubs.HaloResponse
+	_ = new(SecretWorkerOperation).AdvanceStrip(advance, &retried)
+	if err := retried.Err(); stubs.Code(err) != stubs.Stale {
+		t.Fatalf("advancing turn 0 again gave %v, want %s", err, stubs.Stale)
+	}
+	var fetched stubs.FetchStripResponse
+	_ = new(SecretWorkerOperation).FetchStrip(stubs.FetchStripRequest{Header: header, Turn: 1}, &fetched)
+	if err := fetched.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fetched.Rows, upright) {
+		t.Fatalf("got strip %v after turn 1, want %v", fetched.Rows, upright)
+	}
+	var behind stubs.FetchStripResponse
+	_ = new(SecretWorkerOperation).FetchStrip(stubs.FetchStripRequest{Header: header, Turn: 0}, &behind)
+	if err := behind.Err(); stubs.Code(err) != stubs.Stale {
+		t.Fatalf("fetching turn 0 after turn 1 gave %v, want %s", err, stubs.Stale)
+	}
+}
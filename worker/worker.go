@@ -1,12 +1,16 @@
-package main
+package worker
 
 import (
+	"errors"
 	"log"
 	"net"
 	"net/rpc"
 	"os"
 	"sync"
 	"time"
+	"uk.ac.bris.cs/gameoflife/config"
+	"uk.ac.bris.cs/gameoflife/mux"
+	"uk.ac.bris.cs/gameoflife/rules"
 	"uk.ac.bris.cs/gameoflife/stubs"
 )
 
@@ -14,11 +18,18 @@ type Board struct{
 	cells [][]uint8
 	width int
 	height int
+	edge rules.Edge
+	rule rules.Rule
 }
 
 type Game struct {
 	current *Board
 	advanced *Board
+	rule rules.Rule
+	noise rules.Noise
+	turn int
+	originX, originY int
+	deadline time.Time // when the broker stops waiting for the section, zero for no deadline
 }
 
 func handleError(message string, err error) {
@@ -42,13 +53,18 @@ func createBoard(width int, height int) *Board {
 	}
 }
 
-// Makes a Game given the width, height and the cells to initialise it with
-func createGame(width int, height int, startingBoard [][]uint8) *Game {
-	current := &Board{cells: startingBoard,width: width,height: height}
-	advanced := createBoard(width, height)
+// Makes a Game given the width, height and the cells to initialise it with, and to advance them into, made if nil
+func createGame(width int, height int, startingBoard [][]uint8, advancedBoard [][]uint8, rule rules.Rule, edge rules.Edge) *Game {
+	current := &Board{cells: startingBoard,width: width,height: height,edge: edge,rule: rule}
+	advanced := &Board{cells: advancedBoard,width: width,height: height}
+	if advancedBoard == nil {
+		advanced = createBoard(width, height)
+	}
+	advanced.edge, advanced.rule = edge, rule // so its cells can be checked once advanced
 	return &Game{
 		current:        current,
 		advanced:       advanced,
+		rule:           rule,
 	}
 }
 
@@ -62,41 +78,48 @@ func (board *Board) Set(x int, y int, val uint8) {
 	board.cells[y][x] = val
 }
 
-// Alive checks if a cell is alive, accounting for wrap around if necessary
+// Alive checks if a cell is alive, accounting for the board's edge behaviour if necessary
 func (board *Board) Alive(x int, y int, wrap bool) bool {
 	if wrap {
-		x = (x + board.width) % board.width // need to add the w and h for these as Go modulus doesn't like negatives
-		y = (y + board.height) % board.height
+		var insideX, insideY bool
+		x, insideX = board.edge.Resolve(x, board.width)
+		y, insideY = board.edge.Resolve(y, board.height)
+		if !insideX || !insideY { // beyond a dead edge
+			return false
+		}
+	}
+	value := board.Get(x, y)
+	if value == 255 || board.rule.Colours == 0 { // only coloured rules have more than one alive value
+		return value == 255
 	}
-	return board.Get(x, y) == 255
+	return board.rule.Alive(value)
 }
 
 // AdvanceCell advances the specified cell by one turn
 func (game *Game) AdvanceCell(x int, y int) {
-	aliveNeighbours := game.current.Neighbours(x, y)
-	var newCellValue uint8
-	if game.current.Alive(x,y, false) { // if the cell is alive
-		if aliveNeighbours < 2 || aliveNeighbours > 3 {
-			newCellValue = 0 // dies
-		} else {
-			newCellValue = 255 // stays the same
-		}
-	} else { // if the cell is dead
-		if aliveNeighbours == 3 {
-			newCellValue = 255 // becomes alive
+	if game.rule.Colours > 0 || game.noise.Enabled() { // work with states rather than values
+		state := game.rule.State(game.current.Get(x, y))
+		var next int
+		if game.rule.Colours > 0 { // newborn cells need to know the colours of their parents
+			next = game.rule.NextColour(state, game.current.ColourNeighbours(x, y, game.rule))
 		} else {
-			newCellValue = 0 // stays the same
+			next = game.rule.NextState(state, game.current.Neighbours(x, y, game.rule))
 		}
+		next = game.noise.Apply(game.rule, next, game.turn, x-game.originX, y-game.originY)
+		game.advanced.Set(x, y, game.rule.Value(next))
+		return
 	}
+	aliveNeighbours := game.current.Neighbours(x, y, game.rule)
+	newCellValue := game.rule.NextValue(game.current.Get(x, y), aliveNeighbours) // birth, survival or decay under the game's rule
 	game.advanced.Set(x, y, newCellValue)
 }
 
-// Neighbours checks all cells within 1 cell, then checks if each of these are alive to get the returned neighbour count
-func (board *Board) Neighbours(x int, y int) int {
+// Neighbours checks all cells within the rule's radius, then checks if each of these are alive to get the returned neighbour count
+func (board *Board) Neighbours(x int, y int, rule rules.Rule) int {
 	aliveNeighbours := 0
-	for i := -1; i <= 1; i++ {
-		for j := -1; j <= 1; j++ {
-			if i == 0 && j == 0 { // ensures we aren't counting the cell itself
+	for i := -rule.Radius; i <= rule.Radius; i++ {
+		for j := -rule.Radius; j <= rule.Radius; j++ {
+			if !rule.InNeighbourhood(j, i) { // skips the cell itself unless the rule counts it, and cells outside the shape
 				continue
 			}
 			if board.Alive(x+j, y+i, true) { // increase count if this cell is alive
@@ -107,6 +130,22 @@ func (board *Board) Neighbours(x int, y int) int {
 	return aliveNeighbours
 }
 
+// ColourNeighbours counts the alive neighbours of each colour for coloured rules, indexed by colour
+func (board *Board) ColourNeighbours(x int, y int, rule rules.Rule) []int {
+	colours := make([]int, rule.Colours+1)
+	for i := -rule.Radius; i <= rule.Radius; i++ {
+		for j := -rule.Radius; j <= rule.Radius; j++ {
+			if !rule.InNeighbourhood(j, i) || !board.Alive(x+j, y+i, true) {
+				continue
+			}
+			neighbourX, _ := board.edge.Resolve(x+j, board.width) // Alive has already ruled out dead edges
+			neighbourY, _ := board.edge.Resolve(y+i, board.height)
+			colours[rule.State(board.Get(neighbourX, neighbourY))]++
+		}
+	}
+	return colours
+}
+
 // makeMiniBoard returns only the part of the board we have updated
 func (game *Game) makeMiniBoard(startY int, endY int) [][]uint8 {
 	var currentMiniBoard [][]uint8
@@ -116,8 +155,31 @@ func (game *Game) makeMiniBoard(startY int, endY int) [][]uint8 {
 	return currentMiniBoard
 }
 
+// countChanges counts the cells in the section that came alive and died as it was advanced
+func (game *Game) countChanges(startX int, endX int, startY int, endY int) (births int, deaths int) {
+	for j:=startY; j<endY; j++ {
+		for i:=startX; i<endX; i++ {
+			was, is := game.current.Alive(i, j, false), game.advanced.Alive(i, j, false)
+			if is && !was {
+				births++
+			} else if was && !is {
+				deaths++
+			}
+		}
+	}
+	return
+}
+
 func (game *Game) AdvanceMiniSection(startX int, endX int, startY int, endY int) {
 	for j:=startY; j<endY; j++ { // advance every cell
+		if !game.deadline.IsZero() && time.Now().After(game.deadline) { // nobody is waiting for the rest
+			return
+		}
+		select {
+		case <-closed: // the broker is closing, and has stopped waiting for the section
+			return
+		default:
+		}
 		for i:=startX; i<endX; i++ {
 			game.AdvanceCell(i, j)
 		}
@@ -126,23 +188,21 @@ func (game *Game) AdvanceMiniSection(startX int, endX int, startY int, endY int)
 
 func (game *Game) SpawnMiniAdvanceWorker(wg *sync.WaitGroup, startX int, endX int, startY int, endY int) {
 	defer wg.Done()
+	defer dumpOnPanic(game, startY, endY)
 	game.AdvanceMiniSection(startX, endX, startY, endY)
 }
 
-// AdvanceSection advances the section given to our workers by one turn and returns it
-func (s *SecretWorkerOperation) AdvanceSection(request stubs.WorkerRequest, response *stubs.WorkerResponse) (err error) {
-	startX := 0
-	endX := request.Width
-	startY := request.StartY
-	endY := request.EndY
-	game := createGame(endX, request.Height, request.CurrentBoard)
+// advanceRows advances rows startY to endY of the game's board, split between sub-workers, giving false if the broker
+// told the worker to close before they were all started
+func (game *Game) advanceRows(startX int, endX int, startY int, endY int) bool {
 	workers := 2
 	var wg sync.WaitGroup
 	miniWorkerHeight := (endY - startY) / workers // number of rows given to each worker
 	for i:=0; i<workers; i++ {
 		select {
 		case <-closed: // exit if the broker has told us to close
-			return
+			wg.Wait() // for the sub-workers already started, which may be using shared memory that is about to be unmapped
+			return false
 		default:
 		}
 		miniStartY := startY + (i * miniWorkerHeight)
@@ -156,12 +216,132 @@ func (s *SecretWorkerOperation) AdvanceSection(request stubs.WorkerRequest, resp
 		go game.SpawnMiniAdvanceWorker(&wg, startX, endX, miniStartY, miniEndY)
 	}
 	wg.Wait() // wait for all sub-workers to be done
-	response.AdvancedMiniBoard = game.makeMiniBoard(startY, endY) // return only what we updated
+	return true
+}
+
+// AdvanceSection advances the section given to our workers by one turn and returns it
+func (s *SecretWorkerOperation) AdvanceSection(request stubs.WorkerRequest, response *stubs.WorkerResponse) (err error) {
+	response.Header = request.Header
+	if request.Expired() {
+		return response.Fail(stubs.Errorf(stubs.DeadlineExceeded, "section of turn %d arrived after its deadline", request.Turn))
+	}
+	board, advancedBoard := request.CurrentBoard, [][]uint8(nil)
+	if request.SharedBoard != "" { // the broker is on this host, and put the board in shared memory
+		shared, advanced, err := openShared(request)
+		if err != nil {
+			return response.Fail(err)
+		}
+		defer shared.Close()
+		defer advanced.Close()
+		board, advancedBoard = shared.Rows, advanced.Rows
+	} else if request.Board != nil { // the broker packed the board in an encoding
+		if board, err = decodeBoard(request); err != nil {
+			return response.Fail(err)
+		}
+	}
+	if err = request.Checksum.Verify(board); err != nil {
+		return response.Fail(err)
+	}
+	if request.Encodings.Has(stubs.Delta) && request.SharedBoard == "" { // so the next board can be sent as a delta from this one
+		keepBoard(request.GameID, keptBoard{sum: request.Checksum, cells: board})
+	}
+	startX := 0
+	endX := request.Width
+	startY := request.StartY
+	endY := request.EndY
+	rule, err := rules.Parse(request.Rule)
+	if err != nil {
+		return response.Fail(stubs.WithCode(stubs.InvalidParams, err))
+	}
+	edge, err := rules.ParseEdge(request.Edge)
+	if err != nil {
+		return response.Fail(stubs.WithCode(stubs.InvalidParams, err))
+	}
+	game := createGame(endX, request.Height, board, advancedBoard, rule, edge)
+	game.noise = rules.Noise{Seed: request.Seed, Birth: request.BirthProbability, Death: request.DeathProbability}
+	game.turn = request.Turn
+	game.originX, game.originY = request.OriginX, request.OriginY
+	game.deadline = request.Deadline
+	defer dumpOnPanic(game, startY, endY)
+	start := time.Now()
+	if !game.advanceRows(startX, endX, startY, endY) {
+		return
+	}
+	response.Compute = time.Since(start)
+	select {
+	case <-closed: // the sub-workers stopped partway, so there's no section to give back
+		return response.Fail(stubs.Errorf(stubs.Draining, "worker closed during turn %d", request.Turn))
+	default:
+	}
+	if request.Expired() { // the sub-workers may have given up partway
+		return response.Fail(stubs.Errorf(stubs.DeadlineExceeded, "turn %d passed its deadline", request.Turn))
+	}
+	section := game.makeMiniBoard(startY, endY) // return only what we updated
+	response.Births, response.Deaths = game.countChanges(startX, endX, startY, endY)
+	response.Checksum = stubs.Sum(section)
+	if advancedBoard != nil { // the section is already where the broker reads it from
+		response.Shared = true
+	} else if response.Section = encodeSection(request, section, board[startY:endY], response.Births+response.Deaths); response.Section == nil {
+		response.AdvancedMiniBoard = section
+	}
+	if request.KeepSection {
+		if response.Shared { // the shared rows are unmapped once the section has been advanced
+			section = copyRows(section)
+		}
+		keepSection(request.GameID, keptSection{turn: request.Turn, startY: startY, endY: endY, cells: section})
+	}
 	return
 }
 
-func (s *SecretWorkerOperation) CloseWorker(_ stubs.Request, _ *stubs.Response) (err error) {
-	close(closed)
+// Version tells the caller which version of gol the worker is running
+func (s *SecretWorkerOperation) Version(request stubs.VersionRequest, response *stubs.VersionResponse) (err error) {
+	response.Header = request.Header
+	response.Version = config.Version
+	return
+}
+
+// Hello agrees with the broker which capabilities to use, giving back those both of them support
+func (s *SecretWorkerOperation) Hello(request stubs.HelloRequest, response *stubs.HelloResponse) (err error) {
+	response.Header = request.Header
+	response.Version = config.Version
+	response.Capabilities = stubs.WorkerCapabilities.Common(request.Capabilities)
+	return
+}
+
+// Diagnostics describes the worker's runtime state along with the last lines of its log
+func (s *SecretWorkerOperation) Diagnostics(request stubs.DiagnosticsRequest, response *stubs.Diagnostics) (err error) {
+	*response = config.Diagnose(request.Lines)
+	response.Header = request.Header
+	return
+}
+
+// MeasureLatency times how long it takes to connect to each of the given workers, taking the fastest of a few tries
+// so one slow handshake doesn't make a nearby worker look far away
+func (s *SecretWorkerOperation) MeasureLatency(request stubs.LatencyRequest, response *stubs.LatencyResponse) (err error) {
+	response.Header = request.Header
+	response.Latencies = make([]time.Duration, len(request.Addresses))
+	for i, address := range request.Addresses {
+		response.Latencies[i] = stubs.Unreachable
+		for try := 0; try < 3; try++ {
+			start := time.Now()
+			connection, err := stubs.DialConn(address, 2*time.Second)
+			if err != nil {
+				break
+			}
+			if latency := time.Since(start); latency < response.Latencies[i] {
+				response.Latencies[i] = latency
+			}
+			_ = connection.Close()
+		}
+	}
+	return
+}
+
+func (s *SecretWorkerOperation) CloseWorker(request stubs.CloseRequest, response *stubs.CloseResponse) (err error) {
+	response.Header = request.Header
+	closeOnce.Do(func() {
+		close(closed)
+	})
 	return
 }
 
@@ -174,16 +354,31 @@ func checkClosed() {
 }
 
 var closed = make(chan struct{})
-func main(){
-	err := rpc.Register(&SecretWorkerOperation{})
+
+// closeOnce closes closed, so a second CloseWorker, such as one sent again after a lost connection, does no harm
+var closeOnce sync.Once
+
+// Ready reports whether the worker can take sections, which it can until the broker tells it to close
+func Ready() error {
+	select {
+	case <-closed:
+		return errors.New("closing")
+	default:
+		return nil
+	}
+}
+
+// Run starts the worker accepting connections on the listener
+func Run(listener net.Listener) {
+	err := stubs.CheckWorker(&SecretWorkerOperation{})
+	handleError("Worker RPC error", err)
+	err = rpc.Register(&SecretWorkerOperation{})
 	handleError("Register error", err)
-	listener, err := net.Listen("tcp",":8031")
 	go checkClosed()
-	handleError("Listener error", err)
 
 	defer func(listener net.Listener) {
 		err := listener.Close()
 		handleError("Close listener error", err)
 	}(listener)
-	rpc.Accept(listener)
+	mux.Serve(listener, rpc.ServeConn) // the broker multiplexes its connections, other callers don't
 }